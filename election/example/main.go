@@ -17,10 +17,12 @@ limitations under the License.
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	election "k8s.io/contrib/election/lib"
@@ -43,8 +45,11 @@ var (
 	ttl       = flags.Duration("ttl", 10*time.Second, "The TTL for this election")
 	inCluster = flags.Bool("use-cluster-credentials", false, "Should this request use cluster credentials?")
 	addr      = flags.String("http", "", "If non-empty, stand up a simple webserver that reports the leader state")
+	webhooks  = flags.StringSlice("webhook", []string{}, "URLs receiving a POST of the leader state, as served by /leader, when the leader changes")
+	timeout   = flags.Duration("webhook-timeout", 5*time.Second, "The timeout of webhook requests")
 
 	leader = &LeaderData{}
+	state  = &leaderState{}
 )
 
 func makeClient() (*client.Client, error) {
@@ -69,8 +74,45 @@ type LeaderData struct {
 	Name string `json:"name"`
 }
 
+// LeaderState is the leader state of this participant
+type LeaderState struct {
+	// Leader is the id of the current leader, empty while it is unknown
+	Leader string `json:"leader"`
+	// ID is the id of this participant, and Elected whether it is the leader
+	ID      string `json:"id"`
+	Elected bool   `json:"elected"`
+	// Since is when the leader last changed
+	Since time.Time `json:"since"`
+}
+
+// leaderState guards the state shared by the election and the webserver
+type leaderState struct {
+	sync.Mutex
+	LeaderState
+}
+
+// set records a new leader, returning the state and whether it changed
+func (s *leaderState) set(name string) (LeaderState, bool) {
+	s.Lock()
+	defer s.Unlock()
+	if name == s.Leader && !s.Since.IsZero() {
+		return s.LeaderState, false
+	}
+	leader.Name = name
+	s.LeaderState = LeaderState{Leader: name, ID: *id, Elected: name == *id, Since: time.Now()}
+	return s.LeaderState, true
+}
+
+func (s *leaderState) get() LeaderState {
+	s.Lock()
+	defer s.Unlock()
+	return s.LeaderState
+}
+
 func webHandler(res http.ResponseWriter, req *http.Request) {
+	state.Lock()
 	data, err := json.Marshal(leader)
+	state.Unlock()
 	if err != nil {
 		res.WriteHeader(http.StatusInternalServerError)
 		res.Write([]byte(err.Error()))
@@ -80,6 +122,47 @@ func webHandler(res http.ResponseWriter, req *http.Request) {
 	res.Write(data)
 }
 
+func leaderHandler(res http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(res, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := json.Marshal(state.get())
+	if err != nil {
+		res.WriteHeader(http.StatusInternalServerError)
+		res.Write([]byte(err.Error()))
+		return
+	}
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(data)
+}
+
+// notify posts the latest state to the webhooks on each signal of changed.
+// Changes made while the webhooks are posted are coalesced, so slow webhooks
+// skip intermediate states but always get the newest one.
+func notify(changed <-chan struct{}) {
+	c := &http.Client{Timeout: *timeout}
+	for range changed {
+		data, err := json.Marshal(state.get())
+		if err != nil {
+			glog.Errorf("failed to encode the leader state: %v", err)
+			continue
+		}
+		for _, url := range *webhooks {
+			res, err := c.Post(url, "application/json", bytes.NewReader(data))
+			if err != nil {
+				glog.Errorf("webhook %v failed: %v", url, err)
+				continue
+			}
+			res.Body.Close()
+			if res.StatusCode/100 != 2 {
+				glog.Errorf("webhook %v returned %v", url, res.Status)
+			}
+		}
+	}
+}
+
 func validateFlags() {
 	if len(*id) == 0 {
 		glog.Fatal("--id cannot be empty")
@@ -98,9 +181,21 @@ func main() {
 		glog.Fatalf("error connecting to the client: %v", err)
 	}
 
+	// a pending signal already covers any later change, notify reads the
+	// state when it gets to it
+	changes := make(chan struct{}, 1)
+	if len(*webhooks) > 0 {
+		go notify(changes)
+	}
 	fn := func(str string) {
-		leader.Name = str
-		fmt.Printf("%s is the leader\n", leader.Name)
+		_, changed := state.set(str)
+		fmt.Printf("%s is the leader\n", str)
+		if changed && len(*webhooks) > 0 {
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
 	}
 
 	e, err := election.NewElection(*name, *id, *namespace, *ttl, fn, kubeClient)
@@ -111,6 +206,7 @@ func main() {
 
 	if len(*addr) > 0 {
 		http.HandleFunc("/", webHandler)
+		http.HandleFunc("/leader", leaderHandler)
 		http.ListenAndServe(*addr, nil)
 	} else {
 		select {}
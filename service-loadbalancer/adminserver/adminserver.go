@@ -0,0 +1,154 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package adminserver serves the operational endpoints of the service
+// loadbalancer on a listener of their own, authenticating every request
+// with a bearer token or a client certificate.
+package adminserver
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Config configures the authentication and routes of a Server.
+type Config struct {
+	// Token is the bearer token of clients, none is accepted when empty.
+	Token string
+	// ClientCAs verifies the certificates of clients over tls, which are
+	// authorized without a token.
+	ClientCAs *x509.CertPool
+	// Enabled holds the names of the routes served, all of them when nil.
+	Enabled map[string]bool
+}
+
+// Server is the mux of the admin endpoints.
+type Server struct {
+	config Config
+	mux    *http.ServeMux
+	routes map[string][]string
+}
+
+// New returns a Server without routes.
+func New(config Config) *Server {
+	return &Server{
+		config: config,
+		mux:    http.NewServeMux(),
+		routes: map[string][]string{},
+	}
+}
+
+// Handle mounts h at path as part of the route name, and under path/ too
+// for paths without a trailing slash. It reports false without mounting h
+// when the route isn't enabled.
+func (s *Server) Handle(name, path string, h http.Handler) bool {
+	if s.config.Enabled != nil && !s.config.Enabled[name] {
+		return false
+	}
+	s.mux.Handle(path, h)
+	if !strings.HasSuffix(path, "/") {
+		s.mux.Handle(path+"/", h)
+	}
+	s.routes[name] = append(s.routes[name], path)
+	return true
+}
+
+// HandlePprof mounts the runtime profiles under /debug/pprof/, at the paths
+// of net/http/pprof, as the route pprof. They are locked until armed through a PUT of
+// /debug/pprof/arm.
+func (s *Server) HandlePprof() bool {
+	return s.Handle("pprof", pprofPath, newPprofHandler())
+}
+
+// Routes returns the names of the mounted routes, sorted.
+func (s *Server) Routes() []string {
+	names := []string{}
+	for name := range s.routes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// authorized reports whether r carries the token as a bearer token, or
+// comes over tls with a client certificate verified by the client CAs.
+func (s *Server) authorized(r *http.Request) bool {
+	if s.config.ClientCAs != nil && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return true
+	}
+	auth := r.Header.Get("Authorization")
+	return s.config.Token != "" && strings.HasPrefix(auth, "Bearer ") &&
+		subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(s.config.Token)) == 1
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe serves the routes on addr, over tls when certFile and
+// keyFile are set. Client certificates are only requested over tls, and
+// only verified against the client CAs.
+func (s *Server) ListenAndServe(addr, certFile, keyFile string) error {
+	srv := &http.Server{Addr: addr, Handler: s}
+	if certFile == "" {
+		if s.config.ClientCAs != nil {
+			return fmt.Errorf("client certificates require a tls certificate")
+		}
+		return srv.ListenAndServe()
+	}
+	srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	if s.config.ClientCAs != nil {
+		srv.TLSConfig.ClientCAs = s.config.ClientCAs
+		srv.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return srv.ListenAndServeTLS(certFile, keyFile)
+}
+
+// LoadClientCAs reads the PEM encoded certificates in path.
+func LoadClientCAs(path string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates in %v", path)
+	}
+	return pool, nil
+}
+
+// ParseEnabled parses a comma separated list of route names, eg:
+// healthz,metrics,pprof.
+func ParseEnabled(val string) map[string]bool {
+	enabled := map[string]bool{}
+	for _, name := range strings.Split(val, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			enabled[name] = true
+		}
+	}
+	return enabled
+}
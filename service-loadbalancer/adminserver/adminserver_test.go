@@ -0,0 +1,89 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adminserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	s := New(Config{
+		Token:     "secret",
+		ClientCAs: x509.NewCertPool(),
+		Enabled:   ParseEnabled("healthz, config,pprof"),
+	})
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(r.URL.Path)) })
+	if !s.Handle("healthz", "/healthz", ok) || !s.Handle("config", "/admin/config/", ok) {
+		t.Fatalf("Expected the enabled routes to be mounted")
+	}
+	if s.Handle("metrics", "/metrics", ok) {
+		t.Errorf("Expected the metrics route to be disabled")
+	}
+	s.HandlePprof()
+	if routes := s.Routes(); !reflect.DeepEqual(routes, []string{"config", "healthz", "pprof"}) {
+		t.Errorf("Unexpected routes %v", routes)
+	}
+
+	serve := func(path, token string, state *tls.ConnectionState) int {
+		r, _ := http.NewRequest("GET", "http://localhost:8082"+path, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		r.TLS = state
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w.Code
+	}
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+	for _, c := range []struct {
+		path  string
+		token string
+		state *tls.ConnectionState
+		code  int
+	}{
+		{"/healthz", "", nil, http.StatusUnauthorized},
+		{"/healthz", "wrong", nil, http.StatusUnauthorized},
+		{"/healthz", "secret", nil, http.StatusOK},
+		{"/healthz", "", &tls.ConnectionState{}, http.StatusUnauthorized},
+		{"/healthz", "", verified, http.StatusOK},
+		{"/admin/config/diff", "secret", nil, http.StatusOK},
+		{"/metrics", "secret", nil, http.StatusNotFound},
+		{"/metrics", "", nil, http.StatusUnauthorized},
+		{"/debug/pprof/cmdline", "secret", nil, http.StatusForbidden},
+	} {
+		if code := serve(c.path, c.token, c.state); code != c.code {
+			t.Errorf("Expected %v for %v with token %q, got %v", c.code, c.path, c.token, code)
+		}
+	}
+}
+
+func TestServerWithoutToken(t *testing.T) {
+	s := New(Config{})
+	s.Handle("healthz", "/healthz", http.NotFoundHandler())
+	r, _ := http.NewRequest("GET", "http://localhost:8082/healthz", nil)
+	r.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected an empty token to be refused, got %v", w.Code)
+	}
+}
@@ -0,0 +1,251 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adminserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// pprofPath is the prefix of the profiles of net/http/pprof.
+	pprofPath = "/debug/pprof/"
+	// armPath arms the profiles.
+	armPath = pprofPath + "arm"
+
+	// maxArmWindow bounds the time the profiles stay armed.
+	maxArmWindow = time.Hour
+
+	// defaultCPUProfile and defaultTrace are the durations of the cpu
+	// profiles and traces without a seconds parameter.
+	defaultCPUProfile = 30 * time.Second
+	defaultTrace      = time.Second
+)
+
+// armRequest is the body of PUT /debug/pprof/arm, eg:
+// {"requests": 2, "window": "10m"} serves the next 2 requests of profiles
+// within 10 minutes. Zero requests lock the profiles again.
+type armRequest struct {
+	Requests int    `json:"requests"`
+	Window   string `json:"window"`
+}
+
+// armState is the reply of /debug/pprof/arm.
+type armState struct {
+	Armed     bool      `json:"armed"`
+	Requests  int       `json:"requests"`
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+}
+
+// armedHandler serves h for a number of requests within a window after it
+// is armed, and refuses them otherwise, so profiles are only exposed while
+// somebody is capturing them.
+type armedHandler struct {
+	h   http.Handler
+	now func() time.Time
+
+	mu       sync.Mutex
+	requests int
+	until    time.Time
+}
+
+// newPprofHandler returns the profiles, locked until armed. They are served
+// by the handlers below rather than net/http/pprof, whose import registers
+// them on http.DefaultServeMux, unauthenticated.
+func newPprofHandler() *armedHandler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(pprofPath, pprofIndex)
+	mux.HandleFunc(pprofPath+"cmdline", pprofCmdline)
+	mux.HandleFunc(pprofPath+"profile", pprofCPU)
+	mux.HandleFunc(pprofPath+"symbol", pprofSymbol)
+	mux.HandleFunc(pprofPath+"trace", pprofTrace)
+	return &armedHandler{h: mux, now: time.Now}
+}
+
+// pprofIndex lists the runtime profiles with their counts, and serves the
+// profile named by the rest of the path, eg: /debug/pprof/heap, in the
+// format of its debug parameter.
+func pprofIndex(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, pprofPath)
+	if name == "" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, p := range pprof.Profiles() {
+			fmt.Fprintf(w, "%v %v\n", p.Name(), p.Count())
+		}
+		return
+	}
+	p := pprof.Lookup(name)
+	if p == nil {
+		http.NotFound(w, r)
+		return
+	}
+	debug, _ := strconv.Atoi(r.FormValue("debug"))
+	if debug == 0 {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	p.WriteTo(w, debug)
+}
+
+// pprofCmdline serves the command line, its arguments separated by NUL
+// bytes.
+func pprofCmdline(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, strings.Join(os.Args, "\x00"))
+}
+
+// seconds returns the duration of the seconds parameter of r, def without.
+func seconds(r *http.Request, def time.Duration) time.Duration {
+	if sec, err := strconv.ParseInt(r.FormValue("seconds"), 10, 64); err == nil && sec > 0 {
+		return time.Duration(sec) * time.Second
+	}
+	return def
+}
+
+// pprofCPU serves a cpu profile of the seconds parameter.
+func pprofCPU(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if err := pprof.StartCPUProfile(w); err != nil {
+		http.Error(w, fmt.Sprintf("unable to profile: %v", err), http.StatusInternalServerError)
+		return
+	}
+	time.Sleep(seconds(r, defaultCPUProfile))
+	pprof.StopCPUProfile()
+}
+
+// pprofTrace serves an execution trace of the seconds parameter.
+func pprofTrace(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if err := trace.Start(w); err != nil {
+		http.Error(w, fmt.Sprintf("unable to trace: %v", err), http.StatusInternalServerError)
+		return
+	}
+	time.Sleep(seconds(r, defaultTrace))
+	trace.Stop()
+}
+
+// pprofSymbol maps the program counters of the body of a POST, or of the
+// query, separated by +, to the names of their functions, for pprof.
+func pprofSymbol(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, "num_symbols: 1\n")
+	var in *bufio.Reader
+	if r.Method == "POST" {
+		in = bufio.NewReader(r.Body)
+	} else {
+		in = bufio.NewReader(strings.NewReader(r.URL.RawQuery))
+	}
+	for {
+		word, err := in.ReadSlice('+')
+		if err == nil {
+			word = word[:len(word)-1]
+		}
+		if pc, perr := strconv.ParseUint(string(word), 0, 64); perr == nil && pc != 0 {
+			if f := runtime.FuncForPC(uintptr(pc)); f != nil {
+				fmt.Fprintf(w, "%#x %s\n", pc, f.Name())
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintf(w, "reading request: %v\n", err)
+			}
+			return
+		}
+	}
+}
+
+// take consumes one of the armed requests, reporting false if there are
+// none left or the window is over.
+func (a *armedHandler) take() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.requests == 0 || !a.now().Before(a.until) {
+		a.requests = 0
+		return false
+	}
+	a.requests--
+	return true
+}
+
+func (a *armedHandler) state() armState {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.requests == 0 || !a.now().Before(a.until) {
+		return armState{}
+	}
+	return armState{Armed: true, Requests: a.requests, ExpiresAt: a.until}
+}
+
+func (a *armedHandler) arm(req armRequest) error {
+	if req.Requests < 0 {
+		return fmt.Errorf("invalid number of requests %v", req.Requests)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if req.Requests == 0 {
+		a.requests = 0
+		return nil
+	}
+	window, err := time.ParseDuration(req.Window)
+	if err != nil || window <= 0 || window > maxArmWindow {
+		return fmt.Errorf("invalid window %q, expected a duration up to %v", req.Window, maxArmWindow)
+	}
+	a.requests = req.Requests
+	a.until = a.now().Add(window)
+	return nil
+}
+
+func (a *armedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != armPath {
+		if !a.take() {
+			http.Error(w, "profiling is not armed", http.StatusForbidden)
+			return
+		}
+		a.h.ServeHTTP(w, r)
+		return
+	}
+	switch r.Method {
+	case "GET":
+	case "PUT":
+		var req armRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid body: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := a.arm(req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.state())
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adminserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArmedPprof(t *testing.T) {
+	now := time.Unix(1000, 0)
+	a := newPprofHandler()
+	a.now = func() time.Time { return now }
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest(method, "http://localhost:8082"+path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := serve("GET", "/debug/pprof/cmdline", ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected profiles to be locked by default, got %v", w.Code)
+	}
+	for _, body := range []string{"", `{"requests": 2}`, `{"requests": 2, "window": "2h"}`, `{"requests": -1}`} {
+		if w := serve("PUT", "/debug/pprof/arm", body); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected %q to be refused, got %v", body, w.Code)
+		}
+	}
+	w := serve("PUT", "/debug/pprof/arm", `{"requests": 2, "window": "10m"}`)
+	var state armState
+	if err := json.Unmarshal(w.Body.Bytes(), &state); err != nil || !state.Armed || state.Requests != 2 {
+		t.Fatalf("Unexpected state %v after arming: %v", w.Body.String(), err)
+	}
+	for i := 0; i < 2; i++ {
+		if w := serve("GET", "/debug/pprof/cmdline", ""); w.Code != http.StatusOK {
+			t.Errorf("Expected armed request %v to be served, got %v", i, w.Code)
+		}
+	}
+	if w := serve("GET", "/debug/pprof/cmdline", ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected profiles to lock after the armed requests, got %v", w.Code)
+	}
+
+	serve("PUT", "/debug/pprof/arm", `{"requests": 5, "window": "1m"}`)
+	now = now.Add(time.Minute)
+	if w := serve("GET", "/debug/pprof/cmdline", ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected profiles to lock after the window, got %v", w.Code)
+	}
+	if w := serve("GET", "/debug/pprof/arm", ""); !strings.Contains(w.Body.String(), `"armed":false`) {
+		t.Errorf("Expected the profiles to be reported locked, got %v", w.Body.String())
+	}
+
+	serve("PUT", "/debug/pprof/arm", `{"requests": 5, "window": "1m"}`)
+	serve("PUT", "/debug/pprof/arm", `{"requests": 0}`)
+	if w := serve("GET", "/debug/pprof/cmdline", ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected zero requests to lock the profiles, got %v", w.Code)
+	}
+}
+
+func TestPprofHandlers(t *testing.T) {
+	a := newPprofHandler()
+	serve := func(path string) *httptest.ResponseRecorder {
+		a.arm(armRequest{Requests: 1, Window: "1m"})
+		r, _ := http.NewRequest("GET", "http://localhost:8082"+path, nil)
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, r)
+		return w
+	}
+	if w := serve("/debug/pprof/"); !strings.Contains(w.Body.String(), "goroutine ") {
+		t.Errorf("Expected the index to list the goroutine profile, got %q", w.Body.String())
+	}
+	if w := serve("/debug/pprof/goroutine?debug=1"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "TestPprofHandlers") {
+		t.Errorf("Expected the goroutines, got %v: %q", w.Code, w.Body.String())
+	}
+	if w := serve("/debug/pprof/unknown"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected unknown profiles not to be found, got %v", w.Code)
+	}
+	if w := serve("/debug/pprof/cmdline"); w.Body.String() != strings.Join(os.Args, "\x00") {
+		t.Errorf("Unexpected command line %q", w.Body.String())
+	}
+}
+
+func TestPprofNotOnDefaultServeMux(t *testing.T) {
+	r, _ := http.NewRequest("GET", "http://localhost:8081/debug/pprof/cmdline", nil)
+	w := httptest.NewRecorder()
+	http.DefaultServeMux.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected the profiles not to be served by the default mux, got %v", w.Code)
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package backoff computes exponential backoffs with jitter and retries
+// operations with them, so the keys or replicas failing together don't
+// retry in lockstep.
+package backoff
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Backoff describes the delays between the attempts of an operation.
+type Backoff struct {
+	// Initial is the delay after the first attempt, and Max caps delays.
+	Initial time.Duration
+	Max     time.Duration
+	// Factor multiplies the delay after each attempt, 2 if 0.
+	Factor float64
+	// Jitter randomizes delays by up to this fraction of them, eg: 0.2
+	// waits between 80% and 120% of a delay.
+	Jitter float64
+	// MaxElapsed stops Retry once this long passed since its first
+	// attempt, never if 0.
+	MaxElapsed time.Duration
+}
+
+// random is replaced by tests.
+var random = rand.Float64
+
+// Delay returns the delay after attempt, counted from 0.
+func (b Backoff) Delay(attempt int) time.Duration {
+	factor := b.Factor
+	if factor == 0 {
+		factor = 2
+	}
+	delay := float64(b.Initial)
+	for i := 0; i < attempt && (b.Max == 0 || delay < float64(b.Max)); i++ {
+		delay *= factor
+	}
+	if b.Max > 0 && delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+	if b.Jitter > 0 {
+		delay += delay * b.Jitter * (2*random() - 1)
+	}
+	return time.Duration(delay)
+}
+
+// permanentError stops Retry.
+type permanentError struct {
+	err error
+}
+
+func (p permanentError) Error() string {
+	return p.err.Error()
+}
+
+// Permanent wraps err so Retry returns it without retrying.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// Retry runs op until it succeeds, returns a Permanent error, ctx is done
+// or MaxElapsed passed, waiting Delay between attempts. It returns the
+// last error of op, unwrapped if it was permanent.
+func Retry(ctx context.Context, b Backoff, op func() error) error {
+	start := time.Now()
+	for attempt := 0; ; attempt++ {
+		err := op()
+		if err == nil {
+			return nil
+		}
+		if p, ok := err.(permanentError); ok {
+			return p.err
+		}
+		delay := b.Delay(attempt)
+		if b.MaxElapsed > 0 && time.Since(start)+delay > b.MaxElapsed {
+			return err
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
+
+// Keyed tracks the attempts of keys retried independently, eg: the keys of
+// a workqueue.
+type Keyed struct {
+	Backoff
+
+	mu       sync.Mutex
+	attempts map[string]int
+}
+
+// NewKeyed returns a Keyed without attempts.
+func NewKeyed(b Backoff) *Keyed {
+	return &Keyed{Backoff: b, attempts: map[string]int{}}
+}
+
+// Next records a failed attempt of key, returning the delay until the next.
+func (k *Keyed) Next(key string) time.Duration {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	attempt := k.attempts[key]
+	k.attempts[key]++
+	return k.Delay(attempt)
+}
+
+// Reset forgets the attempts of key, after it succeeded.
+func (k *Keyed) Reset(key string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.attempts, key)
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backoff
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestDelay(t *testing.T) {
+	defer func(r func() float64) { random = r }(random)
+	random = func() float64 { return 0.5 }
+
+	b := Backoff{Initial: time.Second, Max: 10 * time.Second}
+	for attempt, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		if delay := b.Delay(attempt); delay != expected {
+			t.Errorf("Expected %v after attempt %v, got %v", expected, attempt, delay)
+		}
+	}
+	if delay := b.Delay(1000); delay != 10*time.Second {
+		t.Errorf("Expected the delays to stay capped, got %v", delay)
+	}
+
+	b.Jitter = 0.2
+	for r, expected := range map[float64]time.Duration{0: 3200 * time.Millisecond, 0.5: 4 * time.Second, 1: 4800 * time.Millisecond} {
+		random = func() float64 { return r }
+		if delay := b.Delay(2); delay != expected {
+			t.Errorf("Expected %v with a random %v, got %v", expected, r, delay)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	b := Backoff{Initial: time.Millisecond, Max: 2 * time.Millisecond}
+	attempts := 0
+	err := Retry(context.Background(), b, func() error {
+		if attempts++; attempts < 3 {
+			return fmt.Errorf("attempt %v", attempts)
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Errorf("Expected success after 3 attempts, got %v after %v", err, attempts)
+	}
+
+	attempts = 0
+	err = Retry(context.Background(), b, func() error {
+		attempts++
+		return Permanent(fmt.Errorf("invalid"))
+	})
+	if err == nil || err.Error() != "invalid" || attempts != 1 {
+		t.Errorf("Expected a permanent error not to be retried, got %v after %v", err, attempts)
+	}
+
+	b.MaxElapsed = 20 * time.Millisecond
+	start := time.Now()
+	err = Retry(context.Background(), b, func() error { return fmt.Errorf("down") })
+	if err == nil || time.Since(start) > time.Second {
+		t.Errorf("Expected to give up after %v, got %v after %v", b.MaxElapsed, err, time.Since(start))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	attempts = 0
+	err = Retry(ctx, Backoff{Initial: time.Hour}, func() error {
+		attempts++
+		return fmt.Errorf("down")
+	})
+	if err == nil || attempts != 1 {
+		t.Errorf("Expected a done context to stop retries, got %v after %v", err, attempts)
+	}
+}
+
+func TestKeyed(t *testing.T) {
+	k := NewKeyed(Backoff{Initial: time.Second, Max: time.Minute})
+	if d := k.Next("a"); d != time.Second {
+		t.Errorf("Unexpected first delay %v", d)
+	}
+	if d := k.Next("a"); d != 2*time.Second {
+		t.Errorf("Unexpected second delay %v", d)
+	}
+	if d := k.Next("b"); d != time.Second {
+		t.Errorf("Expected keys to back off independently, got %v", d)
+	}
+	k.Reset("a")
+	if d := k.Next("a"); d != time.Second {
+		t.Errorf("Expected a reset key to start over, got %v", d)
+	}
+}
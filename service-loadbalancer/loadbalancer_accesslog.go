@@ -0,0 +1,95 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/ziutek/syslog"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	// syslogSocket is the unix socket of the syslog server of the
+	// controller, forwarding haproxy logs to stdout.
+	syslogSocket = "/var/run/haproxy.log.socket"
+
+	// accessLogFacility is the syslog facility of access logs, the syslog
+	// server writes their messages as they are.
+	accessLogFacility = syslog.Local1
+
+	// defaultAccessLogFormat is a haproxy log-format rendering a json
+	// object per request.
+	defaultAccessLogFormat = `{"time":"%t","client":"%ci:%cp","frontend":"%ft","backend":"%b","server":"%s",` +
+		`"method":"%HM","uri":%{+Q}HU,"status":%ST,"bytes":%B,"request_ms":%Tq,"connect_ms":%Tc,` +
+		`"response_ms":%Tr,"total_ms":%Tt,"termination":"%ts"}`
+
+	// defaultRequestIDFormat is a haproxy log-format of request ids, unique
+	// across loadbalancers and their reloads: the hex encoded client and
+	// frontend addresses, the time, the request counter and the pid.
+	defaultRequestIDFormat = `%{+X}o %ci:%cp_%fi:%fp_%Ts_%rt:%pid`
+
+	// requestIDHeader carries the request id to the backends.
+	requestIDHeader = "X-Request-ID"
+)
+
+// requestIDLogFormat returns the access log-format for requests with an id.
+// The id is added to the default format, custom formats log it with %ID.
+func requestIDLogFormat(format string) string {
+	if format != defaultAccessLogFormat {
+		return format
+	}
+	return strings.TrimSuffix(format, "}") + `,"request_id":"%ID"}`
+}
+
+// getAccessLog reports whether the requests of an http service are logged,
+// the default of the loadbalancer unless the service overrides it. Services
+// never log without a target.
+func (lbc *loadBalancerController) getAccessLog(s *api.Service) bool {
+	if lbc.cfg.accessLogTarget == "" {
+		return false
+	}
+	val, ok := serviceAnnotations(s.ObjectMeta.Annotations).getAccessLog()
+	if !ok {
+		return lbc.cfg.accessLog
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		logWarningf("Ignoring invalid %v %q of service %v", lbAccessLog, val, s.Name)
+		return lbc.cfg.accessLog
+	}
+	return b
+}
+
+// accessLogged reports whether any of the services logs its requests.
+func accessLogged(svcGroups ...[]service) bool {
+	for _, group := range svcGroups {
+		for _, svc := range group {
+			if svc.AccessLog {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// quoteLogFormat quotes a log-format for the haproxy config, where it would
+// otherwise end at the first space.
+func quoteLogFormat(format string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(format) + `"`
+}
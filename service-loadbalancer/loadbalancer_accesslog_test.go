@@ -0,0 +1,115 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestAccessLog(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	obj, _, _ := flb.svcLister.Store.GetByKey("default/svc-2")
+	obj.(*api.Service).ObjectMeta.Annotations = map[string]string{lbAccessLog: "true"}
+	httpSvc, _, _ := flb.getServices()
+	if accessLogged(httpSvc) {
+		t.Fatalf("Expected no access logs without a target, got %+v", httpSvc)
+	}
+
+	flb.cfg.accessLogTarget = "10.0.0.5:514"
+	flb.cfg.accessLogFormat = `{"status":%ST}`
+	httpSvc, _, _ = flb.getServices()
+	for _, svc := range httpSvc {
+		if svc.AccessLog != strings.HasPrefix(svc.Name, "svc-2") {
+			t.Fatalf("Expected only svc-2 to log its requests, got %+v", svc)
+		}
+	}
+	config, err := flb.backend.render(map[string][]service{"http": httpSvc})
+	if err != nil {
+		t.Fatalf("Unexpected error rendering the config: %v", err)
+	}
+	for _, line := range []string{
+		"*:80\n    no log\n",
+		"log 10.0.0.5:514 local1 info\n",
+		`log-format "{\"status\":%ST}"` + "\n",
+		"http-request set-log-level silent\n",
+	} {
+		if !strings.Contains(string(config), line) {
+			t.Fatalf("Expected %q in the config:\n%s", line, config)
+		}
+	}
+	silent := 0
+	for _, svc := range httpSvc {
+		if !svc.AccessLog {
+			silent++
+		}
+	}
+	if strings.Count(string(config), "set-log-level silent") != silent {
+		t.Fatalf("Expected only the backends of svc-1 to be silent:\n%s", config)
+	}
+
+	flb.cfg.accessLog = true
+	obj.(*api.Service).ObjectMeta.Annotations = map[string]string{lbAccessLog: "false"}
+	httpSvc, _, _ = flb.getServices()
+	for _, svc := range httpSvc {
+		if svc.AccessLog != strings.HasPrefix(svc.Name, "svc-1") {
+			t.Fatalf("Expected svc-2 to opt out of access logs, got %+v", svc)
+		}
+	}
+}
+
+func TestQuoteLogFormat(t *testing.T) {
+	if quoted := quoteLogFormat(`{"uri":%{+Q}HU} \x`); quoted != `"{\"uri\":%{+Q}HU} \\x"` {
+		t.Fatalf("Unexpected quoted log format %v", quoted)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	httpSvc, _, _ := flb.getServices()
+	config, err := flb.backend.render(map[string][]service{"http": httpSvc})
+	if err != nil {
+		t.Fatalf("Unexpected error rendering the config: %v", err)
+	}
+	if strings.Contains(string(config), "unique-id") {
+		t.Fatalf("Expected no request ids by default:\n%s", config)
+	}
+
+	flb.cfg.requestIDFormat = defaultRequestIDFormat
+	config, err = flb.backend.render(map[string][]service{"http": httpSvc})
+	if err != nil {
+		t.Fatalf("Unexpected error rendering the config: %v", err)
+	}
+	for _, line := range []string{
+		"http-request del-header X-Request-ID\n",
+		`unique-id-format "%{+X}o %ci:%cp_%fi:%fp_%Ts_%rt:%pid"` + "\n",
+		"unique-id-header X-Request-ID\n",
+	} {
+		if !strings.Contains(string(config), line) {
+			t.Fatalf("Expected %q in the config:\n%s", line, config)
+		}
+	}
+
+	if format := requestIDLogFormat(defaultAccessLogFormat); !strings.HasSuffix(format, `"termination":"%ts","request_id":"%ID"}`) {
+		t.Errorf("Expected the request id in the default access log format, got %v", format)
+	}
+	if format := requestIDLogFormat(`%ST`); format != `%ST` {
+		t.Errorf("Expected custom access log formats to be kept, got %v", format)
+	}
+}
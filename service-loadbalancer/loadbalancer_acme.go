@@ -0,0 +1,451 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/errors"
+	"k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/util"
+	"k8s.io/kubernetes/pkg/util/wait"
+)
+
+const (
+	// acmeChallengePath is the path prefix of http-01 challenges, routed by
+	// haproxy to the controller.
+	acmeChallengePath = "/.well-known/acme-challenge/"
+
+	// acmeAccountKey is the key of the account key in the account secret.
+	acmeAccountKey = "account.key"
+
+	// acmeRenewBefore is how long before they expire certificates are
+	// renewed.
+	acmeRenewBefore = 30 * 24 * time.Hour
+
+	// acmeChallengesSuffix names the ConfigMap sharing the pending
+	// challenges with the other replicas after the account secret.
+	acmeChallengesSuffix = "-challenges"
+
+	// acmeChallengeSaveAttempts bounds the updates of the challenges
+	// ConfigMap conflicting with another replica.
+	acmeChallengeSaveAttempts = 5
+)
+
+// acmeResponder serves the key authorizations of pending http-01 challenges.
+type acmeResponder struct {
+	lock   sync.Mutex
+	tokens map[string]string
+
+	// shared returns the key authorization of a token published by the
+	// leader, for the challenges landing on other replicas.
+	shared func(token string) (string, bool)
+}
+
+func newACMEResponder() *acmeResponder {
+	return &acmeResponder{tokens: map[string]string{}}
+}
+
+// respond serves keyAuthorization for token until the returned func is
+// called.
+func (r *acmeResponder) respond(token, keyAuthorization string) func() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.tokens[token] = keyAuthorization
+	return func() {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		delete(r.tokens, token)
+	}
+}
+
+func (r *acmeResponder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	token := strings.TrimPrefix(req.URL.Path, acmeChallengePath)
+	r.lock.Lock()
+	keyAuthorization, ok := r.tokens[token]
+	r.lock.Unlock()
+	if !ok && r.shared != nil {
+		keyAuthorization, ok = r.shared(token)
+	}
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(keyAuthorization))
+}
+
+// acmeRequest is a certificate for host wanted in the tls secret key,
+// namespace/name.
+type acmeRequest struct {
+	host   string
+	secret string
+}
+
+// acmeManager obtains and renews the certificates of the services with the
+// serviceloadbalancer/lb.acme annotation, and stores them in their
+// sslSecret, from where they are loaded like any other certificate.
+type acmeManager struct {
+	directoryURL  string
+	email         string
+	accountSecret string
+	responder     *acmeResponder
+
+	// getSecret returns the secret key, or nil if it doesn't exist, and
+	// saveSecret creates or updates a secret.
+	getSecret  func(key string) (*api.Secret, error)
+	saveSecret func(secret *api.Secret) error
+	// saveChallenge publishes the key authorization of token to the
+	// other replicas, or withdraws it if empty.
+	saveChallenge func(token, keyAuthorization string) error
+
+	// client is created with the account key on the first sync.
+	client *acmeClient
+	// failures delays new attempts for the hosts that failed.
+	failures     *util.Backoff
+	pollInterval time.Duration
+	now          func() time.Time
+}
+
+func newACMEManager(directoryURL, email, accountSecret string, client *unversioned.Client) *acmeManager {
+	namespace, name, _ := splitKey(accountSecret)
+	challenges := &acmeChallenges{client: client.ConfigMaps(namespace), namespace: namespace, name: name + acmeChallengesSuffix}
+	return &acmeManager{
+		directoryURL:  directoryURL,
+		email:         email,
+		accountSecret: accountSecret,
+		responder:     newACMEResponder(),
+		getSecret: func(key string) (*api.Secret, error) {
+			namespace, name, err := splitKey(key)
+			if err != nil {
+				return nil, err
+			}
+			var secret *api.Secret
+			err = retryAPI(func() error {
+				secret, err = client.Secrets(namespace).Get(name)
+				return err
+			})
+			if errors.IsNotFound(err) {
+				return nil, nil
+			}
+			return secret, err
+		},
+		saveSecret: func(secret *api.Secret) error {
+			return writeAPI(func() error {
+				var err error
+				if secret.ResourceVersion == "" {
+					_, err = client.Secrets(secret.Namespace).Create(secret)
+				} else {
+					_, err = client.Secrets(secret.Namespace).Update(secret)
+				}
+				return err
+			})
+		},
+		saveChallenge: challenges.save,
+		failures:      util.NewBackOff(5*time.Minute, 12*time.Hour),
+		pollInterval:  acmePollInterval,
+		now:           time.Now,
+	}
+}
+
+// splitKey splits a namespace/name key.
+func splitKey(key string) (string, string, error) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid secret %q, expected namespace/name", key)
+	}
+	return parts[0], parts[1], nil
+}
+
+// accountClient returns the client of the account, whose key is read from
+// the account secret, or generated and saved there the first time.
+func (m *acmeManager) accountClient() (*acmeClient, error) {
+	if m.client != nil {
+		return m.client, nil
+	}
+	secret, err := m.getSecret(m.accountSecret)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil {
+		namespace, name, err := splitKey(m.accountSecret)
+		if err != nil {
+			return nil, err
+		}
+		secret = &api.Secret{ObjectMeta: api.ObjectMeta{Namespace: namespace, Name: name}}
+	}
+	var key *ecdsa.PrivateKey
+	if data, ok := secret.Data[acmeAccountKey]; ok {
+		if key, err = decodeECKey(data); err != nil {
+			return nil, fmt.Errorf("invalid %v in secret %v: %v", acmeAccountKey, m.accountSecret, err)
+		}
+	} else {
+		logInfof("Generating the acme account key in secret %v", m.accountSecret)
+		if key, err = generateECKey(); err != nil {
+			return nil, err
+		}
+		data, err := encodeECKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		secret.Data[acmeAccountKey] = data
+		if err := m.saveSecret(secret); err != nil {
+			return nil, fmt.Errorf("unable to save the acme account key: %v", err)
+		}
+	}
+	m.client = newACMEClient(m.directoryURL, m.email, key)
+	m.client.pollInterval = m.pollInterval
+	return m.client, nil
+}
+
+// respond serves keyAuthorization for token until the returned func is
+// called, on this replica and, through the challenges ConfigMap, on the
+// others, since the validation requests of the acme server may land on any
+// of them. Failing to publish it only leaves the other replicas out.
+func (m *acmeManager) respond(token, keyAuthorization string) func() {
+	done := m.responder.respond(token, keyAuthorization)
+	if m.saveChallenge == nil {
+		return done
+	}
+	if err := m.saveChallenge(token, keyAuthorization); err != nil {
+		logWarningf("Unable to share the acme challenge %v with the other replicas: %v", token, err)
+	}
+	return func() {
+		done()
+		if err := m.saveChallenge(token, ""); err != nil {
+			logWarningf("Unable to withdraw the acme challenge %v: %v", token, err)
+		}
+	}
+}
+
+// acmeChallenges is the ConfigMap the leader publishes the key
+// authorizations of its pending challenges in, by token, for the other
+// replicas to serve.
+type acmeChallenges struct {
+	client    unversioned.ConfigMapsInterface
+	namespace string
+	name      string
+}
+
+// save sets the key authorization of token, or removes it if empty,
+// keeping the other tokens. The update is retried when it conflicts with
+// another replica.
+func (c *acmeChallenges) save(token, keyAuthorization string) error {
+	var err error
+	for attempt := 0; attempt < acmeChallengeSaveAttempts; attempt++ {
+		err = c.update(token, keyAuthorization)
+		if !errors.IsConflict(err) && !errors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// update sets the key authorization of token in the current ConfigMap,
+// which is created if it doesn't exist.
+func (c *acmeChallenges) update(token, keyAuthorization string) error {
+	var configMap *api.ConfigMap
+	err := retryAPI(func() error {
+		var err error
+		configMap, err = c.client.Get(c.name)
+		return err
+	})
+	if errors.IsNotFound(err) {
+		if keyAuthorization == "" {
+			return nil
+		}
+		configMap = &api.ConfigMap{ObjectMeta: api.ObjectMeta{Name: c.name, Namespace: c.namespace}}
+	} else if err != nil {
+		return err
+	}
+	if configMap.Data == nil {
+		configMap.Data = map[string]string{}
+	}
+	if keyAuthorization == "" {
+		delete(configMap.Data, token)
+	} else {
+		configMap.Data[token] = keyAuthorization
+	}
+	return writeAPI(func() error {
+		if configMap.ResourceVersion == "" {
+			_, err = c.client.Create(configMap)
+		} else {
+			_, err = c.client.Update(configMap)
+		}
+		return err
+	})
+}
+
+// sharedACMEChallenge returns the key authorization of token published by
+// the leader in the challenges ConfigMap of accountSecret, which is only
+// seen when its namespace is watched.
+func (lbc *loadBalancerController) sharedACMEChallenge(accountSecret, token string) (string, bool) {
+	configMap, err := lbc.getConfigMap(accountSecret + acmeChallengesSuffix)
+	if err != nil {
+		return "", false
+	}
+	keyAuthorization, ok := configMap.Data[token]
+	return keyAuthorization, ok && token != ""
+}
+
+// needsCertificate reports whether the certificate of secret doesn't cover
+// host or expires soon.
+func needsCertificate(secret *api.Secret, host string, now time.Time) bool {
+	if secret == nil {
+		return true
+	}
+	block, _ := pem.Decode(secret.Data[api.TLSCertKey])
+	if block == nil {
+		return true
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil || cert.VerifyHostname(host) != nil {
+		return true
+	}
+	return cert.NotAfter.Sub(now) < acmeRenewBefore
+}
+
+// sync obtains the certificates of requests that are missing or expire
+// soon.
+func (m *acmeManager) sync(requests []acmeRequest) {
+	for _, req := range requests {
+		if m.failures.IsInBackOffSinceUpdate(req.host, m.now()) {
+			continue
+		}
+		if err := m.ensure(req); err != nil {
+			logWarningf("Unable to obtain a certificate for %v: %v", req.host, err)
+			acmeCertificates.WithLabelValues("error").Inc()
+			m.failures.Next(req.host, m.now())
+			continue
+		}
+		m.failures.Reset(req.host)
+	}
+}
+
+// ensure obtains the certificate of req if needed, and saves it with its
+// key in the secret of req.
+func (m *acmeManager) ensure(req acmeRequest) error {
+	secret, err := m.getSecret(req.secret)
+	if err != nil {
+		return err
+	}
+	if !needsCertificate(secret, req.host, m.now()) {
+		return nil
+	}
+	client, err := m.accountClient()
+	if err != nil {
+		return err
+	}
+	logInfof("Obtaining a certificate for %v from %v", req.host, m.directoryURL)
+	key, err := generateECKey()
+	if err != nil {
+		return err
+	}
+	chain, err := client.obtain(req.host, key, m.respond)
+	if err != nil {
+		return err
+	}
+	keyPEM, err := encodeECKey(key)
+	if err != nil {
+		return err
+	}
+	if secret == nil {
+		namespace, name, err := splitKey(req.secret)
+		if err != nil {
+			return err
+		}
+		secret = &api.Secret{ObjectMeta: api.ObjectMeta{Namespace: namespace, Name: name}, Type: api.SecretTypeTLS}
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[api.TLSCertKey] = chain
+	secret.Data[api.TLSPrivateKeyKey] = keyPEM
+	if err := m.saveSecret(secret); err != nil {
+		return err
+	}
+	logInfof("Saved the certificate of %v in secret %v", req.host, req.secret)
+	acmeCertificates.WithLabelValues("issued").Inc()
+	return nil
+}
+
+// acmeRequests returns the certificates wanted by the services with the
+// serviceloadbalancer/lb.acme annotation, which need a host and a
+// sslSecret to store it in.
+func (lbc *loadBalancerController) acmeRequests() []acmeRequest {
+	services, _ := lbc.svcLister.List()
+	var requests []acmeRequest
+	for _, s := range services.Items {
+		if !lbc.selected(&s) {
+			continue
+		}
+		annotations := serviceAnnotations(s.ObjectMeta.Annotations)
+		val, ok := annotations[lbACME]
+		if !ok {
+			continue
+		}
+		if b, err := strconv.ParseBool(val); err != nil {
+			logWarningf("Ignoring invalid %v %q of service %v", lbACME, val, s.Name)
+			continue
+		} else if !b {
+			continue
+		}
+		host, _ := annotations.getHost()
+		secret, _ := annotations.getSslSecret()
+		if host == "" || secret == "" || hostKind(host) != exactHost {
+			logWarningf("Not obtaining a certificate for service %v, it needs a %v without wildcard and a %v", s.Name, lbHostKey, lbSslSecret)
+			continue
+		}
+		if strings.Contains(secret, "/") {
+			logWarningf("Not obtaining a certificate for service %v, its %v must be in the namespace of the service", s.Name, lbSslSecret)
+			continue
+		}
+		requests = append(requests, acmeRequest{host: host, secret: fmt.Sprintf("%v/%v", s.Namespace, secret)})
+	}
+	sort.Sort(acmeRequestsByHost(requests))
+	return requests
+}
+
+type acmeRequestsByHost []acmeRequest
+
+func (r acmeRequestsByHost) Len() int           { return len(r) }
+func (r acmeRequestsByHost) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r acmeRequestsByHost) Less(i, j int) bool { return r[i].host < r[j].host }
+
+// runACME obtains and renews certificates every interval, on the leader
+// only when replicas elect one.
+func (lbc *loadBalancerController) runACME(interval time.Duration, stopCh <-chan struct{}) {
+	wait.Until(func() {
+		if !lbc.leading() {
+			return
+		}
+		lbc.acme.sync(lbc.acmeRequests())
+	}, interval, stopCh)
+}
@@ -0,0 +1,350 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"time"
+
+	"k8s.io/contrib/service-loadbalancer/backoff"
+)
+
+const (
+	// acmePollInterval and acmePollAttempts bound the wait for an
+	// authorization or an order to be processed. Polls back off from
+	// acmePollInterval up to 4 times it.
+	acmePollInterval = 2 * time.Second
+	acmePollAttempts = 30
+)
+
+// acmeClient obtains certificates from an ACME server, RFC 8555, with http-01
+// challenges. The vendored dependencies have no ACME client.
+type acmeClient struct {
+	directoryURL string
+	key          *ecdsa.PrivateKey
+	email        string
+	http         *http.Client
+
+	pollInterval time.Duration
+
+	directory struct {
+		NewNonce   string `json:"newNonce"`
+		NewAccount string `json:"newAccount"`
+		NewOrder   string `json:"newOrder"`
+	}
+	nonce string
+	// kid is the url of the account, set once it is registered.
+	kid string
+}
+
+type acmeProblem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Status int    `json:"status"`
+}
+
+func (p *acmeProblem) Error() string {
+	return fmt.Sprintf("acme error %v: %v", p.Type, p.Detail)
+}
+
+type acmeOrder struct {
+	Status         string   `json:"status"`
+	Authorizations []string `json:"authorizations"`
+	Finalize       string   `json:"finalize"`
+	Certificate    string   `json:"certificate"`
+}
+
+type acmeAuthorization struct {
+	Status     string `json:"status"`
+	Identifier struct {
+		Value string `json:"value"`
+	} `json:"identifier"`
+	Challenges []struct {
+		Type   string `json:"type"`
+		URL    string `json:"url"`
+		Token  string `json:"token"`
+		Status string `json:"status"`
+	} `json:"challenges"`
+}
+
+func newACMEClient(directoryURL, email string, key *ecdsa.PrivateKey) *acmeClient {
+	return &acmeClient{
+		directoryURL: directoryURL,
+		key:          key,
+		email:        email,
+		http:         &http.Client{Timeout: 30 * time.Second},
+		pollInterval: acmePollInterval,
+	}
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// jwk returns the json web key of the public key of the account, with its
+// members in the lexicographic order of its thumbprint, RFC 7638.
+func (c *acmeClient) jwk() string {
+	pad := func(n *big.Int) string {
+		b := n.Bytes()
+		return b64(append(make([]byte, 32-len(b)), b...))
+	}
+	return fmt.Sprintf(`{"crv":"P-256","kty":"EC","x":"%v","y":"%v"}`, pad(c.key.X), pad(c.key.Y))
+}
+
+// keyAuthorization returns the response to the challenge with token.
+func (c *acmeClient) keyAuthorization(token string) string {
+	thumbprint := sha256.Sum256([]byte(c.jwk()))
+	return token + "." + b64(thumbprint[:])
+}
+
+// register fetches the directory and registers the account, or finds it
+// when the key was already registered.
+func (c *acmeClient) register() error {
+	resp, err := c.http.Get(c.directoryURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %v for the acme directory", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&c.directory); err != nil {
+		return fmt.Errorf("invalid acme directory: %v", err)
+	}
+	account := map[string]interface{}{"termsOfServiceAgreed": true}
+	if c.email != "" {
+		account["contact"] = []string{"mailto:" + c.email}
+	}
+	resp, _, err = c.post(c.directory.NewAccount, account, nil)
+	if err != nil {
+		return err
+	}
+	c.kid = resp.Header.Get("Location")
+	if c.kid == "" {
+		return fmt.Errorf("no account url in the response of the acme server")
+	}
+	return nil
+}
+
+// getNonce returns a fresh nonce, the one of the last response if any.
+func (c *acmeClient) getNonce() (string, error) {
+	if nonce := c.nonce; nonce != "" {
+		c.nonce = ""
+		return nonce, nil
+	}
+	resp, err := c.http.Head(c.directory.NewNonce)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	nonce := resp.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", fmt.Errorf("no nonce in the response of the acme server")
+	}
+	return nonce, nil
+}
+
+// sign returns the jws of payload for url, or of an empty payload for a
+// POST-as-GET when payload is nil.
+func (c *acmeClient) sign(url string, payload interface{}) ([]byte, error) {
+	nonce, err := c.getNonce()
+	if err != nil {
+		return nil, err
+	}
+	key := `"jwk":` + c.jwk()
+	if c.kid != "" {
+		key = fmt.Sprintf(`"kid":%q`, c.kid)
+	}
+	protected := b64([]byte(fmt.Sprintf(`{"alg":"ES256",%v,"nonce":%q,"url":%q}`, key, nonce, url)))
+	encoded := ""
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		encoded = b64(data)
+	}
+	hash := sha256.Sum256([]byte(protected + "." + encoded))
+	r, s, err := ecdsa.Sign(rand.Reader, c.key, hash[:])
+	if err != nil {
+		return nil, err
+	}
+	signature := make([]byte, 64)
+	rb, sb := r.Bytes(), s.Bytes()
+	copy(signature[32-len(rb):32], rb)
+	copy(signature[64-len(sb):], sb)
+	return json.Marshal(map[string]string{"protected": protected, "payload": encoded, "signature": b64(signature)})
+}
+
+// post sends payload to url, decoding the json response into result unless
+// it is nil. Requests rejected for their nonce are retried once.
+func (c *acmeClient) post(url string, payload, result interface{}) (*http.Response, []byte, error) {
+	for attempt := 0; ; attempt++ {
+		body, err := c.sign(url, payload)
+		if err != nil {
+			return nil, nil, err
+		}
+		resp, err := c.http.Post(url, "application/jose+json", bytes.NewReader(body))
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		c.nonce = resp.Header.Get("Replay-Nonce")
+		if resp.StatusCode >= 400 {
+			problem := &acmeProblem{Status: resp.StatusCode}
+			if err := json.Unmarshal(data, problem); err != nil || problem.Type == "" {
+				return nil, nil, fmt.Errorf("unexpected status %v from the acme server: %s", resp.Status, data)
+			}
+			if problem.Type == "urn:ietf:params:acme:error:badNonce" && attempt == 0 {
+				continue
+			}
+			return nil, nil, problem
+		}
+		if result != nil {
+			if err := json.Unmarshal(data, result); err != nil {
+				return nil, nil, fmt.Errorf("invalid response from the acme server: %v", err)
+			}
+		}
+		return resp, data, nil
+	}
+}
+
+// obtain returns the PEM certificate chain of host for key, answering its
+// challenge with respond, which makes the key authorization of a token
+// available, and returns a func removing it.
+func (c *acmeClient) obtain(host string, key crypto.Signer, respond func(token, keyAuthorization string) func()) ([]byte, error) {
+	if c.kid == "" {
+		if err := c.register(); err != nil {
+			return nil, err
+		}
+	}
+	var order acmeOrder
+	resp, _, err := c.post(c.directory.NewOrder, map[string]interface{}{
+		"identifiers": []map[string]string{{"type": "dns", "value": host}},
+	}, &order)
+	if err != nil {
+		return nil, err
+	}
+	orderURL := resp.Header.Get("Location")
+
+	for _, url := range order.Authorizations {
+		if err := c.authorize(url, respond); err != nil {
+			return nil, err
+		}
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: host},
+		DNSNames: []string{host},
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := c.post(order.Finalize, map[string]string{"csr": b64(csr)}, &order); err != nil {
+		return nil, err
+	}
+	for i := 0; order.Status != "valid"; i++ {
+		if order.Status == "invalid" || i == acmePollAttempts {
+			return nil, fmt.Errorf("order of %v is %v", host, order.Status)
+		}
+		time.Sleep(c.pollDelay(i))
+		if _, _, err := c.post(orderURL, nil, &order); err != nil {
+			return nil, err
+		}
+	}
+	_, chain, err := c.post(order.Certificate, nil, nil)
+	return chain, err
+}
+
+// pollDelay returns the delay before poll i of an authorization or order.
+func (c *acmeClient) pollDelay(i int) time.Duration {
+	return backoff.Backoff{Initial: c.pollInterval, Max: 4 * c.pollInterval, Jitter: 0.2}.Delay(i)
+}
+
+// authorize answers the http-01 challenge of the authorization at url, and
+// waits for it to be valid.
+func (c *acmeClient) authorize(url string, respond func(token, keyAuthorization string) func()) error {
+	var authz acmeAuthorization
+	if _, _, err := c.post(url, nil, &authz); err != nil {
+		return err
+	}
+	if authz.Status == "valid" {
+		return nil
+	}
+	for _, challenge := range authz.Challenges {
+		if challenge.Type != "http-01" {
+			continue
+		}
+		defer respond(challenge.Token, c.keyAuthorization(challenge.Token))()
+		if _, _, err := c.post(challenge.URL, struct{}{}, nil); err != nil {
+			return err
+		}
+		for i := 0; ; i++ {
+			time.Sleep(c.pollDelay(i))
+			if _, _, err := c.post(url, nil, &authz); err != nil {
+				return err
+			}
+			switch {
+			case authz.Status == "valid":
+				return nil
+			case authz.Status != "pending" || i == acmePollAttempts:
+				return fmt.Errorf("authorization of %v is %v", authz.Identifier.Value, authz.Status)
+			}
+		}
+	}
+	return fmt.Errorf("no http-01 challenge for %v", authz.Identifier.Value)
+}
+
+// generateECKey returns a new P-256 key.
+func generateECKey() (*ecdsa.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+// encodeECKey and decodeECKey convert keys from and to PEM.
+func encodeECKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+func decodeECKey(data []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "EC PRIVATE KEY" {
+		return nil, fmt.Errorf("no EC PRIVATE KEY block found")
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
@@ -0,0 +1,437 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/util"
+)
+
+// fakeACMEServer issues certificates signed by a test CA to the orders whose
+// http-01 challenges are answered by responder.
+type fakeACMEServer struct {
+	*httptest.Server
+	t         *testing.T
+	responder *acmeResponder
+	ca        *x509.Certificate
+	caKey     *ecdsa.PrivateKey
+
+	lock     sync.Mutex
+	nonces   int
+	accounts map[string]*ecdsa.PublicKey
+	// token and host of the pending challenge, its result, and the issued
+	// certificate.
+	token   string
+	host    string
+	valid   bool
+	invalid bool
+	cert    []byte
+	// badNonce rejects the next request for its nonce.
+	badNonce bool
+}
+
+func newFakeACMEServer(t *testing.T, responder *acmeResponder) *fakeACMEServer {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake acme ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(der)
+	f := &fakeACMEServer{t: t, responder: responder, ca: ca, caKey: caKey, accounts: map[string]*ecdsa.PublicKey{}}
+	f.Server = httptest.NewServer(f)
+	return f
+}
+
+func (f *fakeACMEServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.nonces++
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%v", f.nonces))
+	switch {
+	case r.URL.Path == "/directory":
+		json.NewEncoder(w).Encode(map[string]string{
+			"newNonce":   f.URL + "/new-nonce",
+			"newAccount": f.URL + "/new-account",
+			"newOrder":   f.URL + "/new-order",
+		})
+		return
+	case r.URL.Path == "/new-nonce":
+		return
+	}
+
+	payload, kid, err := f.verify(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"type":"urn:ietf:params:acme:error:malformed","detail":%q}`, err.Error())
+		return
+	}
+	if f.badNonce {
+		f.badNonce = false
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"type":"urn:ietf:params:acme:error:badNonce","detail":"stale nonce"}`))
+		return
+	}
+	order := func() {
+		status := "pending"
+		if f.valid {
+			status = "ready"
+		}
+		if f.cert != nil {
+			status = "valid"
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":         status,
+			"authorizations": []string{f.URL + "/authz"},
+			"finalize":       f.URL + "/finalize",
+			"certificate":    f.URL + "/cert",
+		})
+	}
+	switch r.URL.Path {
+	case "/new-account":
+		w.Header().Set("Location", f.URL+"/account/"+kid)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"status":"valid"}`))
+	case "/new-order":
+		var req struct {
+			Identifiers []struct{ Value string } `json:"identifiers"`
+		}
+		json.Unmarshal(payload, &req)
+		f.host, f.token = req.Identifiers[0].Value, "token-"+req.Identifiers[0].Value
+		f.valid, f.invalid, f.cert = false, false, nil
+		w.Header().Set("Location", f.URL+"/order")
+		w.WriteHeader(http.StatusCreated)
+		order()
+	case "/order":
+		order()
+	case "/authz":
+		status := "pending"
+		if f.valid {
+			status = "valid"
+		} else if f.invalid {
+			status = "invalid"
+		}
+		fmt.Fprintf(w, `{"status":%q,"identifier":{"type":"dns","value":%q},"challenges":[{"type":"dns-01","url":"%v/dns","token":"x"},{"type":"http-01","url":"%v/challenge","token":%q}]}`,
+			status, f.host, f.URL, f.URL, f.token)
+	case "/challenge":
+		rec := httptest.NewRecorder()
+		f.responder.ServeHTTP(rec, &http.Request{URL: mustParseURL(f.t, "http://"+f.host+acmeChallengePath+f.token)})
+		thumbprint := sha256.Sum256([]byte(jwkOf(f.accounts[kid])))
+		f.valid = rec.Body.String() == f.token+"."+base64.RawURLEncoding.EncodeToString(thumbprint[:])
+		f.invalid = !f.valid
+		w.Write([]byte(`{"status":"processing"}`))
+	case "/finalize":
+		if !f.valid {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"type":"urn:ietf:params:acme:error:orderNotReady","detail":"not authorized"}`))
+			return
+		}
+		var req struct{ CSR string }
+		json.Unmarshal(payload, &req)
+		der, _ := base64.RawURLEncoding.DecodeString(req.CSR)
+		csr, err := x509.ParseCertificateRequest(der)
+		if err != nil {
+			f.t.Errorf("invalid csr: %v", err)
+			return
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      csr.Subject,
+			DNSNames:     csr.DNSNames,
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		}
+		cert, err := x509.CreateCertificate(rand.Reader, template, f.ca, csr.PublicKey, f.caKey)
+		if err != nil {
+			f.t.Errorf("unable to sign the csr: %v", err)
+			return
+		}
+		f.cert = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})
+		order()
+	case "/cert":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.Write(f.cert)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// verify checks the jws of r, returning its payload and the id of its
+// account.
+func (f *fakeACMEServer) verify(r *http.Request) ([]byte, string, error) {
+	var jws struct{ Protected, Payload, Signature string }
+	if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+		return nil, "", err
+	}
+	data, _ := base64.RawURLEncoding.DecodeString(jws.Protected)
+	var protected struct {
+		Alg, Nonce, URL, Kid string
+		JWK                  *struct{ X, Y string }
+	}
+	if err := json.Unmarshal(data, &protected); err != nil {
+		return nil, "", err
+	}
+	if protected.Alg != "ES256" || protected.Nonce == "" || protected.URL != f.URL+r.URL.Path {
+		return nil, "", fmt.Errorf("invalid protected header %s", data)
+	}
+	var key *ecdsa.PublicKey
+	kid := strings.TrimPrefix(protected.Kid, f.URL+"/account/")
+	switch {
+	case protected.JWK != nil && r.URL.Path == "/new-account":
+		x, _ := base64.RawURLEncoding.DecodeString(protected.JWK.X)
+		y, _ := base64.RawURLEncoding.DecodeString(protected.JWK.Y)
+		key = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		kid = fmt.Sprintf("%v", len(f.accounts)+1)
+		for id, account := range f.accounts {
+			if account.X.Cmp(key.X) == 0 {
+				kid = id
+			}
+		}
+		f.accounts[kid] = key
+	case f.accounts[kid] != nil:
+		key = f.accounts[kid]
+	default:
+		return nil, "", fmt.Errorf("unknown account %q", protected.Kid)
+	}
+	signature, _ := base64.RawURLEncoding.DecodeString(jws.Signature)
+	hash := sha256.Sum256([]byte(jws.Protected + "." + jws.Payload))
+	if len(signature) != 64 || !ecdsa.Verify(key, hash[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])) {
+		return nil, "", fmt.Errorf("invalid signature")
+	}
+	payload, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+	return payload, kid, nil
+}
+
+func jwkOf(key *ecdsa.PublicKey) string {
+	return (&acmeClient{key: &ecdsa.PrivateKey{PublicKey: *key}}).jwk()
+}
+
+func mustParseURL(t *testing.T, raw string) *url.URL {
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// newFakeACMEManager returns a manager of the fake server keeping secrets
+// in memory.
+func newFakeACMEManager(t *testing.T) (*acmeManager, *fakeACMEServer, map[string]*api.Secret) {
+	secrets := map[string]*api.Secret{}
+	m := &acmeManager{
+		accountSecret: "kube-system/acme-account",
+		responder:     newACMEResponder(),
+		getSecret: func(key string) (*api.Secret, error) {
+			return secrets[key], nil
+		},
+		saveSecret: func(secret *api.Secret) error {
+			secret.ResourceVersion = "1"
+			secrets[secret.Namespace+"/"+secret.Name] = secret
+			return nil
+		},
+		failures:     util.NewBackOff(5*time.Minute, 12*time.Hour),
+		pollInterval: time.Millisecond,
+		now:          time.Now,
+	}
+	server := newFakeACMEServer(t, m.responder)
+	m.directoryURL = server.URL + "/directory"
+	return m, server, secrets
+}
+
+func TestACMEObtainsCertificate(t *testing.T) {
+	m, server, secrets := newFakeACMEManager(t)
+	defer server.Close()
+	m.sync([]acmeRequest{{host: "foo.example.com", secret: "default/foo-tls"}})
+
+	account := secrets["kube-system/acme-account"]
+	if account == nil || len(account.Data[acmeAccountKey]) == 0 {
+		t.Fatalf("Expected the account key to be saved, got %+v", account)
+	}
+	secret := secrets["default/foo-tls"]
+	if secret == nil {
+		t.Fatalf("Expected a certificate in secret default/foo-tls")
+	}
+	if secret.Type != api.SecretTypeTLS || len(secret.Data[api.TLSPrivateKeyKey]) == 0 {
+		t.Errorf("Expected a tls secret with a key, got %+v", secret)
+	}
+	if needsCertificate(secret, "foo.example.com", time.Now()) {
+		t.Errorf("Expected the certificate to cover foo.example.com")
+	}
+	if !needsCertificate(secret, "bar.example.com", time.Now()) {
+		t.Errorf("Expected a new certificate for bar.example.com")
+	}
+	if !needsCertificate(secret, "foo.example.com", time.Now().Add(70*24*time.Hour)) {
+		t.Errorf("Expected the certificate to be renewed 30 days before it expires")
+	}
+	if len(m.responder.tokens) != 0 {
+		t.Errorf("Expected challenges to be removed once answered, got %v", m.responder.tokens)
+	}
+
+	// valid certificates are kept, the account is reused
+	server.nonces = 0
+	m.sync([]acmeRequest{{host: "foo.example.com", secret: "default/foo-tls"}})
+	if server.nonces != 0 {
+		t.Errorf("Expected no request for a valid certificate, got %v", server.nonces)
+	}
+	m.client = nil
+	server.badNonce = true
+	m.sync([]acmeRequest{{host: "bar.example.com", secret: "default/foo-tls"}})
+	if len(server.accounts) != 1 {
+		t.Errorf("Expected the saved account key to be reused, got %v accounts", len(server.accounts))
+	}
+	if needsCertificate(secrets["default/foo-tls"], "bar.example.com", time.Now()) {
+		t.Errorf("Expected the certificate to be replaced for bar.example.com")
+	}
+}
+
+func TestACMEBacksOffFailures(t *testing.T) {
+	m, server, secrets := newFakeACMEManager(t)
+	defer server.Close()
+	// the challenge fails when the responder doesn't know the token
+	m.responder = newACMEResponder()
+	m.sync([]acmeRequest{{host: "foo.example.com", secret: "default/foo-tls"}})
+	if secrets["default/foo-tls"] != nil {
+		t.Fatalf("Expected no certificate without an answered challenge")
+	}
+	if !m.failures.IsInBackOffSinceUpdate("foo.example.com", m.now()) {
+		t.Errorf("Expected foo.example.com to be backed off")
+	}
+	server.nonces = 0
+	m.sync([]acmeRequest{{host: "foo.example.com", secret: "default/foo-tls"}})
+	if server.nonces != 0 {
+		t.Errorf("Expected no request while backed off, got %v", server.nonces)
+	}
+}
+
+func TestACMEResponder(t *testing.T) {
+	r := newACMEResponder()
+	done := r.respond("abc", "abc.key")
+	for _, test := range []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{acmeChallengePath + "abc", http.StatusOK, "abc.key"},
+		{acmeChallengePath + "def", http.StatusNotFound, ""},
+	} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, &http.Request{URL: mustParseURL(t, "http://foo"+test.path)})
+		if rec.Code != test.status || (test.body != "" && rec.Body.String() != test.body) {
+			t.Errorf("Expected %v %q for %v, got %v %q", test.status, test.body, test.path, rec.Code, rec.Body.String())
+		}
+	}
+	done()
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, &http.Request{URL: mustParseURL(t, "http://foo"+acmeChallengePath+"abc")})
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected the answered challenge to be removed, got %v", rec.Code)
+	}
+}
+
+func TestACMESharesChallenges(t *testing.T) {
+	m, server, secrets := newFakeACMEManager(t)
+	defer server.Close()
+	published := map[string]string{}
+	m.saveChallenge = func(token, keyAuthorization string) error {
+		if keyAuthorization == "" {
+			delete(published, token)
+		} else {
+			published[token] = keyAuthorization
+		}
+		return nil
+	}
+	// the validation requests land on another replica, which only knows
+	// the published challenges
+	replica := newACMEResponder()
+	replica.shared = func(token string) (string, bool) {
+		keyAuthorization, ok := published[token]
+		return keyAuthorization, ok
+	}
+	server.responder = replica
+	m.sync([]acmeRequest{{host: "foo.example.com", secret: "default/foo-tls"}})
+	if secrets["default/foo-tls"] == nil {
+		t.Fatalf("Expected the challenge answered by another replica to be validated")
+	}
+	if len(published) != 0 {
+		t.Errorf("Expected challenges to be withdrawn once answered, got %v", published)
+	}
+}
+
+func TestACMERequests(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	services, _ := flb.svcLister.List()
+	annotations := []map[string]string{
+		{lbACME: "true", lbHostKey: "foo.example.com", lbSslSecret: "foo-tls"},
+		{lbACME: "true", lbHostKey: "*.example.com", lbSslSecret: "other/bar-tls"},
+	}
+	for i := range services.Items {
+		services.Items[i].Annotations = annotations[i]
+		flb.svcLister.Store.Update(&services.Items[i])
+	}
+	requests := flb.acmeRequests()
+	expected := []acmeRequest{{host: "foo.example.com", secret: "default/foo-tls"}}
+	if fmt.Sprintf("%+v", requests) != fmt.Sprintf("%+v", expected) {
+		t.Errorf("Expected requests %+v, got %+v", expected, requests)
+	}
+}
+
+func TestACMEChallengeRoute(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	flb.cfg.acmeChallenges = true
+	httpSvc, _, _ := flb.getServices()
+	config, err := flb.backend.render(map[string][]service{"http": httpSvc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	route := "use_backend default-backend if { path_beg /.well-known/acme-challenge/ }"
+	if !strings.Contains(string(config), route) {
+		t.Errorf("Expected %q in the config:\n%s", route, config)
+	}
+	if strings.Index(string(config), route) > strings.Index(string(config), "use_backend "+httpSvc[0].Name) {
+		t.Errorf("Expected challenges to be routed before the services")
+	}
+}
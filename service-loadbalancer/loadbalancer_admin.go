@@ -0,0 +1,387 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/contrib/service-loadbalancer/adminserver"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/errors"
+	"k8s.io/kubernetes/pkg/client/unversioned"
+)
+
+const (
+	// adminPath is the prefix of the admin api of the servers.
+	adminPath = "/admin/backends"
+
+	// adminQueueKey is queued for the syncs triggered by the admin api.
+	adminQueueKey = "admin"
+
+	// overridesKey is the key of the ConfigMap of --admin-overrides holding
+	// the drained servers, a json object of their addresses by backend.
+	overridesKey = "drained"
+
+	// overridesSaveAttempts bounds the updates of the ConfigMap of
+	// --admin-overrides conflicting with other replicas.
+	overridesSaveAttempts = 5
+)
+
+// adminEndpointNames are the routes of the admin server.
+var adminEndpointNames = []string{"healthz", "readyz", "metrics", "stats", "config", "backends", "pprof"}
+
+// serverOverrides holds the servers drained through the admin api, by
+// backend and endpoint address. They stay drained until they are enabled
+// again, whatever happens to their endpoints.
+type serverOverrides struct {
+	lock    sync.Mutex
+	drained map[string]map[string]bool
+}
+
+func newServerOverrides() *serverOverrides {
+	return &serverOverrides{drained: map[string]map[string]bool{}}
+}
+
+// set drains the server of backend at addr, or clears its override.
+func (o *serverOverrides) set(backend, addr string, drained bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if drained {
+		if o.drained[backend] == nil {
+			o.drained[backend] = map[string]bool{}
+		}
+		o.drained[backend][addr] = true
+		return
+	}
+	delete(o.drained[backend], addr)
+	if len(o.drained[backend]) == 0 {
+		delete(o.drained, backend)
+	}
+}
+
+// replace drains the servers of drained, by backend, instead of the current
+// ones.
+func (o *serverOverrides) replace(drained map[string][]string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.drained = map[string]map[string]bool{}
+	for backend, addrs := range drained {
+		for _, addr := range addrs {
+			if o.drained[backend] == nil {
+				o.drained[backend] = map[string]bool{}
+			}
+			o.drained[backend][addr] = true
+		}
+	}
+}
+
+// isDrained reports whether the server of backend at addr was drained.
+func (o *serverOverrides) isDrained(backend, addr string) bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.drained[backend][addr]
+}
+
+// list returns the sorted addresses of the drained servers by backend.
+func (o *serverOverrides) list() map[string][]string {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	drained := map[string][]string{}
+	for backend, addrs := range o.drained {
+		for addr := range addrs {
+			drained[backend] = append(drained[backend], addr)
+		}
+		sort.Strings(drained[backend])
+	}
+	return drained
+}
+
+// adminHandler serves the admin api of the servers, for clients sending
+// token as a bearer token:
+//
+// GET /admin/backends lists the drained servers by backend.
+// POST /admin/backends/<backend>/<ip:port>/drain drains a server.
+// POST /admin/backends/<backend>/<ip:port>/enable clears its override.
+type adminHandler struct {
+	token     string
+	overrides *serverOverrides
+
+	// save persists an override before it is applied, nil when overrides
+	// are only kept in memory.
+	save func(backend, addr string, drained bool) error
+
+	// sync queues a sync applying the overrides, which changes the state
+	// of the server slots through the runtime api.
+	sync func()
+}
+
+// newAdminServer returns the admin server of --admin-address, serving the
+// routes of --admin-endpoints for clients sending token or a certificate
+// verified by --admin-client-ca.
+func newAdminServer(token string) *adminserver.Server {
+	config := adminserver.Config{
+		Token:   token,
+		Enabled: adminserver.ParseEnabled(*adminEndpoints),
+	}
+	for name := range config.Enabled {
+		known := false
+		for _, endpoint := range adminEndpointNames {
+			known = known || name == endpoint
+		}
+		if !known {
+			logFatalf("Unknown admin endpoint %q, expected one of %v", name, strings.Join(adminEndpointNames, ","))
+		}
+	}
+	if *adminClientCA != "" {
+		pool, err := adminserver.LoadClientCAs(*adminClientCA)
+		if err != nil {
+			logFatalf("Unable to load the admin client CAs: %v", err)
+		}
+		config.ClientCAs = pool
+	}
+	if config.Token == "" && config.ClientCAs == nil {
+		logFatalf("--admin-address requires --admin-token-file or --admin-client-ca")
+	}
+	if (*adminTLSCert == "") != (*adminTLSKey == "") {
+		logFatalf("--admin-tls-cert and --admin-tls-key are set together")
+	}
+	return adminserver.New(config)
+}
+
+// authorized reports whether r carries token as a bearer token, replying
+// with an error otherwise. An empty token authorizes every request, for
+// handlers mounted on the admin server which authenticates them itself.
+func authorized(w http.ResponseWriter, r *http.Request, token string) bool {
+	if token == "" {
+		return true
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") ||
+		subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func (a *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !authorized(w, r, a.token) {
+		return
+	}
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, adminPath), "/")
+	if path == "" {
+		if r.Method != "GET" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(a.overrides.list())
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	if len(parts) != 3 || parts[0] == "" || (parts[2] != "drain" && parts[2] != "enable") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	backend, addr, drain := parts[0], parts[1], parts[2] == "drain"
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		http.Error(w, "invalid server address: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	logInfof("Admin api: %v server %v of %v", parts[2], addr, backend)
+	if a.save != nil {
+		if err := a.save(backend, addr, drain); err != nil {
+			logErrorf("Unable to save the override of server %v of %v: %v", addr, backend, err)
+			http.Error(w, "unable to save the override: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	a.overrides.set(backend, addr, drain)
+	a.sync()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// newAdminHandler returns the handler of the admin api for clients sending
+// token, serving the overrides of lbc. With --admin-overrides, they are
+// loaded from its ConfigMap and saved in it.
+func (lbc *loadBalancerController) newAdminHandler(token string, client *unversioned.Client) *adminHandler {
+	lbc.overrides = newServerOverrides()
+	admin := &adminHandler{
+		token:     token,
+		overrides: lbc.overrides,
+		sync:      func() { lbc.queue.Add(adminQueueKey) },
+	}
+	if *adminOverrides == "" {
+		return admin
+	}
+	parts := strings.Split(*adminOverrides, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		logFatalf("Invalid --admin-overrides %q, expected namespace/name", *adminOverrides)
+	}
+	configMap := &overridesConfigMap{client: client.ConfigMaps(parts[0]), namespace: parts[0], name: parts[1]}
+	drained, version, err := configMap.load()
+	if err != nil {
+		logFatalf("Unable to load the overrides of the admin api: %v", err)
+	}
+	lbc.overrides.replace(drained)
+	lbc.overridesConfigMap, lbc.overridesVersion = *adminOverrides, version
+	admin.save = configMap.save
+	return admin
+}
+
+// loadOverrides drains the servers saved in the ConfigMap of
+// --admin-overrides when it changed, eg: through the admin api of another
+// replica. Changes are only seen when its namespace is watched.
+func (lbc *loadBalancerController) loadOverrides() {
+	if lbc.overrides == nil || lbc.overridesConfigMap == "" {
+		return
+	}
+	configMap, err := lbc.getConfigMap(lbc.overridesConfigMap)
+	if err != nil || configMap.ResourceVersion == lbc.overridesVersion {
+		return
+	}
+	drained, err := parseOverrides(configMap)
+	if err != nil {
+		logWarningf("Ignoring the overrides of the admin api: %v", err)
+		return
+	}
+	logInfof("Overrides of the admin api changed in %v", lbc.overridesConfigMap)
+	lbc.overrides.replace(drained)
+	lbc.overridesVersion = configMap.ResourceVersion
+}
+
+// overridesConfigMap saves the servers drained through the admin api in a
+// ConfigMap, so they stay drained when the controller restarts and are
+// shared by the replicas.
+type overridesConfigMap struct {
+	client    unversioned.ConfigMapsInterface
+	namespace string
+	name      string
+}
+
+// parseOverrides returns the drained servers saved in configMap, by
+// backend.
+func parseOverrides(configMap *api.ConfigMap) (map[string][]string, error) {
+	drained := map[string][]string{}
+	if data, ok := configMap.Data[overridesKey]; ok {
+		if err := json.Unmarshal([]byte(data), &drained); err != nil {
+			return nil, fmt.Errorf("invalid %v of configmap %v/%v: %v", overridesKey, configMap.Namespace, configMap.Name, err)
+		}
+	}
+	return drained, nil
+}
+
+// get returns the ConfigMap, nil if it doesn't exist.
+func (c *overridesConfigMap) get() (*api.ConfigMap, error) {
+	var configMap *api.ConfigMap
+	err := retryAPI(func() error {
+		var err error
+		configMap, err = c.client.Get(c.name)
+		return err
+	})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	return configMap, err
+}
+
+// load returns the drained servers saved in the ConfigMap and its resource
+// version, none if it doesn't exist.
+func (c *overridesConfigMap) load() (map[string][]string, string, error) {
+	configMap, err := c.get()
+	if err != nil || configMap == nil {
+		return nil, "", err
+	}
+	drained, err := parseOverrides(configMap)
+	return drained, configMap.ResourceVersion, err
+}
+
+// save drains the server of backend at addr in the ConfigMap, or clears its
+// override, keeping the others. The update is retried when it conflicts
+// with another replica.
+func (c *overridesConfigMap) save(backend, addr string, drained bool) error {
+	var err error
+	for attempt := 0; attempt < overridesSaveAttempts; attempt++ {
+		err = c.update(backend, addr, drained)
+		if !errors.IsConflict(err) && !errors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// update sets the override of the server of backend at addr in the current
+// ConfigMap, which is created if it doesn't exist.
+func (c *overridesConfigMap) update(backend, addr string, drained bool) error {
+	configMap, err := c.get()
+	if err != nil {
+		return err
+	}
+	if configMap == nil {
+		configMap = &api.ConfigMap{ObjectMeta: api.ObjectMeta{Name: c.name, Namespace: c.namespace}}
+	}
+	saved, err := parseOverrides(configMap)
+	if err != nil {
+		return err
+	}
+	overrides := newServerOverrides()
+	overrides.replace(saved)
+	overrides.set(backend, addr, drained)
+	data, err := json.Marshal(overrides.list())
+	if err != nil {
+		return err
+	}
+	if configMap.Data == nil {
+		configMap.Data = map[string]string{}
+	}
+	configMap.Data[overridesKey] = string(data)
+	return writeAPI(func() error {
+		if configMap.ResourceVersion == "" {
+			_, err = c.client.Create(configMap)
+		} else {
+			_, err = c.client.Update(configMap)
+		}
+		return err
+	})
+}
+
+// drainOverridden marks the servers of backend drained through the admin
+// api as draining, like the servers of removed endpoints.
+func (lbc *loadBalancerController) drainOverridden(backend string, servers []backendServer) {
+	if lbc.overrides == nil {
+		return
+	}
+	for i := range servers {
+		if !servers[i].Disabled && lbc.overrides.isDrained(backend, servers[i].Addr) {
+			servers[i].Draining = true
+		}
+	}
+}
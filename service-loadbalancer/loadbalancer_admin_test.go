@@ -0,0 +1,249 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/errors"
+	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/watch"
+)
+
+// fakeConfigMaps is an in memory ConfigMapsInterface that rejects updates of
+// stale objects, and the next conflicts updates, like the apiserver when
+// other replicas write.
+type fakeConfigMaps struct {
+	items     map[string]api.ConfigMap
+	conflicts int
+}
+
+func (f *fakeConfigMaps) Create(cm *api.ConfigMap) (*api.ConfigMap, error) {
+	if _, ok := f.items[cm.Name]; ok {
+		return nil, errors.NewAlreadyExists(api.Resource("configmaps"), cm.Name)
+	}
+	cm.ResourceVersion = "1"
+	f.items[cm.Name] = *cm
+	return cm, nil
+}
+
+func (f *fakeConfigMaps) Get(name string) (*api.ConfigMap, error) {
+	cm, ok := f.items[name]
+	if !ok {
+		return nil, errors.NewNotFound(api.Resource("configmaps"), name)
+	}
+	data := map[string]string{}
+	for k, v := range cm.Data {
+		data[k] = v
+	}
+	cm.Data = data
+	return &cm, nil
+}
+
+func (f *fakeConfigMaps) Update(cm *api.ConfigMap) (*api.ConfigMap, error) {
+	if f.conflicts > 0 || f.items[cm.Name].ResourceVersion != cm.ResourceVersion {
+		f.conflicts--
+		return nil, errors.NewConflict(api.Resource("configmaps"), cm.Name, fmt.Errorf("stale"))
+	}
+	v, _ := strconv.Atoi(cm.ResourceVersion)
+	cm.ResourceVersion = strconv.Itoa(v + 1)
+	f.items[cm.Name] = *cm
+	return cm, nil
+}
+
+func (f *fakeConfigMaps) List(opts api.ListOptions) (*api.ConfigMapList, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (f *fakeConfigMaps) Delete(name string) error {
+	return fmt.Errorf("not implemented")
+}
+
+func (f *fakeConfigMaps) Watch(opts api.ListOptions) (watch.Interface, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func TestAdminHandler(t *testing.T) {
+	syncs := 0
+	admin := &adminHandler{
+		token:     "secret",
+		overrides: newServerOverrides(),
+		sync:      func() { syncs++ },
+	}
+	serve := func(method, path, token string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest(method, "http://localhost:8081"+path, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, token := range []string{"", "wrong"} {
+		if w := serve("POST", "/admin/backends/svc-1/1.2.3.4:80/drain", token); w.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected 401 for token %q, got %v", token, w.Code)
+		}
+	}
+	for path, code := range map[string]int{
+		"/admin/backends/svc-1/1.2.3.4:80/stop": http.StatusNotFound,
+		"/admin/backends/svc-1/drain":           http.StatusNotFound,
+		"/admin/backends/svc-1/1.2.3.4/drain":   http.StatusBadRequest,
+	} {
+		if w := serve("POST", path, "secret"); w.Code != code {
+			t.Fatalf("Expected %v for %v, got %v", code, path, w.Code)
+		}
+	}
+	if w := serve("GET", "/admin/backends/svc-1/1.2.3.4:80/drain", "secret"); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("Expected 405 for a GET, got %v", w.Code)
+	}
+	if syncs != 0 {
+		t.Fatalf("Expected rejected requests to change nothing, got %v syncs", syncs)
+	}
+
+	for _, path := range []string{
+		"/admin/backends/svc-1/1.2.3.4:80/drain",
+		"/admin/backends/svc-1/5.6.7.8:80/drain",
+		"/admin/backends/svc-2:443/[fd00::1]:443/drain",
+		"/admin/backends/svc-1/5.6.7.8:80/enable",
+	} {
+		if w := serve("POST", path, "secret"); w.Code != http.StatusNoContent {
+			t.Fatalf("Expected 204 for %v, got %v: %v", path, w.Code, w.Body.String())
+		}
+	}
+	if syncs != 4 {
+		t.Fatalf("Expected 4 syncs, got %v", syncs)
+	}
+
+	w := serve("GET", "/admin/backends", "secret")
+	if w.Code != http.StatusOK || w.Body.String() != `{"svc-1":["1.2.3.4:80"],"svc-2:443":["[fd00::1]:443"]}`+"\n" {
+		t.Fatalf("Unexpected overrides %v: %v", w.Code, w.Body.String())
+	}
+}
+
+func TestDrainOverridden(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	flb.overrides = newServerOverrides()
+	flb.overrides.set("svc-1", "1.2.3.4:80", true)
+	flb.overrides.set("svc-1", "5.6.7.8:80", true)
+	flb.overrides.set("svc-1", "5.6.7.8:80", false)
+
+	httpSvc, _, _ := flb.getServices()
+	for _, svc := range httpSvc {
+		for _, srv := range svc.Servers {
+			if expected := svc.Name == "svc-1" && srv.Addr == "1.2.3.4:80"; srv.Draining != expected {
+				t.Fatalf("Expected draining %v for %v/%v, got %v", expected, svc.Name, srv.Addr, srv.Draining)
+			}
+		}
+	}
+}
+
+func TestOverridesConfigMap(t *testing.T) {
+	client := &fakeConfigMaps{items: map[string]api.ConfigMap{}}
+	configMap := &overridesConfigMap{client: client, namespace: "default", name: "overrides"}
+	if drained, version, err := configMap.load(); err != nil || len(drained) != 0 || version != "" {
+		t.Fatalf("Expected no overrides without a configmap, got %v %q: %v", drained, version, err)
+	}
+
+	if err := configMap.save("svc-1", "1.2.3.4:80", true); err != nil {
+		t.Fatalf("Unexpected error creating the configmap: %v", err)
+	}
+	// Another replica saves an override in between.
+	client.conflicts = 2
+	if err := configMap.save("svc-2", "5.6.7.8:80", true); err != nil {
+		t.Fatalf("Expected conflicting updates to be retried, got %v", err)
+	}
+	if err := configMap.save("svc-1", "9.9.9.9:80", false); err != nil {
+		t.Fatalf("Unexpected error clearing an override: %v", err)
+	}
+	client.conflicts = overridesSaveAttempts
+	if err := configMap.save("svc-1", "5.6.7.8:80", true); !errors.IsConflict(err) {
+		t.Fatalf("Expected the conflict after %v attempts, got %v", overridesSaveAttempts, err)
+	}
+
+	drained, version, err := configMap.load()
+	if err != nil {
+		t.Fatalf("Unexpected error loading the overrides: %v", err)
+	}
+	if fmt.Sprintf("%v", drained) != "map[svc-1:[1.2.3.4:80] svc-2:[5.6.7.8:80]]" || version != "3" {
+		t.Fatalf("Unexpected overrides %v at version %q", drained, version)
+	}
+}
+
+func TestAdminHandlerSaveFailure(t *testing.T) {
+	syncs := 0
+	admin := &adminHandler{
+		overrides: newServerOverrides(),
+		save:      func(backend, addr string, drained bool) error { return fmt.Errorf("forbidden") },
+		sync:      func() { syncs++ },
+	}
+	r, _ := http.NewRequest("POST", "http://localhost:8081/admin/backends/svc-1/1.2.3.4:80/drain", nil)
+	w := httptest.NewRecorder()
+	admin.ServeHTTP(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected 500 when the override can't be saved, got %v", w.Code)
+	}
+	if admin.overrides.isDrained("svc-1", "1.2.3.4:80") || syncs != 0 {
+		t.Fatalf("Expected an override which wasn't saved not to be applied")
+	}
+}
+
+func TestLoadOverrides(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	flb.overrides = newServerOverrides()
+	flb.overrides.set("svc-1", "1.2.3.4:80", true)
+	flb.overridesConfigMap, flb.overridesVersion = "default/overrides", "1"
+	flb.configMapStore = cache.NewStore(cache.MetaNamespaceKeyFunc)
+
+	// Missing configmaps and loaded versions keep the overrides.
+	flb.loadOverrides()
+	flb.configMapStore.Add(&api.ConfigMap{
+		ObjectMeta: api.ObjectMeta{Name: "overrides", Namespace: "default", ResourceVersion: "1"},
+		Data:       map[string]string{overridesKey: `{}`},
+	})
+	flb.loadOverrides()
+	if !flb.overrides.isDrained("svc-1", "1.2.3.4:80") {
+		t.Fatalf("Expected the overrides to be kept")
+	}
+
+	flb.configMapStore.Update(&api.ConfigMap{
+		ObjectMeta: api.ObjectMeta{Name: "overrides", Namespace: "default", ResourceVersion: "2"},
+		Data:       map[string]string{overridesKey: `{"svc-2":["5.6.7.8:80"]}`},
+	})
+	flb.loadOverrides()
+	if flb.overrides.isDrained("svc-1", "1.2.3.4:80") || !flb.overrides.isDrained("svc-2", "5.6.7.8:80") {
+		t.Fatalf("Expected the overrides of the new version, got %v", flb.overrides.list())
+	}
+	if flb.overridesVersion != "2" {
+		t.Fatalf("Expected version 2 to be loaded, got %q", flb.overridesVersion)
+	}
+}
+
+func TestPprofNotOnDefaultServeMux(t *testing.T) {
+	// Port 8081 serves the default mux, and unmatched public traffic.
+	r, _ := http.NewRequest("GET", "http://localhost:8081/debug/pprof/", nil)
+	w := httptest.NewRecorder()
+	http.DefaultServeMux.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected the profiles not to be served on port 8081, got %v", w.Code)
+	}
+}
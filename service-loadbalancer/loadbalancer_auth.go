@@ -0,0 +1,91 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// authSecretKey is the key of the htpasswd user list in the secrets of the
+// serviceloadbalancer/lb.authSecret annotation.
+const authSecretKey = "auth"
+
+var (
+	authUserName = regexp.MustCompile(`^[A-Za-z0-9._@-]+$`)
+
+	// authPassword matches crypt(3) hashes, haproxy checks passwords with
+	// the crypt of the system.
+	authPassword = regexp.MustCompile(`^[A-Za-z0-9./$]+$`)
+)
+
+// basicAuth requires the clients of a service to authenticate as one of
+// Users, rendered as an haproxy userlist.
+// http://cbonte.github.io/haproxy-dconv/configuration-1.5.html#3.4
+type basicAuth struct {
+	Enabled bool
+	Users   []authUser
+}
+
+type authUser struct {
+	Name     string
+	Password string
+}
+
+// getBasicAuth returns the basic auth of s from the secret referenced by its
+// serviceloadbalancer/lb.authSecret annotation. A missing or invalid secret
+// leaves the service enabled without users, rejecting every client rather
+// than exposing the service.
+func (lbc *loadBalancerController) getBasicAuth(s *api.Service) basicAuth {
+	val, ok := serviceAnnotations(s.ObjectMeta.Annotations).getAuthSecret()
+	if !ok {
+		return basicAuth{}
+	}
+	auth := basicAuth{Enabled: true}
+	secret, err := lbc.getServiceSecret(s, val)
+	if err != nil {
+		logWarningf("Rejecting every client of service %v: %v", s.Name, err)
+		return auth
+	}
+	auth.Users = parseHtpasswd(s, string(secret.Data[authSecretKey]))
+	if len(auth.Users) == 0 {
+		logWarningf("Rejecting every client of service %v: no users in the %v key of secret %v/%v",
+			s.Name, authSecretKey, secret.Namespace, secret.Name)
+	}
+	return auth
+}
+
+// parseHtpasswd returns the users of an htpasswd file, one user:hash per
+// line. Invalid lines are ignored.
+func parseHtpasswd(s *api.Service, htpasswd string) []authUser {
+	var users []authUser
+	for _, line := range strings.Split(htpasswd, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || !authUserName.MatchString(parts[0]) || !authPassword.MatchString(parts[1]) {
+			logWarningf("Ignoring invalid user of %v in the auth secret of service %v", lbAuthSecret, s.Name)
+			continue
+		}
+		users = append(users, authUser{Name: parts[0], Password: parts[1]})
+	}
+	return users
+}
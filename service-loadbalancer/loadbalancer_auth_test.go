@@ -0,0 +1,85 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+)
+
+func TestParseHtpasswd(t *testing.T) {
+	svc := &api.Service{ObjectMeta: api.ObjectMeta{Name: "svc"}}
+	users := parseHtpasswd(svc, `
+# staging users
+alice:$6$salt$hash
+bob:$1$salt$hash
+eve:has spaces
+:nouser
+`)
+	expected := []authUser{{"alice", "$6$salt$hash"}, {"bob", "$1$salt$hash"}}
+	if !reflect.DeepEqual(users, expected) {
+		t.Fatalf("Expected users %+v, got %+v", expected, users)
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	flb.secretStore = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	flb.secretStore.Add(&api.Secret{
+		ObjectMeta: api.ObjectMeta{Name: "users", Namespace: api.NamespaceDefault},
+		Data:       map[string][]byte{authSecretKey: []byte("alice:$6$salt$hash\n")},
+	})
+	obj, _, _ := flb.svcLister.Store.GetByKey("default/svc-2")
+	obj.(*api.Service).ObjectMeta.Annotations = map[string]string{lbAuthSecret: "users"}
+	obj, _, _ = flb.svcLister.Store.GetByKey("default/svc-1")
+	obj.(*api.Service).ObjectMeta.Annotations = map[string]string{lbAuthSecret: "missing"}
+	httpSvc, _, tcpSvc := flb.getServices()
+
+	for _, svc := range httpSvc {
+		if !svc.Auth.Enabled {
+			t.Fatalf("Expected basic auth for %v", svc.Name)
+		}
+		if svc.Name == "svc-1:443" && len(svc.Auth.Users) != 0 {
+			t.Fatalf("Expected no users for %v without its secret, got %+v", svc.Name, svc.Auth.Users)
+		}
+	}
+
+	defer os.Remove(flb.cfg.Config)
+	if err := writeConfig(flb,
+		map[string][]service{
+			"http": httpSvc,
+			"tcp":  tcpSvc,
+		}); err != nil {
+		t.Fatalf("Expected at least one tcp or http service: %v", err)
+	}
+	cfg, _ := ioutil.ReadFile(flb.cfg.Config)
+	for _, line := range []string{
+		"http-request auth realm svc-2 if !{ http_auth(auth-svc-2) }",
+		"userlist auth-svc-2\n    user alice password $6$salt$hash\n",
+		"userlist auth-svc-1:443\n",
+	} {
+		if !strings.Contains(string(cfg), line) {
+			t.Fatalf("Expected %q in the config:\n%s", line, cfg)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"k8s.io/contrib/service-loadbalancer/pkg/haproxyvalidate"
+)
+
+// proxyBackend generates the configuration of a proxy and applies it.
+type proxyBackend interface {
+	// render returns the configuration of the proxy for the http,
+	// httpsTerm and tcp services.
+	render(services map[string][]service) ([]byte, error)
+
+	// validate checks config with the proxy before it is applied.
+	validate(config []byte) error
+
+	// apply writes config, reloading the proxy with it if reload is set.
+	apply(config []byte, reload bool) error
+
+	// stats returns the current number of sessions of every backend, or
+	// of the whole proxy under totalSessions if it doesn't count them by
+	// backend.
+	stats() (map[string]int, error)
+}
+
+// totalSessions is the stats key of the sessions of the whole proxy.
+const totalSessions = "total"
+
+// newProxyBackend returns the backend of the named proxy configured by cfg.
+func newProxyBackend(name string, cfg *loadBalancerConfig) (proxyBackend, error) {
+	switch name {
+	case "haproxy":
+		return &haproxyBackend{cfg, &haproxySocket{path: *haproxySocketPath}}, nil
+	case "nginx":
+		return &nginxBackend{cfg, fmt.Sprintf("http://localhost:%v", *statsPort)}, nil
+	}
+	return nil, fmt.Errorf("unknown proxy %q, expected haproxy or nginx", name)
+}
+
+// validate runs the validateCmd of the json manifest against config, written
+// next to the config file so relative paths resolve the same way. Configs
+// are not validated without a validateCmd.
+func (cfg *loadBalancerConfig) validate(config []byte) error {
+	if cfg.ValidateCmd == "" {
+		return nil
+	}
+	f, err := ioutil.TempFile(filepath.Dir(cfg.Config), ".validate")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(config)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	output, err := exec.Command("sh", "-c", cfg.ValidateCmd+" "+f.Name()).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("invalid %v config -- %v: %v", cfg.Name, string(output), err)
+	}
+	return nil
+}
+
+// keepRejected writes config, which failed validation with err, next to the
+// config file with a .rejected suffix, so it can be compared with the last
+// applied config. Only the last rejected config is kept.
+func (cfg *loadBalancerConfig) keepRejected(config []byte, err error) {
+	path := cfg.Config + ".rejected"
+	if werr := ioutil.WriteFile(path, config, 0644); werr != nil {
+		logWarningf("Unable to keep the rejected config: %v", werr)
+		return
+	}
+	logWarningf("Rejected config written to %v: %v", path, err)
+}
+
+// apply writes config to the config file of the json manifest, and reloads
+// the loadbalancer if reload is set.
+func (cfg *loadBalancerConfig) apply(config []byte, reload bool) error {
+	if err := ioutil.WriteFile(cfg.Config, config, 0644); err != nil {
+		return err
+	}
+	if !reload {
+		return nil
+	}
+	return cfg.reload()
+}
+
+// haproxyBackend configures haproxy with the template of the json manifest.
+type haproxyBackend struct {
+	*loadBalancerConfig
+	socket *haproxySocket
+}
+
+func (h *haproxyBackend) render(services map[string][]service) ([]byte, error) {
+	conf := make(map[string]interface{})
+	conf["startSyslog"] = strconv.FormatBool(h.startSyslog)
+	if h.logTarget != "" {
+		conf["logTarget"] = h.logTarget
+		conf["logFacility"] = h.logFacility
+		conf["logLevel"] = h.logLevel
+	}
+	// host routes are evaluated in the order of the services
+	ordered := map[string][]service{}
+	for group, svcs := range services {
+		ordered[group] = hostOrder(svcs)
+	}
+	conf["services"] = ordered
+
+	var sslConfig string
+	if h.sslCert != "" {
+		sslConfig = "crt " + h.sslCert
+	}
+	if h.sslCaCert != "" {
+		sslConfig += " ca-file " + h.sslCaCert
+	}
+	if len(crtList(services["httpsTerm"])) > 0 {
+		sslConfig = strings.TrimSpace(sslConfig + " crt-list " + h.sslCrtList)
+	}
+	conf["sslCert"] = sslConfig
+	if err := haproxyvalidate.Validate(h.model(ordered, sslConfig)); err != nil {
+		return nil, fmt.Errorf("invalid routing: %v", err)
+	}
+	conf["acceptProxy"] = h.acceptProxy
+	conf["ipv6Bind"] = ipFamilies[h.ipFamily]
+	conf["timeoutConnect"] = haproxyTime(*timeoutConnect)
+	conf["timeoutServer"] = haproxyTime(*timeoutServer)
+	conf["timeoutClient"] = haproxyTime(*timeoutClient)
+	conf["pathRoutes"] = pathRoutes(services["http"])
+	if accessLogged(services["http"], services["httpsTerm"]) {
+		conf["accessLog"] = h.accessLogTarget
+		conf["accessLogFacility"] = accessLogFacility.String()
+		conf["accessLogFormat"] = quoteLogFormat(h.accessLogFormat)
+	}
+	if h.requestIDFormat != "" {
+		conf["requestIDFormat"] = quoteLogFormat(h.requestIDFormat)
+		conf["requestIDHeader"] = requestIDHeader
+	}
+	conf["acmeChallenges"] = h.acmeChallenges
+	if externalNameResolved(services["http"], services["httpsTerm"], services["tcp"]) {
+		conf["nameservers"] = h.nameservers
+		conf["resolvePrefer"] = "ipv4"
+		if h.ipFamily == "ipv6" {
+			conf["resolvePrefer"] = "ipv6"
+		}
+	}
+	conf["seamlessReload"] = h.seamlessReload != ""
+	conf["adminSocket"] = h.runtimeAPI || h.seamlessReload != ""
+	conf["alpnH2"] = speaksH2(services["httpsTerm"])
+	if redirectsToSsl(services["httpsTerm"]) {
+		conf["sslRedirectExclude"] = h.sslRedirectExclude
+	}
+
+	// default load balancer algorithm is roundrobin
+	conf["defLbAlgorithm"] = lbDefAlgorithm
+	if h.lbDefAlgorithm != "" {
+		conf["defLbAlgorithm"] = h.lbDefAlgorithm
+	}
+	return h.renderTemplate(conf)
+}
+
+// stats reads the scur column of the BACKEND rows of the haproxy stats.
+func (h *haproxyBackend) stats() (map[string]int, error) {
+	out, err := h.socket.exec("show stat")
+	if err != nil {
+		return nil, err
+	}
+	sessions := map[string]int{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, ",")
+		if len(fields) <= 4 || fields[1] != "BACKEND" {
+			continue
+		}
+		n, err := strconv.Atoi(fields[4])
+		if err != nil {
+			return nil, fmt.Errorf("invalid sessions of %v: %v", fields[0], err)
+		}
+		sessions[fields[0]] = n
+	}
+	return sessions, nil
+}
+
+// statsHandler serves the stats of backend as json.
+func statsHandler(backend proxyBackend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessions, err := backend.stats()
+		if err != nil {
+			logInfof("Error reading stats: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sessions)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateAndApply(t *testing.T) {
+	f, err := ioutil.TempFile("", "reloaded")
+	if err != nil {
+		t.Fatalf("Unexpected error creating temp file: %v", err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	defer os.Remove(f.Name())
+
+	flb := buildTestLoadBalancer("")
+	defer os.Remove(flb.cfg.Config)
+	flb.cfg.ValidateCmd = "grep -q '^frontend httpfrontend'"
+	flb.cfg.ReloadCmd = "touch " + f.Name()
+	httpSvc, _, _ := flb.getServices()
+	config, err := flb.backend.render(map[string][]service{"http": httpSvc})
+	if err != nil {
+		t.Fatalf("Unexpected error rendering the config: %v", err)
+	}
+
+	if err := flb.backend.validate(config); err != nil {
+		t.Fatalf("Expected the config to be valid: %v", err)
+	}
+	if err := flb.backend.validate([]byte("global\n")); err == nil {
+		t.Fatalf("Expected an invalid config to be rejected")
+	}
+
+	if err := flb.backend.apply(config, false); err != nil {
+		t.Fatalf("Unexpected error applying the config: %v", err)
+	}
+	if _, err := os.Stat(f.Name()); err == nil {
+		t.Fatalf("Expected no reload")
+	}
+	if err := flb.backend.apply(config, true); err != nil {
+		t.Fatalf("Unexpected error applying the config: %v", err)
+	}
+	if _, err := os.Stat(f.Name()); err != nil {
+		t.Fatalf("Expected a reload")
+	}
+	if written, _ := ioutil.ReadFile(flb.cfg.Config); string(written) != string(config) {
+		t.Fatalf("Expected the config to be written")
+	}
+}
+
+func TestKeepRejected(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	defer os.Remove(flb.cfg.Config + ".rejected")
+	flb.cfg.keepRejected([]byte("global\n"), errors.New("invalid"))
+	if rejected, _ := ioutil.ReadFile(flb.cfg.Config + ".rejected"); string(rejected) != "global\n" {
+		t.Fatalf("Expected the rejected config to be kept, got %q", rejected)
+	}
+}
+
+func TestSeamlessReload(t *testing.T) {
+	f, err := ioutil.TempFile("", "reloaded")
+	if err != nil {
+		t.Fatalf("Unexpected error creating temp file: %v", err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	flb := buildTestLoadBalancer("")
+	defer os.Remove(flb.cfg.Config)
+	flb.cfg.ReloadCmd = "echo $SEAMLESS_RELOAD > " + f.Name()
+	flb.cfg.seamlessReload = "/tmp/haproxy"
+	httpSvc, _, _ := flb.getServices()
+	config, err := flb.backend.render(map[string][]service{"http": httpSvc})
+	if err != nil {
+		t.Fatalf("Unexpected error rendering the config: %v", err)
+	}
+	if !strings.Contains(string(config), "stats socket /tmp/haproxy level admin expose-fd listeners\n") {
+		t.Fatalf("Expected the stats socket to expose the listeners:\n%s", config)
+	}
+	if err := flb.backend.apply(config, true); err != nil {
+		t.Fatalf("Unexpected error applying the config: %v", err)
+	}
+	if env, _ := ioutil.ReadFile(f.Name()); string(env) != "/tmp/haproxy\n" {
+		t.Fatalf("Expected the reload to hand over the sockets, got %q", env)
+	}
+}
+
+func TestStatsSocketLevel(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	defer os.Remove(flb.cfg.Config)
+	httpSvc, _, _ := flb.getServices()
+	for _, tc := range []struct {
+		runtimeAPI bool
+		expected   string
+	}{
+		{false, "stats socket /tmp/haproxy\n"},
+		{true, "stats socket /tmp/haproxy level admin\n"},
+	} {
+		flb.cfg.runtimeAPI = tc.runtimeAPI
+		config, err := flb.backend.render(map[string][]service{"http": httpSvc})
+		if err != nil {
+			t.Fatalf("Unexpected error rendering the config: %v", err)
+		}
+		if !strings.Contains(string(config), tc.expected) {
+			t.Fatalf("Expected %q with runtime api %v:\n%s", tc.expected, tc.runtimeAPI, config)
+		}
+	}
+}
+
+func TestHAProxyStats(t *testing.T) {
+	fake, path := newFakeHAProxySocket(t)
+	defer fake.close(path)
+	fake.response = "# pxname,svname,qcur,qmax,scur,smax\n" +
+		"svc-1,1.2.3.4:80,0,0,3,5\n" +
+		"svc-1,BACKEND,0,0,7,9\n" +
+		"svc-2:443,BACKEND,0,0,0,1\n"
+
+	backend := &haproxyBackend{&loadBalancerConfig{}, &haproxySocket{path: path}}
+	sessions, err := backend.stats()
+	if err != nil {
+		t.Fatalf("Unexpected error reading stats: %v", err)
+	}
+	expected := map[string]int{"svc-1": 7, "svc-2:443": 0}
+	if !reflect.DeepEqual(sessions, expected) {
+		t.Fatalf("Unexpected stats %v, expected %v", sessions, expected)
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// backendCAKey is the key of the CA bundle in the secrets of the
+// serviceloadbalancer/lb.backendCASecret annotation.
+const backendCAKey = "ca.crt"
+
+// backendTLS makes haproxy connect to the servers of a service over TLS,
+// verifying their certificates against CAFile and presenting ClientCert when
+// they are set.
+// http://cbonte.github.io/haproxy-dconv/configuration-1.5.html#5.2-ssl
+type backendTLS struct {
+	Enabled bool
+
+	// CAFile is the CA bundle the certificates of the servers must be
+	// signed by. Certificates are not verified without it.
+	CAFile string
+
+	// VerifyHost is the name the certificates of the servers must be
+	// valid for, any name signed by the CA is accepted without it.
+	VerifyHost string
+
+	// ClientCert is the PEM bundle of the certificate and key presented
+	// to the servers.
+	ClientCert string
+
+	// caSecret and clientSecret are the namespace/name of the secrets
+	// written to CAFile and ClientCert, and versions their resource
+	// versions, so rotated secrets are seen as a change of the service.
+	caSecret     string
+	clientSecret string
+	versions     string
+}
+
+// getBackendTLS returns the backend TLS of s from its annotations. It fails
+// when a secret it needs is missing or invalid, as connecting without it
+// would either fail or not be authenticated.
+func (lbc *loadBalancerController) getBackendTLS(s *api.Service) (backendTLS, error) {
+	annotations := serviceAnnotations(s.ObjectMeta.Annotations)
+	val, ok := annotations[lbBackendTLS]
+	if !ok {
+		return backendTLS{}, nil
+	}
+	enabled, err := strconv.ParseBool(val)
+	if err != nil {
+		return backendTLS{}, fmt.Errorf("invalid %v %q", lbBackendTLS, val)
+	}
+	if !enabled {
+		return backendTLS{}, nil
+	}
+
+	tls := backendTLS{Enabled: true, VerifyHost: annotations[lbBackendVerifyHost]}
+	if name, ok := annotations[lbBackendCASecret]; ok {
+		secret, err := lbc.getServiceSecret(s, name)
+		if err != nil {
+			return backendTLS{}, err
+		}
+		if len(secret.Data[backendCAKey]) == 0 {
+			return backendTLS{}, fmt.Errorf("secret %v/%v must contain %v", secret.Namespace, secret.Name, backendCAKey)
+		}
+		tls.caSecret = fmt.Sprintf("%v/%v", secret.Namespace, secret.Name)
+		tls.CAFile = filepath.Join(lbc.sslCertDir, fmt.Sprintf("backend-ca_%v_%v.pem", secret.Namespace, secret.Name))
+		tls.versions = secret.ResourceVersion
+	} else if tls.VerifyHost != "" {
+		logWarningf("Ignoring %v of service %v, certificates are only verified with %v", lbBackendVerifyHost, s.Name, lbBackendCASecret)
+		tls.VerifyHost = ""
+	}
+	if name, ok := annotations[lbBackendClientSecret]; ok {
+		secret, err := lbc.getServiceSecret(s, name)
+		if err != nil {
+			return backendTLS{}, err
+		}
+		if len(secret.Data[api.TLSCertKey]) == 0 || len(secret.Data[api.TLSPrivateKeyKey]) == 0 {
+			return backendTLS{}, fmt.Errorf("secret %v/%v must contain %v and %v", secret.Namespace, secret.Name, api.TLSCertKey, api.TLSPrivateKeyKey)
+		}
+		tls.clientSecret = fmt.Sprintf("%v/%v", secret.Namespace, secret.Name)
+		tls.ClientCert = filepath.Join(lbc.sslCertDir, fmt.Sprintf("backend-client_%v_%v.pem", secret.Namespace, secret.Name))
+		tls.versions += "," + secret.ResourceVersion
+	}
+	return tls, nil
+}
+
+// writeBackendTLS writes the CA bundles and client certificates of the
+// services connecting to their servers over TLS. Files are only rewritten
+// when their content changed.
+func (lbc *loadBalancerController) writeBackendTLS(svcGroups ...[]service) error {
+	for _, group := range svcGroups {
+		for _, svc := range group {
+			tls := svc.BackendTLS
+			if tls.caSecret != "" {
+				secret, err := lbc.getSecret(tls.caSecret)
+				if err != nil {
+					return err
+				}
+				if err := writeSecretFile(tls.CAFile, tls.caSecret, secret.Data[backendCAKey]); err != nil {
+					return err
+				}
+			}
+			if tls.clientSecret != "" {
+				secret, err := lbc.getSecret(tls.clientSecret)
+				if err != nil {
+					return err
+				}
+				pem := append(append([]byte{}, secret.Data[api.TLSCertKey]...), '\n')
+				pem = append(pem, secret.Data[api.TLSPrivateKeyKey]...)
+				if err := writeSecretFile(tls.ClientCert, tls.clientSecret, pem); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// writeSecretFile writes data from secret to path, logging actual writes.
+func writeSecretFile(path, secret string, data []byte) error {
+	written, err := writeFile(path, data)
+	if err != nil {
+		return err
+	}
+	if written {
+		logInfof("Wrote secret %v to %v", secret, path)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestBackendTLS(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	dir, err := ioutil.TempDir("", "backend-tls")
+	if err != nil {
+		t.Fatalf("Unexpected error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	flb.sslCertDir = dir
+	flb.secretStore = storeSecrets([]*api.Secret{
+		{
+			ObjectMeta: api.ObjectMeta{Name: "mesh-ca", Namespace: "default", ResourceVersion: "1"},
+			Data:       map[string][]byte{backendCAKey: []byte("ca")},
+		},
+		{
+			ObjectMeta: api.ObjectMeta{Name: "lb-client", Namespace: "default", ResourceVersion: "2"},
+			Data: map[string][]byte{
+				api.TLSCertKey:       []byte("cert"),
+				api.TLSPrivateKeyKey: []byte("key"),
+			},
+		},
+	})
+	for name, annotations := range map[string]map[string]string{
+		"default/svc-1": {
+			lbBackendTLS:          "true",
+			lbBackendCASecret:     "mesh-ca",
+			lbBackendClientSecret: "lb-client",
+			lbBackendVerifyHost:   "svc-1.default.svc",
+		},
+		"default/svc-2": {lbBackendTLS: "true", lbBackendVerifyHost: "ignored"},
+	} {
+		obj, _, _ := flb.svcLister.Store.GetByKey(name)
+		obj.(*api.Service).ObjectMeta.Annotations = annotations
+	}
+
+	httpSvc, _, tcpSvc := flb.getServices()
+	caFile := filepath.Join(dir, "backend-ca_default_mesh-ca.pem")
+	clientCert := filepath.Join(dir, "backend-client_default_lb-client.pem")
+	for _, svc := range httpSvc {
+		tls := svc.BackendTLS
+		if strings.HasPrefix(svc.Name, "svc-1") {
+			if !tls.Enabled || tls.CAFile != caFile || tls.ClientCert != clientCert || tls.VerifyHost != "svc-1.default.svc" || tls.versions != "1,2" {
+				t.Fatalf("Unexpected backend tls of %v: %+v", svc.Name, tls)
+			}
+		} else if !tls.Enabled || tls.CAFile != "" || tls.ClientCert != "" || tls.VerifyHost != "" {
+			t.Fatalf("Expected unverified backend tls for %v, got %+v", svc.Name, tls)
+		}
+	}
+
+	if err := flb.writeBackendTLS(httpSvc, tcpSvc); err != nil {
+		t.Fatalf("Unexpected error writing backend tls files: %v", err)
+	}
+	if ca, err := ioutil.ReadFile(caFile); err != nil || string(ca) != "ca" {
+		t.Fatalf("Unexpected CA bundle %q: %v", ca, err)
+	}
+	if pem, err := ioutil.ReadFile(clientCert); err != nil || string(pem) != "cert\nkey" {
+		t.Fatalf("Unexpected client certificate %q: %v", pem, err)
+	}
+
+	config, err := flb.backend.render(map[string][]service{"http": httpSvc, "tcp": tcpSvc})
+	if err != nil {
+		t.Fatalf("Unexpected error rendering config: %v", err)
+	}
+	for _, expected := range []string{
+		"server 1.2.3.4:80 1.2.3.4:80 check check-ssl port 80 inter 5 ssl verify required ca-file " + caFile +
+			" verifyhost svc-1.default.svc crt " + clientCert,
+		"ssl verify none",
+	} {
+		if !strings.Contains(string(config), expected) {
+			t.Fatalf("Expected %q in config:\n%s", expected, config)
+		}
+	}
+}
+
+func TestBackendTLSMissingSecret(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	flb.secretStore = storeSecrets(nil)
+	obj, _, _ := flb.svcLister.Store.GetByKey("default/svc-1")
+	obj.(*api.Service).ObjectMeta.Annotations = map[string]string{lbBackendTLS: "true", lbBackendCASecret: "missing"}
+
+	httpSvc, _, _ := flb.getServices()
+	for _, svc := range httpSvc {
+		if strings.HasPrefix(svc.Name, "svc-1") {
+			t.Fatalf("Expected svc-1 not to be exposed without its CA, got %+v", svc)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+
+	"k8s.io/kubernetes/pkg/util/wait"
+)
+
+// bgpCheckInterval is how often the node is checked for the virtual ip.
+const bgpCheckInterval = 2 * time.Second
+
+// bgpAnnouncer announces the virtual ip over bgp while keepalived holds it
+// on this node, through the cli of a gobgpd running next to the controller,
+// so the routers of other racks follow the virtual ip when it moves.
+type bgpAnnouncer struct {
+	// prefix is the host route of the virtual ip, eg: 10.0.0.100/32.
+	prefix string
+	family string
+	// held reports whether the virtual ip is on the node, and exec runs the
+	// gobgp cli with args.
+	held func() (bool, error)
+	exec func(args ...string) error
+
+	announced bool
+}
+
+func newBGPAnnouncer(command, iface, addr string) *bgpAnnouncer {
+	ip := net.ParseIP(addr)
+	b := &bgpAnnouncer{prefix: addr + "/32", family: "ipv4"}
+	if ip.To4() == nil {
+		b.prefix, b.family = addr+"/128", "ipv6"
+	}
+	b.held = func() (bool, error) { return interfaceHasIP(iface, ip) }
+	b.exec = func(args ...string) error {
+		if out, err := exec.Command(command, args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("%v %v: %v: %v", command, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+	return b
+}
+
+// interfaceHasIP reports whether ip is one of the addresses of iface.
+func interfaceHasIP(iface string, ip net.IP) (bool, error) {
+	i, err := net.InterfaceByName(iface)
+	if err != nil {
+		return false, err
+	}
+	addrs, err := i.Addrs()
+	if err != nil {
+		return false, err
+	}
+	for _, addr := range addrs {
+		if n, ok := addr.(*net.IPNet); ok && n.IP.Equal(ip) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// check announces the prefix when the virtual ip arrived on the node, and
+// withdraws it when it left. Failed commands are retried by the next check.
+func (b *bgpAnnouncer) check() {
+	held, err := b.held()
+	if err != nil {
+		logWarningf("Unable to check for the virtual ip: %v", err)
+		return
+	}
+	if held == b.announced {
+		return
+	}
+	op := "del"
+	if held {
+		op = "add"
+	}
+	if err := b.exec("global", "rib", op, "-a", b.family, b.prefix); err != nil {
+		logWarningf("Unable to update the bgp announcement of %v: %v", b.prefix, err)
+		return
+	}
+	b.announced = held
+	if held {
+		logInfof("Announcing %v over bgp", b.prefix)
+		vipAnnounced.Set(1)
+	} else {
+		logInfof("Withdrew %v from bgp", b.prefix)
+		vipAnnounced.Set(0)
+	}
+}
+
+func (b *bgpAnnouncer) run(stopCh <-chan struct{}) {
+	wait.Until(b.check, bgpCheckInterval, stopCh)
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBGPAnnouncer(t *testing.T) {
+	b := newBGPAnnouncer("gobgp", "lo", "10.0.0.100")
+	if b.prefix != "10.0.0.100/32" || b.family != "ipv4" {
+		t.Fatalf("Unexpected prefix %v %v", b.prefix, b.family)
+	}
+	if b6 := newBGPAnnouncer("gobgp", "lo", "fd00::100"); b6.prefix != "fd00::100/128" || b6.family != "ipv6" {
+		t.Fatalf("Unexpected prefix %v %v", b6.prefix, b6.family)
+	}
+
+	held, fail := false, false
+	var commands []string
+	b.held = func() (bool, error) { return held, nil }
+	b.exec = func(args ...string) error {
+		if fail {
+			return fmt.Errorf("connection refused")
+		}
+		commands = append(commands, strings.Join(args, " "))
+		return nil
+	}
+	b.check()
+	held = true
+	b.check()
+	b.check()
+	held, fail = false, true
+	b.check()
+	if !b.announced {
+		t.Errorf("Expected a failed withdrawal to be retried")
+	}
+	fail = false
+	b.check()
+	expected := []string{
+		"global rib add -a ipv4 10.0.0.100/32",
+		"global rib del -a ipv4 10.0.0.100/32",
+	}
+	if !reflect.DeepEqual(commands, expected) {
+		t.Errorf("Expected commands %v, got %v", expected, commands)
+	}
+}
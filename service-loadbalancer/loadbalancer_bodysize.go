@@ -0,0 +1,95 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	// bodyTooLargeStatus is the status requests over the body size limit
+	// of their service are denied with, which needs haproxy 2.2.
+	bodyTooLargeStatus = 413
+
+	// bodyTooLargePage is the page of the 413 response, in the error pages
+	// directory.
+	bodyTooLargePage = "413.http"
+	bodyTooLargeHTML = "<html><body><h1>413 Request Entity Too Large</h1>\nThe request body is too large.\n</body></html>\n"
+)
+
+// bodySizeUnits are the suffixes of body sizes, powers of 1024 like the
+// client_max_body_size of nginx.
+var bodySizeUnits = map[string]int64{"k": 1 << 10, "m": 1 << 20, "g": 1 << 30}
+
+// bodyLimit denies requests whose Content-Length is over Bytes with Status,
+// whose errorfile is the 413 response of Page. A zero Bytes means bodies
+// aren't limited.
+type bodyLimit struct {
+	Bytes  int64
+	Page   string
+	Status int
+}
+
+// parseBodySize parses a size in bytes, optionally followed by k, m or g.
+func parseBodySize(val string) (int64, bool) {
+	val = strings.ToLower(strings.TrimSpace(val))
+	unit := int64(1)
+	if n := len(val); n > 0 {
+		if u, ok := bodySizeUnits[val[n-1:]]; ok {
+			unit, val = u, val[:n-1]
+		}
+	}
+	n, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || n <= 0 || n > (1<<62)/unit {
+		return 0, false
+	}
+	return n * unit, true
+}
+
+// getBodyLimit returns the body size limit of s from its maxBodySize
+// annotation, eg: 10m.
+func (lbc *loadBalancerController) getBodyLimit(s *api.Service) bodyLimit {
+	val, ok := serviceAnnotations(s.ObjectMeta.Annotations).getMaxBodySize()
+	if !ok {
+		return bodyLimit{}
+	}
+	n, ok := parseBodySize(val)
+	if !ok {
+		logWarningf("Ignoring invalid %v %q of service %v", lbMaxBodySize, val, s.Name)
+		return bodyLimit{}
+	}
+	return bodyLimit{Bytes: n, Page: filepath.Join(lbc.errorPagesDir, bodyTooLargePage), Status: bodyTooLargeStatus}
+}
+
+// writeBodyTooLargePage writes the page of requests over the body size
+// limit of their service, if any service has one.
+func (lbc *loadBalancerController) writeBodyTooLargePage(svcGroups ...[]service) error {
+	for _, group := range svcGroups {
+		for _, svc := range group {
+			if svc.MaxBody.Bytes == 0 {
+				continue
+			}
+			_, err := writeFile(svc.MaxBody.Page, errorResponse("413", bodyTooLargeHTML))
+			return err
+		}
+	}
+	return nil
+}
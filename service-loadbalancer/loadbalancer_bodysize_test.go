@@ -0,0 +1,92 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestParseBodySize(t *testing.T) {
+	for val, expected := range map[string]int64{
+		"1024": 1024,
+		"512k": 512 << 10,
+		"10M":  10 << 20,
+		"2g":   2 << 30,
+		"0":    0,
+		"-1m":  0,
+		"10mb": 0,
+		"m":    0,
+		"":     0,
+	} {
+		n, ok := parseBodySize(val)
+		if n != expected || ok != (expected > 0) {
+			t.Errorf("Expected %v for %q, got %v %v", expected, val, n, ok)
+		}
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	dir, err := ioutil.TempDir("", "body-limit")
+	if err != nil {
+		t.Fatalf("Unexpected error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	flb.errorPagesDir = dir
+	for name, val := range map[string]string{"default/svc-1": "10m", "default/svc-2": "lots"} {
+		obj, _, _ := flb.svcLister.Store.GetByKey(name)
+		obj.(*api.Service).ObjectMeta.Annotations = map[string]string{lbMaxBodySize: val}
+	}
+
+	httpSvc, _, _ := flb.getServices()
+	page := filepath.Join(dir, bodyTooLargePage)
+	backends := 0
+	for _, svc := range httpSvc {
+		limited := strings.HasPrefix(svc.Name, "svc-1")
+		if limited {
+			backends++
+		}
+		if limited != (svc.MaxBody.Bytes == 10<<20) || limited != (svc.MaxBody.Page == page) {
+			t.Fatalf("Expected only svc-1 to limit request bodies, got %+v", svc)
+		}
+	}
+	if err := flb.writeBodyTooLargePage(httpSvc); err != nil {
+		t.Fatalf("Unexpected error writing the page: %v", err)
+	}
+	if content, err := ioutil.ReadFile(page); err != nil || !strings.HasPrefix(string(content), "HTTP/1.0 413 Request Entity Too Large\r\n") {
+		t.Fatalf("Unexpected page %q: %v", content, err)
+	}
+
+	config, err := flb.backend.render(map[string][]service{"http": httpSvc})
+	if err != nil {
+		t.Fatalf("Unexpected error rendering the config: %v", err)
+	}
+	for _, expected := range []string{
+		"errorfile 413 " + page + "\n",
+		"http-request deny deny_status 413 if { req.hdr_val(content-length) gt 10485760 }\n",
+	} {
+		if strings.Count(string(config), expected) != backends {
+			t.Fatalf("Expected %q in the %v backends of svc-1:\n%s", expected, backends, config)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// getCanaryEndpoints returns the endpoints of the canary of servicePort of s,
+// with the percentage of the traffic they get. The canary is the service
+// named by the serviceloadbalancer/lb.canary annotation of s, in the same
+// namespace, and its port with the same number serves the canary traffic.
+func (lbc *loadBalancerController) getCanaryEndpoints(s *api.Service, servicePort *api.ServicePort) ([]string, int) {
+	annotations := serviceAnnotations(s.ObjectMeta.Annotations)
+	name, ok := annotations.getCanary()
+	if !ok {
+		return nil, 0
+	}
+	val, _ := annotations.getCanaryWeight()
+	percent, err := strconv.Atoi(val)
+	if err != nil || percent < 0 || percent > 100 {
+		logWarningf("Ignoring the canary of service %v, invalid %v %q", s.Name, lbCanaryWeight, val)
+		return nil, 0
+	}
+	obj, exists, err := lbc.svcLister.Store.GetByKey(fmt.Sprintf("%v/%v", s.Namespace, name))
+	if err != nil || !exists {
+		logWarningf("Canary %v of service %v not found", name, s.Name)
+		return nil, 0
+	}
+	canary := obj.(*api.Service)
+	for i := range canary.Spec.Ports {
+		canaryPort := &canary.Spec.Ports[i]
+		if canaryPort.Port != servicePort.Port {
+			continue
+		}
+		if lbc.forwardServices {
+			return []string{hostPort(canary.Spec.ClusterIP, canaryPort.Port)}, percent
+		}
+		return lbc.getEndpoints(canary, canaryPort), percent
+	}
+	logWarningf("Canary %v of service %v has no port %v", name, s.Name, servicePort.Port)
+	return nil, 0
+}
+
+// splitWeights returns the weights of the primary and canary endpoints of a
+// backend by ip, so that the canary endpoints get percent of the traffic
+// together. Weights are reduced to the range of haproxy, which may round
+// the split when there are many endpoints.
+func splitWeights(primary, canary []string, percent int) map[string]string {
+	wp, wc := (100-percent)*len(canary), percent*len(primary)
+	if g := gcd(wp, wc); g > 1 {
+		wp, wc = wp/g, wc/g
+	}
+	m := wp
+	if wc > m {
+		m = wc
+	}
+	if m > maxWeight {
+		wp, wc = scaleWeight(wp, m), scaleWeight(wc, m)
+	}
+	weights := map[string]string{}
+	for _, eps := range []struct {
+		endpoints []string
+		weight    int
+	}{{primary, wp}, {canary, wc}} {
+		for _, ep := range eps.endpoints {
+			if host, _, err := net.SplitHostPort(ep); err == nil {
+				weights[host] = strconv.Itoa(eps.weight)
+			}
+		}
+	}
+	return weights
+}
+
+// scaleWeight scales w from the range 0-m to 0-maxWeight, keeping non zero
+// weights above 0.
+func scaleWeight(w, m int) int {
+	scaled := (w*maxWeight + m/2) / m
+	if scaled == 0 && w > 0 {
+		return 1
+	}
+	return scaled
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/util/intstr"
+)
+
+func TestSplitWeights(t *testing.T) {
+	testCases := []struct {
+		primary, canary []string
+		percent         int
+		expected        map[string]string
+	}{
+		{
+			[]string{"1.1.1.1:80", "2.2.2.2:80"}, []string{"3.3.3.3:80"}, 10,
+			map[string]string{"1.1.1.1": "9", "2.2.2.2": "9", "3.3.3.3": "2"},
+		},
+		{
+			[]string{"1.1.1.1:80"}, []string{"3.3.3.3:80"}, 0,
+			map[string]string{"1.1.1.1": "1", "3.3.3.3": "0"},
+		},
+		{
+			[]string{"1.1.1.1:80"}, []string{"3.3.3.3:80"}, 100,
+			map[string]string{"1.1.1.1": "0", "3.3.3.3": "1"},
+		},
+		{
+			// 99*3 is above the haproxy maximum.
+			[]string{"1.1.1.1:80"}, []string{"3.3.3.3:80", "4.4.4.4:80", "5.5.5.5:80"}, 1,
+			map[string]string{"1.1.1.1": "256", "3.3.3.3": "1", "4.4.4.4": "1", "5.5.5.5": "1"},
+		},
+	}
+	for _, tc := range testCases {
+		if weights := splitWeights(tc.primary, tc.canary, tc.percent); !reflect.DeepEqual(weights, tc.expected) {
+			t.Errorf("Expected weights %v for %v%% of %v, got %v", tc.expected, tc.percent, tc.canary, weights)
+		}
+	}
+}
+
+func TestCanary(t *testing.T) {
+	newService := func(name string, annotations map[string]string) *api.Service {
+		return &api.Service{
+			ObjectMeta: api.ObjectMeta{Name: name, Namespace: api.NamespaceDefault, Annotations: annotations},
+			Spec:       api.ServiceSpec{Ports: []api.ServicePort{{Port: 80, TargetPort: intstr.FromInt(8080)}}},
+		}
+	}
+	web := newService("web", map[string]string{lbCanary: "web-canary", lbCanaryWeight: "10"})
+	canary := newService("web-canary", nil)
+	ports := []api.EndpointPort{{Port: 8080}}
+	flb := newFakeLoadBalancerController([]*api.Endpoints{
+		getEndpoints(web, []api.EndpointAddress{{IP: "1.1.1.1"}, {IP: "2.2.2.2"}}, ports),
+		getEndpoints(canary, []api.EndpointAddress{{IP: "3.3.3.3"}}, ports),
+	}, []*api.Service{web, canary})
+	flb.cfg = &loadBalancerConfig{}
+
+	httpSvc, _, _ := flb.getServices()
+	expected := []backendServer{
+		{Name: "1.1.1.1:8080", Addr: "1.1.1.1:8080", Weight: "9"},
+		{Name: "2.2.2.2:8080", Addr: "2.2.2.2:8080", Weight: "9"},
+		{Name: "3.3.3.3:8080", Addr: "3.3.3.3:8080", Weight: "2"},
+	}
+	for _, svc := range httpSvc {
+		if svc.Name == "web" && !reflect.DeepEqual(svc.Servers, expected) {
+			t.Fatalf("Unexpected servers %+v, expected %+v", svc.Servers, expected)
+		}
+		if svc.Name == "web-canary" && len(svc.Servers) != 1 {
+			t.Fatalf("Expected the canary to keep its own backend, got %+v", svc.Servers)
+		}
+	}
+
+	web.Annotations[lbCanaryWeight] = "oops"
+	httpSvc, _, _ = flb.getServices()
+	if httpSvc[0].Name != "web" || len(httpSvc[0].Servers) != 2 {
+		t.Fatalf("Expected an invalid canary weight to leave the canary out, got %+v", httpSvc[0].Servers)
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/kubernetes/pkg/util"
+	"k8s.io/kubernetes/pkg/util/sets"
+)
+
+var (
+	// resyncResources are the resources of --resync-periods.
+	resyncResources = sets.NewString("services", "endpoints", "secrets", "configmaps", "nodes", "pods")
+
+	// resyncPeriods overrides --resync-period by resource.
+	resyncPeriods map[string]time.Duration
+
+	// apiWrites limits the rate of the writes of the controller, nil if
+	// they aren't limited.
+	apiWrites util.RateLimiter
+)
+
+// parseResyncPeriods parses a comma separated list of resource=period, eg:
+// endpoints=1m,secrets=1h.
+func parseResyncPeriods(val string) (map[string]time.Duration, error) {
+	periods := map[string]time.Duration{}
+	for _, entry := range strings.Split(val, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || !resyncResources.Has(parts[0]) {
+			return nil, fmt.Errorf("invalid resync period %q, expected <resource>=<period> with a resource out of %v", entry, strings.Join(resyncResources.List(), ", "))
+		}
+		period, err := time.ParseDuration(parts[1])
+		if err != nil || period < 0 {
+			return nil, fmt.Errorf("invalid resync period of %v %q", parts[0], parts[1])
+		}
+		periods[parts[0]] = period
+	}
+	return periods, nil
+}
+
+// resyncPeriodOf returns the resync period of the informer of resource.
+func resyncPeriodOf(resource string) time.Duration {
+	if period, ok := resyncPeriods[resource]; ok {
+		return period
+	}
+	return *resyncPeriod
+}
+
+// writeAPI runs an api call writing an object, eg: the status annotation of
+// a service, once apiWrites allows it, retrying it like retryAPI. Retries
+// wait for apiWrites too.
+func writeAPI(call func() error) error {
+	return retryAPI(func() error {
+		if apiWrites != nil {
+			apiWrites.Accept()
+		}
+		return call()
+	})
+}
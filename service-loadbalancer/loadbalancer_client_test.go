@@ -0,0 +1,78 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/util"
+)
+
+func TestResyncPeriods(t *testing.T) {
+	periods, err := parseResyncPeriods("endpoints=1m, secrets=1h,pods=0s")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]time.Duration{"endpoints": time.Minute, "secrets": time.Hour, "pods": 0}
+	if !reflect.DeepEqual(periods, expected) {
+		t.Errorf("Expected %v, got %v", expected, periods)
+	}
+	for _, val := range []string{"ingresses=1m", "endpoints", "endpoints=soon", "secrets=-1m"} {
+		if _, err := parseResyncPeriods(val); err == nil {
+			t.Errorf("Expected %q to be refused", val)
+		}
+	}
+
+	defer func(p map[string]time.Duration) { resyncPeriods = p }(resyncPeriods)
+	resyncPeriods = periods
+	if resyncPeriodOf("secrets") != time.Hour || resyncPeriodOf("pods") != 0 || resyncPeriodOf("services") != *resyncPeriod {
+		t.Errorf("Unexpected resync periods %v %v %v", resyncPeriodOf("secrets"), resyncPeriodOf("pods"), resyncPeriodOf("services"))
+	}
+}
+
+// countingRateLimiter counts the writes it lets through.
+type countingRateLimiter struct {
+	util.RateLimiter
+	accepted int
+}
+
+func (c *countingRateLimiter) Accept() {
+	c.accepted++
+}
+
+func TestWriteAPI(t *testing.T) {
+	defer func(l util.RateLimiter, b time.Duration) { apiWrites, apiBackoff.Initial = l, b }(apiWrites, apiBackoff.Initial)
+	limiter := &countingRateLimiter{}
+	apiWrites, apiBackoff.Initial = limiter, time.Millisecond
+
+	calls := 0
+	err := writeAPI(func() error {
+		if calls++; calls < 2 {
+			return fmt.Errorf("connection refused")
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("Expected the write to be retried, got %v after %v calls", err, calls)
+	}
+	if limiter.accepted != 2 {
+		t.Errorf("Expected every attempt to be rate limited, got %v", limiter.accepted)
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// defaultCompressionTypes are the mime types of the responses compressed by
+// default, text formats worth the cpu.
+const defaultCompressionTypes = "text/html,text/plain,text/css,application/javascript,application/json"
+
+// mimeTypePattern matches the mime types of compressed responses.
+var mimeTypePattern = regexp.MustCompile(`^[a-z0-9][-a-z0-9.+]*/[-a-z0-9.+*]+$`)
+
+// compression compresses the responses of Types with gzip, if Enabled and the
+// client accepts it. MinSize is the size in bytes under which responses are
+// sent as they are, unless it is zero.
+type compression struct {
+	Enabled bool
+	Types   []string
+	MinSize int64
+}
+
+// parseCompressionTypes parses a comma separated list of mime types.
+func parseCompressionTypes(val string) ([]string, error) {
+	var types []string
+	for _, t := range strings.Split(val, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" {
+			continue
+		}
+		if !mimeTypePattern.MatchString(t) {
+			return nil, fmt.Errorf("invalid mime type %q", t)
+		}
+		types = append(types, t)
+	}
+	if len(types) == 0 {
+		return nil, fmt.Errorf("no mime types in %q", val)
+	}
+	return types, nil
+}
+
+// newCompression returns the default compression of http services.
+func newCompression(enabled bool, types, minSize string) (compression, error) {
+	c := compression{Enabled: enabled}
+	var err error
+	if c.Types, err = parseCompressionTypes(types); err != nil {
+		return c, err
+	}
+	if minSize != "" && minSize != "0" {
+		n, ok := parseBodySize(minSize)
+		if !ok {
+			return c, fmt.Errorf("invalid minimum size %q", minSize)
+		}
+		c.MinSize = n
+	}
+	return c, nil
+}
+
+// getCompression returns the compression of the responses of s, def unless
+// its compression annotations override it.
+func getCompression(s *api.Service, def compression) compression {
+	annotations := serviceAnnotations(s.ObjectMeta.Annotations)
+	c := def
+	if val, ok := annotations.getCompression(); ok {
+		if b, err := strconv.ParseBool(val); err == nil {
+			c.Enabled = b
+		} else {
+			logWarningf("Ignoring invalid %v %q of service %v", lbCompression, val, s.Name)
+		}
+	}
+	if val, ok := annotations.getCompressionTypes(); ok {
+		if types, err := parseCompressionTypes(val); err == nil {
+			c.Types = types
+		} else {
+			logWarningf("Ignoring invalid %v %q of service %v", lbCompressionTypes, val, s.Name)
+		}
+	}
+	if !c.Enabled {
+		return compression{}
+	}
+	if len(c.Types) == 0 {
+		c.Types, _ = parseCompressionTypes(defaultCompressionTypes)
+	}
+	return c
+}
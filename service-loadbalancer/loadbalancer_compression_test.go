@@ -0,0 +1,92 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestNewCompression(t *testing.T) {
+	c, err := newCompression(true, "text/html, Application/JSON", "1k")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := (compression{Enabled: true, Types: []string{"text/html", "application/json"}, MinSize: 1024}); !reflect.DeepEqual(c, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, c)
+	}
+	for _, args := range [][2]string{{"", ""}, {"text html", ""}, {defaultCompressionTypes, "small"}} {
+		if _, err := newCompression(true, args[0], args[1]); err == nil {
+			t.Errorf("Expected an error for types %q and minimum size %q", args[0], args[1])
+		}
+	}
+}
+
+func TestCompression(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	flb.defaultCompression, _ = newCompression(false, defaultCompressionTypes, "")
+	for name, annotations := range map[string]map[string]string{
+		"default/svc-1": {lbCompression: "true", lbCompressionTypes: "application/json"},
+		"default/svc-2": {lbCompression: "maybe"},
+	} {
+		obj, _, _ := flb.svcLister.Store.GetByKey(name)
+		obj.(*api.Service).ObjectMeta.Annotations = annotations
+	}
+
+	httpSvc, _, _ := flb.getServices()
+	backends := 0
+	for _, svc := range httpSvc {
+		if !strings.HasPrefix(svc.Name, "svc-1") {
+			if svc.Compression.Enabled {
+				t.Fatalf("Expected %v to keep the default, got %+v", svc.Name, svc.Compression)
+			}
+			continue
+		}
+		backends++
+		if !svc.Compression.Enabled || !reflect.DeepEqual(svc.Compression.Types, []string{"application/json"}) {
+			t.Fatalf("Expected %v to compress json, got %+v", svc.Name, svc.Compression)
+		}
+	}
+	config, err := flb.backend.render(map[string][]service{"http": httpSvc})
+	if err != nil {
+		t.Fatalf("Unexpected error rendering the config: %v", err)
+	}
+	if expected := "    compression algo gzip\n    compression type application/json\n"; strings.Count(string(config), expected) != backends {
+		t.Fatalf("Expected %q in the %v backends of svc-1:\n%s", expected, backends, config)
+	}
+
+	flb.defaultCompression.Enabled = true
+	flb.defaultCompression.MinSize = 1024
+	obj, _, _ := flb.svcLister.Store.GetByKey("default/svc-1")
+	obj.(*api.Service).ObjectMeta.Annotations = map[string]string{lbCompression: "false"}
+	httpSvc, _, _ = flb.getServices()
+	for _, svc := range httpSvc {
+		if svc.Compression.Enabled == strings.HasPrefix(svc.Name, "svc-1") {
+			t.Fatalf("Expected only svc-1 to opt out of compression, got %+v", svc)
+		}
+	}
+	config, err = flb.backend.render(map[string][]service{"http": httpSvc})
+	if err != nil {
+		t.Fatalf("Unexpected error rendering the config: %v", err)
+	}
+	if !strings.Contains(string(config), "compression type "+strings.Replace(defaultCompressionTypes, ",", " ", -1)+"\n    compression minsize-res 1024\n") {
+		t.Fatalf("Expected the default compression in the backends of svc-2:\n%s", config)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/util/sets"
+)
+
+// annotationPrefix is left out of the keys of the defaults ConfigMap, which
+// can't hold slashes.
+const annotationPrefix = "serviceloadbalancer/"
+
+// defaultableAnnotations are the annotations the ConfigMap of --service-defaults
+// sets for every service: timeouts and limits, health checks, affinity,
+// logging, compression and the like. Annotations naming objects of a
+// service, like its host or secrets, have no default.
+var defaultableAnnotations = sets.NewString(
+	lbAlgorithmKey, lbMaxConn, lbMaxQueue,
+	lbTimeoutConnect, lbTimeoutServer, lbTimeoutQueue, lbTimeoutClient,
+	lbCheckPath, lbCheckStatus, lbCheckInterval, lbCheckRise, lbCheckFall,
+	lbErrorLimit, lbErrorCooldown,
+	lbAffinity, lbCookieName, lbCookieMaxAge,
+	lbAccessLog, lbTCPLog,
+	lbCompression, lbCompressionTypes, lbMaxBodySize,
+	lbRateLimit, lbRateLimitPeriod, lbRateLimitStatus,
+	lbSslRedirect, lbSslRedirectCode,
+)
+
+// getServiceDefaults returns the annotations of every service from the
+// ConfigMap of --service-defaults, whose keys are annotations without the
+// serviceloadbalancer/ prefix, eg: lb.timeoutServer. Keys of other
+// annotations are ignored.
+func (lbc *loadBalancerController) getServiceDefaults() map[string]string {
+	if lbc.serviceDefaults == "" {
+		return nil
+	}
+	configMap, err := lbc.getConfigMap(lbc.serviceDefaults)
+	if err != nil {
+		logWarningf("Ignoring the defaults of services: %v", err)
+		return nil
+	}
+	defaults := map[string]string{}
+	ignored := []string{}
+	for key, val := range configMap.Data {
+		if !defaultableAnnotations.Has(annotationPrefix + key) {
+			ignored = append(ignored, key)
+			continue
+		}
+		defaults[annotationPrefix+key] = val
+	}
+	if len(ignored) > 0 && configMap.ResourceVersion != lbc.serviceDefaultsVersion {
+		sort.Strings(ignored)
+		logWarningf("Ignoring the keys %v of the defaults of services %v, expected some of %v",
+			strings.Join(ignored, ","), lbc.serviceDefaults, strings.Join(defaultableAnnotations.List(), ","))
+	}
+	lbc.serviceDefaultsVersion = configMap.ResourceVersion
+	return defaults
+}
+
+// withDefaults returns annotations over defaults, without changing either.
+func withDefaults(annotations, defaults map[string]string) map[string]string {
+	if len(defaults) == 0 {
+		return annotations
+	}
+	merged := make(map[string]string, len(annotations)+len(defaults))
+	for key, val := range defaults {
+		merged[key] = val
+	}
+	for key, val := range annotations {
+		merged[key] = val
+	}
+	return merged
+}
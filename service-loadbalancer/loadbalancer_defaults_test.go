@@ -0,0 +1,68 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+)
+
+func TestServiceDefaults(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	flb.serviceDefaults = "kube-system/lb-defaults"
+	flb.configMapStore = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	flb.configMapStore.Add(&api.ConfigMap{
+		ObjectMeta: api.ObjectMeta{Name: "lb-defaults", Namespace: "kube-system", ResourceVersion: "1"},
+		Data: map[string]string{
+			"lb.timeoutServer": "2m",
+			"lb.maxconn":       "100",
+			"lb.host":          "ignored.example.com",
+		},
+	})
+	obj, _, _ := flb.svcLister.Store.GetByKey("default/svc-1")
+	obj.(*api.Service).ObjectMeta.Annotations = map[string]string{lbTimeoutServer: "30s"}
+
+	httpSvc, _, _ := flb.getServices()
+	if len(httpSvc) == 0 {
+		t.Fatalf("Expected http services")
+	}
+	for _, svc := range httpSvc {
+		expected := "120s"
+		if svc.objectKey == "default/svc-1" {
+			expected = "30s"
+		}
+		if svc.Limits.TimeoutServer != expected || svc.Limits.MaxConn != 100 {
+			t.Errorf("Expected %v to time out after %v with 100 connections, got %+v", svc.Name, expected, svc.Limits)
+		}
+		if svc.Host != "" {
+			t.Errorf("Expected the host of %v not to have a default, got %v", svc.Name, svc.Host)
+		}
+	}
+	if annotations := obj.(*api.Service).ObjectMeta.Annotations; len(annotations) != 1 {
+		t.Errorf("Expected the annotations in the store to be left as they are, got %v", annotations)
+	}
+
+	flb.configMapStore.Delete(&api.ConfigMap{ObjectMeta: api.ObjectMeta{Name: "lb-defaults", Namespace: "kube-system"}})
+	httpSvc, _, _ = flb.getServices()
+	for _, svc := range httpSvc {
+		if svc.Limits.MaxConn != 0 {
+			t.Errorf("Expected no defaults without the ConfigMap, got %+v", svc.Limits)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const (
+	// configPath is the prefix of the admin api of the config.
+	configPath = "/admin/config"
+
+	// diffContext is the number of unchanged lines around changes in diffs.
+	diffContext = 3
+
+	// maxDiffCells bounds the size of the table comparing the changed lines
+	// of two configs. Beyond it, they are shown as entirely replaced.
+	maxDiffCells = 4 << 20
+)
+
+// configHandler serves the config of the loadbalancer, for clients sending
+// token as a bearer token:
+//
+// GET /admin/config/running returns the applied config.
+// GET /admin/config/diff returns the differences between the applied config
+// and the one the controller would apply now, as a unified diff.
+type configHandler struct {
+	token string
+	// running is the path of the applied config, and pending renders the
+	// config of the next sync.
+	running string
+	pending func() ([]byte, error)
+}
+
+func (c *configHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !authorized(w, r, c.token) {
+		return
+	}
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, configPath), "/")
+	if path != "running" && path != "diff" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	running, err := ioutil.ReadFile(c.running)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if path == "running" {
+		w.Write(running)
+		return
+	}
+	pending, err := c.pending()
+	if err == errDeferredSync {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write([]byte(unifiedDiff(c.running, "pending", running, pending)))
+}
+
+// pendingConfig renders the config from the current state of the cluster,
+// like the next sync would.
+func (lbc *loadBalancerController) pendingConfig() ([]byte, error) {
+	if !lbc.informersSynced() {
+		return nil, errDeferredSync
+	}
+	lbc.syncLock.Lock()
+	defer lbc.syncLock.Unlock()
+	httpSvc, httpsTermSvc, tcpSvc := lbc.getServices()
+	return lbc.backend.render(
+		map[string][]service{
+			"http":      httpSvc,
+			"httpsTerm": httpsTermSvc,
+			"tcp":       tcpSvc,
+		})
+}
+
+// diffLine is a line of a diff, unchanged, removed or added, with the
+// number of lines of a and b before it.
+type diffLine struct {
+	op   byte
+	text string
+	a, b int
+}
+
+// unifiedDiff returns the differences between a and b in the unified format,
+// or nothing if they are equal.
+func unifiedDiff(nameA, nameB string, a, b []byte) string {
+	if bytes.Equal(a, b) {
+		return ""
+	}
+	lines := diffLines(splitLines(a), splitLines(b))
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- %v\n+++ %v\n", nameA, nameB)
+	for start := 0; start < len(lines); {
+		if lines[start].op == ' ' {
+			start++
+			continue
+		}
+		// extend the hunk over changes closer than twice the context
+		end := start
+		for i := start; i < len(lines) && i <= end+2*diffContext; i++ {
+			if lines[i].op != ' ' {
+				end = i
+			}
+		}
+		first, last := start-diffContext, end+diffContext
+		if first < 0 {
+			first = 0
+		}
+		if last >= len(lines) {
+			last = len(lines) - 1
+		}
+		hunk := lines[first : last+1]
+		var lenA, lenB int
+		for _, line := range hunk {
+			if line.op != '+' {
+				lenA++
+			}
+			if line.op != '-' {
+				lenB++
+			}
+		}
+		startA, startB := hunk[0].a, hunk[0].b
+		if lenA > 0 {
+			startA++
+		}
+		if lenB > 0 {
+			startB++
+		}
+		fmt.Fprintf(&out, "@@ -%v,%v +%v,%v @@\n", startA, lenA, startB, lenB)
+		for _, line := range hunk {
+			fmt.Fprintf(&out, "%c%v\n", line.op, line.text)
+		}
+		start = last + 1
+	}
+	return out.String()
+}
+
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// diffLines returns the lines of a and b, as the longest common
+// subsequence of unchanged lines between the removed and added ones.
+func diffLines(a, b []string) []diffLine {
+	// lines shared at the start and the end are unchanged
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	// common[i][j] is the length of the longest common subsequence of
+	// ma[i:] and mb[j:]
+	var common [][]int
+	if (len(ma)+1)*(len(mb)+1) <= maxDiffCells {
+		common = make([][]int, len(ma)+1)
+		for i := range common {
+			common[i] = make([]int, len(mb)+1)
+		}
+		for i := len(ma) - 1; i >= 0; i-- {
+			for j := len(mb) - 1; j >= 0; j-- {
+				if ma[i] == mb[j] {
+					common[i][j] = common[i+1][j+1] + 1
+				} else if common[i+1][j] >= common[i][j+1] {
+					common[i][j] = common[i+1][j]
+				} else {
+					common[i][j] = common[i][j+1]
+				}
+			}
+		}
+	}
+
+	var lines []diffLine
+	ia, ib := 0, 0
+	add := func(op byte, text string) {
+		lines = append(lines, diffLine{op, text, ia, ib})
+		if op != '+' {
+			ia++
+		}
+		if op != '-' {
+			ib++
+		}
+	}
+	for _, line := range a[:prefix] {
+		add(' ', line)
+	}
+	i, j := 0, 0
+	for common != nil && i < len(ma) && j < len(mb) {
+		switch {
+		case ma[i] == mb[j]:
+			add(' ', ma[i])
+			i++
+			j++
+		case common[i+1][j] >= common[i][j+1]:
+			add('-', ma[i])
+			i++
+		default:
+			add('+', mb[j])
+			j++
+		}
+	}
+	for ; i < len(ma); i++ {
+		add('-', ma[i])
+	}
+	for ; j < len(mb); j++ {
+		add('+', mb[j])
+	}
+	for _, line := range a[len(a)-suffix:] {
+		add(' ', line)
+	}
+	return lines
+}
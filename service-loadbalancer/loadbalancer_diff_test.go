@@ -0,0 +1,107 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n"
+	b := "1\n2\n3\n4\nfour\n5\n6\n7\n9\n10\n11\n12\n13\n14\n15\n16\nsixteen\n"
+	expected := `--- a
++++ b
+@@ -2,10 +2,10 @@
+ 2
+ 3
+ 4
++four
+ 5
+ 6
+ 7
+-8
+ 9
+ 10
+ 11
+@@ -14,3 +14,4 @@
+ 14
+ 15
+ 16
++sixteen
+`
+	if diff := unifiedDiff("a", "b", []byte(a), []byte(b)); diff != expected {
+		t.Fatalf("Expected diff:\n%v\ngot:\n%v", expected, diff)
+	}
+	if diff := unifiedDiff("a", "b", []byte(a), []byte(a)); diff != "" {
+		t.Fatalf("Expected no diff of equal configs, got:\n%v", diff)
+	}
+	if diff := unifiedDiff("a", "b", nil, []byte("1\n")); diff != "--- a\n+++ b\n@@ -0,0 +1,1 @@\n+1\n" {
+		t.Fatalf("Expected an added line, got:\n%v", diff)
+	}
+}
+
+func TestConfigHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	running := filepath.Join(dir, "haproxy.cfg")
+	if err := ioutil.WriteFile(running, []byte("global\n    daemon\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pending := "global\n    daemon\n    maxconn 100\n"
+	h := &configHandler{token: "secret", running: running, pending: func() ([]byte, error) {
+		return []byte(pending), nil
+	}}
+	serve := func(method, path, token string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest(method, "http://localhost:8081"+path, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := serve("GET", "/admin/config/running", "wrong"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 for a wrong token, got %v", w.Code)
+	}
+	if w := serve("GET", "/admin/config/pending", "secret"); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 for an unknown path, got %v", w.Code)
+	}
+	if w := serve("POST", "/admin/config/diff", "secret"); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("Expected 405 for a POST, got %v", w.Code)
+	}
+	if w := serve("GET", "/admin/config/running", "secret"); w.Code != http.StatusOK || w.Body.String() != "global\n    daemon\n" {
+		t.Fatalf("Expected the running config, got %v %q", w.Code, w.Body.String())
+	}
+	w := serve("GET", "/admin/config/diff", "secret")
+	if w.Code != http.StatusOK || !strings.HasSuffix(w.Body.String(), "@@ -1,2 +1,3 @@\n global\n     daemon\n+    maxconn 100\n") {
+		t.Fatalf("Expected the pending maxconn in the diff, got %v %q", w.Code, w.Body.String())
+	}
+	pending = "global\n    daemon\n"
+	if w := serve("GET", "/admin/config/diff", "secret"); w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Fatalf("Expected an empty diff, got %v %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/util/sets"
+)
+
+// dnsOwnerPrefix is prepended to a host for the name of its ownership TXT
+// record. A CNAME can't share its name with a TXT record.
+const dnsOwnerPrefix = "_servicelb."
+
+// dnsRecord is a record set of a zone. Names have no trailing dot.
+type dnsRecord struct {
+	Name   string
+	Type   string
+	TTL    int
+	Values []string
+}
+
+// dnsProvider manages the records of a single zone.
+type dnsProvider interface {
+	// records returns the records of the zone.
+	records() ([]dnsRecord, error)
+
+	// apply deletes and adds records in a single change. Deletions must
+	// match the current records exactly.
+	apply(deletions, additions []dnsRecord) error
+}
+
+// newDNSProvider returns the named provider managing zone.
+func newDNSProvider(name, zone, project string) (dnsProvider, error) {
+	switch name {
+	case "route53":
+		return newRoute53Provider(zone)
+	case "clouddns":
+		return newCloudDNSProvider(zone, project)
+	}
+	return nil, fmt.Errorf("unknown dns provider %q, expected route53 or clouddns", name)
+}
+
+// dnsPublisher points the hosts of services at the loadbalancer. Every host
+// it manages has a TXT record naming its owner, so that several controllers
+// sharing a zone only change their own records, and records created by
+// hand are never touched.
+type dnsPublisher struct {
+	provider dnsProvider
+	domain   string
+	owner    string
+	ttl      int
+
+	// applied identifies the hosts and target of the last successful
+	// sync, changes are only looked up when they differ.
+	applied string
+}
+
+func newDNSPublisher(provider dnsProvider, domain, owner string, ttl int) *dnsPublisher {
+	return &dnsPublisher{provider: provider, domain: strings.TrimSuffix(domain, "."), owner: owner, ttl: ttl}
+}
+
+// ownerValue is the value of the ownership TXT records of the publisher.
+func (p *dnsPublisher) ownerValue() string {
+	return fmt.Sprintf("\"heritage=service-loadbalancer,owner=%v\"", p.owner)
+}
+
+// targetRecord returns the record pointing host at target, an ip or a
+// hostname.
+func (p *dnsPublisher) targetRecord(host, target string) dnsRecord {
+	record := dnsRecord{Name: host, Type: "CNAME", TTL: p.ttl, Values: []string{target}}
+	if ip := net.ParseIP(target); ip != nil {
+		record.Type = "A"
+		if ip.To4() == nil {
+			record.Type = "AAAA"
+		}
+	}
+	return record
+}
+
+// inDomain reports whether host belongs to the zone of the publisher.
+func (p *dnsPublisher) inDomain(host string) bool {
+	return host == p.domain || strings.HasSuffix(host, "."+p.domain)
+}
+
+// sync points hosts at target, and removes the records of the hosts it owns
+// that aren't in hosts anymore.
+func (p *dnsPublisher) sync(hosts sets.String, target string) error {
+	wanted := sets.NewString()
+	for _, host := range hosts.List() {
+		switch {
+		case hostKind(host) != exactHost:
+			logV(2).Infof("Not publishing wildcard host %v", host)
+		case !p.inDomain(host):
+			logV(2).Infof("Not publishing %v, it is not in %v", host, p.domain)
+		default:
+			wanted.Insert(host)
+		}
+	}
+	id := fmt.Sprintf("%v %v", wanted.List(), target)
+	if id == p.applied {
+		return nil
+	}
+
+	current, err := p.provider.records()
+	if err != nil {
+		return err
+	}
+	addresses := map[string][]dnsRecord{}
+	owners := map[string]dnsRecord{}
+	for _, record := range current {
+		switch record.Type {
+		case "A", "AAAA", "CNAME":
+			addresses[record.Name] = append(addresses[record.Name], record)
+		case "TXT":
+			if strings.HasPrefix(record.Name, dnsOwnerPrefix) {
+				owners[strings.TrimPrefix(record.Name, dnsOwnerPrefix)] = record
+			}
+		}
+	}
+	owned := func(host string) bool {
+		owner, ok := owners[host]
+		return ok && reflect.DeepEqual(owner.Values, []string{p.ownerValue()})
+	}
+
+	var deletions, additions []dnsRecord
+	for _, host := range wanted.List() {
+		_, claimed := owners[host]
+		if (claimed || len(addresses[host]) > 0) && !owned(host) {
+			logWarningf("Not publishing %v, its records are not owned by %v", host, p.owner)
+			continue
+		}
+		record := p.targetRecord(host, target)
+		found := false
+		for _, existing := range addresses[host] {
+			if reflect.DeepEqual(existing, record) {
+				found = true
+			} else {
+				deletions = append(deletions, existing)
+			}
+		}
+		if !found {
+			additions = append(additions, record)
+		}
+		if !claimed {
+			additions = append(additions, dnsRecord{Name: dnsOwnerPrefix + host, Type: "TXT", TTL: p.ttl, Values: []string{p.ownerValue()}})
+		}
+	}
+	var stale []string
+	for host := range owners {
+		if !wanted.Has(host) && owned(host) {
+			stale = append(stale, host)
+		}
+	}
+	sort.Strings(stale)
+	for _, host := range stale {
+		deletions = append(deletions, addresses[host]...)
+		deletions = append(deletions, owners[host])
+	}
+
+	if len(deletions) > 0 || len(additions) > 0 {
+		logInfof("Updating dns records, deleting %v and adding %v", deletions, additions)
+		if err := p.provider.apply(deletions, additions); err != nil {
+			return err
+		}
+	}
+	p.applied = id
+	return nil
+}
+
+// publishDNS points the hosts of the http services at the loadbalancer.
+func (lbc *loadBalancerController) publishDNS(svcGroups ...[]service) {
+	if lbc.dns == nil || lbc.publishAddress == "" || !lbc.leading() {
+		return
+	}
+	hosts := sets.NewString()
+	for _, group := range svcGroups {
+		for _, svc := range group {
+			if svc.Host != "" {
+				hosts.Insert(svc.Host)
+			}
+		}
+	}
+	if err := lbc.dns.sync(hosts, lbc.publishAddress); err != nil {
+		logWarningf("Unable to publish dns records: %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	cloudDNSEndpoint = "https://www.googleapis.com/dns/v1"
+	gceMetadata      = "http://metadata.google.internal/computeMetadata/v1"
+)
+
+// cloudDNSProvider manages a Google Cloud DNS managed zone through its REST
+// API, with the token of the service account of the GCE instance.
+type cloudDNSProvider struct {
+	endpoint string
+	metadata string
+	project  string
+	zone     string
+	client   *http.Client
+}
+
+func newCloudDNSProvider(zone, project string) (*cloudDNSProvider, error) {
+	p := &cloudDNSProvider{
+		endpoint: cloudDNSEndpoint,
+		metadata: gceMetadata,
+		project:  project,
+		zone:     zone,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+	if p.project == "" {
+		id, err := p.getMetadata("/project/project-id")
+		if err != nil {
+			return nil, fmt.Errorf("unable to get the project from the metadata server, use --dns-project: %v", err)
+		}
+		p.project = string(id)
+	}
+	return p, nil
+}
+
+type cloudDNSRecordSet struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	TTL     int      `json:"ttl"`
+	Rrdatas []string `json:"rrdatas"`
+}
+
+type cloudDNSListResponse struct {
+	Rrsets        []cloudDNSRecordSet `json:"rrsets"`
+	NextPageToken string              `json:"nextPageToken"`
+}
+
+type cloudDNSChange struct {
+	Additions []cloudDNSRecordSet `json:"additions,omitempty"`
+	Deletions []cloudDNSRecordSet `json:"deletions,omitempty"`
+}
+
+// getMetadata returns the value at path of the GCE metadata server.
+func (p *cloudDNSProvider) getMetadata(path string) ([]byte, error) {
+	req, err := http.NewRequest("GET", p.metadata+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata %v: %v", path, resp.Status)
+	}
+	return data, nil
+}
+
+// token returns an access token of the default service account. Tokens are
+// cached by the metadata server, so it's asked for every request.
+func (p *cloudDNSProvider) token() (string, error) {
+	data, err := p.getMetadata("/instance/service-accounts/default/token")
+	if err != nil {
+		return "", err
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(data, &token); err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+// fqdn adds the trailing dot Cloud DNS expects to names.
+func fqdn(name string) string {
+	return strings.TrimSuffix(name, ".") + "."
+}
+
+func toCloudDNS(record dnsRecord) cloudDNSRecordSet {
+	set := cloudDNSRecordSet{Name: fqdn(record.Name), Type: record.Type, TTL: record.TTL, Rrdatas: record.Values}
+	if record.Type == "CNAME" {
+		set.Rrdatas = nil
+		for _, value := range record.Values {
+			set.Rrdatas = append(set.Rrdatas, fqdn(value))
+		}
+	}
+	return set
+}
+
+func (p *cloudDNSProvider) records() ([]dnsRecord, error) {
+	var records []dnsRecord
+	query := url.Values{}
+	for {
+		var resp cloudDNSListResponse
+		if err := p.do("GET", "/rrsets?"+query.Encode(), nil, &resp); err != nil {
+			return nil, err
+		}
+		for _, set := range resp.Rrsets {
+			record := dnsRecord{Name: strings.TrimSuffix(set.Name, "."), Type: set.Type, TTL: set.TTL, Values: set.Rrdatas}
+			if set.Type == "CNAME" {
+				record.Values = nil
+				for _, value := range set.Rrdatas {
+					record.Values = append(record.Values, strings.TrimSuffix(value, "."))
+				}
+			}
+			records = append(records, record)
+		}
+		if resp.NextPageToken == "" {
+			return records, nil
+		}
+		query = url.Values{"pageToken": {resp.NextPageToken}}
+	}
+}
+
+func (p *cloudDNSProvider) apply(deletions, additions []dnsRecord) error {
+	var change cloudDNSChange
+	for _, record := range deletions {
+		change.Deletions = append(change.Deletions, toCloudDNS(record))
+	}
+	for _, record := range additions {
+		change.Additions = append(change.Additions, toCloudDNS(record))
+	}
+	body, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	return p.do("POST", "/changes", bytes.NewReader(body), nil)
+}
+
+// do sends an authorized request to the managed zone, decoding the json
+// response into out.
+func (p *cloudDNSProvider) do(method, path string, body io.Reader, out interface{}) error {
+	token, err := p.token()
+	if err != nil {
+		return fmt.Errorf("unable to get a token from the metadata server: %v", err)
+	}
+	u := fmt.Sprintf("%v/projects/%v/managedZones/%v%v", p.endpoint, p.project, p.zone, path)
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("clouddns %v %v: %v %s", method, path, resp.Status, data)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,266 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	route53Endpoint = "https://route53.amazonaws.com"
+	route53Version  = "2013-04-01"
+	route53Xmlns    = "https://route53.amazonaws.com/doc/2013-04-01/"
+)
+
+// awsCredentials sign requests to AWS APIs.
+type awsCredentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// route53Provider manages a Route53 hosted zone through its REST API, with
+// the credentials of the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN environment variables.
+type route53Provider struct {
+	endpoint string
+	zoneID   string
+	creds    awsCredentials
+	client   *http.Client
+
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+func newRoute53Provider(zoneID string) (*route53Provider, error) {
+	creds := awsCredentials{
+		accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.accessKeyID == "" || creds.secretAccessKey == "" {
+		return nil, fmt.Errorf("route53 requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return &route53Provider{
+		endpoint: route53Endpoint,
+		zoneID:   strings.TrimPrefix(zoneID, "/hostedzone/"),
+		creds:    creds,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		now:      time.Now,
+	}, nil
+}
+
+type route53RecordSet struct {
+	Name    string   `xml:"Name"`
+	Type    string   `xml:"Type"`
+	TTL     int      `xml:"TTL,omitempty"`
+	Records []string `xml:"ResourceRecords>ResourceRecord>Value"`
+}
+
+type route53ListResponse struct {
+	RecordSets     []route53RecordSet `xml:"ResourceRecordSets>ResourceRecordSet"`
+	IsTruncated    bool               `xml:"IsTruncated"`
+	NextRecordName string             `xml:"NextRecordName"`
+	NextRecordType string             `xml:"NextRecordType"`
+}
+
+type route53Change struct {
+	Action    string           `xml:"Action"`
+	RecordSet route53RecordSet `xml:"ResourceRecordSet"`
+}
+
+type route53ChangeRequest struct {
+	XMLName xml.Name        `xml:"ChangeResourceRecordSetsRequest"`
+	Xmlns   string          `xml:"xmlns,attr"`
+	Changes []route53Change `xml:"ChangeBatch>Changes>Change"`
+}
+
+// route53Name undoes the octal escapes of names returned by Route53, eg: of
+// wildcards, and drops the trailing dot.
+func route53Name(name string) string {
+	return strings.TrimSuffix(strings.Replace(name, `\052`, "*", -1), ".")
+}
+
+func (r *route53Provider) records() ([]dnsRecord, error) {
+	var records []dnsRecord
+	query := url.Values{}
+	for {
+		var resp route53ListResponse
+		path := fmt.Sprintf("/%v/hostedzone/%v/rrset", route53Version, r.zoneID)
+		if err := r.do("GET", path, query, nil, &resp); err != nil {
+			return nil, err
+		}
+		for _, set := range resp.RecordSets {
+			records = append(records, dnsRecord{
+				Name:   route53Name(set.Name),
+				Type:   set.Type,
+				TTL:    set.TTL,
+				Values: set.Records,
+			})
+		}
+		if !resp.IsTruncated {
+			return records, nil
+		}
+		query = url.Values{"name": {resp.NextRecordName}, "type": {resp.NextRecordType}}
+	}
+}
+
+func (r *route53Provider) apply(deletions, additions []dnsRecord) error {
+	request := route53ChangeRequest{Xmlns: route53Xmlns}
+	for _, batch := range []struct {
+		action  string
+		records []dnsRecord
+	}{{"DELETE", deletions}, {"CREATE", additions}} {
+		for _, record := range batch.records {
+			request.Changes = append(request.Changes, route53Change{
+				Action:    batch.action,
+				RecordSet: route53RecordSet{Name: record.Name, Type: record.Type, TTL: record.TTL, Records: record.Values},
+			})
+		}
+	}
+	body, err := xml.Marshal(request)
+	if err != nil {
+		return err
+	}
+	path := fmt.Sprintf("/%v/hostedzone/%v/rrset/", route53Version, r.zoneID)
+	return r.do("POST", path, nil, append([]byte(xml.Header), body...), nil)
+}
+
+// do sends a signed request to Route53, decoding the xml response into out.
+func (r *route53Provider) do(method, path string, query url.Values, body []byte, out interface{}) error {
+	u := r.endpoint + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/xml")
+	}
+	signV4(req, body, r.creds, "us-east-1", "route53", r.now())
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("route53 %v %v: %v %s", method, path, resp.Status, data)
+	}
+	if out == nil {
+		return nil
+	}
+	return xml.Unmarshal(data, out)
+}
+
+// signV4 signs req with the AWS signature version 4.
+// http://docs.aws.amazon.com/general/latest/gr/signature-version-4.html
+func signV4(req *http.Request, body []byte, creds awsCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%v:%v\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var params []string
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			params = append(params, awsEscape(key)+"="+awsEscape(value))
+		}
+	}
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		strings.Join(params, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hexSHA256(body),
+	}, "\n")
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hexSHA256([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.secretAccessKey), date)
+	for _, part := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		creds.accessKeyID, scope, signedHeaders, signature))
+}
+
+// awsEscape escapes s as required by AWS signatures, like url.QueryEscape
+// but with spaces as %20.
+func awsEscape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,232 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/util/sets"
+)
+
+type fakeDNSProvider struct {
+	zone    []dnsRecord
+	applied int
+}
+
+func (f *fakeDNSProvider) records() ([]dnsRecord, error) {
+	return f.zone, nil
+}
+
+func (f *fakeDNSProvider) apply(deletions, additions []dnsRecord) error {
+	var zone []dnsRecord
+	for _, record := range f.zone {
+		deleted := false
+		for _, deletion := range deletions {
+			deleted = deleted || reflect.DeepEqual(record, deletion)
+		}
+		if !deleted {
+			zone = append(zone, record)
+		}
+	}
+	f.zone = append(zone, additions...)
+	f.applied++
+	return nil
+}
+
+func (f *fakeDNSProvider) lookup(name, recordType string) []string {
+	for _, record := range f.zone {
+		if record.Name == name && record.Type == recordType {
+			return record.Values
+		}
+	}
+	return nil
+}
+
+func TestDNSPublisher(t *testing.T) {
+	other := `"heritage=service-loadbalancer,owner=other"`
+	provider := &fakeDNSProvider{zone: []dnsRecord{
+		{Name: "manual.example.com", Type: "A", TTL: 60, Values: []string{"10.0.0.1"}},
+		{Name: "claimed.example.com", Type: "A", TTL: 60, Values: []string{"10.0.0.2"}},
+		{Name: dnsOwnerPrefix + "claimed.example.com", Type: "TXT", TTL: 60, Values: []string{other}},
+	}}
+	p := newDNSPublisher(provider, "example.com.", "lb", 300)
+
+	hosts := sets.NewString("foo.example.com", "manual.example.com", "claimed.example.com", "foo.example.org", "*.example.com")
+	if err := p.sync(hosts, "1.2.3.4"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if values := provider.lookup("foo.example.com", "A"); !reflect.DeepEqual(values, []string{"1.2.3.4"}) {
+		t.Fatalf("Expected foo.example.com to point at 1.2.3.4, got %v", values)
+	}
+	if values := provider.lookup(dnsOwnerPrefix+"foo.example.com", "TXT"); !reflect.DeepEqual(values, []string{p.ownerValue()}) {
+		t.Fatalf("Expected foo.example.com to be owned, got %v", values)
+	}
+	if values := provider.lookup("manual.example.com", "A"); !reflect.DeepEqual(values, []string{"10.0.0.1"}) {
+		t.Fatalf("Expected the unowned manual.example.com to be untouched, got %v", values)
+	}
+	if values := provider.lookup("claimed.example.com", "A"); !reflect.DeepEqual(values, []string{"10.0.0.2"}) {
+		t.Fatalf("Expected claimed.example.com of another owner to be untouched, got %v", values)
+	}
+	if len(provider.zone) != 5 {
+		t.Fatalf("Expected only foo.example.com to be added, got %v", provider.zone)
+	}
+
+	if err := p.sync(hosts, "1.2.3.4"); err != nil || provider.applied != 1 {
+		t.Fatalf("Expected no change for the same hosts, got %v changes: %v", provider.applied, err)
+	}
+
+	if err := p.sync(sets.NewString("bar.example.com"), "lb.example.net"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if values := provider.lookup("bar.example.com", "CNAME"); !reflect.DeepEqual(values, []string{"lb.example.net"}) {
+		t.Fatalf("Expected bar.example.com to be a CNAME of lb.example.net, got %v", values)
+	}
+	if provider.lookup("foo.example.com", "A") != nil || provider.lookup(dnsOwnerPrefix+"foo.example.com", "TXT") != nil {
+		t.Fatalf("Expected the records of foo.example.com to be deleted, got %v", provider.zone)
+	}
+	if len(provider.zone) != 5 {
+		t.Fatalf("Expected the other records to be untouched, got %v", provider.zone)
+	}
+}
+
+func TestSignV4(t *testing.T) {
+	// get-vanilla of the AWS signature version 4 test suite.
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	creds := awsCredentials{accessKeyID: "AKIDEXAMPLE", secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signV4(req, nil, creds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if auth := req.Header.Get("Authorization"); auth != expected {
+		t.Fatalf("Expected %q, got %q", expected, auth)
+	}
+}
+
+func TestRoute53Provider(t *testing.T) {
+	var change route53ChangeRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=id/") {
+			t.Errorf("Expected a signed request, got %v", r.Header)
+		}
+		switch {
+		case r.Method == "GET" && r.URL.Query().Get("name") == "":
+			fmt.Fprint(w, `<ListResourceRecordSetsResponse><ResourceRecordSets>
+<ResourceRecordSet><Name>\052.example.com.</Name><Type>A</Type><TTL>60</TTL>
+<ResourceRecords><ResourceRecord><Value>10.0.0.1</Value></ResourceRecord></ResourceRecords></ResourceRecordSet>
+</ResourceRecordSets><IsTruncated>true</IsTruncated><NextRecordName>foo.example.com.</NextRecordName><NextRecordType>A</NextRecordType></ListResourceRecordSetsResponse>`)
+		case r.Method == "GET":
+			fmt.Fprint(w, `<ListResourceRecordSetsResponse><ResourceRecordSets>
+<ResourceRecordSet><Name>foo.example.com.</Name><Type>A</Type><TTL>60</TTL>
+<ResourceRecords><ResourceRecord><Value>10.0.0.2</Value></ResourceRecord></ResourceRecords></ResourceRecordSet>
+</ResourceRecordSets><IsTruncated>false</IsTruncated></ListResourceRecordSetsResponse>`)
+		case r.Method == "POST" && r.URL.Path == "/2013-04-01/hostedzone/Z1/rrset/":
+			body, _ := ioutil.ReadAll(r.Body)
+			if err := xml.Unmarshal(body, &change); err != nil {
+				t.Errorf("Unexpected change %s: %v", body, err)
+			}
+			fmt.Fprint(w, `<ChangeResourceRecordSetsResponse/>`)
+		default:
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	r := &route53Provider{
+		endpoint: server.URL,
+		zoneID:   "Z1",
+		creds:    awsCredentials{accessKeyID: "id", secretAccessKey: "secret"},
+		client:   http.DefaultClient,
+		now:      time.Now,
+	}
+	records, err := r.records()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []dnsRecord{
+		{Name: "*.example.com", Type: "A", TTL: 60, Values: []string{"10.0.0.1"}},
+		{Name: "foo.example.com", Type: "A", TTL: 60, Values: []string{"10.0.0.2"}},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Fatalf("Expected records %v, got %v", expected, records)
+	}
+
+	addition := dnsRecord{Name: "foo.example.com", Type: "A", TTL: 300, Values: []string{"1.2.3.4"}}
+	if err := r.apply(expected[1:], []dnsRecord{addition}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(change.Changes) != 2 || change.Changes[0].Action != "DELETE" || change.Changes[1].Action != "CREATE" ||
+		!reflect.DeepEqual(change.Changes[1].RecordSet.Records, []string{"1.2.3.4"}) {
+		t.Fatalf("Expected the deletion then the creation, got %+v", change)
+	}
+}
+
+func TestCloudDNSProvider(t *testing.T) {
+	var change cloudDNSChange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/metadata/instance/service-accounts/default/token":
+			if r.Header.Get("Metadata-Flavor") != "Google" {
+				t.Errorf("Expected the metadata flavor header, got %v", r.Header)
+			}
+			fmt.Fprint(w, `{"access_token": "token"}`)
+		case r.Header.Get("Authorization") != "Bearer token":
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		case r.URL.Path == "/dns/projects/p/managedZones/z/rrsets":
+			fmt.Fprint(w, `{"rrsets": [{"name": "foo.example.com.", "type": "CNAME", "ttl": 60, "rrdatas": ["lb.example.net."]}]}`)
+		case r.URL.Path == "/dns/projects/p/managedZones/z/changes":
+			json.NewDecoder(r.Body).Decode(&change)
+			fmt.Fprint(w, `{}`)
+		default:
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	p := &cloudDNSProvider{
+		endpoint: server.URL + "/dns",
+		metadata: server.URL + "/metadata",
+		project:  "p",
+		zone:     "z",
+		client:   http.DefaultClient,
+	}
+	records, err := p.records()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []dnsRecord{{Name: "foo.example.com", Type: "CNAME", TTL: 60, Values: []string{"lb.example.net"}}}
+	if !reflect.DeepEqual(records, expected) {
+		t.Fatalf("Expected records %v, got %v", expected, records)
+	}
+
+	addition := dnsRecord{Name: "foo.example.com", Type: "A", TTL: 300, Values: []string{"1.2.3.4"}}
+	if err := p.apply(expected, []dnsRecord{addition}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(change.Deletions) != 1 || change.Deletions[0].Rrdatas[0] != "lb.example.net." ||
+		len(change.Additions) != 1 || change.Additions[0].Name != "foo.example.com." {
+		t.Fatalf("Expected fully qualified names in the change, got %+v", change)
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// drainCheckInterval is how often a sync is triggered while servers
+	// are draining, to notice the ones that are done.
+	drainCheckInterval = 2 * time.Second
+
+	// drainQueueKey is queued for the syncs triggered by draining servers.
+	drainQueueKey = "drain"
+)
+
+// drainer keeps the endpoints that went away in their backend until they
+// have no sessions left, or their drain period is over. They are rendered
+// as draining servers in the meantime, which get no new traffic.
+type drainer struct {
+	period time.Duration
+
+	// idle reports whether the server of backend at addr has no sessions.
+	idle func(backend, addr string) bool
+
+	// last holds the endpoints of every backend at the previous sync, and
+	// draining the deadline of the endpoints being drained.
+	last     map[string][]string
+	draining map[string]map[string]time.Time
+}
+
+func newDrainer(period time.Duration, idle func(backend, addr string) bool) *drainer {
+	return &drainer{
+		period:   period,
+		idle:     idle,
+		last:     map[string][]string{},
+		draining: map[string]map[string]time.Time{},
+	}
+}
+
+// keep returns eps along with the endpoints of backend that are still
+// draining, and the set of those.
+func (d *drainer) keep(backend string, eps []string) ([]string, map[string]bool) {
+	now := time.Now()
+	current := map[string]bool{}
+	for _, ep := range eps {
+		current[ep] = true
+	}
+	if d.draining[backend] == nil {
+		d.draining[backend] = map[string]time.Time{}
+	}
+	deadlines := d.draining[backend]
+	for _, ep := range d.last[backend] {
+		if _, ok := deadlines[ep]; !current[ep] && !ok {
+			logInfof("Draining endpoint %v of %v", ep, backend)
+			deadlines[ep] = now.Add(d.period)
+		}
+	}
+	d.last[backend] = eps
+
+	var kept []string
+	for ep, deadline := range deadlines {
+		if current[ep] || now.After(deadline) || d.idle(backend, ep) {
+			delete(deadlines, ep)
+			continue
+		}
+		kept = append(kept, ep)
+	}
+	sort.Strings(kept)
+
+	draining := map[string]bool{}
+	all := append([]string{}, eps...)
+	for _, ep := range kept {
+		draining[ep] = true
+		all = append(all, ep)
+	}
+	return all, draining
+}
+
+// active reports whether any endpoint is draining.
+func (d *drainer) active() bool {
+	for _, deadlines := range d.draining {
+		if len(deadlines) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// retain forgets the backends that are no longer rendered.
+func (d *drainer) retain(svcs []service) {
+	current := map[string]bool{}
+	for _, svc := range svcs {
+		current[svc.Name] = true
+	}
+	for name := range d.last {
+		if !current[name] {
+			delete(d.last, name)
+			delete(d.draining, name)
+		}
+	}
+}
+
+// serverIdle reports whether the server slot of backend holding addr has no
+// sessions left. Servers whose sessions can't be read are not idle, their
+// drain period still applies.
+func (lbc *loadBalancerController) serverIdle(backend, addr string) bool {
+	for i, ep := range lbc.slots.backends[backend] {
+		if ep != addr {
+			continue
+		}
+		n, err := lbc.socket.serverSessions(backend, slotName(i))
+		if err != nil {
+			logWarningf("Unable to read the sessions of %v/%v: %v", backend, slotName(i), err)
+			return false
+		}
+		return n == 0
+	}
+	return true
+}
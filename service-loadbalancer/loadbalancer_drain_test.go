@@ -0,0 +1,80 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDrainerKeep(t *testing.T) {
+	idle := map[string]bool{}
+	d := newDrainer(time.Hour, func(backend, addr string) bool {
+		return idle[addr]
+	})
+
+	d.keep("svc", []string{"1.1.1.1:80", "2.2.2.2:80"})
+	eps, draining := d.keep("svc", []string{"2.2.2.2:80"})
+	if !reflect.DeepEqual(eps, []string{"2.2.2.2:80", "1.1.1.1:80"}) || !draining["1.1.1.1:80"] {
+		t.Fatalf("Expected 1.1.1.1:80 to be draining, got %v %v", eps, draining)
+	}
+	if !d.active() {
+		t.Fatalf("Expected the drainer to be active")
+	}
+
+	// Once idle, the endpoint is removed.
+	idle["1.1.1.1:80"] = true
+	eps, draining = d.keep("svc", []string{"2.2.2.2:80"})
+	if !reflect.DeepEqual(eps, []string{"2.2.2.2:80"}) || len(draining) != 0 || d.active() {
+		t.Fatalf("Expected the drain of 1.1.1.1:80 to be over, got %v %v", eps, draining)
+	}
+
+	// Endpoints are removed at the end of the drain period, busy or not.
+	d.period = 0
+	d.keep("svc", []string{})
+	eps, _ = d.keep("svc", []string{})
+	if len(eps) != 0 {
+		t.Fatalf("Expected no endpoints after the drain period, got %v", eps)
+	}
+}
+
+func TestUpdateServersDrain(t *testing.T) {
+	fake, path := newFakeHAProxySocket(t)
+	defer fake.close(path)
+
+	running := []service{{Name: "svc", Servers: []backendServer{{Name: "s0", Addr: "1.1.1.1:80"}}}}
+	draining := []service{{Name: "svc", Servers: []backendServer{{Name: "s0", Addr: "1.1.1.1:80", Draining: true}}}}
+	removed := []service{{Name: "svc", Servers: []backendServer{{Name: "s0", Addr: placeholderAddr, Disabled: true}}}}
+
+	lbc := &loadBalancerController{socket: &haproxySocket{path: path}}
+	if err := lbc.updateServers(running, draining); err != nil {
+		t.Fatalf("Unexpected error updating servers: %v", err)
+	}
+	if err := lbc.updateServers(draining, removed); err != nil {
+		t.Fatalf("Unexpected error updating servers: %v", err)
+	}
+	expected := []string{
+		"set server svc/s0 state drain",
+		"set server svc/s0 weight 0",
+		"set server svc/s0 state maint",
+		"set server svc/s0 weight 1",
+	}
+	if !reflect.DeepEqual(fake.commands, expected) {
+		t.Fatalf("Unexpected commands %v, expected %v", fake.commands, expected)
+	}
+}
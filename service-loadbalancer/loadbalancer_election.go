@@ -0,0 +1,205 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/errors"
+	"k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/util/wait"
+)
+
+const (
+	// leaderAnnotation holds the lease on the election endpoints. It is the
+	// annotation used by the kubernetes leaderelection package, so the
+	// leader shows up the same way as for other components.
+	leaderAnnotation = "control-plane.alpha.kubernetes.io/leader"
+
+	// leaderQueueKey is queued when leadership is gained or lost.
+	leaderQueueKey = "leader"
+)
+
+// leaderRecord is the lease of the leader.
+type leaderRecord struct {
+	HolderIdentity       string    `json:"holderIdentity"`
+	LeaseDurationSeconds int       `json:"leaseDurationSeconds"`
+	AcquireTime          time.Time `json:"acquireTime"`
+	RenewTime            time.Time `json:"renewTime"`
+}
+
+// leaderElector campaigns for a lease stored on an endpoints object, so that
+// only one of several replicas makes the changes shared by all of them. Leases of other
+// replicas are timed with the local clock from when they were last seen to
+// be renewed, which makes the election insensitive to clock skew.
+type leaderElector struct {
+	client        unversioned.EndpointsInterface
+	name          string
+	identity      string
+	leaseDuration time.Duration
+
+	// now is replaced in tests.
+	now func() time.Time
+
+	mu           sync.Mutex
+	leading      bool
+	renewed      time.Time
+	observed     leaderRecord
+	observedTime time.Time
+}
+
+func newLeaderElector(client unversioned.EndpointsInterface, name, identity string, leaseDuration time.Duration) *leaderElector {
+	return &leaderElector{
+		client:        client,
+		name:          name,
+		identity:      identity,
+		leaseDuration: leaseDuration,
+		now:           time.Now,
+	}
+}
+
+// leading reports whether this replica makes the cluster-wide changes:
+// status annotations, dns records, acme certificates and events. Every
+// replica configures its own loadbalancer.
+func (lbc *loadBalancerController) leading() bool {
+	return lbc.elector == nil || lbc.elector.isLeader()
+}
+
+// isLeader reports whether this replica currently holds the lease.
+func (le *leaderElector) isLeader() bool {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	return le.leading
+}
+
+// tryAcquireOrRenew takes the lease if it is free or expired, or renews it
+// if it is already held. It returns true if the lease is held afterwards.
+func (le *leaderElector) tryAcquireOrRenew() bool {
+	now := le.now()
+	record := leaderRecord{
+		HolderIdentity:       le.identity,
+		LeaseDurationSeconds: int(le.leaseDuration / time.Second),
+		AcquireTime:          now,
+		RenewTime:            now,
+	}
+
+	ep, err := le.client.Get(le.name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			logErrorf("Error getting the leader lease %v: %v", le.name, err)
+			return false
+		}
+		ep = &api.Endpoints{ObjectMeta: api.ObjectMeta{Name: le.name}}
+		if err := le.setRecord(ep, record); err != nil {
+			return false
+		}
+		if _, err := le.client.Create(ep); err != nil {
+			logErrorf("Error creating the leader lease %v: %v", le.name, err)
+			return false
+		}
+		le.observe(record, now)
+		return true
+	}
+
+	var current leaderRecord
+	if val, ok := ep.Annotations[leaderAnnotation]; ok {
+		if err := json.Unmarshal([]byte(val), &current); err != nil {
+			logErrorf("Invalid leader lease %v: %v", le.name, err)
+			return false
+		}
+	}
+	if current.HolderIdentity != le.observed.HolderIdentity || !current.RenewTime.Equal(le.observed.RenewTime) {
+		le.observe(current, now)
+	}
+	if current.HolderIdentity != "" && current.HolderIdentity != le.identity &&
+		now.Before(le.observedTime.Add(le.leaseDuration)) {
+		return false
+	}
+
+	if current.HolderIdentity == le.identity {
+		record.AcquireTime = current.AcquireTime
+	}
+	if err := le.setRecord(ep, record); err != nil {
+		return false
+	}
+	// A conflict means another replica updated the lease first.
+	if _, err := le.client.Update(ep); err != nil {
+		logInfof("Unable to update the leader lease %v: %v", le.name, err)
+		return false
+	}
+	le.observe(record, now)
+	return true
+}
+
+func (le *leaderElector) setRecord(ep *api.Endpoints, record leaderRecord) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		logErrorf("Unable to encode the leader lease: %v", err)
+		return err
+	}
+	if ep.Annotations == nil {
+		ep.Annotations = map[string]string{}
+	}
+	ep.Annotations[leaderAnnotation] = string(b)
+	return nil
+}
+
+func (le *leaderElector) observe(record leaderRecord, now time.Time) {
+	le.observed = record
+	le.observedTime = now
+}
+
+// update campaigns once and returns whether leadership changed. Leadership
+// is given up when the lease couldn't be renewed for half its duration, well
+// before another replica may take it over.
+func (le *leaderElector) update() bool {
+	held := le.tryAcquireOrRenew()
+
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	if held {
+		le.renewed = le.now()
+	}
+	leading := held || (le.leading && le.now().Before(le.renewed.Add(le.leaseDuration/2)))
+	if leading == le.leading {
+		return false
+	}
+	le.leading = leading
+	return true
+}
+
+// run campaigns for the lease until stopCh is closed, calling onChange every
+// time leadership is gained or lost.
+func (le *leaderElector) run(onChange func(leading bool), stopCh <-chan struct{}) {
+	wait.Until(func() {
+		if !le.update() {
+			return
+		}
+		leading := le.isLeader()
+		if leading {
+			logInfof("Became the leader as %v", le.identity)
+			isLeader.Set(1)
+		} else {
+			logInfof("Stopped being the leader")
+			isLeader.Set(0)
+		}
+		onChange(leading)
+	}, le.leaseDuration/4, stopCh)
+}
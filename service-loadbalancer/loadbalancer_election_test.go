@@ -0,0 +1,114 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/errors"
+	"k8s.io/kubernetes/pkg/watch"
+)
+
+// fakeEndpoints is an in memory EndpointsInterface that rejects updates of
+// stale objects, like the apiserver.
+type fakeEndpoints struct {
+	items map[string]api.Endpoints
+}
+
+func (f *fakeEndpoints) Create(ep *api.Endpoints) (*api.Endpoints, error) {
+	if _, ok := f.items[ep.Name]; ok {
+		return nil, errors.NewAlreadyExists(api.Resource("endpoints"), ep.Name)
+	}
+	ep.ResourceVersion = "1"
+	f.items[ep.Name] = *ep
+	return ep, nil
+}
+
+func (f *fakeEndpoints) Get(name string) (*api.Endpoints, error) {
+	ep, ok := f.items[name]
+	if !ok {
+		return nil, errors.NewNotFound(api.Resource("endpoints"), name)
+	}
+	annotations := map[string]string{}
+	for k, v := range ep.Annotations {
+		annotations[k] = v
+	}
+	ep.Annotations = annotations
+	return &ep, nil
+}
+
+func (f *fakeEndpoints) Update(ep *api.Endpoints) (*api.Endpoints, error) {
+	if f.items[ep.Name].ResourceVersion != ep.ResourceVersion {
+		return nil, errors.NewConflict(api.Resource("endpoints"), ep.Name, fmt.Errorf("stale"))
+	}
+	v, _ := strconv.Atoi(ep.ResourceVersion)
+	ep.ResourceVersion = strconv.Itoa(v + 1)
+	f.items[ep.Name] = *ep
+	return ep, nil
+}
+
+func (f *fakeEndpoints) List(opts api.ListOptions) (*api.EndpointsList, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (f *fakeEndpoints) Delete(name string) error {
+	return fmt.Errorf("not implemented")
+}
+
+func (f *fakeEndpoints) Watch(opts api.ListOptions) (watch.Interface, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func TestLeaderElection(t *testing.T) {
+	client := &fakeEndpoints{items: map[string]api.Endpoints{}}
+	now := time.Now()
+	clock := func() time.Time { return now }
+	a := newLeaderElector(client, "lb", "a", 10*time.Second)
+	a.now = clock
+	b := newLeaderElector(client, "lb", "b", 10*time.Second)
+	b.now = clock
+
+	if !a.update() || !a.isLeader() {
+		t.Fatalf("Expected a to take the free lease")
+	}
+	if b.update() || b.isLeader() {
+		t.Fatalf("Expected b to wait for the lease held by a")
+	}
+
+	// a keeps renewing the lease, so b never gets it.
+	now = now.Add(8 * time.Second)
+	a.update()
+	b.update()
+	now = now.Add(8 * time.Second)
+	if a.update() || !a.isLeader() || b.update() || b.isLeader() {
+		t.Fatalf("Expected a to remain the leader while renewing")
+	}
+
+	// a stops renewing, b takes over once the lease expired, and a steps
+	// down since it can't renew anymore.
+	now = now.Add(11 * time.Second)
+	if !b.update() || !b.isLeader() {
+		t.Fatalf("Expected b to take the expired lease")
+	}
+	if !a.update() || a.isLeader() {
+		t.Fatalf("Expected a to step down")
+	}
+}
@@ -0,0 +1,380 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/controller/framework"
+	"k8s.io/kubernetes/pkg/util/wait"
+)
+
+const (
+	// endpointSliceServiceLabel names the service of an endpoint slice.
+	endpointSliceServiceLabel = "kubernetes.io/service-name"
+
+	// endpointSliceWatchTimeout bounds a single watch, the slices are
+	// listed again after it.
+	endpointSliceWatchTimeout = 5 * time.Minute
+)
+
+// endpointSlice is a discovery.k8s.io/v1 EndpointSlice, with the fields the
+// loadbalancer uses.
+type endpointSlice struct {
+	Metadata struct {
+		Name      string            `json:"name"`
+		Namespace string            `json:"namespace"`
+		Labels    map[string]string `json:"labels"`
+	} `json:"metadata"`
+	AddressType string `json:"addressType"`
+	Endpoints   []struct {
+		Addresses  []string `json:"addresses"`
+		Conditions struct {
+			Ready       *bool `json:"ready"`
+			Serving     *bool `json:"serving"`
+			Terminating *bool `json:"terminating"`
+		} `json:"conditions"`
+		TargetRef *api.ObjectReference `json:"targetRef"`
+	} `json:"endpoints"`
+	Ports []struct {
+		Name     *string `json:"name"`
+		Port     *int    `json:"port"`
+		Protocol *string `json:"protocol"`
+	} `json:"ports"`
+}
+
+func (s *endpointSlice) key() string {
+	return s.Metadata.Namespace + "/" + s.Metadata.Name
+}
+
+// serviceKey returns the namespace/name of the service of s, empty for
+// slices not managed for a service.
+func (s *endpointSlice) serviceKey() string {
+	name := s.Metadata.Labels[endpointSliceServiceLabel]
+	if name == "" {
+		return ""
+	}
+	return s.Metadata.Namespace + "/" + name
+}
+
+// mergeEndpointSlices returns the endpoints of the service namespace/name
+// from its slices, every slice being a subset. Ready endpoints are the
+// addresses, the others are not ready. When none is ready, endpoints that
+// are terminating but still serving are used, so a service being rolled out
+// keeps its traffic until its last pods are gone.
+func mergeEndpointSlices(namespace, name string, slices []*endpointSlice) *api.Endpoints {
+	sort.Sort(slicesByName(slices))
+	isTrue := func(b *bool, def bool) bool {
+		if b == nil {
+			return def
+		}
+		return *b
+	}
+
+	endpoints := &api.Endpoints{ObjectMeta: api.ObjectMeta{Namespace: namespace, Name: name}}
+	var subsets, fallback []api.EndpointSubset
+	hasReady := false
+	for _, slice := range slices {
+		if slice.AddressType != "IPv4" && slice.AddressType != "IPv6" {
+			continue
+		}
+		var ports []api.EndpointPort
+		for _, p := range slice.Ports {
+			// A slice port without a number stands for all the ports,
+			// which the loadbalancer can't route to.
+			if p.Port == nil {
+				continue
+			}
+			port := api.EndpointPort{Port: *p.Port, Protocol: api.ProtocolTCP}
+			if p.Name != nil {
+				port.Name = *p.Name
+			}
+			if p.Protocol != nil {
+				port.Protocol = api.Protocol(*p.Protocol)
+			}
+			ports = append(ports, port)
+		}
+		if len(ports) == 0 {
+			continue
+		}
+
+		subset := api.EndpointSubset{Ports: ports}
+		serving := api.EndpointSubset{Ports: ports}
+		for _, ep := range slice.Endpoints {
+			if len(ep.Addresses) == 0 {
+				continue
+			}
+			address := api.EndpointAddress{IP: ep.Addresses[0], TargetRef: ep.TargetRef}
+			ready := isTrue(ep.Conditions.Ready, true)
+			if ready {
+				hasReady = true
+				subset.Addresses = append(subset.Addresses, address)
+			} else {
+				subset.NotReadyAddresses = append(subset.NotReadyAddresses, address)
+			}
+			if ready || (isTrue(ep.Conditions.Serving, ready) && isTrue(ep.Conditions.Terminating, false)) {
+				serving.Addresses = append(serving.Addresses, address)
+			}
+		}
+		if len(subset.Addresses) > 0 || len(subset.NotReadyAddresses) > 0 {
+			subsets = append(subsets, subset)
+		}
+		if len(serving.Addresses) > 0 {
+			fallback = append(fallback, serving)
+		}
+	}
+	endpoints.Subsets = subsets
+	if !hasReady && len(fallback) > 0 {
+		logV(2).Infof("No ready endpoints for %v/%v, using the terminating ones", namespace, name)
+		endpoints.Subsets = fallback
+	}
+	return endpoints
+}
+
+type slicesByName []*endpointSlice
+
+func (s slicesByName) Len() int           { return len(s) }
+func (s slicesByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s slicesByName) Less(i, j int) bool { return s[i].Metadata.Name < s[j].Metadata.Name }
+
+// endpointSliceWatcher keeps the endpoints of services, merged from their
+// endpoint slices, in store, and notifies handler of their changes like an
+// endpoints informer. The vendored client predates endpoint slices, so they
+// are listed and watched with raw requests.
+type endpointSliceWatcher struct {
+	store   cache.Store
+	handler framework.ResourceEventHandler
+
+	// namespaces are listed and watched one by one, api.NamespaceAll
+	// watches all of them.
+	namespaces []string
+
+	// list returns the slices of a namespace as a json list, and watch
+	// streams the json watch events of its slices from a resource version.
+	list  func(namespace string) ([]byte, error)
+	watch func(namespace, resourceVersion string) (io.ReadCloser, error)
+
+	// slices holds every slice by namespace/name, and services indexes
+	// them by the key of their service and their name, so an event only
+	// merges the slices of its service.
+	lock     sync.Mutex
+	slices   map[string]*endpointSlice
+	services map[string]map[string]*endpointSlice
+	listed   map[string]bool
+}
+
+func newEndpointSliceWatcher(client *unversioned.Client, namespaces []string, handler framework.ResourceEventHandler) *endpointSliceWatcher {
+	path := func(namespace string) string {
+		if namespace == api.NamespaceAll {
+			return "/apis/discovery.k8s.io/v1/endpointslices"
+		}
+		return fmt.Sprintf("/apis/discovery.k8s.io/v1/namespaces/%v/endpointslices", namespace)
+	}
+	return &endpointSliceWatcher{
+		store:      cache.NewStore(cache.MetaNamespaceKeyFunc),
+		handler:    handler,
+		namespaces: namespaces,
+		list: func(namespace string) ([]byte, error) {
+			return client.Get().AbsPath(path(namespace)).DoRaw()
+		},
+		watch: func(namespace, resourceVersion string) (io.ReadCloser, error) {
+			return client.Get().AbsPath(path(namespace)).
+				Param("watch", "true").
+				Param("resourceVersion", resourceVersion).
+				Param("timeoutSeconds", fmt.Sprintf("%d", int(endpointSliceWatchTimeout/time.Second))).
+				Stream()
+		},
+		slices:   map[string]*endpointSlice{},
+		services: map[string]map[string]*endpointSlice{},
+		listed:   map[string]bool{},
+	}
+}
+
+// hasSynced reports whether the slices of every namespace were listed at
+// least once.
+func (w *endpointSliceWatcher) hasSynced() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for _, ns := range w.namespaces {
+		if !w.listed[ns] {
+			return false
+		}
+	}
+	return true
+}
+
+// run lists and watches the slices of each namespace until stopCh is
+// closed, listing them again whenever a watch ends.
+func (w *endpointSliceWatcher) run(stopCh <-chan struct{}) {
+	for _, ns := range w.namespaces {
+		ns := ns
+		go wait.Until(func() {
+			if err := w.listAndWatch(ns); err != nil {
+				logWarning("Watching endpoint slices", "namespace", ns, "error", err)
+			}
+		}, time.Second, stopCh)
+	}
+}
+
+func (w *endpointSliceWatcher) listAndWatch(namespace string) error {
+	data, err := w.list(namespace)
+	if err != nil {
+		return err
+	}
+	var list struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+		Items []*endpointSlice `json:"items"`
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("invalid endpoint slice list: %v", err)
+	}
+	w.replace(namespace, list.Items)
+
+	body, err := w.watch(namespace, list.Metadata.ResourceVersion)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	decoder := json.NewDecoder(body)
+	for {
+		var event struct {
+			Type   string          `json:"type"`
+			Object json.RawMessage `json:"object"`
+		}
+		if err := decoder.Decode(&event); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if event.Type == "ERROR" {
+			// Most likely an expired resource version, listing again
+			// recovers.
+			return fmt.Errorf("watch error: %s", event.Object)
+		}
+		slice := &endpointSlice{}
+		if err := json.Unmarshal(event.Object, slice); err != nil {
+			return fmt.Errorf("invalid endpoint slice: %v", err)
+		}
+		w.update(slice, event.Type == "DELETED")
+	}
+}
+
+// replace replaces the slices of namespace with slices.
+func (w *endpointSliceWatcher) replace(namespace string, slices []*endpointSlice) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	services := map[string]bool{}
+	for _, slice := range w.slices {
+		if namespace == api.NamespaceAll || slice.Metadata.Namespace == namespace {
+			services[slice.serviceKey()] = true
+			w.remove(slice)
+		}
+	}
+	for _, slice := range slices {
+		w.add(slice)
+		services[slice.serviceKey()] = true
+	}
+	for key := range services {
+		w.merge(key)
+	}
+	w.listed[namespace] = true
+}
+
+// update adds, replaces or deletes slice.
+func (w *endpointSliceWatcher) update(slice *endpointSlice, deleted bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	// the service label of a slice may change, the endpoints of its
+	// previous service lose it
+	if old, ok := w.slices[slice.key()]; ok {
+		w.remove(old)
+		if old.serviceKey() != slice.serviceKey() {
+			w.merge(old.serviceKey())
+		}
+	}
+	if !deleted {
+		w.add(slice)
+	}
+	w.merge(slice.serviceKey())
+}
+
+// add indexes slice, replacing any slice with its name.
+func (w *endpointSliceWatcher) add(slice *endpointSlice) {
+	w.slices[slice.key()] = slice
+	service := w.services[slice.serviceKey()]
+	if service == nil {
+		service = map[string]*endpointSlice{}
+		w.services[slice.serviceKey()] = service
+	}
+	service[slice.Metadata.Name] = slice
+}
+
+// remove drops slice from the index.
+func (w *endpointSliceWatcher) remove(slice *endpointSlice) {
+	delete(w.slices, slice.key())
+	service := w.services[slice.serviceKey()]
+	delete(service, slice.Metadata.Name)
+	if len(service) == 0 {
+		delete(w.services, slice.serviceKey())
+	}
+}
+
+// merge updates the endpoints of the service key, namespace/name, from its
+// slices.
+func (w *endpointSliceWatcher) merge(key string) {
+	if key == "" {
+		return
+	}
+	var slices []*endpointSlice
+	for _, slice := range w.services[key] {
+		slices = append(slices, slice)
+	}
+	old, exists, _ := w.store.GetByKey(key)
+	if len(slices) == 0 {
+		if exists {
+			w.store.Delete(old)
+			w.handler.OnDelete(old)
+		}
+		return
+	}
+	endpoints := mergeEndpointSlices(slices[0].Metadata.Namespace, slices[0].Metadata.Labels[endpointSliceServiceLabel], slices)
+	if exists {
+		w.store.Update(endpoints)
+		w.handler.OnUpdate(old, endpoints)
+	} else {
+		w.store.Add(endpoints)
+		w.handler.OnAdd(endpoints)
+	}
+}
+
+// endpointsSynced reports whether the endpoints of the services are known.
+func (lbc *loadBalancerController) endpointsSynced() bool {
+	if lbc.slices != nil {
+		return lbc.slices.hasSynced()
+	}
+	return lbc.epController.HasSynced()
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/controller/framework"
+)
+
+func parseEndpointSlice(t *testing.T, data string) *endpointSlice {
+	slice := &endpointSlice{}
+	if err := json.Unmarshal([]byte(data), slice); err != nil {
+		t.Fatalf("Unexpected error parsing %v: %v", data, err)
+	}
+	return slice
+}
+
+func TestMergeEndpointSlices(t *testing.T) {
+	slices := []*endpointSlice{
+		parseEndpointSlice(t, `{"metadata":{"name":"web-b","namespace":"default"},"addressType":"IPv4",
+			"ports":[{"name":"http","port":8080,"protocol":"TCP"}],
+			"endpoints":[{"addresses":["10.0.0.3"],"conditions":{"ready":false}}]}`),
+		parseEndpointSlice(t, `{"metadata":{"name":"web-a","namespace":"default"},"addressType":"IPv4",
+			"ports":[{"name":"http","port":8080,"protocol":"TCP"},{"name":"all"}],
+			"endpoints":[
+				{"addresses":["10.0.0.1"],"conditions":{"ready":true},"targetRef":{"kind":"Pod","namespace":"default","name":"web-1"}},
+				{"addresses":["10.0.0.2"],"conditions":{}}]}`),
+		parseEndpointSlice(t, `{"metadata":{"name":"web-c","namespace":"default"},"addressType":"FQDN",
+			"ports":[{"port":8080}],"endpoints":[{"addresses":["web.example.com"]}]}`),
+	}
+	ports := []api.EndpointPort{{Name: "http", Port: 8080, Protocol: api.ProtocolTCP}}
+	expected := []api.EndpointSubset{
+		{
+			Addresses: []api.EndpointAddress{
+				{IP: "10.0.0.1", TargetRef: &api.ObjectReference{Kind: "Pod", Namespace: "default", Name: "web-1"}},
+				{IP: "10.0.0.2"},
+			},
+			Ports: ports,
+		},
+		{NotReadyAddresses: []api.EndpointAddress{{IP: "10.0.0.3"}}, Ports: ports},
+	}
+	endpoints := mergeEndpointSlices("default", "web", slices)
+	if endpoints.Namespace != "default" || endpoints.Name != "web" || !reflect.DeepEqual(endpoints.Subsets, expected) {
+		t.Fatalf("Expected subsets %+v, got %+v", expected, endpoints)
+	}
+
+	terminating := []*endpointSlice{
+		parseEndpointSlice(t, `{"metadata":{"name":"web-a","namespace":"default"},"addressType":"IPv6",
+			"ports":[{"port":8080}],
+			"endpoints":[
+				{"addresses":["fd00::1"],"conditions":{"ready":false,"serving":true,"terminating":true}},
+				{"addresses":["fd00::2"],"conditions":{"ready":false,"serving":false,"terminating":true}}]}`),
+	}
+	expected = []api.EndpointSubset{{
+		Addresses: []api.EndpointAddress{{IP: "fd00::1"}},
+		Ports:     []api.EndpointPort{{Port: 8080, Protocol: api.ProtocolTCP}},
+	}}
+	if endpoints := mergeEndpointSlices("default", "web", terminating); !reflect.DeepEqual(endpoints.Subsets, expected) {
+		t.Fatalf("Expected the serving terminating endpoints %+v, got %+v", expected, endpoints.Subsets)
+	}
+}
+
+func TestEndpointSliceWatcher(t *testing.T) {
+	var events []string
+	handler := framework.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			events = append(events, "add "+obj.(*api.Endpoints).Name)
+		},
+		UpdateFunc: func(old, cur interface{}) {
+			events = append(events, "update "+cur.(*api.Endpoints).Name)
+		},
+		DeleteFunc: func(obj interface{}) {
+			events = append(events, "delete "+obj.(*api.Endpoints).Name)
+		},
+	}
+	slice := func(name, service, ip string) string {
+		return `{"metadata":{"name":"` + name + `","namespace":"default","labels":{"kubernetes.io/service-name":"` + service + `"}},
+			"addressType":"IPv4","ports":[{"port":80}],"endpoints":[{"addresses":["` + ip + `"]}]}`
+	}
+	watched := ""
+	w := &endpointSliceWatcher{
+		store:      newFakeLoadBalancerController(nil, nil).epLister.Store,
+		handler:    handler,
+		namespaces: []string{"default", "other"},
+		list: func(namespace string) ([]byte, error) {
+			if namespace == "other" {
+				return []byte(`{"metadata":{"resourceVersion":"12"},"items":[]}`), nil
+			}
+			return []byte(`{"metadata":{"resourceVersion":"10"},"items":[` +
+				slice("svc-1-a", "svc-1", "1.2.3.4") + `,` + slice("svc-2-a", "svc-2", "5.6.7.8") + `]}`), nil
+		},
+		watch: func(namespace, resourceVersion string) (io.ReadCloser, error) {
+			watched = resourceVersion
+			return ioutil.NopCloser(strings.NewReader(
+				`{"type":"ADDED","object":` + slice("svc-1-b", "svc-1", "1.2.3.5") + `}` +
+					`{"type":"DELETED","object":` + slice("svc-2-a", "svc-2", "5.6.7.8") + `}`)), nil
+		},
+		slices:   map[string]*endpointSlice{},
+		services: map[string]map[string]*endpointSlice{},
+		listed:   map[string]bool{},
+	}
+	if w.hasSynced() {
+		t.Fatalf("Expected the watcher not to be synced before listing")
+	}
+	if err := w.listAndWatch("default"); err != nil {
+		t.Fatalf("Unexpected error watching: %v", err)
+	}
+	if w.hasSynced() || watched != "10" {
+		t.Fatalf("Expected a watch from resource version 10 after listing default alone, got %q", watched)
+	}
+	sort.Strings(events[:2])
+	if expected := []string{"add svc-1", "add svc-2", "update svc-1", "delete svc-2"}; !reflect.DeepEqual(events, expected) {
+		t.Fatalf("Expected events %v, got %v", expected, events)
+	}
+
+	svc := &api.Service{ObjectMeta: api.ObjectMeta{Namespace: "default", Name: "svc-1"}}
+	lister := cache.StoreToEndpointsLister{Store: w.store}
+	ep, err := lister.GetServiceEndpoints(svc)
+	if err != nil || len(ep.Subsets) != 2 {
+		t.Fatalf("Expected the endpoints of both slices of svc-1, got %+v: %v", ep, err)
+	}
+	if _, exists, _ := w.store.GetByKey("default/svc-2"); exists {
+		t.Fatalf("Expected the endpoints of svc-2 to be deleted")
+	}
+
+	w.watch = func(string, string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(`{"type":"ERROR","object":{"code":410}}`)), nil
+	}
+	if err := w.listAndWatch("other"); err == nil {
+		t.Fatalf("Expected an error for an expired watch")
+	}
+	if !w.hasSynced() {
+		t.Fatalf("Expected the watcher to be synced once every namespace was listed")
+	}
+	if _, exists, _ := w.store.GetByKey("default/svc-1"); !exists {
+		t.Fatalf("Expected listing other not to replace the slices of default")
+	}
+	if err := w.listAndWatch("default"); err == nil {
+		t.Fatalf("Expected an error for an expired watch")
+	}
+}
+
+func TestEndpointSliceServiceChange(t *testing.T) {
+	w := &endpointSliceWatcher{
+		store:    newFakeLoadBalancerController(nil, nil).epLister.Store,
+		handler:  framework.ResourceEventHandlerFuncs{},
+		slices:   map[string]*endpointSlice{},
+		services: map[string]map[string]*endpointSlice{},
+		listed:   map[string]bool{},
+	}
+	slice := func(service string) *endpointSlice {
+		return parseEndpointSlice(t, `{"metadata":{"name":"a","namespace":"default","labels":{"kubernetes.io/service-name":"`+service+`"}},
+			"addressType":"IPv4","ports":[{"port":80}],"endpoints":[{"addresses":["1.2.3.4"]}]}`)
+	}
+	w.update(slice("svc-1"), false)
+	w.update(slice("svc-2"), false)
+	if _, exists, _ := w.store.GetByKey("default/svc-1"); exists {
+		t.Fatalf("Expected the endpoints of svc-1 to be deleted once its slice moved to svc-2")
+	}
+	if _, exists, _ := w.store.GetByKey("default/svc-2"); !exists {
+		t.Fatalf("Expected the endpoints of svc-2")
+	}
+	w.update(slice("svc-2"), true)
+	if len(w.slices) != 0 || len(w.services) != 0 {
+		t.Fatalf("Expected the deleted slice to leave the index, got %v and %v", w.slices, w.services)
+	}
+}
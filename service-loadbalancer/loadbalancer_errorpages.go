@@ -0,0 +1,155 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// errorPageCodes are the status codes haproxy has an errorfile for in the
+// backends of the template, and a ConfigMap may replace.
+var errorPageCodes = []string{"400", "403", "408", "500", "502", "503", "504"}
+
+// errorPages are the custom error pages of a service, from the ConfigMap of
+// --error-pages and the ConfigMap named by its errorPages annotation.
+type errorPages struct {
+	// Files maps status codes to the errorfile written for them.
+	Files map[string]string
+
+	// configMaps holds the resource version of every ConfigMap the pages
+	// come from by namespace/name, so that changed pages are seen as a
+	// change of the service.
+	configMaps map[string]string
+}
+
+// getConfigMap returns the ConfigMap key, namespace/name.
+func (lbc *loadBalancerController) getConfigMap(key string) (*api.ConfigMap, error) {
+	if lbc.configMapStore == nil {
+		return nil, fmt.Errorf("configmap %v requested but configmaps are not watched", key)
+	}
+	obj, exists, err := lbc.configMapStore.GetByKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("configmap %v not found", key)
+	}
+	return obj.(*api.ConfigMap), nil
+}
+
+// errorPagePath returns the path of the errorfile written for the page of
+// code in configMap.
+func (lbc *loadBalancerController) errorPagePath(configMap *api.ConfigMap, code string) string {
+	return filepath.Join(lbc.errorPagesDir, fmt.Sprintf("%v_%v", configMap.Namespace, configMap.Name), code+".http")
+}
+
+// getErrorPages returns the error pages of s. Pages of the ConfigMap named
+// by the errorPages annotation, either a name in the namespace of the
+// service or a namespace/name pair, replace the pages of --error-pages.
+// Keys of the ConfigMaps are status codes.
+func (lbc *loadBalancerController) getErrorPages(s *api.Service) errorPages {
+	var keys []string
+	if lbc.errorPages != "" {
+		keys = append(keys, lbc.errorPages)
+	}
+	if val, ok := serviceAnnotations(s.ObjectMeta.Annotations).getErrorPages(); ok {
+		if !strings.Contains(val, "/") {
+			val = fmt.Sprintf("%v/%v", s.Namespace, val)
+		}
+		keys = append(keys, val)
+	}
+	pages := errorPages{}
+	for _, key := range keys {
+		configMap, err := lbc.getConfigMap(key)
+		if err != nil {
+			logWarning("Not using the error pages of service", "service", s.Name, "namespace", s.Namespace, "error", err)
+			continue
+		}
+		for _, code := range errorPageCodes {
+			if _, ok := configMap.Data[code]; !ok {
+				continue
+			}
+			if pages.Files == nil {
+				pages.Files = map[string]string{}
+				pages.configMaps = map[string]string{}
+			}
+			pages.Files[code] = lbc.errorPagePath(configMap, code)
+			pages.configMaps[key] = configMap.ResourceVersion
+		}
+	}
+	return pages
+}
+
+// errorResponse returns the errorfile serving page for code. haproxy sends
+// errorfiles as they are, so pages are prefixed with a response header
+// unless they are complete responses already.
+func errorResponse(code string, page string) []byte {
+	if strings.HasPrefix(page, "HTTP/") {
+		return []byte(page)
+	}
+	status, _ := strconv.Atoi(code)
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "HTTP/1.0 %v %v\r\n", code, http.StatusText(status))
+	b.WriteString("Cache-Control: no-cache\r\n")
+	b.WriteString("Connection: close\r\n")
+	b.WriteString("Content-Type: text/html\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(page)
+	return b.Bytes()
+}
+
+// writeErrorPages writes the errorfiles of the error pages of the services.
+// Files are only rewritten when their content changed.
+func (lbc *loadBalancerController) writeErrorPages(svcGroups ...[]service) error {
+	written := map[string]bool{}
+	for _, group := range svcGroups {
+		for _, svc := range group {
+			for key := range svc.ErrorPages.configMaps {
+				if written[key] {
+					continue
+				}
+				written[key] = true
+				configMap, err := lbc.getConfigMap(key)
+				if err != nil {
+					return err
+				}
+				for _, code := range errorPageCodes {
+					page, ok := configMap.Data[code]
+					if !ok {
+						continue
+					}
+					path := lbc.errorPagePath(configMap, code)
+					changed, err := writeFile(path, errorResponse(code, page))
+					if err != nil {
+						return err
+					}
+					if changed {
+						logInfof("Wrote error page %v of configmap %v to %v", code, key, path)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
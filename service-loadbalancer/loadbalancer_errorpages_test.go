@@ -0,0 +1,110 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+)
+
+func TestErrorPages(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	dir, err := ioutil.TempDir("", "error-pages")
+	if err != nil {
+		t.Fatalf("Unexpected error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	flb.errorPagesDir = dir
+	flb.errorPages = "kube-system/lb-errors"
+	flb.configMapStore = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for _, configMap := range []*api.ConfigMap{
+		{
+			ObjectMeta: api.ObjectMeta{Name: "lb-errors", Namespace: "kube-system", ResourceVersion: "1"},
+			Data:       map[string]string{"502": "<h1>Bad gateway</h1>", "503": "<h1>Unavailable</h1>", "418": "ignored"},
+		},
+		{
+			ObjectMeta: api.ObjectMeta{Name: "maintenance", Namespace: "default", ResourceVersion: "2"},
+			Data:       map[string]string{"503": "HTTP/1.0 503 Service Unavailable\r\nRetry-After: 60\r\n\r\nBack soon"},
+		},
+	} {
+		flb.configMapStore.Add(configMap)
+	}
+	obj, _, _ := flb.svcLister.Store.GetByKey("default/svc-1")
+	obj.(*api.Service).ObjectMeta.Annotations = map[string]string{lbErrorPages: "maintenance"}
+
+	httpSvc, _, _ := flb.getServices()
+	global := filepath.Join(dir, "kube-system_lb-errors")
+	maintenance := filepath.Join(dir, "default_maintenance")
+	for _, svc := range httpSvc {
+		files := svc.ErrorPages.Files
+		if files["502"] != filepath.Join(global, "502.http") || files["418"] != "" {
+			t.Fatalf("Expected the default error pages for %v, got %+v", svc.Name, files)
+		}
+		expected := filepath.Join(global, "503.http")
+		if strings.HasPrefix(svc.Name, "svc-1") {
+			expected = filepath.Join(maintenance, "503.http")
+		}
+		if files["503"] != expected {
+			t.Fatalf("Expected the 503 page of %v at %v, got %+v", svc.Name, expected, files)
+		}
+	}
+
+	if err := flb.writeErrorPages(httpSvc); err != nil {
+		t.Fatalf("Unexpected error writing error pages: %v", err)
+	}
+	page, err := ioutil.ReadFile(filepath.Join(global, "502.http"))
+	if err != nil || !strings.HasPrefix(string(page), "HTTP/1.0 502 Bad Gateway\r\n") || !strings.HasSuffix(string(page), "\r\n\r\n<h1>Bad gateway</h1>") {
+		t.Fatalf("Unexpected error page %q: %v", page, err)
+	}
+	if page, err := ioutil.ReadFile(filepath.Join(maintenance, "503.http")); err != nil || !strings.Contains(string(page), "Retry-After: 60") {
+		t.Fatalf("Expected the response of the configmap as is, got %q: %v", page, err)
+	}
+
+	config, err := flb.backend.render(map[string][]service{"http": httpSvc})
+	if err != nil {
+		t.Fatalf("Unexpected error rendering config: %v", err)
+	}
+	for _, expected := range []string{
+		"errorfile 503 " + filepath.Join(maintenance, "503.http"),
+		"errorfile 502 " + filepath.Join(global, "502.http"),
+		"errorfile 504 /etc/haproxy/errors/504.http",
+	} {
+		if !strings.Contains(string(config), expected) {
+			t.Fatalf("Expected %q in config:\n%s", expected, config)
+		}
+	}
+}
+
+func TestErrorPagesMissingConfigMap(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	flb.configMapStore = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	obj, _, _ := flb.svcLister.Store.GetByKey("default/svc-1")
+	obj.(*api.Service).ObjectMeta.Annotations = map[string]string{lbErrorPages: "missing"}
+
+	httpSvc, _, _ := flb.getServices()
+	for _, svc := range httpSvc {
+		if len(svc.ErrorPages.Files) != 0 {
+			t.Fatalf("Expected the haproxy error pages for %v, got %+v", svc.Name, svc.ErrorPages.Files)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/unversioned"
+)
+
+const (
+	// serviceTypeExternalName is the type of services aliasing a dns name.
+	// The vendored api predates it, so their externalName is read from the
+	// raw service.
+	serviceTypeExternalName api.ServiceType = "ExternalName"
+
+	// resolvConf lists the nameservers of the controller.
+	resolvConf = "/etc/resolv.conf"
+)
+
+// externalNamePattern matches the dns names ExternalName services may alias.
+var externalNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*\.?$`)
+
+// externalName is the externalName of a service read at its resourceVersion.
+type externalName struct {
+	version string
+	name    string
+}
+
+// fetchExternalName returns a function reading the externalName of a
+// service from the apiserver.
+func fetchExternalName(client *unversioned.Client) func(namespace, name string) (string, error) {
+	return func(namespace, name string) (string, error) {
+		raw, err := client.Get().Namespace(namespace).Resource("services").Name(name).DoRaw()
+		if err != nil {
+			return "", err
+		}
+		var svc struct {
+			Spec struct {
+				ExternalName string `json:"externalName"`
+			} `json:"spec"`
+		}
+		if err := json.Unmarshal(raw, &svc); err != nil {
+			return "", err
+		}
+		return svc.Spec.ExternalName, nil
+	}
+}
+
+// getExternalName returns the dns name aliased by the ExternalName service
+// s, or an empty string if it can't be fronted. Names are only read again
+// when the service changes.
+func (lbc *loadBalancerController) getExternalName(s *api.Service) string {
+	if _, ok := lbc.backend.(*haproxyBackend); !ok || lbc.fetchExternalName == nil {
+		logV(2).Info("Ignoring ExternalName service, only haproxy resolves its servers", "service", s.Name, "namespace", s.Namespace)
+		return ""
+	}
+	key := fmt.Sprintf("%v/%v", s.Namespace, s.Name)
+	if cached, ok := lbc.externalNames[key]; ok && cached.version == s.ResourceVersion {
+		return cached.name
+	}
+	name, err := lbc.fetchExternalName(s.Namespace, s.Name)
+	if err != nil {
+		logWarning("Unable to read the externalName of service", "service", s.Name, "namespace", s.Namespace, "error", err)
+		return ""
+	}
+	name = strings.ToLower(name)
+	if !externalNamePattern.MatchString(name) {
+		logWarningf("Ignoring invalid externalName %q of service %v", name, s.Name)
+		name = ""
+	}
+	if lbc.externalNames == nil {
+		lbc.externalNames = map[string]externalName{}
+	}
+	lbc.externalNames[key] = externalName{version: s.ResourceVersion, name: name}
+	return name
+}
+
+// externalNameResolved reports whether any of the services has servers
+// resolved at runtime.
+func externalNameResolved(svcGroups ...[]service) bool {
+	for _, group := range svcGroups {
+		for _, svc := range group {
+			if svc.ExternalName != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseNameservers returns the nameservers of a comma separated list of
+// ip[:port], on port 53 by default.
+func parseNameservers(val string) ([]string, error) {
+	var nameservers []string
+	for _, ns := range strings.Split(val, ",") {
+		ns = strings.TrimSpace(ns)
+		if ns == "" {
+			continue
+		}
+		if ip := net.ParseIP(strings.Trim(ns, "[]")); ip != nil {
+			nameservers = append(nameservers, hostPort(ip.String(), 53))
+			continue
+		}
+		host, _, err := net.SplitHostPort(ns)
+		if err != nil || net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("invalid nameserver %q, expected ip[:port]", ns)
+		}
+		nameservers = append(nameservers, ns)
+	}
+	return nameservers, nil
+}
+
+// readNameservers returns the nameservers of the resolv.conf at path.
+func readNameservers(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var nameservers []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" && net.ParseIP(fields[1]) != nil {
+			nameservers = append(nameservers, hostPort(fields[1], 53))
+		}
+	}
+	return nameservers, scanner.Err()
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/util/intstr"
+)
+
+func TestExternalName(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	flb.cfg.nameservers = []string{"10.0.0.10:53"}
+	names := map[string]string{"default/db": "DB.example.com", "default/bad": "not_a_host"}
+	fetched := 0
+	flb.fetchExternalName = func(namespace, name string) (string, error) {
+		fetched++
+		return names[namespace+"/"+name], nil
+	}
+	for _, name := range []string{"db", "bad"} {
+		svc := getService([]api.ServicePort{{Port: 80, TargetPort: intstr.FromInt(80)}})
+		svc.ObjectMeta.Name = name
+		svc.ObjectMeta.ResourceVersion = "1"
+		svc.Spec.Type = serviceTypeExternalName
+		flb.svcLister.Store.Add(svc)
+	}
+
+	for i := 0; i < 2; i++ {
+		httpSvc, _, _ := flb.getServices()
+		var db *service
+		for j := range httpSvc {
+			switch httpSvc[j].Name {
+			case "db":
+				db = &httpSvc[j]
+			case "bad":
+				t.Fatalf("Expected the service with an invalid externalName to be ignored, got %+v", httpSvc[j])
+			}
+		}
+		if db == nil || db.ExternalName != "db.example.com" || len(db.Servers) != 1 || db.Servers[0].Addr != "db.example.com:80" {
+			t.Fatalf("Expected a single server resolving db.example.com, got %+v", db)
+		}
+		if i == 1 {
+			config, err := flb.backend.render(map[string][]service{"http": httpSvc})
+			if err != nil {
+				t.Fatalf("Unexpected error rendering the config: %v", err)
+			}
+			for _, expected := range []string{
+				"resolvers dns\n    nameserver dns0 10.0.0.10:53\n    hold valid 10s\n",
+				"server db.example.com:80 db.example.com:80 check port 80 inter 5 resolvers dns resolve-prefer ipv4\n",
+			} {
+				if !strings.Contains(string(config), expected) {
+					t.Fatalf("Expected %q in the config:\n%s", expected, config)
+				}
+			}
+		}
+	}
+	if fetched != 2 {
+		t.Fatalf("Expected the externalNames to be read once per service version, read %v times", fetched)
+	}
+}
+
+func TestNameservers(t *testing.T) {
+	nameservers, err := parseNameservers("10.0.0.10, 10.0.0.11:5353,fd00::10,[fd00::11]:53")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := []string{"10.0.0.10:53", "10.0.0.11:5353", "[fd00::10]:53", "[fd00::11]:53"}; !reflect.DeepEqual(nameservers, expected) {
+		t.Fatalf("Expected nameservers %v, got %v", expected, nameservers)
+	}
+	if _, err := parseNameservers("dns.example.com:53"); err == nil {
+		t.Fatalf("Expected an error for a nameserver that isn't an ip")
+	}
+
+	f, err := ioutil.TempFile("", "resolv.conf")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("search default.svc.cluster.local svc.cluster.local\nnameserver 10.0.0.10\noptions ndots:5\n")
+	f.Close()
+	if nameservers, err := readNameservers(f.Name()); err != nil || !reflect.DeepEqual(nameservers, []string{"10.0.0.10:53"}) {
+		t.Fatalf("Unexpected nameservers %v: %v", nameservers, err)
+	}
+}
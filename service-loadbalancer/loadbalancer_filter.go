@@ -0,0 +1,103 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/labels"
+	"k8s.io/kubernetes/pkg/util/sets"
+)
+
+// serviceFilter selects the services a controller loadbalances, so that
+// several controllers can share a cluster, eg: one per team.
+type serviceFilter struct {
+	// namespaces holds the namespaces of the selected services, all
+	// namespaces if it is empty.
+	namespaces sets.String
+	selector   labels.Selector
+
+	// class is the serviceloadbalancer/class of the selected services.
+	// Services without one are selected by controllers without a class.
+	class string
+}
+
+// newServiceFilter returns a filter for a comma separated list of namespaces,
+// a label selector and a class, all of which may be empty to select every
+// service without a class.
+func newServiceFilter(namespaces, selector, class string) (*serviceFilter, error) {
+	f := &serviceFilter{namespaces: sets.NewString(), selector: labels.Everything(), class: class}
+	for _, ns := range strings.Split(namespaces, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			f.namespaces.Insert(ns)
+		}
+	}
+	if selector != "" {
+		sel, err := labels.Parse(selector)
+		if err != nil {
+			return nil, err
+		}
+		f.selector = sel
+	}
+	return f, nil
+}
+
+// matches reports whether s is selected by the filter. Services with the
+// serviceloadbalancer/lb.exclude annotation are never selected.
+func (f *serviceFilter) matches(s *api.Service) bool {
+	if f.namespaces.Len() > 0 && !f.namespaces.Has(s.Namespace) {
+		return false
+	}
+	if s.Annotations[lbClass] != f.class || excluded(s) {
+		return false
+	}
+	return f.selector.Matches(labels.Set(s.Labels))
+}
+
+// excluded reports whether s opted out of loadbalancing.
+func excluded(s *api.Service) bool {
+	val, ok := s.Annotations[lbExclude]
+	if !ok {
+		return false
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		logWarningf("Ignoring invalid %v %q of service %v", lbExclude, val, s.Name)
+		return false
+	}
+	return b
+}
+
+// watchNamespaces returns the namespaces the informers have to watch, def
+// without namespaces.
+func (f *serviceFilter) watchNamespaces(def string) []string {
+	if f.namespaces.Len() == 0 {
+		return []string{def}
+	}
+	return f.namespaces.List()
+}
+
+// selected reports whether the controller loadbalances s: it matches the
+// filter, or didn't opt out without one.
+func (lbc *loadBalancerController) selected(s *api.Service) bool {
+	if lbc.filter == nil {
+		return !excluded(s)
+	}
+	return lbc.filter.matches(s)
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestServiceFilter(t *testing.T) {
+	newService := func(namespace, team string) *api.Service {
+		return &api.Service{ObjectMeta: api.ObjectMeta{
+			Name:      "svc",
+			Namespace: namespace,
+			Labels:    map[string]string{"team": team},
+		}}
+	}
+
+	f, err := newServiceFilter("", "", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !f.matches(newService("ns-a", "a")) || !reflect.DeepEqual(f.watchNamespaces("ns"), []string{"ns"}) {
+		t.Fatalf("Expected an empty filter to select everything")
+	}
+
+	f, err = newServiceFilter("ns-a, ns-b", "team=a", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testCases := []struct {
+		svc      *api.Service
+		expected bool
+	}{
+		{newService("ns-a", "a"), true},
+		{newService("ns-b", "a"), true},
+		{newService("ns-c", "a"), false},
+		{newService("ns-a", "b"), false},
+	}
+	for _, tc := range testCases {
+		if f.matches(tc.svc) != tc.expected {
+			t.Errorf("Expected %v/%v matched to be %v", tc.svc.Namespace, tc.svc.Labels, tc.expected)
+		}
+	}
+	if ns := f.watchNamespaces("ns"); !reflect.DeepEqual(ns, []string{"ns-a", "ns-b"}) {
+		t.Errorf("Expected ns-a and ns-b to be watched, got %q", ns)
+	}
+
+	f, _ = newServiceFilter("ns-a", "", "")
+	if ns := f.watchNamespaces(""); !reflect.DeepEqual(ns, []string{"ns-a"}) {
+		t.Errorf("Expected ns-a to be watched, got %q", ns)
+	}
+
+	if _, err := newServiceFilter("", "team in (a", ""); err == nil {
+		t.Errorf("Expected an invalid selector to be rejected")
+	}
+}
+
+func TestGetServicesFiltered(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	obj, _, _ := flb.svcLister.Store.GetByKey("default/svc-2")
+	obj.(*api.Service).ObjectMeta.Labels = map[string]string{"team": "a"}
+	flb.filter, _ = newServiceFilter(api.NamespaceDefault, "team=a", "")
+
+	httpSvc, httpsTermSvc, tcpSvc := flb.getServices()
+	if len(httpSvc)+len(httpsTermSvc)+len(tcpSvc) == 0 {
+		t.Fatalf("Expected the services of svc-2")
+	}
+	for _, group := range [][]service{httpSvc, httpsTermSvc, tcpSvc} {
+		for _, svc := range group {
+			if !strings.HasPrefix(svc.Name, "svc-2") {
+				t.Errorf("Expected %v to be filtered out", svc.Name)
+			}
+		}
+	}
+}
+
+func TestServiceFilterClass(t *testing.T) {
+	newService := func(annotations map[string]string) *api.Service {
+		return &api.Service{ObjectMeta: api.ObjectMeta{Name: "svc", Namespace: "ns", Annotations: annotations}}
+	}
+	unclassified, _ := newServiceFilter("", "", "")
+	internal, _ := newServiceFilter("", "", "internal")
+	testCases := []struct {
+		annotations            map[string]string
+		unclassified, internal bool
+	}{
+		{nil, true, false},
+		{map[string]string{lbClass: "internal"}, false, true},
+		{map[string]string{lbClass: "public"}, false, false},
+		{map[string]string{lbExclude: "true"}, false, false},
+		{map[string]string{lbClass: "internal", lbExclude: "true"}, false, false},
+		{map[string]string{lbExclude: "false"}, true, false},
+		{map[string]string{lbExclude: "yes please"}, true, false},
+	}
+	for _, tc := range testCases {
+		svc := newService(tc.annotations)
+		if unclassified.matches(svc) != tc.unclassified || internal.matches(svc) != tc.internal {
+			t.Errorf("Expected a service with %v to be matched %v without a class and %v with the internal class",
+				tc.annotations, tc.unclassified, tc.internal)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/runtime"
+	"k8s.io/kubernetes/pkg/util/wait"
+	"k8s.io/kubernetes/pkg/util/yaml"
+)
+
+const (
+	// fixtureQueueKey is queued for the syncs of the objects of --from-file.
+	fixtureQueueKey = "fixture"
+
+	// fixturePollInterval is how often the fixture is checked for changes.
+	fixturePollInterval = 2 * time.Second
+)
+
+// readFixture decodes the objects of a fixture, yaml or json documents of
+// objects or lists of them, eg: the output of kubectl get -o yaml.
+func readFixture(data []byte) ([]runtime.Object, error) {
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	var objects []runtime.Object
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err == io.EOF {
+			return objects, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if raw = bytes.TrimSpace(raw); len(raw) == 0 || string(raw) == "null" {
+			continue
+		}
+		obj, err := runtime.Decode(api.Codecs.UniversalDecoder(), raw)
+		if err != nil {
+			return nil, err
+		}
+		list, ok := obj.(*api.List)
+		if !ok {
+			objects = append(objects, obj)
+			continue
+		}
+		if errs := runtime.DecodeList(list.Items, api.Codecs.UniversalDecoder()); len(errs) > 0 {
+			return nil, errs[0]
+		}
+		objects = append(objects, list.Items...)
+	}
+}
+
+// loadFixture replaces the stores of the controller with the services,
+// endpoints, secrets, configmaps and pods of the fixture at path. Objects
+// without a namespace are in the default one.
+func (lbc *loadBalancerController) loadFixture(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	objects, err := readFixture(data)
+	if err != nil {
+		return fmt.Errorf("invalid fixture %v: %v", path, err)
+	}
+	svcs := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	eps := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	secrets := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	configMaps := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	pods := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for _, obj := range objects {
+		var store cache.Store
+		var meta *api.ObjectMeta
+		switch o := obj.(type) {
+		case *api.Service:
+			store, meta = svcs, &o.ObjectMeta
+		case *api.Endpoints:
+			store, meta = eps, &o.ObjectMeta
+		case *api.Secret:
+			store, meta = secrets, &o.ObjectMeta
+		case *api.ConfigMap:
+			store, meta = configMaps, &o.ObjectMeta
+		case *api.Pod:
+			store, meta = pods, &o.ObjectMeta
+		default:
+			return fmt.Errorf("unexpected %T in fixture %v, expected services, endpoints, secrets, configmaps and pods", obj, path)
+		}
+		if meta.Namespace == "" {
+			meta.Namespace = api.NamespaceDefault
+		}
+		store.Add(obj)
+	}
+
+	lbc.syncLock.Lock()
+	defer lbc.syncLock.Unlock()
+	lbc.fixture = path
+	lbc.svcLister.Store = svcs
+	lbc.epLister.Store = eps
+	lbc.secretStore = secrets
+	lbc.configMapStore = configMaps
+	lbc.podStore = pods
+	logInfo("Loaded fixture", "file", path, "services", len(svcs.List()), "endpoints", len(eps.List()))
+	return nil
+}
+
+// watchFixture loads the fixture at path again every time its content
+// changes, checked every interval, and queues a sync.
+func (lbc *loadBalancerController) watchFixture(path string, interval time.Duration, stopCh <-chan struct{}) {
+	last, _ := ioutil.ReadFile(path)
+	go wait.Until(func() {
+		data, err := ioutil.ReadFile(path)
+		if err != nil || bytes.Equal(data, last) {
+			return
+		}
+		last = data
+		if err := lbc.loadFixture(path); err != nil {
+			logWarningf("Keeping the objects of the previous fixture: %v", err)
+			return
+		}
+		lbc.queue.Add(fixtureQueueKey)
+	}, interval, stopCh)
+}
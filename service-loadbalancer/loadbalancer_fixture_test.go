@@ -0,0 +1,111 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+const testFixture = `apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: web
+  spec:
+    ports:
+    - port: 80
+      targetPort: 8080
+- apiVersion: v1
+  kind: Endpoints
+  metadata:
+    name: web
+  subsets:
+  - addresses:
+    - ip: 10.0.0.1
+    - ip: 10.0.0.2
+    ports:
+    - port: 8080
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: api
+  namespace: prod
+spec:
+  ports:
+  - port: 443
+    targetPort: 8443
+---
+{"apiVersion": "v1", "kind": "Endpoints", "metadata": {"name": "api", "namespace": "prod"}, "subsets": [{"addresses": [{"ip": "10.0.1.1"}], "ports": [{"port": 8443}]}]}
+`
+
+func writeFixture(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "fixture")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return f.Name()
+}
+
+func TestLoadFixture(t *testing.T) {
+	path := writeFixture(t, testFixture)
+	defer os.Remove(path)
+
+	flb := buildTestLoadBalancer("")
+	if err := flb.loadFixture(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !flb.informersSynced() {
+		t.Errorf("Expected the informers of a fixture to be synced")
+	}
+	httpSvc, httpsTermSvc, tcpSvc := flb.getServices()
+	backends := map[string]int{}
+	for _, svcs := range [][]service{httpSvc, httpsTermSvc, tcpSvc} {
+		for _, svc := range svcs {
+			backends[svc.objectKey] += len(svc.Ep)
+		}
+	}
+	if backends["default/web"] != 2 || backends["prod/api"] != 1 {
+		t.Errorf("Expected 2 endpoints for default/web and 1 for prod/api, got %v", backends)
+	}
+	if _, ok := backends["default/svc-1"]; ok {
+		t.Errorf("Expected the objects of the fixture to replace the previous ones, got %v", backends)
+	}
+}
+
+func TestLoadFixtureUnexpectedKind(t *testing.T) {
+	path := writeFixture(t, testFixture+"---\napiVersion: v1\nkind: Namespace\nmetadata:\n  name: prod\n")
+	defer os.Remove(path)
+
+	flb := buildTestLoadBalancer("")
+	err := flb.loadFixture(path)
+	if err == nil || !strings.Contains(err.Error(), "Namespace") {
+		t.Errorf("Expected an error for the namespace of the fixture, got %v", err)
+	}
+	if flb.fixture != "" {
+		t.Errorf("Expected the stores to be left as they are, got fixture %v", flb.fixture)
+	}
+}
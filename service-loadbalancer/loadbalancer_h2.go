@@ -0,0 +1,54 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// backendProtocols maps the values of serviceloadbalancer/lb.backendProtocol
+// to the haproxy proto of the servers. gRPC runs over h2.
+var backendProtocols = map[string]string{
+	"http": "",
+	"h2":   "h2",
+	"h2c":  "h2",
+	"grpc": "h2",
+}
+
+// getBackendProtocol returns the haproxy proto the servers of s speak, or an
+// empty string for HTTP/1.
+func getBackendProtocol(s *api.Service) string {
+	val, ok := serviceAnnotations(s.ObjectMeta.Annotations).getBackendProtocol()
+	if !ok {
+		return ""
+	}
+	proto, ok := backendProtocols[val]
+	if !ok {
+		logWarningf("Ignoring invalid %v %q of service %v", lbBackendProtocol, val, s.Name)
+	}
+	return proto
+}
+
+// speaksH2 reports whether the servers of any of svcs speak h2.
+func speaksH2(svcs []service) bool {
+	for _, svc := range svcs {
+		if svc.Proto == "h2" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestBackendProtocol(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	flb.cfg.sslCert = "/etc/haproxy/ssl.pem"
+	for _, name := range []string{"default/svc-1", "default/svc-2"} {
+		obj, _, _ := flb.svcLister.Store.GetByKey(name)
+		obj.(*api.Service).ObjectMeta.Annotations = map[string]string{lbSslTerm: "true"}
+	}
+	obj, _, _ := flb.svcLister.Store.GetByKey("default/svc-2")
+	obj.(*api.Service).ObjectMeta.Annotations[lbBackendProtocol] = "grpc"
+	obj.(*api.Service).ObjectMeta.Annotations[lbCheckPath] = "/healthz"
+	_, httpsTermSvc, _ := flb.getServices()
+	for _, svc := range httpsTermSvc {
+		if expected := map[bool]string{true: "h2"}[strings.HasPrefix(svc.Name, "svc-2")]; svc.Proto != expected {
+			t.Fatalf("Expected proto %q for %v, got %q", expected, svc.Name, svc.Proto)
+		}
+	}
+
+	defer os.Remove(flb.cfg.Config)
+	if err := writeConfig(flb, map[string][]service{"httpsTerm": httpsTermSvc}); err != nil {
+		t.Fatalf("Expected a valid HAProxy cfg, but an error was returned: %v", err)
+	}
+	cfg, _ := ioutil.ReadFile(flb.cfg.Config)
+	for _, line := range []string{
+		"bind :443 ssl crt /etc/haproxy/ssl.pem no-sslv3 alpn h2,http/1.1\n",
+		"server 1.2.3.4:80 1.2.3.4:80 check port 80 inter 5 proto h2 check-proto h2\n",
+		"server 1.2.3.4:443 1.2.3.4:443 check port 443 inter 5\n",
+	} {
+		if !strings.Contains(string(cfg), line) {
+			t.Fatalf("Expected %q in the config:\n%s", line, cfg)
+		}
+	}
+}
+
+func TestBackendProtocolInvalid(t *testing.T) {
+	svc := &api.Service{ObjectMeta: api.ObjectMeta{Name: "svc", Annotations: map[string]string{lbBackendProtocol: "spdy"}}}
+	if proto := getBackendProtocol(svc); proto != "" {
+		t.Fatalf("Expected an invalid protocol to be ignored, got %q", proto)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// headerActions are the actions of header rules, named like their haproxy
+// counterparts add-header, set-header and del-header.
+var headerActions = map[string]bool{"add": true, "set": true, "del": true}
+
+// headerRule adds, sets or deletes a request or response header in the
+// backend of a service. Value is quoted for the haproxy config, it is a
+// log-format so it can use sample fetches, eg: %[src].
+type headerRule struct {
+	Action string
+	Name   string
+	Value  string
+}
+
+// getHeaderRules returns the header rules of the annotation key of s, one
+// per line, eg: "set X-Forwarded-Proto: https" or "del Server". Invalid
+// lines are ignored.
+func getHeaderRules(s *api.Service, key string) []headerRule {
+	var rules []headerRule
+	for _, line := range strings.Split(s.ObjectMeta.Annotations[key], "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		rule, err := parseHeaderRule(line)
+		if err != nil {
+			logWarningf("Ignoring invalid %v %q of service %v: %v", key, line, s.Name, err)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// parseHeaderRule parses a single "<action> <name>[: <value>]" rule.
+func parseHeaderRule(line string) (headerRule, error) {
+	fields := strings.SplitN(line, " ", 2)
+	if len(fields) != 2 || !headerActions[fields[0]] {
+		return headerRule{}, fmt.Errorf("expected add, set or del followed by a header")
+	}
+	rule := headerRule{Action: fields[0]}
+	header := strings.SplitN(fields[1], ":", 2)
+	rule.Name = strings.TrimSpace(header[0])
+	if !validHeaderName(rule.Name) {
+		return headerRule{}, fmt.Errorf("invalid header name %q", rule.Name)
+	}
+	switch {
+	case rule.Action == "del" && len(header) == 2:
+		return headerRule{}, fmt.Errorf("del doesn't take a value")
+	case rule.Action != "del" && len(header) != 2:
+		return headerRule{}, fmt.Errorf("%v requires a value", rule.Action)
+	case rule.Action != "del":
+		rule.Value = quoteLogFormat(strings.TrimSpace(header[1]))
+	}
+	return rule, nil
+}
+
+// validHeaderName reports whether name is an http token.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c > '~' || c <= ' ' || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return false
+		}
+	}
+	return true
+}
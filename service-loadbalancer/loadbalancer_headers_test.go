@@ -0,0 +1,74 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestParseHeaderRule(t *testing.T) {
+	for line, expected := range map[string]headerRule{
+		"set X-Forwarded-Proto: https":    {Action: "set", Name: "X-Forwarded-Proto", Value: `"https"`},
+		"add X-Client: %[src] via \"lb\"": {Action: "add", Name: "X-Client", Value: `"%[src] via \"lb\""`},
+		"del Server":                      {Action: "del", Name: "Server"},
+	} {
+		if rule, err := parseHeaderRule(line); err != nil || rule != expected {
+			t.Fatalf("Expected %+v for %q, got %+v: %v", expected, line, rule, err)
+		}
+	}
+	for _, line := range []string{"drop Server", "set X-Foo", "del Server: x", "set X Foo: bar", "del"} {
+		if _, err := parseHeaderRule(line); err == nil {
+			t.Fatalf("Expected an error for %q", line)
+		}
+	}
+}
+
+func TestHeaderRules(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	obj, _, _ := flb.svcLister.Store.GetByKey("default/svc-2")
+	obj.(*api.Service).ObjectMeta.Annotations = map[string]string{
+		lbRequestHeaders:  "set X-Forwarded-Proto: https\n oops\n",
+		lbResponseHeaders: "del Server",
+	}
+	httpSvc, _, _ := flb.getServices()
+	for _, svc := range httpSvc {
+		if svc.Name != "svc-2" {
+			continue
+		}
+		expected := []headerRule{{Action: "set", Name: "X-Forwarded-Proto", Value: `"https"`}}
+		if !reflect.DeepEqual(svc.RequestHeaders, expected) {
+			t.Fatalf("Expected request header rules %+v, got %+v", expected, svc.RequestHeaders)
+		}
+	}
+
+	config, err := flb.backend.render(map[string][]service{"http": httpSvc})
+	if err != nil {
+		t.Fatalf("Unexpected error rendering the config: %v", err)
+	}
+	for _, line := range []string{
+		"    http-request set-header X-Forwarded-Proto \"https\"\n",
+		"    http-response del-header Server\n",
+	} {
+		if !strings.Contains(string(config), line) {
+			t.Fatalf("Expected %q in the config:\n%s", line, config)
+		}
+	}
+}
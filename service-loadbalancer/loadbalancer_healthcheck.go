@@ -0,0 +1,99 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// defaultCheckInterval is the haproxy inter of servers without a
+// serviceloadbalancer/lb.checkInterval annotation.
+const defaultCheckInterval = "5"
+
+// healthCheck is how haproxy checks the servers of a backend. Without a
+// Path, servers are checked by opening a tcp connection to Port.
+// http://cbonte.github.io/haproxy-dconv/configuration-1.5.html#5.2-check
+type healthCheck struct {
+	// Path and Status make it an http check, expecting Status in the
+	// response to a GET of Path, or any 2xx or 3xx without one.
+	Path   string
+	Status int
+
+	Port     int
+	Interval string
+	Rise     int
+	Fall     int
+}
+
+// getHealthCheck returns the health check of s from its annotations. Invalid
+// annotations are ignored, falling back to a tcp check of backendPort.
+func getHealthCheck(s *api.Service, backendPort int) healthCheck {
+	annotations := serviceAnnotations(s.ObjectMeta.Annotations)
+	check := healthCheck{Port: backendPort, Interval: defaultCheckInterval}
+	invalid := func(key, val string) {
+		logWarningf("Ignoring invalid %v %q of service %v", key, val, s.Name)
+	}
+
+	if val, ok := annotations.getCheckPath(); ok {
+		if strings.HasPrefix(val, "/") && !strings.ContainsAny(val, " \t") {
+			check.Path = val
+		} else {
+			invalid(lbCheckPath, val)
+		}
+	}
+	if val, ok := annotations.getCheckStatus(); ok {
+		if n, err := strconv.Atoi(val); err == nil && n >= 100 && n < 600 {
+			check.Status = n
+		} else {
+			invalid(lbCheckStatus, val)
+		}
+	}
+	if val, ok := annotations.getCheckPort(); ok {
+		if n, err := strconv.Atoi(val); err == nil && n > 0 && n < 65536 {
+			check.Port = n
+		} else {
+			invalid(lbCheckPort, val)
+		}
+	}
+	if val, ok := annotations.getCheckInterval(); ok {
+		if d, err := time.ParseDuration(val); err == nil && d >= time.Millisecond {
+			check.Interval = fmt.Sprintf("%dms", int64(d/time.Millisecond))
+		} else {
+			invalid(lbCheckInterval, val)
+		}
+	}
+	if val, ok := annotations.getCheckRise(); ok {
+		if n, err := strconv.Atoi(val); err == nil && n > 0 {
+			check.Rise = n
+		} else {
+			invalid(lbCheckRise, val)
+		}
+	}
+	if val, ok := annotations.getCheckFall(); ok {
+		if n, err := strconv.Atoi(val); err == nil && n > 0 {
+			check.Fall = n
+		} else {
+			invalid(lbCheckFall, val)
+		}
+	}
+	return check
+}
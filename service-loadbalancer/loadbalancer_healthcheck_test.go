@@ -0,0 +1,70 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestHealthCheck(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	obj, _, _ := flb.svcLister.Store.GetByKey("default/svc-2")
+	obj.(*api.Service).ObjectMeta.Annotations = map[string]string{
+		lbCheckPath:     "/healthz",
+		lbCheckStatus:   "204",
+		lbCheckPort:     "8080",
+		lbCheckInterval: "2s",
+		lbCheckRise:     "3",
+		lbCheckFall:     "oops",
+	}
+	httpSvc, _, tcpSvc := flb.getServices()
+
+	expected := healthCheck{Path: "/healthz", Status: 204, Port: 8080, Interval: "2000ms", Rise: 3}
+	for _, svc := range httpSvc {
+		if svc.Name == "svc-1:443" && svc.Check != (healthCheck{Port: 443, Interval: defaultCheckInterval}) {
+			t.Fatalf("Expected the default health check for %v, got %+v", svc.Name, svc.Check)
+		}
+		if svc.Name == "svc-2" && svc.Check != expected {
+			t.Fatalf("Expected health check %+v for %v, got %+v", expected, svc.Name, svc.Check)
+		}
+	}
+
+	defer os.Remove(flb.cfg.Config)
+	if err := writeConfig(flb,
+		map[string][]service{
+			"http": httpSvc,
+			"tcp":  tcpSvc,
+		}); err != nil {
+		t.Fatalf("Expected at least one tcp or http service: %v", err)
+	}
+	cfg, _ := ioutil.ReadFile(flb.cfg.Config)
+	for _, line := range []string{
+		"option httpchk GET /healthz",
+		"http-check expect status 204",
+		"server 1.2.3.4:80 1.2.3.4:80 check port 8080 inter 2000ms rise 3",
+		"server 1.2.3.4:443 1.2.3.4:443 check port 443 inter 5\n",
+	} {
+		if !strings.Contains(string(cfg), line) {
+			t.Fatalf("Expected %q in the config:\n%s", line, cfg)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// Kinds of hosts, in the order of their precedence: an exact host, a
+// wildcard *.example.com matching any subdomain, and a regular expression
+// prefixed with ~, eg: ~^api[0-9]+\.example\.com$.
+const (
+	exactHost = iota
+	wildcardHost
+	regexHost
+)
+
+// hostPattern matches the dns names of exact hosts, optionally followed by
+// the port of the host header, and the parent domain of wildcard hosts.
+var hostPattern = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9]*[A-Za-z0-9])?(\.[A-Za-z0-9]([-A-Za-z0-9]*[A-Za-z0-9])?)*(:[0-9]+)?$`)
+
+// hostKind returns the kind of host.
+func hostKind(host string) int {
+	switch {
+	case strings.HasPrefix(host, "~"):
+		return regexHost
+	case strings.HasPrefix(host, "*."):
+		return wildcardHost
+	}
+	return exactHost
+}
+
+// getHost returns the host routed to s, empty when it has none or it is
+// invalid.
+func getHost(s *api.Service) string {
+	val, ok := serviceAnnotations(s.ObjectMeta.Annotations).getHost()
+	if !ok {
+		return ""
+	}
+	var valid bool
+	switch hostKind(val) {
+	case regexHost:
+		_, err := regexp.Compile(val[1:])
+		valid = err == nil && len(val) > 1 && printableWord(val)
+	case wildcardHost:
+		valid = hostPattern.MatchString(val[2:])
+	default:
+		valid = hostPattern.MatchString(val)
+	}
+	if !valid {
+		logWarningf("Ignoring invalid %v %q of service %v", lbHostKey, val, s.Name)
+		return ""
+	}
+	return val
+}
+
+// printableWord reports whether val is a single word of the haproxy config:
+// printable ascii without spaces, or the # starting a comment.
+func printableWord(val string) bool {
+	for _, r := range val {
+		if r <= ' ' || r > '~' || r == '#' {
+			return false
+		}
+	}
+	return true
+}
+
+// hostACL returns the haproxy criterion matching host with the host header,
+// or with the sni of the connection if sni is set. Exact hosts keep the
+// case sensitive match of the host header.
+func hostACL(host string, sni bool) string {
+	fetch, exact := "hdr", "hdr(host)"
+	if sni {
+		fetch, exact = "ssl_fc_sni", "ssl_fc_sni -i"
+	}
+	switch hostKind(host) {
+	case regexHost:
+		if sni {
+			return fetch + "_reg -i " + host[1:]
+		}
+		return fetch + "_reg(host) -i " + host[1:]
+	case wildcardHost:
+		if sni {
+			return fetch + "_end -i " + host[1:]
+		}
+		return fetch + "_end(host) -i " + host[1:]
+	}
+	return exact + " " + host
+}
+
+// hostOrder returns svcs in the order their host routes must be evaluated:
+// exact hosts and services without one first, then wildcards, longest
+// first, then regular expressions, each by name.
+func hostOrder(svcs []service) []service {
+	ordered := append([]service{}, svcs...)
+	sort.Stable(byHostPrecedence(ordered))
+	return ordered
+}
+
+type byHostPrecedence []service
+
+func (h byHostPrecedence) Len() int {
+	return len(h)
+}
+func (h byHostPrecedence) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+func (h byHostPrecedence) Less(i, j int) bool {
+	return compareHosts(h[i].Host, h[j].Host) < 0
+}
+
+// compareHosts returns -1 if the routes of host a must be evaluated before
+// the ones of b, 1 if after, and 0 if their order doesn't matter.
+func compareHosts(a, b string) int {
+	ka, kb := hostKind(a), hostKind(b)
+	switch {
+	case ka != kb:
+		if ka < kb {
+			return -1
+		}
+		return 1
+	case ka == wildcardHost && len(a) > len(b):
+		return -1
+	case ka == wildcardHost && len(a) < len(b):
+		return 1
+	}
+	return 0
+}
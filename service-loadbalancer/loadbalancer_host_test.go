@@ -0,0 +1,108 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestGetHost(t *testing.T) {
+	for host, expected := range map[string]string{
+		"foo.bar":                "foo.bar",
+		"*.foo.bar":              "*.foo.bar",
+		`~^api[0-9]+\.foo\.bar$`: `~^api[0-9]+\.foo\.bar$`,
+		"*.*.foo.bar":            "",
+		"foo.*.bar":              "",
+		"*":                      "",
+		"~":                      "",
+		"~api(":                  "",
+		"foo.bar:8080":           "foo.bar:8080",
+		"foo.bar baz":            "",
+		"foo.bar\nbind :1":       "",
+		"*.foo.bar\rbind :1":     "",
+		"~^foo\nbind :1":         "",
+		"foo_bar":                "",
+		"-foo.bar":               "",
+		"":                       "",
+	} {
+		s := &api.Service{ObjectMeta: api.ObjectMeta{Name: "svc", Annotations: map[string]string{lbHostKey: host}}}
+		if got := getHost(s); got != expected {
+			t.Errorf("Expected host %q for %q, got %q", expected, host, got)
+		}
+	}
+}
+
+func TestHostACL(t *testing.T) {
+	for _, test := range []struct {
+		host, acl, sni string
+	}{
+		{"foo.bar", "hdr(host) foo.bar", "ssl_fc_sni -i foo.bar"},
+		{"*.foo.bar", "hdr_end(host) -i .foo.bar", "ssl_fc_sni_end -i .foo.bar"},
+		{`~^api[0-9]+\.foo\.bar$`, `hdr_reg(host) -i ^api[0-9]+\.foo\.bar$`, `ssl_fc_sni_reg -i ^api[0-9]+\.foo\.bar$`},
+	} {
+		if acl := hostACL(test.host, false); acl != test.acl {
+			t.Errorf("Expected %q for %v, got %q", test.acl, test.host, acl)
+		}
+		if sni := hostACL(test.host, true); sni != test.sni {
+			t.Errorf("Expected %q for the sni of %v, got %q", test.sni, test.host, sni)
+		}
+	}
+}
+
+func TestHostOrder(t *testing.T) {
+	svcs := hostOrder([]service{
+		{Name: "a", Host: "~^foo"},
+		{Name: "b", Host: "*.bar"},
+		{Name: "c", Host: "*.foo.bar"},
+		{Name: "d"},
+		{Name: "e", Host: "x.foo.bar"},
+	})
+	var names []string
+	for _, svc := range svcs {
+		names = append(names, svc.Name)
+	}
+	if strings.Join(names, ",") != "d,e,c,b,a" {
+		t.Fatalf("Expected services d,e,c,b,a, got %v", names)
+	}
+}
+
+func TestWildcardHostRoutes(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	obj, _, _ := flb.svcLister.Store.GetByKey("default/svc-1")
+	obj.(*api.Service).ObjectMeta.Annotations = map[string]string{lbHostKey: "*.foo.bar"}
+	obj, _, _ = flb.svcLister.Store.GetByKey("default/svc-2")
+	obj.(*api.Service).ObjectMeta.Annotations = map[string]string{lbHostKey: "www.foo.bar"}
+	httpSvc, _, _ := flb.getServices()
+	config, err := flb.backend.render(map[string][]service{"http": httpSvc})
+	if err != nil {
+		t.Fatalf("Unexpected error rendering the config: %v", err)
+	}
+	for _, line := range []string{
+		"acl host_acl_svc-1 hdr_end(host) -i .foo.bar\n",
+		"acl host_acl_svc-2 hdr(host) www.foo.bar\n",
+	} {
+		if !strings.Contains(string(config), line) {
+			t.Fatalf("Expected %q in the config:\n%s", line, config)
+		}
+	}
+	if strings.Index(string(config), "use_backend svc-2 ") > strings.Index(string(config), "use_backend svc-1 ") {
+		t.Fatalf("Expected the exact host before the wildcard:\n%s", config)
+	}
+}
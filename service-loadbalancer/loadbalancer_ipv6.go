@@ -0,0 +1,60 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// ipFamilies maps the ip families frontends can bind to the option of the
+// wildcard ipv6 address they bind in haproxy. ipv4 frontends bind *.
+var ipFamilies = map[string]string{
+	"ipv4": "",
+	"ipv6": "v6only",
+	"dual": "v4v6",
+}
+
+// getIPv6Bind returns the ipv6 bind option of the frontend of a tcp service,
+// def unless the service overrides the ip family.
+func getIPv6Bind(s *api.Service, def string) string {
+	val, ok := serviceAnnotations(s.ObjectMeta.Annotations).getIPFamily()
+	if !ok {
+		return def
+	}
+	option, ok := ipFamilies[val]
+	if !ok {
+		logWarningf("Ignoring invalid %v %q of service %v", lbIPFamily, val, s.Name)
+		return def
+	}
+	return option
+}
+
+// hostPort returns the address of an endpoint, with brackets around ipv6
+// addresses.
+func hostPort(ip string, port int) string {
+	return net.JoinHostPort(ip, strconv.Itoa(port))
+}
+
+// serverName returns the name of the server of an endpoint, haproxy doesn't
+// allow the brackets of ipv6 addresses in names.
+func serverName(ep string) string {
+	return strings.NewReplacer("[", "", "]", "").Replace(ep)
+}
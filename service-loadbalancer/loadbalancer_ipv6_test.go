@@ -0,0 +1,76 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestIPv6(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	flb.cfg.ipFamily = "dual"
+	flb.tcpServices = map[string]int{"svc-1": 443}
+	obj, _, _ := flb.epLister.Store.GetByKey("default/svc-2")
+	obj.(*api.Endpoints).Subsets[0].Addresses = []api.EndpointAddress{{IP: "fd00::1"}}
+	obj, _, _ = flb.svcLister.Store.GetByKey("default/svc-1")
+	obj.(*api.Service).ObjectMeta.Annotations = map[string]string{lbIPFamily: "ipv4"}
+	httpSvc, _, tcpSvc := flb.getServices()
+
+	for _, svc := range httpSvc {
+		if svc.Name == "svc-2" && svc.Servers[0] != (backendServer{Name: "fd00::1:80", Addr: "[fd00::1]:80"}) {
+			t.Fatalf("Expected a bracketed ipv6 server address, got %+v", svc.Servers[0])
+		}
+	}
+	if len(tcpSvc) != 1 || tcpSvc[0].IPv6Bind != "" {
+		t.Fatalf("Expected the tcp service to bind ipv4 only, got %+v", tcpSvc)
+	}
+
+	services := map[string][]service{"http": httpSvc, "tcp": tcpSvc}
+	config, err := flb.backend.render(services)
+	if err != nil {
+		t.Fatalf("Unexpected error rendering the config: %v", err)
+	}
+	for _, line := range []string{
+		"bind :::1936 v4v6\n",
+		"bind :::80 v4v6\n",
+		"bind *:443\n",
+		"server fd00::1:80 [fd00::1]:80",
+	} {
+		if !strings.Contains(string(config), line) {
+			t.Fatalf("Expected %q in the config:\n%s", line, config)
+		}
+	}
+
+	flb.cfg.Template, _ = filepath.Abs("nginx_template.cfg")
+	config, err = (&nginxBackend{loadBalancerConfig: flb.cfg}).render(services)
+	if err != nil {
+		t.Fatalf("Unexpected error rendering the nginx config: %v", err)
+	}
+	for _, line := range []string{
+		"listen [::]:80 default_server ipv6only=off;",
+		"listen 443;",
+		"server [fd00::1]:80;",
+	} {
+		if !strings.Contains(string(config), line) {
+			t.Fatalf("Expected %q in the nginx config:\n%s", line, config)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	goflag "flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// The controller logs through the functions below rather than glog, so with
+// --log-format=json each entry is written as json by the call, with its
+// fields, and fatal entries are written before the controller exits. They
+// log through glog otherwise, the fields ending the message as key=value
+// pairs.
+
+var (
+	// jsonLogs is set by logToJSON, and jsonLogOut is the stderr entries are
+	// written to, locked by jsonLogLock.
+	jsonLogs    bool
+	jsonLogOut  io.Writer = os.Stderr
+	jsonLogLock sync.Mutex
+
+	// glogHeader matches the header of glog lines, eg:
+	// I1015 12:34:56.789012   12345 file.go:42] message
+	glogHeader = regexp.MustCompile(`^([IWEF])\d{4} \d{2}:\d{2}:\d{2}\.\d{6}\s+\d+ ([^\]]+)\] (.*)$`)
+
+	glogLevels = map[string]string{"I": "info", "W": "warning", "E": "error", "F": "fatal"}
+)
+
+// logInfo logs msg with the fields of keysAndValues, eg:
+// logInfo("Reloaded haproxy", "reload_duration", 0.2). Keys are lower case
+// with underscores.
+func logInfo(msg string, keysAndValues ...interface{}) { writeLog("info", msg, keysAndValues) }
+
+// logWarning logs msg as a warning with the fields of keysAndValues.
+func logWarning(msg string, keysAndValues ...interface{}) {
+	writeLog("warning", msg, keysAndValues)
+}
+
+func logInfof(format string, args ...interface{}) {
+	writeLog("info", fmt.Sprintf(format, args...), nil)
+}
+
+func logWarningf(format string, args ...interface{}) {
+	writeLog("warning", fmt.Sprintf(format, args...), nil)
+}
+
+func logErrorf(format string, args ...interface{}) {
+	writeLog("error", fmt.Sprintf(format, args...), nil)
+}
+
+// logFatalf logs and exits.
+func logFatalf(format string, args ...interface{}) {
+	writeLog("fatal", fmt.Sprintf(format, args...), nil)
+}
+
+// logVerbose logs when the verbosity of the controller, -v, is at least the
+// level it was returned for.
+type logVerbose bool
+
+func logV(level glog.Level) logVerbose { return logVerbose(glog.V(level)) }
+
+func (v logVerbose) Info(msg string, keysAndValues ...interface{}) {
+	if v {
+		writeLog("info", msg, keysAndValues)
+	}
+}
+
+func (v logVerbose) Infof(format string, args ...interface{}) {
+	if v {
+		writeLog("info", fmt.Sprintf(format, args...), nil)
+	}
+}
+
+// writeLog writes an entry at level for the caller of the log function
+// calling it.
+func writeLog(level, msg string, keysAndValues []interface{}) {
+	if !jsonLogs {
+		text := msg + logFields(keysAndValues...)
+		switch level {
+		case "info":
+			glog.InfoDepth(2, text)
+		case "warning":
+			glog.WarningDepth(2, text)
+		case "error":
+			glog.ErrorDepth(2, text)
+		default:
+			glog.FatalDepth(2, text)
+		}
+		return
+	}
+	caller := "???:1"
+	if _, file, line, ok := runtime.Caller(2); ok {
+		caller = fmt.Sprintf("%v:%v", filepath.Base(file), line)
+	}
+	writeJSONLog(jsonLogEntry(level, caller, msg, keysAndValues, time.Now()))
+	if level == "fatal" {
+		os.Exit(255)
+	}
+}
+
+// writeJSONLog writes an entry to stderr, a line at a time.
+func writeJSONLog(data []byte) {
+	jsonLogLock.Lock()
+	defer jsonLogLock.Unlock()
+	jsonLogOut.Write(append(data, '\n'))
+}
+
+// logFields formats key value pairs as they end text logs, eg:
+// ` service=web error="not found"`.
+func logFields(keysAndValues ...interface{}) string {
+	var b bytes.Buffer
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		val := fmt.Sprint(keysAndValues[i+1])
+		if val == "" || strings.ContainsAny(val, " \t\n\"\\=") {
+			val = strconv.Quote(val)
+		}
+		fmt.Fprintf(&b, " %v=%v", keysAndValues[i], val)
+	}
+	return b.String()
+}
+
+// jsonLogEntry returns a json log entry with the fields of keysAndValues.
+// Numbers stay numbers, errors and other values are formatted as strings.
+func jsonLogEntry(level, caller, msg string, keysAndValues []interface{}, now time.Time) []byte {
+	entry := map[string]interface{}{}
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		key := fmt.Sprint(keysAndValues[i])
+		switch val := keysAndValues[i+1].(type) {
+		case int, int32, int64, float32, float64, bool:
+			entry[key] = val
+		default:
+			entry[key] = fmt.Sprint(val)
+		}
+	}
+	entry["time"] = now.UTC().Format(time.RFC3339Nano)
+	entry["level"] = level
+	entry["caller"] = caller
+	entry["msg"] = msg
+	data, _ := json.Marshal(entry)
+	return data
+}
+
+// convertLogs writes the glog lines of r, logged by libraries like the api
+// client, to stderr as json with the level and caller of their header.
+// Lines without a header, like the continuation of a multi-line message,
+// keep the level of the previous one.
+func convertLogs(r io.Reader) {
+	in := bufio.NewReader(r)
+	level, caller := "info", ""
+	for {
+		line, err := in.ReadString('\n')
+		if msg := strings.TrimSuffix(line, "\n"); msg != "" {
+			if m := glogHeader.FindStringSubmatch(msg); m != nil {
+				level, caller, msg = glogLevels[m[1]], m[2], m[3]
+			}
+			writeJSONLog(jsonLogEntry(level, caller, msg, nil, time.Now()))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// logToJSON makes the controller log json to stderr. Libraries still log
+// through glog, whose lines go through a pipe to be converted.
+func logToJSON() error {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	if err := goflag.Set("logtostderr", "true"); err != nil {
+		return err
+	}
+	jsonLogOut = os.Stderr
+	jsonLogs = true
+	go convertLogs(r)
+	os.Stderr = w
+	return nil
+}
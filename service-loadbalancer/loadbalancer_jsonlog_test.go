@@ -0,0 +1,93 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogFields(t *testing.T) {
+	fields := logFields("service", "web", "reload_duration", 0.25, "error", `bad "config"`, "output", "")
+	expected := ` service=web reload_duration=0.25 error="bad \"config\"" output=""`
+	if fields != expected {
+		t.Fatalf("Expected %q, got %q", expected, fields)
+	}
+}
+
+func TestJSONLogEntry(t *testing.T) {
+	now := time.Date(2016, 10, 15, 12, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		level, msg    string
+		keysAndValues []interface{}
+		expected      string
+	}{
+		{
+			"info", "Reloaded haproxy", []interface{}{"reload_duration", 0.5, "output", "ok"},
+			`{"caller":"a.go:1","level":"info","msg":"Reloaded haproxy","output":"ok","reload_duration":0.5,"time":"2016-10-15T12:00:00Z"}`,
+		},
+		{
+			"warning", "Not exposing service", []interface{}{"service", "web", "error", fmt.Errorf("secret a b not found")},
+			`{"caller":"a.go:1","error":"secret a b not found","level":"warning","msg":"Not exposing service","service":"web","time":"2016-10-15T12:00:00Z"}`,
+		},
+		{
+			// Messages ending like fields are kept as they are.
+			"error", "Invalid value x=1", nil,
+			`{"caller":"a.go:1","level":"error","msg":"Invalid value x=1","time":"2016-10-15T12:00:00Z"}`,
+		},
+	} {
+		if data := jsonLogEntry(test.level, "a.go:1", test.msg, test.keysAndValues, now); string(data) != test.expected {
+			t.Errorf("Expected %v for %q, got %s", test.expected, test.msg, data)
+		}
+	}
+}
+
+func TestConvertLogs(t *testing.T) {
+	var out bytes.Buffer
+	jsonLogOut = &out
+	defer func() { jsonLogOut = os.Stderr }()
+	convertLogs(strings.NewReader("E1015 12:00:00.000000   42 a.go:1] first x=1\nsecond"))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"msg":"first x=1"`) {
+		t.Fatalf("Expected the lines of libraries to be converted as they are, got %v", lines)
+	}
+	if !strings.Contains(lines[1], `"level":"error"`) || !strings.Contains(lines[1], `"msg":"second"`) {
+		t.Fatalf("Expected the continuation to keep the level of the entry, got %v", lines)
+	}
+}
+
+func TestFatalJSONLog(t *testing.T) {
+	if os.Getenv("TEST_FATAL_JSON_LOG") != "" {
+		logToJSON()
+		logFatalf("Invalid flag %v", "x")
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=TestFatalJSONLog")
+	cmd.Env = append(os.Environ(), "TEST_FATAL_JSON_LOG=1")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err == nil {
+		t.Fatalf("Expected the fatal log to exit")
+	}
+	if !strings.Contains(stderr.String(), `"level":"fatal","msg":"Invalid flag x"`) {
+		t.Fatalf("Expected the fatal entry to be written before the exit, got %q", stderr.String())
+	}
+}
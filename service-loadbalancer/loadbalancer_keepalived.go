@@ -0,0 +1,202 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"text/template"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/util/wait"
+)
+
+// vipPeerRefreshInterval is how often the pods of --vip-peer-selector are
+// listed for the unicast peers of keepalived.
+const vipPeerRefreshInterval = 10 * time.Second
+
+// keepalived runs a keepalived process floating a virtual ip between the
+// nodes of the loadbalancer. All of them are backups without preemption, so
+// the ip stays where it is until the check script fails there.
+type keepalived struct {
+	// vip is the virtual ip with its prefix length, eg: 10.0.0.100/24.
+	vip         string
+	iface       string
+	routerID    int
+	priority    int
+	peers       []string
+	checkScript string
+	config      string
+
+	// staticPeers are the peers of --vip-peers, kept when the pods of
+	// --vip-peer-selector are added to peers.
+	staticPeers []string
+
+	mu      sync.Mutex
+	process *os.Process
+}
+
+// parseVIP returns vip in cidr notation, with a host prefix length when it
+// has none, and its address.
+func parseVIP(vip string) (string, string, error) {
+	if !strings.Contains(vip, "/") {
+		ip := net.ParseIP(vip)
+		if ip == nil {
+			return "", "", fmt.Errorf("invalid virtual ip %q", vip)
+		}
+		if ip.To4() != nil {
+			return vip + "/32", vip, nil
+		}
+		return vip + "/128", vip, nil
+	}
+	ip, _, err := net.ParseCIDR(vip)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid virtual ip %q: %v", vip, err)
+	}
+	return vip, ip.String(), nil
+}
+
+// parsePeers returns the ips of a comma separated list.
+func parsePeers(peers string) ([]string, error) {
+	var parsed []string
+	for _, peer := range strings.Split(peers, ",") {
+		if peer = strings.TrimSpace(peer); peer == "" {
+			continue
+		}
+		if net.ParseIP(peer) == nil {
+			return nil, fmt.Errorf("invalid peer ip %q", peer)
+		}
+		parsed = append(parsed, peer)
+	}
+	return parsed, nil
+}
+
+// podPeers returns the ips of the running pods, without self, sorted.
+func podPeers(pods []api.Pod, self string) []string {
+	peers := []string{}
+	for _, pod := range pods {
+		ip := pod.Status.PodIP
+		if pod.Status.Phase != api.PodRunning || ip == "" || ip == self {
+			continue
+		}
+		peers = append(peers, ip)
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// setPeers sets the peers to the static ones and discovered, reporting
+// whether they changed.
+func (k *keepalived) setPeers(discovered []string) bool {
+	peers := append([]string{}, k.staticPeers...)
+	for _, peer := range discovered {
+		static := false
+		for _, s := range k.staticPeers {
+			static = static || s == peer
+		}
+		if !static {
+			peers = append(peers, peer)
+		}
+	}
+	if reflect.DeepEqual(peers, k.peers) {
+		return false
+	}
+	k.peers = peers
+	return true
+}
+
+// watchPeers keeps the unicast peers of keepalived in sync with the ips
+// returned by list, rewriting its config and reloading it when they change.
+func (k *keepalived) watchPeers(list func() ([]string, error), tmplPath string, stopCh <-chan struct{}) {
+	wait.Until(func() {
+		discovered, err := list()
+		if err != nil {
+			logWarningf("Unable to list the vrrp peers: %v", err)
+			return
+		}
+		if !k.setPeers(discovered) {
+			return
+		}
+		logInfof("vrrp peers changed to %v", strings.Join(k.peers, ","))
+		if err := k.writeConfig(tmplPath); err != nil {
+			logWarningf("Unable to write the keepalived config: %v", err)
+			return
+		}
+		k.reload()
+	}, vipPeerRefreshInterval, stopCh)
+}
+
+// reload makes keepalived read its config again.
+func (k *keepalived) reload() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.process == nil {
+		return
+	}
+	if err := k.process.Signal(syscall.SIGHUP); err != nil {
+		logWarningf("Unable to reload keepalived: %v", err)
+	}
+}
+
+// writeConfig renders the keepalived template into the config file.
+func (k *keepalived) writeConfig(tmplPath string) error {
+	tmpl, err := template.ParseFiles(tmplPath)
+	if err != nil {
+		return err
+	}
+	w, err := os.Create(k.config)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	conf := map[string]interface{}{
+		"vip":         k.vip,
+		"iface":       k.iface,
+		"routerID":    k.routerID,
+		"priority":    k.priority,
+		"peers":       k.peers,
+		"checkScript": k.checkScript,
+	}
+	return tmpl.Execute(w, conf)
+}
+
+// run starts keepalived in the foreground, and exits when it dies so the
+// pod is restarted instead of silently losing the virtual ip.
+func (k *keepalived) run() {
+	cmd := exec.Command("keepalived", "--dont-fork", "--log-console", "--release-vips", "-f", k.config)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	logInfof("Starting keepalived for virtual ip %v on %v", k.vip, k.iface)
+	if err := cmd.Start(); err != nil {
+		logFatalf("keepalived error: %v", err)
+	}
+	k.mu.Lock()
+	k.process = cmd.Process
+	k.mu.Unlock()
+	if err := cmd.Wait(); err != nil {
+		logFatalf("keepalived error: %v", err)
+	}
+	logFatalf("keepalived exited")
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestParseVIP(t *testing.T) {
+	for vip, expected := range map[string][2]string{
+		"10.0.0.100":    {"10.0.0.100/32", "10.0.0.100"},
+		"10.0.0.100/24": {"10.0.0.100/24", "10.0.0.100"},
+		"fd00::100":     {"fd00::100/128", "fd00::100"},
+	} {
+		cidr, addr, err := parseVIP(vip)
+		if err != nil || cidr != expected[0] || addr != expected[1] {
+			t.Fatalf("Expected %v for %v, got %v %v: %v", expected, vip, cidr, addr, err)
+		}
+	}
+	for _, vip := range []string{"", "10.0.0", "10.0.0.100/33"} {
+		if _, _, err := parseVIP(vip); err == nil {
+			t.Fatalf("Expected an error for %q", vip)
+		}
+	}
+	if _, err := parsePeers("10.0.0.1, oops"); err == nil {
+		t.Fatalf("Expected an error for an invalid peer")
+	}
+}
+
+func TestKeepalivedConfig(t *testing.T) {
+	config, _ := ioutil.TempFile("", "keepalived")
+	config.Close()
+	defer os.Remove(config.Name())
+	peers, _ := parsePeers("10.0.0.2,10.0.0.3")
+	k := &keepalived{
+		vip:         "10.0.0.100/24",
+		iface:       "eth1",
+		routerID:    51,
+		priority:    150,
+		peers:       peers,
+		checkScript: "/keepalived_check",
+		config:      config.Name(),
+	}
+	if err := k.writeConfig("keepalived.tmpl"); err != nil {
+		t.Fatalf("Unexpected error writing the config: %v", err)
+	}
+	out, _ := ioutil.ReadFile(config.Name())
+	for _, line := range []string{
+		"script \"/keepalived_check\"\n",
+		"interface eth1\n",
+		"virtual_router_id 51\n",
+		"priority 150\n",
+		"unicast_peer {\n    10.0.0.2\n    10.0.0.3\n  }",
+		"track_script {\n    check_loadbalancer\n  }",
+		"10.0.0.100/24 dev eth1\n",
+	} {
+		if !strings.Contains(string(out), line) {
+			t.Fatalf("Expected %q in the keepalived config:\n%s", line, out)
+		}
+	}
+}
+
+func TestVRRPPeers(t *testing.T) {
+	pod := func(ip string, phase api.PodPhase) api.Pod {
+		return api.Pod{Status: api.PodStatus{PodIP: ip, Phase: phase}}
+	}
+	pods := []api.Pod{
+		pod("10.0.0.3", api.PodRunning),
+		pod("10.0.0.1", api.PodRunning),
+		pod("10.0.0.2", api.PodRunning),
+		pod("10.0.0.4", api.PodPending),
+		pod("", api.PodRunning),
+	}
+	discovered := podPeers(pods, "10.0.0.2")
+	if !reflect.DeepEqual(discovered, []string{"10.0.0.1", "10.0.0.3"}) {
+		t.Fatalf("Unexpected peers %v", discovered)
+	}
+
+	k := &keepalived{staticPeers: []string{"10.1.0.1", "10.0.0.3"}}
+	if !k.setPeers(discovered) {
+		t.Errorf("Expected the peers to change")
+	}
+	if !reflect.DeepEqual(k.peers, []string{"10.1.0.1", "10.0.0.3", "10.0.0.1"}) {
+		t.Errorf("Unexpected peers %v", k.peers)
+	}
+	if k.setPeers(discovered) {
+		t.Errorf("Expected the same peers not to change")
+	}
+	if !k.setPeers(nil) || !reflect.DeepEqual(k.peers, k.staticPeers) {
+		t.Errorf("Expected only the static peers without pods, got %v", k.peers)
+	}
+}
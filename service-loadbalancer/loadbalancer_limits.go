@@ -0,0 +1,98 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// backendLimits are the connection limits and timeouts of the backend of a
+// service. Zero limits are unlimited, and empty timeouts are the ones of the
+// defaults section, see the timeout flags.
+// http://cbonte.github.io/haproxy-dconv/configuration-1.5.html#5.2-maxconn
+type backendLimits struct {
+	// MaxConn is the number of concurrent connections of each server,
+	// MaxQueue the number of connections waiting for one of its slots.
+	MaxConn  int
+	MaxQueue int
+
+	TimeoutConnect string
+	TimeoutServer  string
+	TimeoutQueue   string
+
+	// TimeoutClient only applies to tcp services, http services share
+	// their frontends.
+	TimeoutClient string
+}
+
+// haproxyTime formats d as a haproxy time, in seconds when it can.
+func haproxyTime(d time.Duration) string {
+	if d%time.Second == 0 {
+		return fmt.Sprintf("%ds", int64(d/time.Second))
+	}
+	return fmt.Sprintf("%dms", int64(d/time.Millisecond))
+}
+
+// getBackendLimits returns the limits of s from its annotations, def unless
+// overridden. Invalid annotations are ignored.
+func getBackendLimits(s *api.Service, def backendLimits, tcp bool) backendLimits {
+	annotations := serviceAnnotations(s.ObjectMeta.Annotations)
+	limits := def
+	invalid := func(key, val string) {
+		logWarningf("Ignoring invalid %v %q of service %v", key, val, s.Name)
+	}
+
+	for key, limit := range map[string]*int{
+		lbMaxConn:  &limits.MaxConn,
+		lbMaxQueue: &limits.MaxQueue,
+	} {
+		val, ok := annotations[key]
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(val); err == nil && n >= 0 {
+			*limit = n
+		} else {
+			invalid(key, val)
+		}
+	}
+	for key, timeout := range map[string]*string{
+		lbTimeoutConnect: &limits.TimeoutConnect,
+		lbTimeoutServer:  &limits.TimeoutServer,
+		lbTimeoutQueue:   &limits.TimeoutQueue,
+		lbTimeoutClient:  &limits.TimeoutClient,
+	} {
+		val, ok := annotations[key]
+		if !ok {
+			continue
+		}
+		if key == lbTimeoutClient && !tcp {
+			logWarningf("Ignoring %v of http service %v, it shares its frontend", key, s.Name)
+			continue
+		}
+		if d, err := time.ParseDuration(val); err == nil && d >= time.Millisecond {
+			*timeout = haproxyTime(d)
+		} else {
+			invalid(key, val)
+		}
+	}
+	return limits
+}
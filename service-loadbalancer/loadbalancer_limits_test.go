@@ -0,0 +1,81 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestHAProxyTime(t *testing.T) {
+	for d, expected := range map[time.Duration]string{
+		5 * time.Second:         "5s",
+		time.Hour:               "3600s",
+		1500 * time.Millisecond: "1500ms",
+	} {
+		if got := haproxyTime(d); got != expected {
+			t.Fatalf("Expected %v for %v, got %v", expected, d, got)
+		}
+	}
+}
+
+func TestBackendLimits(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	flb.defaultLimits = backendLimits{MaxConn: 100}
+	flb.tcpServices = map[string]int{"svc-1": 443}
+	annotations := map[string]string{
+		lbMaxQueue:       "10",
+		lbTimeoutServer:  "5m",
+		lbTimeoutQueue:   "oops",
+		lbTimeoutClient:  "2m",
+		lbTimeoutConnect: "500ms",
+	}
+	for _, name := range []string{"default/svc-1", "default/svc-2"} {
+		obj, _, _ := flb.svcLister.Store.GetByKey(name)
+		obj.(*api.Service).ObjectMeta.Annotations = annotations
+	}
+	httpSvc, _, tcpSvc := flb.getServices()
+
+	expected := backendLimits{MaxConn: 100, MaxQueue: 10, TimeoutConnect: "500ms", TimeoutServer: "300s"}
+	for _, svc := range httpSvc {
+		if svc.Limits != expected {
+			t.Fatalf("Expected limits %+v for %v, got %+v", expected, svc.Name, svc.Limits)
+		}
+	}
+	expected.TimeoutClient = "120s"
+	if len(tcpSvc) != 1 || tcpSvc[0].Limits != expected {
+		t.Fatalf("Expected limits %+v for the tcp service, got %+v", expected, tcpSvc)
+	}
+
+	config, err := flb.backend.render(map[string][]service{"http": httpSvc, "tcp": tcpSvc})
+	if err != nil {
+		t.Fatalf("Unexpected error rendering the config: %v", err)
+	}
+	for _, line := range []string{
+		"    timeout connect         5s\n",
+		"    timeout connect 500ms\n    timeout server 300s\n",
+		"    mode tcp\n    timeout client 120s\n",
+		"server 1.2.3.4:443 1.2.3.4:443 maxconn 100 maxqueue 10\n",
+	} {
+		if !strings.Contains(string(config), line) {
+			t.Fatalf("Expected %q in the config:\n%s", line, config)
+		}
+	}
+}
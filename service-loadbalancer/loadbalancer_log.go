@@ -21,10 +21,35 @@ import (
 	"os"
 	"strings"
 
-	"github.com/golang/glog"
 	"github.com/ziutek/syslog"
+	"k8s.io/kubernetes/pkg/util/sets"
 )
 
+var (
+	// syslogFacilities and syslogLevels are the facilities and levels of
+	// haproxy logs.
+	syslogFacilities = sets.NewString("kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+		"uucp", "cron", "auth2", "ftp", "ntp", "audit", "alert", "cron2",
+		"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7")
+	syslogLevels = sets.NewString("emerg", "alert", "crit", "err", "warning", "notice", "info", "debug")
+)
+
+// validateLog checks the facility and level of the haproxy logs sent to
+// target. The syslog server of the controller writes the messages of the
+// access log facility as they are, so other logs can't use it.
+func validateLog(target, facility, level string) error {
+	if !syslogFacilities.Has(facility) {
+		return fmt.Errorf("unknown syslog facility %q", facility)
+	}
+	if !syslogLevels.Has(level) {
+		return fmt.Errorf("unknown log level %q, expected one of %v", level, strings.Join(syslogLevels.List(), ", "))
+	}
+	if target == syslogSocket && facility == accessLogFacility.String() {
+		return fmt.Errorf("facility %v is reserved for access logs by the syslog server of the controller", facility)
+	}
+	return nil
+}
+
 type handler struct {
 	*syslog.BaseHandler
 }
@@ -35,7 +60,7 @@ type syslogServer struct {
 
 // newSyslogServer start a syslog server using a unix socket to listen for connections
 func newSyslogServer(path string) (*syslogServer, error) {
-	glog.Infof("Starting syslog server for haproxy using %v as socket", path)
+	logInfof("Starting syslog server for haproxy using %v as socket", path)
 	// remove the socket file if exists
 	os.Remove(path)
 
@@ -62,6 +87,11 @@ func (h *handler) mainLoop() {
 			break
 		}
 
+		if message.Facility == accessLogFacility {
+			// access logs are structured, they're written as they are
+			fmt.Println(message.Content)
+			continue
+		}
 		fmt.Printf("servicelb [%s] %s%s\n", strings.ToUpper(message.Severity.String()), message.Tag, message.Content)
 	}
 
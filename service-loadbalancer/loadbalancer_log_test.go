@@ -17,7 +17,10 @@ limitations under the License.
 package main
 
 import (
+	"strings"
 	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
 )
 
 func TestSyslogSocket(t *testing.T) {
@@ -28,3 +31,44 @@ func TestSyslogSocket(t *testing.T) {
 
 	server.Shutdown()
 }
+
+func TestValidateLog(t *testing.T) {
+	for _, valid := range [][]string{
+		{"10.0.0.5:514", "local0", "info"},
+		{"10.0.0.5:514", "local1", "debug"},
+		{syslogSocket, "daemon", "err"},
+	} {
+		if err := validateLog(valid[0], valid[1], valid[2]); err != nil {
+			t.Fatalf("Unexpected error for %v: %v", valid, err)
+		}
+	}
+	for _, invalid := range [][]string{
+		{"10.0.0.5:514", "local8", "info"},
+		{"10.0.0.5:514", "local0", "verbose"},
+		{syslogSocket, "local1", "info"},
+	} {
+		if err := validateLog(invalid[0], invalid[1], invalid[2]); err == nil {
+			t.Fatalf("Expected an error for %v", invalid)
+		}
+	}
+}
+
+func TestLogTarget(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	flb.cfg.startSyslog = true
+	flb.cfg.logTarget, flb.cfg.logFacility, flb.cfg.logLevel = "10.0.0.5:514", "local2", "notice"
+	flb.tcpServices = map[string]int{"svc-1": 443, "svc-2": 443}
+	obj, _, _ := flb.svcLister.Store.GetByKey("default/svc-1")
+	obj.(*api.Service).ObjectMeta.Annotations = map[string]string{lbTCPLog: "true"}
+	httpSvc, _, tcpSvc := flb.getServices()
+	config, err := flb.backend.render(map[string][]service{"http": httpSvc, "tcp": tcpSvc})
+	if err != nil {
+		t.Fatalf("Unexpected error rendering config: %v", err)
+	}
+	if !strings.Contains(string(config), "    log 10.0.0.5:514 local2 notice\n") || strings.Contains(string(config), "local0") {
+		t.Fatalf("Expected logs sent to the log target only:\n%s", config)
+	}
+	if strings.Count(string(config), "option tcplog") != 1 {
+		t.Fatalf("Expected the tcp frontend of svc-1 to log its connections:\n%s", config)
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "servicelb"
+
+var (
+	syncDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "sync_duration_seconds",
+			Help:      "Time spent in a single sync of services and endpoints with the loadbalancer.",
+		},
+	)
+
+	lastSyncTimestamp = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "last_successful_sync_timestamp_seconds",
+			Help:      "Unix time of the last sync that completed without error.",
+		},
+	)
+
+	watchedObjects = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "watched_objects",
+			Help:      "Number of kubernetes objects currently known to the controller.",
+		}, []string{"resource"},
+	)
+
+	reloadTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "reloads_total",
+			Help:      "Number of loadbalancer reloads attempted.",
+		},
+	)
+
+	reloadFailures = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "reload_failures_total",
+			Help:      "Number of loadbalancer reloads that returned an error.",
+		},
+	)
+
+	reloadDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "reload_duration_seconds",
+			Help:      "Time spent running the loadbalancer reload command.",
+		},
+	)
+
+	syncEvents = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "sync_events_total",
+			Help:      "Number of changes of watched objects that required a sync.",
+		},
+	)
+
+	coalescedEvents = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "coalesced_events",
+			Help:      "Number of changes coalesced into a single sync by the debounce window.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 8),
+		},
+	)
+
+	serversMarkedDown = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "servers_marked_down_total",
+			Help:      "Number of servers of backends with outlier detection seen going down.",
+		}, []string{"backend"},
+	)
+
+	acmeCertificates = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "acme_certificates_total",
+			Help:      "Number of certificates requested from the acme server, by result.",
+		}, []string{"result"},
+	)
+
+	unresolvedPorts = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "unresolved_target_ports",
+			Help:      "Target ports of services matching no port of their ready endpoints.",
+		}, []string{"service", "target_port"},
+	)
+
+	isLeader = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "leader",
+			Help:      "1 if this replica configures the loadbalancer, 0 while another replica is the leader.",
+		},
+	)
+
+	vipAnnounced = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "vip_announced",
+			Help:      "1 while this node announces the virtual ip over bgp.",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(syncDuration)
+	prometheus.MustRegister(lastSyncTimestamp)
+	prometheus.MustRegister(watchedObjects)
+	prometheus.MustRegister(reloadTotal)
+	prometheus.MustRegister(reloadFailures)
+	prometheus.MustRegister(reloadDuration)
+	prometheus.MustRegister(syncEvents)
+	prometheus.MustRegister(coalescedEvents)
+	prometheus.MustRegister(serversMarkedDown)
+	prometheus.MustRegister(acmeCertificates)
+	prometheus.MustRegister(unresolvedPorts)
+	prometheus.MustRegister(isLeader)
+	prometheus.MustRegister(vipAnnounced)
+}
+
+// observeSync records the duration of a sync that started at start, and
+// the completion time if it succeeded.
+func observeSync(start time.Time, err error) {
+	syncDuration.Observe(time.Since(start).Seconds())
+	if err == nil {
+		lastSyncTimestamp.Set(float64(time.Now().Unix()))
+	}
+}
+
+// observeReload records a reload attempt that started at start.
+func observeReload(start time.Time, err error) {
+	reloadTotal.Inc()
+	reloadDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		reloadFailures.Inc()
+	}
+}
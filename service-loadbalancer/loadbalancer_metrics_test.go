@@ -0,0 +1,53 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	m := &dto.Metric{}
+	if err := c.Write(m); err != nil {
+		t.Fatalf("Unexpected error reading counter: %v", err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestReloadMetrics(t *testing.T) {
+	total := counterValue(t, reloadTotal)
+	failures := counterValue(t, reloadFailures)
+
+	cfg := &loadBalancerConfig{Name: "test", ReloadCmd: "true"}
+	if err := cfg.reload(); err != nil {
+		t.Fatalf("Unexpected error reloading: %v", err)
+	}
+	cfg.ReloadCmd = "false"
+	if err := cfg.reload(); err == nil {
+		t.Fatalf("Expected an error from a failing reload command")
+	}
+
+	if got := counterValue(t, reloadTotal) - total; got != 2 {
+		t.Fatalf("Expected 2 reloads to be counted, got %v", got)
+	}
+	if got := counterValue(t, reloadFailures) - failures; got != 1 {
+		t.Fatalf("Expected 1 reload failure to be counted, got %v", got)
+	}
+}
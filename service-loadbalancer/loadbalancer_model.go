@@ -0,0 +1,147 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"k8s.io/contrib/service-loadbalancer/pkg/haproxyvalidate"
+)
+
+// defaultBackend serves the requests no service routes, see template.cfg.
+const defaultBackend = "default-backend"
+
+// bind returns the bind of a frontend on port, on the wildcard ipv6 address
+// with ipv6Bind if set.
+func bind(port int, ipv6Bind string, acceptProxy bool) string {
+	b := "*:" + strconv.Itoa(port)
+	if ipv6Bind != "" {
+		b = fmt.Sprintf(":::%v %v", port, ipv6Bind)
+	}
+	if acceptProxy {
+		b += " accept-proxy"
+	}
+	return b
+}
+
+// servers returns the servers of the backend of svc.
+func servers(svc service) []haproxyvalidate.Server {
+	var s []haproxyvalidate.Server
+	for _, srv := range svc.Servers {
+		s = append(s, haproxyvalidate.Server{Name: srv.Name, Address: srv.Addr})
+	}
+	return s
+}
+
+// model returns the frontends and backends the built-in template renders
+// for services, in the order of their routes, with sslBind the certificates
+// of the https frontend if any. Only the routing is modelled, so it can be
+// validated before the template renders the config.
+func (h *haproxyBackend) model(services map[string][]service, sslBind string) haproxyvalidate.Config {
+	ipv6Bind := ipFamilies[h.ipFamily]
+	c := haproxyvalidate.Config{
+		Backends: []haproxyvalidate.Backend{{
+			Name:    defaultBackend,
+			Servers: []haproxyvalidate.Server{{Name: "localhost", Address: "127.0.0.1:8081"}},
+		}},
+	}
+	backend := func(svc service, mode string) {
+		c.Backends = append(c.Backends, haproxyvalidate.Backend{
+			Name:    svc.Name,
+			Mode:    mode,
+			Servers: servers(svc),
+		})
+	}
+
+	if sslBind != "" {
+		https := haproxyvalidate.Frontend{
+			Name:  "httpsfrontend",
+			Mode:  "http",
+			Binds: []string{bind(443, ipv6Bind, false) + " ssl " + sslBind},
+		}
+		for _, svc := range services["httpsTerm"] {
+			match := svc.AclMatch
+			if match == "" {
+				match = "/" + svc.Name
+			}
+			url := "url_acl_" + svc.Name
+			https.ACLs = append(https.ACLs, haproxyvalidate.ACL{Name: url, Criterion: "path_beg " + match})
+			condition := url
+			if svc.Host != "" {
+				host, sni := "host_acl_"+svc.Name, "sni_acl_"+svc.Name
+				https.ACLs = append(https.ACLs,
+					haproxyvalidate.ACL{Name: host, Criterion: svc.HostACL},
+					haproxyvalidate.ACL{Name: sni, Criterion: svc.SNIACL})
+				condition += " or " + host + " or " + sni
+			}
+			https.UseBackends = append(https.UseBackends, haproxyvalidate.UseBackend{Backend: svc.Name, Condition: condition})
+		}
+		c.Frontends = append(c.Frontends, https)
+	}
+
+	httpFrontend := haproxyvalidate.Frontend{
+		Name:  "httpfrontend",
+		Binds: []string{bind(80, ipv6Bind, h.acceptProxy)},
+	}
+	if h.acmeChallenges {
+		httpFrontend.UseBackends = append(httpFrontend.UseBackends, haproxyvalidate.UseBackend{
+			Backend:   defaultBackend,
+			Condition: "{ path_beg /.well-known/acme-challenge/ }",
+		})
+	}
+	for _, svc := range pathRoutes(services["http"]) {
+		path := "path_acl_" + svc.Name
+		httpFrontend.ACLs = append(httpFrontend.ACLs,
+			haproxyvalidate.ACL{Name: path, Criterion: "path " + svc.PathPrefix},
+			haproxyvalidate.ACL{Name: path, Criterion: "path_beg " + svc.PathPrefix + "/"})
+		condition := path
+		if svc.Host != "" {
+			host := "path_host_acl_" + svc.Name
+			httpFrontend.ACLs = append(httpFrontend.ACLs, haproxyvalidate.ACL{Name: host, Criterion: svc.HostACL})
+			condition += " " + host
+		}
+		httpFrontend.UseBackends = append(httpFrontend.UseBackends, haproxyvalidate.UseBackend{Backend: svc.Name, Condition: condition})
+	}
+	for _, svc := range services["http"] {
+		url := "url_acl_" + svc.Name
+		httpFrontend.ACLs = append(httpFrontend.ACLs, haproxyvalidate.ACL{Name: url, Criterion: "path_beg /" + svc.Name})
+		condition := url
+		if svc.Host != "" && svc.PathPrefix == "" {
+			host := "host_acl_" + svc.Name
+			httpFrontend.ACLs = append(httpFrontend.ACLs, haproxyvalidate.ACL{Name: host, Criterion: svc.HostACL})
+			condition += " or " + host
+		}
+		httpFrontend.UseBackends = append(httpFrontend.UseBackends, haproxyvalidate.UseBackend{Backend: svc.Name, Condition: condition})
+		backend(svc, "")
+	}
+	c.Frontends = append(c.Frontends, httpFrontend)
+	for _, svc := range services["httpsTerm"] {
+		backend(svc, "")
+	}
+
+	for _, svc := range services["tcp"] {
+		c.Frontends = append(c.Frontends, haproxyvalidate.Frontend{
+			Name:           svc.Name,
+			Mode:           "tcp",
+			Binds:          []string{bind(svc.FrontendPort, svc.IPv6Bind, svc.AcceptProxy || h.acceptProxy)},
+			DefaultBackend: svc.Name,
+		})
+		backend(svc, "tcp")
+	}
+	return c
+}
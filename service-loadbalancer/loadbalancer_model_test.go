@@ -0,0 +1,58 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/contrib/service-loadbalancer/pkg/haproxyvalidate"
+)
+
+func TestModel(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	httpSvc, httpsTermSvc, tcpSvc := flb.getServices()
+	services := map[string][]service{"http": httpSvc, "httpsTerm": httpsTermSvc, "tcp": tcpSvc}
+	h := &haproxyBackend{loadBalancerConfig: flb.cfg}
+
+	c := h.model(services, "")
+	if err := haproxyvalidate.Validate(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	routes := map[string]string{}
+	for _, f := range c.Frontends {
+		for _, use := range f.UseBackends {
+			routes[use.Backend] = use.Condition
+		}
+	}
+	for _, svc := range httpSvc {
+		if routes[svc.Name] != "url_acl_"+svc.Name {
+			t.Errorf("Expected a route for %v, got %q", svc.Name, routes[svc.Name])
+		}
+	}
+	if len(c.Backends) != 1+len(httpSvc)+len(httpsTermSvc)+len(tcpSvc) {
+		t.Errorf("Expected a backend per service and the default one, got %v", len(c.Backends))
+	}
+
+	services["httpsTerm"] = append(services["httpsTerm"], httpSvc[0])
+	if err := haproxyvalidate.Validate(h.model(services, "crt /ssl")); err == nil || !strings.Contains(err.Error(), "duplicate backend") {
+		t.Errorf("Expected an error for services with the same backend, got %v", err)
+	}
+	if _, err := h.render(services); err == nil {
+		t.Errorf("Expected services with the same backend not to render")
+	}
+}
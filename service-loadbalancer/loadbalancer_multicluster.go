@@ -0,0 +1,236 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/client/unversioned/clientcmd"
+	"k8s.io/kubernetes/pkg/controller/framework"
+)
+
+// remoteCluster is another cluster whose endpoints are merged into the
+// backends of the services with the same namespace and name.
+type remoteCluster struct {
+	name       string
+	kubeconfig string
+	context    string
+
+	epLister   cache.StoreToEndpointsLister
+	controller *framework.Controller
+}
+
+// clusterSet merges the endpoints of the remote clusters with the ones of
+// the cluster of the loadbalancer, named local.
+type clusterSet struct {
+	local   string
+	remotes []*remoteCluster
+	// weights are the weights of the servers of each cluster, for the
+	// servers of pods without a weight.
+	weights map[string]string
+	// priorities order the clusters for failover, servers of clusters with
+	// a higher priority than the best one with endpoints are backups.
+	priorities map[string]int
+}
+
+// parseRemoteCluster parses a name=kubeconfig[#context] spec of --remote-clusters.
+func parseRemoteCluster(spec string) (*remoteCluster, error) {
+	parts := strings.SplitN(spec, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid remote cluster %q, expected name=kubeconfig[#context]", spec)
+	}
+	r := &remoteCluster{name: parts[0], kubeconfig: parts[1]}
+	if i := strings.LastIndex(r.kubeconfig, "#"); i >= 0 {
+		r.kubeconfig, r.context = r.kubeconfig[:i], r.kubeconfig[i+1:]
+	}
+	return r, nil
+}
+
+// newClusterSet parses the remote clusters, their weights, eg: east=2,west=1,
+// and their failover order, eg: local+east,west where local and east are
+// active and west their backup. Clusters missing from the failover order
+// come after the ones in it.
+func newClusterSet(local string, remotes []string, weights string, failover []string) (*clusterSet, error) {
+	c := &clusterSet{local: local, weights: map[string]string{}, priorities: map[string]int{}}
+	known := map[string]bool{local: true}
+	for _, spec := range remotes {
+		r, err := parseRemoteCluster(spec)
+		if err != nil {
+			return nil, err
+		}
+		if known[r.name] {
+			return nil, fmt.Errorf("duplicate cluster %v", r.name)
+		}
+		known[r.name] = true
+		c.remotes = append(c.remotes, r)
+	}
+	if weights != "" {
+		for _, kv := range strings.Split(weights, ",") {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 || !known[parts[0]] {
+				return nil, fmt.Errorf("invalid cluster weight %q, expected cluster=weight of a known cluster", kv)
+			}
+			w, err := strconv.Atoi(parts[1])
+			if err != nil || w < 0 || w > maxWeight {
+				return nil, fmt.Errorf("invalid weight of cluster %v: %q, expected 0 to %v", parts[0], parts[1], maxWeight)
+			}
+			c.weights[parts[0]] = strconv.Itoa(w)
+		}
+	}
+	for name := range known {
+		c.priorities[name] = len(failover)
+	}
+	for i, tier := range failover {
+		for _, name := range strings.Split(tier, "+") {
+			if !known[name] {
+				return nil, fmt.Errorf("unknown cluster %v in the failover order", name)
+			}
+			c.priorities[name] = i
+		}
+	}
+	return c, nil
+}
+
+// watch starts watching the endpoints of the remote clusters in namespaces,
+// calling handlers on their changes. The informers run with run.
+func (c *clusterSet) watch(namespaces []string, handlers framework.ResourceEventHandlerFuncs) error {
+	for _, r := range c.remotes {
+		cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			&clientcmd.ClientConfigLoadingRules{ExplicitPath: r.kubeconfig},
+			&clientcmd.ConfigOverrides{CurrentContext: r.context}).ClientConfig()
+		if err != nil {
+			return fmt.Errorf("invalid kubeconfig of cluster %v: %v", r.name, err)
+		}
+		cfg.QPS, cfg.Burst = *apiQPS, *apiBurst
+		client, err := unversioned.New(cfg)
+		if err != nil {
+			return fmt.Errorf("unable to create the client of cluster %v: %v", r.name, err)
+		}
+		r.epLister.Store, r.controller = framework.NewInformer(
+			namespacedListWatch(client, "endpoints", namespaces),
+			&api.Endpoints{}, resyncPeriodOf("endpoints"), handlers)
+	}
+	return nil
+}
+
+// run starts the informers of the remote clusters.
+func (c *clusterSet) run(stopCh <-chan struct{}) {
+	for _, r := range c.remotes {
+		go r.controller.Run(stopCh)
+	}
+}
+
+// synced reports whether the informers of every remote cluster listed
+// their endpoints.
+func (c *clusterSet) synced() bool {
+	for _, r := range c.remotes {
+		if r.controller != nil && !r.controller.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// merge adds the endpoints of servicePort of s in the remote clusters to
+// the local ones, ordered by the failover priority of their cluster, and
+// returns the cluster of each endpoint. Endpoints found in several clusters,
+// eg: with flat networks, are kept once, in the first.
+func (c *clusterSet) merge(s *api.Service, servicePort *api.ServicePort, local []string) ([]string, map[string]string) {
+	clusterOf := map[string]string{}
+	var merged []string
+	add := func(cluster string, endpoints []string) {
+		for _, ep := range endpoints {
+			if _, ok := clusterOf[ep]; !ok {
+				clusterOf[ep] = cluster
+				merged = append(merged, ep)
+			}
+		}
+	}
+	add(c.local, local)
+	for _, r := range c.remotes {
+		ep, err := r.epLister.GetServiceEndpoints(s)
+		if err != nil {
+			continue
+		}
+		remote, _ := endpointAddresses(&ep, s, servicePort)
+		add(r.name, remote)
+	}
+	sort.Stable(endpointsByPriority{merged, clusterOf, c.priorities})
+	return merged, clusterOf
+}
+
+// endpointsByPriority orders endpoints by the failover priority of their
+// cluster.
+type endpointsByPriority struct {
+	endpoints  []string
+	clusterOf  map[string]string
+	priorities map[string]int
+}
+
+func (e endpointsByPriority) Len() int { return len(e.endpoints) }
+func (e endpointsByPriority) Swap(i, j int) {
+	e.endpoints[i], e.endpoints[j] = e.endpoints[j], e.endpoints[i]
+}
+func (e endpointsByPriority) Less(i, j int) bool {
+	return e.priorities[e.clusterOf[e.endpoints[i]]] < e.priorities[e.clusterOf[e.endpoints[j]]]
+}
+
+// standby returns the endpoints of clusterOf in clusters with a lower
+// priority than the best cluster with endpoints, the backups.
+func (c *clusterSet) standby(clusterOf map[string]string) map[string]bool {
+	best, found := 0, false
+	for _, cluster := range clusterOf {
+		if p := c.priorities[cluster]; !found || p < best {
+			best, found = p, true
+		}
+	}
+	standby := map[string]bool{}
+	for ep, cluster := range clusterOf {
+		if c.priorities[cluster] > best {
+			standby[ep] = true
+		}
+	}
+	return standby
+}
+
+// weigh adds the weights of the clusters of the endpoints of clusterOf to
+// weights, by ip, keeping the weights of the pods.
+func (c *clusterSet) weigh(weights map[string]string, clusterOf map[string]string) map[string]string {
+	if len(c.weights) == 0 {
+		return weights
+	}
+	if weights == nil {
+		weights = map[string]string{}
+	}
+	for ep, cluster := range clusterOf {
+		w, ok := c.weights[cluster]
+		if !ok {
+			continue
+		}
+		if host, _, err := net.SplitHostPort(ep); err == nil && weights[host] == "" {
+			weights[host] = w
+		}
+	}
+	return weights
+}
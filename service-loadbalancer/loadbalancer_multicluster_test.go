@@ -0,0 +1,113 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/util/intstr"
+)
+
+func TestNewClusterSet(t *testing.T) {
+	c, err := newClusterSet("local", []string{"east=/etc/east.yaml", "west=/etc/west.yaml#admin"}, "local=2,west=1", []string{"west"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r := c.remotes[1]; r.name != "west" || r.kubeconfig != "/etc/west.yaml" || r.context != "admin" {
+		t.Errorf("Unexpected remote cluster %+v", r)
+	}
+	if expected := map[string]string{"local": "2", "west": "1"}; !reflect.DeepEqual(c.weights, expected) {
+		t.Errorf("Expected weights %v, got %v", expected, c.weights)
+	}
+	if expected := map[string]int{"west": 0, "local": 1, "east": 1}; !reflect.DeepEqual(c.priorities, expected) {
+		t.Errorf("Expected priorities %v, got %v", expected, c.priorities)
+	}
+
+	invalid := []struct {
+		remotes  []string
+		weights  string
+		failover []string
+	}{
+		{remotes: []string{"east"}},
+		{remotes: []string{"=/etc/east.yaml"}},
+		{remotes: []string{"local=/etc/east.yaml"}},
+		{remotes: []string{"east=/etc/east.yaml", "east=/etc/west.yaml"}},
+		{remotes: []string{"east=/etc/east.yaml"}, weights: "west=1"},
+		{remotes: []string{"east=/etc/east.yaml"}, weights: "east=300"},
+		{remotes: []string{"east=/etc/east.yaml"}, failover: []string{"west"}},
+		{remotes: []string{"east=/etc/east.yaml"}, failover: []string{"local+west"}},
+	}
+	for _, tc := range invalid {
+		if _, err := newClusterSet("local", tc.remotes, tc.weights, tc.failover); err == nil {
+			t.Errorf("Expected an error for %+v", tc)
+		}
+	}
+}
+
+func remoteEndpoints(name string, endpoints ...*api.Endpoints) *remoteCluster {
+	r := &remoteCluster{name: name}
+	r.epLister.Store = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for _, ep := range endpoints {
+		r.epLister.Store.Add(ep)
+	}
+	return r
+}
+
+func TestMultiCluster(t *testing.T) {
+	svc := getService([]api.ServicePort{{Port: 80, TargetPort: intstr.FromInt(8080)}})
+	ports := []api.EndpointPort{{Port: 8080}}
+	local := getEndpoints(svc, []api.EndpointAddress{{IP: "10.0.0.1"}}, ports)
+	east := getEndpoints(svc, []api.EndpointAddress{{IP: "10.1.0.1"}, {IP: "10.0.0.1"}}, ports)
+	west := getEndpoints(svc, []api.EndpointAddress{{IP: "10.2.0.1"}}, ports)
+	flb := newFakeLoadBalancerController([]*api.Endpoints{local}, []*api.Service{svc})
+	flb.cfg = &loadBalancerConfig{}
+
+	clusters, err := newClusterSet("local", []string{"east=/etc/east.yaml", "west=/etc/west.yaml"}, "east=3", []string{"local+east"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	clusters.remotes = []*remoteCluster{remoteEndpoints("east", east), remoteEndpoints("west", west)}
+	flb.clusters = clusters
+
+	httpSvc, _, _ := flb.getServices()
+	expected := []backendServer{
+		{Name: "10.0.0.1:8080", Addr: "10.0.0.1:8080"},
+		{Name: "10.1.0.1:8080", Addr: "10.1.0.1:8080", Weight: "3"},
+		{Name: "10.2.0.1:8080", Addr: "10.2.0.1:8080", Backup: true},
+	}
+	if len(httpSvc) != 1 || !reflect.DeepEqual(httpSvc[0].Servers, expected) {
+		t.Fatalf("Unexpected servers %+v, expected %+v", httpSvc, expected)
+	}
+
+	// without local endpoints, the remote clusters keep the service up,
+	// the endpoints east shares with the local cluster are east's now
+	flb.epLister.Store.Delete(local)
+	// west is preferred now, east is its backup
+	clusters.priorities["west"] = -1
+	httpSvc, _, _ = flb.getServices()
+	expected = []backendServer{
+		{Name: "10.2.0.1:8080", Addr: "10.2.0.1:8080"},
+		{Name: "10.1.0.1:8080", Addr: "10.1.0.1:8080", Weight: "3", Backup: true},
+		{Name: "10.0.0.1:8080", Addr: "10.0.0.1:8080", Weight: "3", Backup: true},
+	}
+	if len(httpSvc) != 1 || !reflect.DeepEqual(httpSvc[0].Servers, expected) {
+		t.Fatalf("Unexpected servers without local endpoints %+v, expected %+v", httpSvc, expected)
+	}
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"sync"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/meta"
+	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/fields"
+	"k8s.io/kubernetes/pkg/runtime"
+	"k8s.io/kubernetes/pkg/watch"
+)
+
+// namespacedListWatch lists and watches resource in namespaces. Several
+// namespaces are listed and watched one by one, so that controllers limited
+// to a few namespaces only need permissions in them.
+func namespacedListWatch(client cache.Getter, resource string, namespaces []string) *cache.ListWatch {
+	if len(namespaces) == 1 {
+		return cache.NewListWatchFromClient(client, resource, namespaces[0], fields.Everything())
+	}
+	return newMultiNamespaceListWatch(namespaces, func(namespace string) *cache.ListWatch {
+		return cache.NewListWatchFromClient(client, resource, namespace, fields.Everything())
+	})
+}
+
+// multiNamespaceListWatch lists and watches the same resource in several
+// namespaces as one. Each namespace is watched from its own resource
+// version, so the events of a namespace behind the others aren't lost when
+// the watches restart.
+type multiNamespaceListWatch struct {
+	namespaces  []string
+	listWatches map[string]*cache.ListWatch
+
+	lock     sync.Mutex
+	versions map[string]string
+}
+
+func newMultiNamespaceListWatch(namespaces []string, newListWatch func(namespace string) *cache.ListWatch) *cache.ListWatch {
+	m := &multiNamespaceListWatch{
+		namespaces:  namespaces,
+		listWatches: map[string]*cache.ListWatch{},
+		versions:    map[string]string{},
+	}
+	for _, ns := range namespaces {
+		m.listWatches[ns] = newListWatch(ns)
+	}
+	return &cache.ListWatch{ListFunc: m.list, WatchFunc: m.watch}
+}
+
+// list returns the objects of every namespace in the list of the first one.
+func (m *multiNamespaceListWatch) list(options api.ListOptions) (runtime.Object, error) {
+	var list runtime.Object
+	var items []runtime.Object
+	versions := map[string]string{}
+	for _, ns := range m.namespaces {
+		obj, err := m.listWatches[ns].List(options)
+		if err != nil {
+			return nil, err
+		}
+		objs, err := meta.ExtractList(obj)
+		if err != nil {
+			return nil, err
+		}
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return nil, err
+		}
+		versions[ns] = accessor.GetResourceVersion()
+		items = append(items, objs...)
+		if list == nil {
+			list = obj
+		}
+	}
+	if err := meta.SetList(list, items); err != nil {
+		return nil, err
+	}
+	m.lock.Lock()
+	m.versions = versions
+	m.lock.Unlock()
+	return list, nil
+}
+
+// watch watches every namespace from the last version seen in it, the
+// resource version of options is the one of a single namespace.
+func (m *multiNamespaceListWatch) watch(options api.ListOptions) (watch.Interface, error) {
+	merged := &mergedWatch{result: make(chan watch.Event), stop: make(chan struct{})}
+	for _, ns := range m.namespaces {
+		opts := options
+		m.lock.Lock()
+		if version, ok := m.versions[ns]; ok {
+			opts.ResourceVersion = version
+		}
+		m.lock.Unlock()
+		w, err := m.listWatches[ns].Watch(opts)
+		if err != nil {
+			merged.Stop()
+			return nil, err
+		}
+		merged.watches = append(merged.watches, w)
+	}
+	for i, ns := range m.namespaces {
+		merged.forward(merged.watches[i], func(event watch.Event) {
+			if event.Type == watch.Error {
+				return
+			}
+			if accessor, err := meta.Accessor(event.Object); err == nil {
+				m.lock.Lock()
+				m.versions[ns] = accessor.GetResourceVersion()
+				m.lock.Unlock()
+			}
+		})
+	}
+	go func() {
+		merged.wg.Wait()
+		close(merged.result)
+	}()
+	return merged, nil
+}
+
+// mergedWatch forwards the events of several watches, and ends with the
+// first of them to end.
+type mergedWatch struct {
+	watches []watch.Interface
+	result  chan watch.Event
+
+	wg   sync.WaitGroup
+	once sync.Once
+	stop chan struct{}
+}
+
+// forward sends the events of w, calling sent after each of them.
+func (m *mergedWatch) forward(w watch.Interface, sent func(watch.Event)) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer m.Stop()
+		for {
+			select {
+			case event, ok := <-w.ResultChan():
+				if !ok {
+					return
+				}
+				select {
+				case m.result <- event:
+					sent(event)
+				case <-m.stop:
+					return
+				}
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (m *mergedWatch) Stop() {
+	m.once.Do(func() {
+		close(m.stop)
+		for _, w := range m.watches {
+			w.Stop()
+		}
+	})
+}
+
+func (m *mergedWatch) ResultChan() <-chan watch.Event {
+	return m.result
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/runtime"
+	"k8s.io/kubernetes/pkg/watch"
+)
+
+func TestMultiNamespaceListWatch(t *testing.T) {
+	watches := map[string]*watch.FakeWatcher{}
+	watchedFrom := map[string]string{}
+	lw := newMultiNamespaceListWatch([]string{"ns-a", "ns-b"}, func(namespace string) *cache.ListWatch {
+		return &cache.ListWatch{
+			ListFunc: func(options api.ListOptions) (runtime.Object, error) {
+				version := map[string]string{"ns-a": "10", "ns-b": "12"}[namespace]
+				return &api.ServiceList{
+					ListMeta: unversioned.ListMeta{ResourceVersion: version},
+					Items:    []api.Service{{ObjectMeta: api.ObjectMeta{Name: "svc", Namespace: namespace}}},
+				}, nil
+			},
+			WatchFunc: func(options api.ListOptions) (watch.Interface, error) {
+				watchedFrom[namespace] = options.ResourceVersion
+				watches[namespace] = watch.NewFake()
+				return watches[namespace], nil
+			},
+		}
+	})
+
+	list, err := lw.List(api.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if items := list.(*api.ServiceList).Items; len(items) != 2 || items[0].Namespace != "ns-a" || items[1].Namespace != "ns-b" {
+		t.Fatalf("Expected the services of both namespaces, got %+v", items)
+	}
+
+	w, err := lw.Watch(api.ListOptions{ResourceVersion: "10"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if watchedFrom["ns-a"] != "10" || watchedFrom["ns-b"] != "12" {
+		t.Fatalf("Expected each namespace to be watched from its list, got %v", watchedFrom)
+	}
+	go watches["ns-b"].Add(&api.Service{ObjectMeta: api.ObjectMeta{Name: "new", Namespace: "ns-b", ResourceVersion: "15"}})
+	if event := <-w.ResultChan(); event.Object.(*api.Service).Name != "new" {
+		t.Fatalf("Unexpected event %+v", event)
+	}
+
+	// the watch ends with the first watch to end, and the next one starts
+	// from the last version seen in each namespace
+	watches["ns-a"].Stop()
+	if _, ok := <-w.ResultChan(); ok {
+		t.Fatalf("Expected the watch to end")
+	}
+	if !watches["ns-b"].Stopped {
+		t.Fatalf("Expected the watches of the other namespaces to be stopped")
+	}
+	if _, err := lw.Watch(api.ListOptions{ResourceVersion: "15"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if watchedFrom["ns-a"] != "10" || watchedFrom["ns-b"] != "15" {
+		t.Fatalf("Expected the namespaces to be watched from their last versions, got %v", watchedFrom)
+	}
+}
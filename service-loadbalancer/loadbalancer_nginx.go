@@ -0,0 +1,69 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+)
+
+// activeConnections matches the first line of the nginx stub_status page.
+var activeConnections = regexp.MustCompile(`Active connections:\s*(\d+)`)
+
+// nginxBackend configures nginx with the template of the json manifest. The
+// open source nginx has neither a runtime API nor stats by backend, so it
+// is always reloaded and only reports its total number of connections.
+type nginxBackend struct {
+	*loadBalancerConfig
+
+	// statusURL serves the stub_status of nginx.
+	statusURL string
+}
+
+func (n *nginxBackend) render(services map[string][]service) ([]byte, error) {
+	conf := make(map[string]interface{})
+	conf["startSyslog"] = n.startSyslog
+	conf["services"] = services
+	conf["sslCert"] = n.sslCert
+	conf["sslCaCert"] = n.sslCaCert
+	conf["acceptProxy"] = n.acceptProxy
+	conf["ipv6Bind"] = ipFamilies[n.ipFamily]
+	conf["statsPort"] = *statsPort
+	conf["defaultBackend"] = fmt.Sprintf("127.0.0.1:%v", lbApiPort)
+	return n.renderTemplate(conf)
+}
+
+func (n *nginxBackend) stats() (map[string]int, error) {
+	resp, err := http.Get(n.statusURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	m := activeConnections.FindSubmatch(body)
+	if m == nil {
+		return nil, fmt.Errorf("unexpected nginx status %q", body)
+	}
+	active, _ := strconv.Atoi(string(m[1]))
+	return map[string]int{totalSessions: active}, nil
+}
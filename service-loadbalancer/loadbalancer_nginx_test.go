@@ -0,0 +1,71 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNginxRender(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	flb.tcpServices = map[string]int{"svc-1": 443}
+	flb.cfg.Template, _ = filepath.Abs("nginx_template.cfg")
+	backend := &nginxBackend{loadBalancerConfig: flb.cfg}
+	httpSvc, _, tcpSvc := flb.getServices()
+	httpSvc[0].Host = "foo.bar"
+	httpSvc[1].Servers[0].Weight = "0"
+	httpSvc[1].Servers[1].Weight = "5"
+
+	config, err := backend.render(map[string][]service{"http": httpSvc, "tcp": tcpSvc})
+	if err != nil {
+		t.Fatalf("Unexpected error rendering the config: %v", err)
+	}
+	for _, expected := range []string{
+		"upstream http_0 {",
+		"server_name foo.bar;",
+		fmt.Sprintf("location /%v {", httpSvc[1].Name),
+		"server 1.2.3.4:80 down;",
+		"server 5.6.7.8:80 weight=5;",
+		"listen 443;",
+		"proxy_pass tcp_0;",
+	} {
+		if !strings.Contains(string(config), expected) {
+			t.Fatalf("Expected %q in the nginx config:\n%s", expected, config)
+		}
+	}
+}
+
+func TestNginxStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Active connections: 12 \nserver accepts handled requests\n 1 1 1 \n")
+	}))
+	defer server.Close()
+
+	backend := &nginxBackend{&loadBalancerConfig{}, server.URL}
+	sessions, err := backend.stats()
+	if err != nil {
+		t.Fatalf("Unexpected error reading stats: %v", err)
+	}
+	if sessions[totalSessions] != 12 {
+		t.Fatalf("Expected 12 sessions, got %v", sessions)
+	}
+}
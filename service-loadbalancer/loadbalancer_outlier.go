@@ -0,0 +1,211 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/util/wait"
+)
+
+// defaultErrorCooldown is how long a server marked down by its errors waits
+// between health checks, when its service doesn't set one.
+const defaultErrorCooldown = 30 * time.Second
+
+// outlierDetection marks down the servers of an http service returning
+// consecutive errors, 5xx responses or failed connections, until their
+// health checks pass again.
+// http://cbonte.github.io/haproxy-dconv/configuration-1.5.html#5.2-observe
+type outlierDetection struct {
+	// ErrorLimit is the number of consecutive errors marking a server
+	// down, outlier detection is off when it is 0.
+	ErrorLimit int
+
+	// Cooldown is the interval of the health checks of a server that is
+	// down, so it gets traffic again after rise times the cooldown.
+	Cooldown string
+}
+
+// getOutlierDetection returns the outlier detection of s from its
+// annotations. Invalid annotations are ignored.
+func getOutlierDetection(s *api.Service, tcp bool) outlierDetection {
+	annotations := serviceAnnotations(s.ObjectMeta.Annotations)
+	val, ok := annotations[lbErrorLimit]
+	if !ok {
+		return outlierDetection{}
+	}
+	if tcp {
+		logWarningf("Ignoring %v of tcp service %v, its servers have no health checks", lbErrorLimit, s.Name)
+		return outlierDetection{}
+	}
+	limit, err := strconv.Atoi(val)
+	if err != nil || limit <= 0 {
+		logWarningf("Ignoring invalid %v %q of service %v", lbErrorLimit, val, s.Name)
+		return outlierDetection{}
+	}
+	outlier := outlierDetection{ErrorLimit: limit, Cooldown: haproxyTime(defaultErrorCooldown)}
+	if val, ok := annotations[lbErrorCooldown]; ok {
+		if d, err := time.ParseDuration(val); err == nil && d >= time.Millisecond {
+			outlier.Cooldown = haproxyTime(d)
+		} else {
+			logWarningf("Ignoring invalid %v %q of service %v", lbErrorCooldown, val, s.Name)
+		}
+	}
+	return outlier
+}
+
+// outlierWatcher reports the servers of the backends with outlier detection
+// going down, with a metric and an event on their service. It polls the
+// haproxy stats, so servers going down and up again between two checks are
+// missed.
+type outlierWatcher struct {
+	socket      *haproxySocket
+	recordEvent func(*api.Event) error
+
+	lock sync.Mutex
+	// services holds the namespace/name of the service of every watched
+	// backend, and states the last status of their servers, by
+	// backend/server.
+	services map[string]string
+	states   map[string]string
+}
+
+func newOutlierWatcher(socket *haproxySocket, recordEvent func(*api.Event) error) *outlierWatcher {
+	return &outlierWatcher{
+		socket:      socket,
+		recordEvent: recordEvent,
+		services:    map[string]string{},
+		states:      map[string]string{},
+	}
+}
+
+// watch replaces the watched backends with the ones of svcs with outlier
+// detection.
+func (w *outlierWatcher) watch(svcs []service) {
+	services := map[string]string{}
+	for _, svc := range svcs {
+		if svc.Outlier.ErrorLimit > 0 {
+			services[svc.Name] = svc.objectKey
+		}
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.services = services
+}
+
+// check reads the status of the servers of the watched backends, and
+// reports the ones that were up at the last check and are down now.
+func (w *outlierWatcher) check() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if len(w.services) == 0 {
+		w.states = map[string]string{}
+		return nil
+	}
+	rows, err := w.socket.showStat()
+	if err != nil {
+		return err
+	}
+	states := map[string]string{}
+	for _, row := range rows {
+		backend, server := row["pxname"], row["svname"]
+		key, ok := w.services[backend]
+		if !ok || server == "FRONTEND" || server == "BACKEND" {
+			continue
+		}
+		name := backend + "/" + server
+		states[name] = row["status"]
+		if row["status"] != "DOWN" || !strings.HasPrefix(w.states[name], "UP") {
+			continue
+		}
+		logWarningf("Server %v of service %v went down", name, key)
+		serversMarkedDown.WithLabelValues(backend).Inc()
+		if err := w.recordEvent(outlierEvent(key, server, row["check_status"])); err != nil {
+			logWarningf("Unable to record the event of server %v: %v", name, err)
+		}
+	}
+	w.states = states
+	return nil
+}
+
+// run checks the servers every interval until stopCh is closed.
+func (w *outlierWatcher) run(interval time.Duration, stopCh <-chan struct{}) {
+	wait.Until(func() {
+		if err := w.check(); err != nil {
+			logWarningf("Unable to check the servers for outliers: %v", err)
+		}
+	}, interval, stopCh)
+}
+
+// outlierEvent returns a warning event on the service key, namespace/name,
+// about its server going down.
+func outlierEvent(key, server, checkStatus string) *api.Event {
+	message := fmt.Sprintf("Server %v was marked down by the loadbalancer", server)
+	if checkStatus != "" {
+		message += fmt.Sprintf(" (%v)", checkStatus)
+	}
+	return serviceEvent(key, "ServerMarkedDown", message)
+}
+
+// serviceEvent returns a warning event on the service key, namespace/name.
+func serviceEvent(key, reason, message string) *api.Event {
+	namespace, name := "", key
+	if parts := strings.SplitN(key, "/", 2); len(parts) == 2 {
+		namespace, name = parts[0], parts[1]
+	}
+	now := unversioned.Now()
+	return &api.Event{
+		ObjectMeta: api.ObjectMeta{
+			Name:      fmt.Sprintf("%v.%x", name, now.UnixNano()),
+			Namespace: namespace,
+		},
+		InvolvedObject: api.ObjectReference{
+			Kind:      "Service",
+			Namespace: namespace,
+			Name:      name,
+		},
+		Reason:         reason,
+		Message:        message,
+		Source:         api.EventSource{Component: "service-loadbalancer"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Type:           api.EventTypeWarning,
+	}
+}
+
+// watchOutliers watches the backends of svcGroups with outlier detection.
+func (lbc *loadBalancerController) watchOutliers(svcGroups ...[]service) {
+	if lbc.outliers == nil {
+		return
+	}
+	if !lbc.leading() {
+		// only the leader records the events
+		svcGroups = nil
+	}
+	svcs := []service{}
+	for _, group := range svcGroups {
+		svcs = append(svcs, group...)
+	}
+	lbc.outliers.watch(svcs)
+}
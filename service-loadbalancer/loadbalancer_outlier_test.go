@@ -0,0 +1,134 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+const outlierStats = `# pxname,svname,qcur,qmax,scur,smax,slim,stot,bin,bout,dreq,dresp,ereq,econ,eresp,wretr,wredis,status,weight,act,bck,chkfail,chkdown,lastchg,downtime,qlimit,pid,iid,sid,throttle,lbtot,tracked,type,rate,rate_lim,rate_max,check_status,
+svc-1,FRONTEND,,,0,1,2000,1,0,0,0,0,0,,,,,OPEN,,,,,,,,,1,2,0,,,,0,0,0,1,,
+svc-1,server0,0,0,0,1,,1,0,0,,0,,0,0,0,0,%v,1,1,0,0,0,5,0,,1,2,1,,1,,2,0,,1,%v,
+svc-1,BACKEND,0,0,0,1,200,1,0,0,0,0,,0,0,0,0,UP,1,1,0,,0,5,0,,1,2,0,,1,,1,0,,1,,
+svc-2,server0,0,0,0,1,,1,0,0,,0,,0,0,0,0,DOWN,1,1,0,0,0,5,0,,1,3,1,,1,,2,0,,1,L4CON,
+`
+
+func TestOutlierDetection(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	flb.tcpServices = map[string]int{"svc-2": 443}
+	annotations := map[string]string{lbErrorLimit: "10", lbErrorCooldown: "1m"}
+	for _, name := range []string{"default/svc-1", "default/svc-2"} {
+		obj, _, _ := flb.svcLister.Store.GetByKey(name)
+		obj.(*api.Service).ObjectMeta.Annotations = annotations
+	}
+	httpSvc, _, tcpSvc := flb.getServices()
+
+	expected := outlierDetection{ErrorLimit: 10, Cooldown: "60s"}
+	for _, svc := range httpSvc {
+		if svc.Outlier != expected {
+			t.Fatalf("Expected outlier detection %+v for %v, got %+v", expected, svc.Name, svc.Outlier)
+		}
+	}
+	for _, svc := range tcpSvc {
+		if svc.Outlier.ErrorLimit != 0 {
+			t.Fatalf("Expected no outlier detection for tcp service %v, got %+v", svc.Name, svc.Outlier)
+		}
+	}
+
+	config, err := flb.backend.render(map[string][]service{"http": httpSvc})
+	if err != nil {
+		t.Fatalf("Unexpected error rendering config: %v", err)
+	}
+	if !strings.Contains(string(config), "observe layer7 error-limit 10 on-error mark-down downinter 60s") {
+		t.Fatalf("Expected servers marked down on errors in config:\n%v", string(config))
+	}
+}
+
+func TestOutlierDetectionDefaults(t *testing.T) {
+	for annotations, expected := range map[string]outlierDetection{
+		"":      {},
+		"5":     {ErrorLimit: 5, Cooldown: "30s"},
+		"0":     {},
+		"often": {},
+	} {
+		s := &api.Service{ObjectMeta: api.ObjectMeta{Name: "svc", Annotations: map[string]string{}}}
+		if annotations != "" {
+			s.ObjectMeta.Annotations[lbErrorLimit] = annotations
+		}
+		if got := getOutlierDetection(s, false); got != expected {
+			t.Fatalf("Expected %+v for %q, got %+v", expected, annotations, got)
+		}
+	}
+}
+
+func TestParseStat(t *testing.T) {
+	rows, err := parseStat(strings.Replace(strings.Replace(outlierStats, "%v", "UP", 1), "%v", "", 1))
+	if err != nil {
+		t.Fatalf("Unexpected error parsing stats: %v", err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("Expected 4 rows, got %v", len(rows))
+	}
+	if rows[1]["svname"] != "server0" || rows[1]["status"] != "UP" || rows[3]["check_status"] != "L4CON" {
+		t.Fatalf("Unexpected rows %v", rows)
+	}
+	if _, err := parseStat("Unknown command."); err == nil {
+		t.Fatalf("Expected an error parsing an invalid header")
+	}
+}
+
+func TestOutlierWatcher(t *testing.T) {
+	fake, path := newFakeHAProxySocket(t)
+	defer fake.close(path)
+	events := []*api.Event{}
+	w := newOutlierWatcher(&haproxySocket{path: path}, func(event *api.Event) error {
+		events = append(events, event)
+		return nil
+	})
+	w.watch([]service{
+		{Name: "svc-1", objectKey: "default/svc-1", Outlier: outlierDetection{ErrorLimit: 10}},
+		{Name: "svc-2", objectKey: "default/svc-2"},
+	})
+
+	for _, status := range []string{"UP", "DOWN", "DOWN", "UP 1/2", "UP", "DOWN"} {
+		fake.mu.Lock()
+		fake.response = strings.Replace(strings.Replace(outlierStats, "%v", status, 1), "%v", "L7STS", 1)
+		fake.mu.Unlock()
+		if err := w.check(); err != nil {
+			t.Fatalf("Unexpected error checking servers: %v", err)
+		}
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %v", len(events))
+	}
+	event := events[0]
+	if event.Namespace != "default" || event.InvolvedObject.Name != "svc-1" || event.Reason != "ServerMarkedDown" ||
+		event.Message != "Server server0 was marked down by the loadbalancer (L7STS)" {
+		t.Fatalf("Unexpected event %+v", event)
+	}
+
+	w.watch(nil)
+	fake.mu.Lock()
+	commands := len(fake.commands)
+	fake.mu.Unlock()
+	if err := w.check(); err != nil || len(fake.commands) != commands {
+		t.Fatalf("Expected no stats read without watched backends, got %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// pathPrefixPattern matches the absolute paths of rfc 3986, without the
+// quotes and comments of the haproxy config.
+var pathPrefixPattern = regexp.MustCompile(`^/[-A-Za-z0-9._~%!$&()*+,;=:@/]*$`)
+
+// getPathPrefix returns the path prefix routed to an http service, without
+// a trailing slash.
+func getPathPrefix(s *api.Service) string {
+	val, ok := serviceAnnotations(s.ObjectMeta.Annotations).getPathPrefix()
+	if !ok {
+		return ""
+	}
+	prefix := strings.TrimRight(val, "/")
+	if prefix == "" || !pathPrefixPattern.MatchString(val) {
+		logWarningf("Ignoring invalid %v %q of service %v", lbPathPrefix, val, s.Name)
+		return ""
+	}
+	return prefix
+}
+
+// pathRoutes returns the services with a path prefix in the order their
+// routes must be evaluated: longest prefixes first, and routes of a host
+// before routes of any host with the same prefix, in the precedence of
+// their hosts.
+func pathRoutes(svcs []service) []service {
+	var routes []service
+	for _, svc := range svcs {
+		if svc.PathPrefix != "" {
+			routes = append(routes, svc)
+		}
+	}
+	sort.Sort(routeOrder(routes))
+	return routes
+}
+
+type routeOrder []service
+
+func (r routeOrder) Len() int {
+	return len(r)
+}
+func (r routeOrder) Swap(i, j int) {
+	r[i], r[j] = r[j], r[i]
+}
+func (r routeOrder) Less(i, j int) bool {
+	if len(r[i].PathPrefix) != len(r[j].PathPrefix) {
+		return len(r[i].PathPrefix) > len(r[j].PathPrefix)
+	}
+	if (r[i].Host == "") != (r[j].Host == "") {
+		return r[i].Host != ""
+	}
+	if c := compareHosts(r[i].Host, r[j].Host); c != 0 {
+		return c < 0
+	}
+	return r[i].Name < r[j].Name
+}
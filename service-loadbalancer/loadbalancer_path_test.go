@@ -0,0 +1,99 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestPathRoutes(t *testing.T) {
+	routes := pathRoutes([]service{
+		{Name: "a", PathPrefix: "/api"},
+		{Name: "b", PathPrefix: "/api/v2"},
+		{Name: "c"},
+		{Name: "d", PathPrefix: "/api", Host: "foo.bar"},
+		{Name: "e", PathPrefix: "/static"},
+	})
+	var names []string
+	for _, route := range routes {
+		names = append(names, route.Name)
+	}
+	if strings.Join(names, ",") != "b,e,d,a" {
+		t.Fatalf("Expected routes b,e,d,a, got %v", names)
+	}
+}
+
+func TestGetPathPrefix(t *testing.T) {
+	for prefix, expected := range map[string]string{
+		"/api/":         "/api",
+		"/api/v1;x=%20": "/api/v1;x=%20",
+		"/":             "",
+		"static":        "",
+		"/a\nbind :1":   "",
+		"/a\rb":         "",
+		"/a b":          "",
+		"/a#b":          "",
+		"/a'b":          "",
+		"":              "",
+	} {
+		s := &api.Service{ObjectMeta: api.ObjectMeta{Name: "svc", Annotations: map[string]string{lbPathPrefix: prefix}}}
+		if got := getPathPrefix(s); got != expected {
+			t.Errorf("Expected prefix %q for %q, got %q", expected, prefix, got)
+		}
+	}
+}
+
+func TestPathPrefix(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	obj, _, _ := flb.svcLister.Store.GetByKey("default/svc-1")
+	obj.(*api.Service).ObjectMeta.Annotations = map[string]string{lbPathPrefix: "/api/", lbHostKey: "foo.bar"}
+	obj, _, _ = flb.svcLister.Store.GetByKey("default/svc-2")
+	obj.(*api.Service).ObjectMeta.Annotations = map[string]string{lbPathPrefix: "static"}
+	httpSvc, _, _ := flb.getServices()
+	for _, svc := range httpSvc {
+		if strings.HasPrefix(svc.Name, "svc-1") && svc.PathPrefix != "/api" {
+			t.Fatalf("Expected the /api prefix for %v, got %q", svc.Name, svc.PathPrefix)
+		}
+		if strings.HasPrefix(svc.Name, "svc-2") && svc.PathPrefix != "" {
+			t.Fatalf("Expected the invalid prefix of %v to be ignored, got %q", svc.Name, svc.PathPrefix)
+		}
+	}
+
+	config, err := flb.backend.render(map[string][]service{"http": httpSvc})
+	if err != nil {
+		t.Fatalf("Unexpected error rendering the config: %v", err)
+	}
+	for _, line := range []string{
+		"    acl path_acl_svc-1 path /api\n",
+		"    acl path_acl_svc-1 path_beg /api/\n",
+		"    acl path_host_acl_svc-1 hdr(host) foo.bar\n",
+		"    use_backend svc-1 if path_acl_svc-1 path_host_acl_svc-1\n",
+	} {
+		if !strings.Contains(string(config), line) {
+			t.Fatalf("Expected %q in the config:\n%s", line, config)
+		}
+	}
+	if strings.Contains(string(config), "acl host_acl_svc-1 ") {
+		t.Fatalf("Expected no route for the whole host of svc-1:\n%s", config)
+	}
+	if strings.Index(string(config), "use_backend svc-1 if path_acl_svc-1") > strings.Index(string(config), "use_backend svc-1 if url_acl_svc-1") {
+		t.Fatalf("Expected the path routes before the other routes:\n%s", config)
+	}
+}
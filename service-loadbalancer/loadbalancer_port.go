@@ -0,0 +1,97 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/util/intstr"
+	"k8s.io/kubernetes/pkg/util/sets"
+)
+
+// endpointPortMatches reports whether epPort, a port of the endpoints of s,
+// serves servicePort. Endpoints name their ports after the ports of their
+// service, with the number of the target port in each pod, so named target
+// ports are matched by the name of the service port. The only port of a
+// service may be unnamed, endpoint ports named after the target port are
+// still matched for such ports.
+func endpointPortMatches(s *api.Service, servicePort *api.ServicePort, epPort api.EndpointPort) bool {
+	if servicePort.TargetPort.Type != intstr.String {
+		return epPort.Port == getTargetPort(servicePort)
+	}
+	if servicePort.Name != "" {
+		return epPort.Name == servicePort.Name
+	}
+	return epPort.Name == servicePort.TargetPort.StrVal || (epPort.Name == "" && len(s.Spec.Ports) == 1)
+}
+
+// backendPort returns the port of the servers of servicePort at eps. Pods may
+// number a named target port differently, 0 is returned when they do, and
+// servers are health checked on their own port.
+func backendPort(servicePort *api.ServicePort, eps []string) int {
+	if servicePort.TargetPort.Type != intstr.String {
+		return getTargetPort(servicePort)
+	}
+	port := 0
+	for _, ep := range eps {
+		_, val, err := net.SplitHostPort(ep)
+		if err != nil {
+			continue
+		}
+		n, _ := strconv.Atoi(val)
+		if port != 0 && n != port {
+			return 0
+		}
+		port = n
+	}
+	return port
+}
+
+// reportPortResolution reports the ports of services whose target port
+// matches no port of their ready endpoints, once until it is resolved, with
+// a warning event on the service and the unresolved_target_ports metric.
+// Such ports would otherwise silently get a backend without servers.
+func (lbc *loadBalancerController) reportPortResolution(s *api.Service, servicePort *api.ServicePort, resolved bool) {
+	key := fmt.Sprintf("%v/%v", s.Namespace, s.Name)
+	port := fmt.Sprintf("%v:%v", key, servicePort.TargetPort.String())
+	if lbc.unresolvedPorts == nil {
+		lbc.unresolvedPorts = sets.NewString()
+	}
+	if resolved {
+		if lbc.unresolvedPorts.Has(port) {
+			lbc.unresolvedPorts.Delete(port)
+			unresolvedPorts.DeleteLabelValues(key, servicePort.TargetPort.String())
+			logInfo("Target port resolved", "service", s.Name, "namespace", s.Namespace, "port", servicePort.TargetPort.String())
+		}
+		return
+	}
+	if lbc.unresolvedPorts.Has(port) {
+		return
+	}
+	lbc.unresolvedPorts.Insert(port)
+	unresolvedPorts.WithLabelValues(key, servicePort.TargetPort.String()).Set(1)
+	message := fmt.Sprintf("Target port %v of port %v matches no port of the endpoints", servicePort.TargetPort.String(), servicePort.Port)
+	logWarning(message, "service", s.Name, "namespace", s.Namespace, "port", servicePort.TargetPort.String())
+	if lbc.recordEvent != nil {
+		if err := lbc.recordEvent(serviceEvent(key, "TargetPortNotFound", message)); err != nil {
+			logWarningf("Unable to record the event of service %v: %v", key, err)
+		}
+	}
+}
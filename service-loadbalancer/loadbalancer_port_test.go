@@ -0,0 +1,83 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/util/intstr"
+)
+
+func TestNamedTargetPort(t *testing.T) {
+	endpointAddresses := []api.EndpointAddress{{IP: "1.2.3.4"}, {IP: "5.6.7.8"}}
+	endpointPorts := []api.EndpointPort{
+		{Port: 8080, Protocol: api.ProtocolTCP, Name: "web"},
+		{Port: 9090, Protocol: api.ProtocolTCP, Name: "metrics"},
+	}
+	servicePorts := []api.ServicePort{
+		{Name: "web", Port: 80, TargetPort: intstr.FromString("http")},
+		{Name: "metrics", Port: 9090, TargetPort: intstr.FromInt(9090)},
+	}
+	svc := getService(servicePorts)
+	flb := newFakeLoadBalancerController([]*api.Endpoints{getEndpoints(svc, endpointAddresses, endpointPorts)}, []*api.Service{svc})
+
+	eps := flb.getEndpoints(svc, &svc.Spec.Ports[0])
+	if strings.Join(eps, ",") != "1.2.3.4:8080,5.6.7.8:8080" {
+		t.Fatalf("Expected the named target port to resolve to 8080, got %v", eps)
+	}
+	if port := backendPort(&svc.Spec.Ports[0], eps); port != 8080 {
+		t.Errorf("Expected backend port 8080, got %v", port)
+	}
+	if port := backendPort(&svc.Spec.Ports[0], []string{"1.2.3.4:8080", "5.6.7.8:8081"}); port != 0 {
+		t.Errorf("Expected no backend port for pods numbering the port differently, got %v", port)
+	}
+	if port := backendPort(&svc.Spec.Ports[1], nil); port != 9090 {
+		t.Errorf("Expected the numeric target port, got %v", port)
+	}
+}
+
+func TestUnresolvedTargetPort(t *testing.T) {
+	endpointPorts := []api.EndpointPort{{Port: 8080, Protocol: api.ProtocolTCP, Name: "web"}}
+	servicePorts := []api.ServicePort{{Name: "api", Port: 80, TargetPort: intstr.FromString("http")}}
+	svc := getService(servicePorts)
+	ep := getEndpoints(svc, []api.EndpointAddress{{IP: "1.2.3.4"}}, endpointPorts)
+	flb := newFakeLoadBalancerController([]*api.Endpoints{ep}, []*api.Service{svc})
+	var events []*api.Event
+	flb.recordEvent = func(event *api.Event) error {
+		events = append(events, event)
+		return nil
+	}
+
+	for i := 0; i < 2; i++ {
+		if eps := flb.getEndpoints(svc, &svc.Spec.Ports[0]); len(eps) != 0 {
+			t.Fatalf("Expected no endpoints for the unresolved port, got %v", eps)
+		}
+	}
+	if len(events) != 1 || events[0].Reason != "TargetPortNotFound" || events[0].InvolvedObject.Name != svc.Name {
+		t.Fatalf("Expected a single event about the unresolved port, got %+v", events)
+	}
+
+	ep.Subsets[0].Ports[0].Name = "api"
+	if eps := flb.getEndpoints(svc, &svc.Spec.Ports[0]); len(eps) != 1 {
+		t.Fatalf("Expected the port to resolve, got %v", eps)
+	}
+	if flb.unresolvedPorts.Len() != 0 {
+		t.Errorf("Expected the resolved port to be cleared, got %v", flb.unresolvedPorts.List())
+	}
+}
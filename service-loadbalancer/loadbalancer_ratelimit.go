@@ -0,0 +1,88 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	// defaultRateLimitPeriod is the window of rate limits without a
+	// serviceloadbalancer/lb.rateLimitPeriod annotation.
+	defaultRateLimitPeriod = "10s"
+
+	// defaultRateLimitStatus is the status of requests denied by a rate
+	// limit without a serviceloadbalancer/lb.rateLimitStatus annotation.
+	defaultRateLimitStatus = 429
+)
+
+// denyStatuses are the statuses haproxy can deny a request with.
+// http://cbonte.github.io/haproxy-dconv/configuration-1.7.html#4.2-http-request
+var denyStatuses = map[int]bool{
+	200: true, 400: true, 403: true, 405: true, 408: true,
+	429: true, 500: true, 502: true, 503: true, 504: true,
+}
+
+// rateLimit denies the requests of a client ip above Requests per Period
+// with Status, counted in a stick-table of its own. A zero Requests means
+// the service isn't rate limited.
+type rateLimit struct {
+	Requests int
+	Period   string
+	Status   int
+}
+
+// getRateLimit returns the rate limit of s from its annotations. Without a
+// valid serviceloadbalancer/lb.rateLimit the service isn't rate limited, and
+// other invalid annotations fall back to their defaults.
+func getRateLimit(s *api.Service) rateLimit {
+	annotations := serviceAnnotations(s.ObjectMeta.Annotations)
+	limit := rateLimit{Period: defaultRateLimitPeriod, Status: defaultRateLimitStatus}
+	invalid := func(key, val string) {
+		logWarningf("Ignoring invalid %v %q of service %v", key, val, s.Name)
+	}
+
+	val, ok := annotations.getRateLimit()
+	if !ok {
+		return rateLimit{}
+	}
+	if n, err := strconv.Atoi(val); err == nil && n > 0 {
+		limit.Requests = n
+	} else {
+		invalid(lbRateLimit, val)
+		return rateLimit{}
+	}
+	if val, ok := annotations.getRateLimitPeriod(); ok {
+		if d, err := time.ParseDuration(val); err == nil && d >= time.Second {
+			limit.Period = fmt.Sprintf("%ds", int64(d/time.Second))
+		} else {
+			invalid(lbRateLimitPeriod, val)
+		}
+	}
+	if val, ok := annotations.getRateLimitStatus(); ok {
+		if n, err := strconv.Atoi(val); err == nil && denyStatuses[n] {
+			limit.Status = n
+		} else {
+			invalid(lbRateLimitStatus, val)
+		}
+	}
+	return limit
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestRateLimit(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	obj, _, _ := flb.svcLister.Store.GetByKey("default/svc-2")
+	obj.(*api.Service).ObjectMeta.Annotations = map[string]string{
+		lbRateLimit:       "20",
+		lbRateLimitPeriod: "1m",
+		lbRateLimitStatus: "418",
+	}
+	httpSvc, _, tcpSvc := flb.getServices()
+
+	expected := rateLimit{Requests: 20, Period: "60s", Status: defaultRateLimitStatus}
+	for _, svc := range httpSvc {
+		if svc.Name == "svc-1:443" && svc.RateLimit != (rateLimit{}) {
+			t.Fatalf("Expected no rate limit for %v, got %+v", svc.Name, svc.RateLimit)
+		}
+		if svc.Name == "svc-2" && svc.RateLimit != expected {
+			t.Fatalf("Expected rate limit %+v for %v, got %+v", expected, svc.Name, svc.RateLimit)
+		}
+	}
+
+	defer os.Remove(flb.cfg.Config)
+	if err := writeConfig(flb,
+		map[string][]service{
+			"http": httpSvc,
+			"tcp":  tcpSvc,
+		}); err != nil {
+		t.Fatalf("Expected at least one tcp or http service: %v", err)
+	}
+	cfg, _ := ioutil.ReadFile(flb.cfg.Config)
+	for _, line := range []string{
+		"http-request track-sc0 src table rate-svc-2\n",
+		"http-request deny deny_status 429 if { sc0_http_req_rate(rate-svc-2) gt 20 }",
+		"backend rate-svc-2\n    stick-table type ip size 100k expire 60s store http_req_rate(60s)",
+	} {
+		if !strings.Contains(string(cfg), line) {
+			t.Fatalf("Expected %q in the config:\n%s", line, cfg)
+		}
+	}
+	if strings.Contains(string(cfg), "rate-svc-1") {
+		t.Fatalf("Expected svc-1 not to be rate limited:\n%s", cfg)
+	}
+}
+
+func TestRateLimitInvalid(t *testing.T) {
+	svc := &api.Service{ObjectMeta: api.ObjectMeta{Name: "svc", Annotations: map[string]string{
+		lbRateLimit:       "-1",
+		lbRateLimitPeriod: "1m",
+	}}}
+	if limit := getRateLimit(svc); limit != (rateLimit{}) {
+		t.Fatalf("Expected an invalid rate limit to be ignored, got %+v", limit)
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// readiness tells whether the loadbalancer runs with the config of the
+// current services: the initial sync completed, and the last one neither
+// failed validation nor failed to reload.
+type readiness struct {
+	lock     sync.Mutex
+	synced   bool
+	err      error
+	stopping bool
+}
+
+// observe records the result of a sync.
+func (r *readiness) observe(err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if err == nil {
+		r.synced = true
+	}
+	r.err = err
+}
+
+// shutdown makes the loadbalancer unready for good.
+func (r *readiness) shutdown() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.stopping = true
+}
+
+// check returns why the loadbalancer isn't ready, or nil.
+func (r *readiness) check() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	switch {
+	case r.stopping:
+		return fmt.Errorf("shutting down")
+	case r.err != nil:
+		return fmt.Errorf("last sync failed: %v", r.err)
+	case !r.synced:
+		return fmt.Errorf("waiting for the initial sync")
+	}
+	return nil
+}
+
+// ServeHTTP serves /readyz, failing while the loadbalancer isn't ready so
+// that it stops getting traffic instead of serving a stale config.
+func (r *readiness) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if err := r.check(); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok"))
+}
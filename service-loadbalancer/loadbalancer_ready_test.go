@@ -0,0 +1,58 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadiness(t *testing.T) {
+	r := &readiness{}
+	serve := func() int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost:8081/readyz", nil)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := serve(); code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 before the initial sync, got %v", code)
+	}
+	r.observe(fmt.Errorf("invalid config"))
+	if code := serve(); code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 after a failed initial sync, got %v", code)
+	}
+	r.observe(nil)
+	if code := serve(); code != http.StatusOK {
+		t.Fatalf("Expected 200 after a sync, got %v", code)
+	}
+	r.observe(fmt.Errorf("reload failed"))
+	if err := r.check(); err == nil || err.Error() != "last sync failed: reload failed" {
+		t.Fatalf("Expected the failed reload to make it unready, got %v", err)
+	}
+	r.observe(nil)
+	if code := serve(); code != http.StatusOK {
+		t.Fatalf("Expected 200 once synced again, got %v", code)
+	}
+	r.shutdown()
+	r.observe(nil)
+	if code := serve(); code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 while shutting down, got %v", code)
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// redirectCodes are the statuses haproxy can redirect with.
+var redirectCodes = map[int]bool{301: true, 302: true, 303: true, 307: true, 308: true}
+
+// getSslRedirect returns the status plaintext requests for s are redirected
+// to https with, or 0 if they aren't. The serviceloadbalancer/lb.sslRedirect
+// and serviceloadbalancer/lb.sslRedirectCode annotations override the
+// defaults of the controller.
+func (lbc *loadBalancerController) getSslRedirect(s *api.Service) int {
+	annotations := serviceAnnotations(s.ObjectMeta.Annotations)
+	redirect, code := lbc.sslRedirect, lbc.sslRedirectCode
+	if val, ok := annotations.getSslRedirect(); ok {
+		if b, err := strconv.ParseBool(val); err == nil {
+			redirect = b
+		} else {
+			logWarningf("Ignoring invalid %v %q of service %v", lbSslRedirect, val, s.Name)
+		}
+	}
+	if val, ok := annotations.getSslRedirectCode(); ok {
+		if n, err := strconv.Atoi(val); err == nil && redirectCodes[n] {
+			code = n
+		} else {
+			logWarningf("Ignoring invalid %v %q of service %v", lbSslRedirectCode, val, s.Name)
+		}
+	}
+	if !redirect {
+		return 0
+	}
+	return code
+}
+
+// parsePaths returns the paths of a comma separated list.
+func parsePaths(paths string) []string {
+	var parsed []string
+	for _, path := range strings.Split(paths, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			parsed = append(parsed, path)
+		}
+	}
+	return parsed
+}
+
+// redirectsToSsl reports whether any of svcs redirects plaintext requests.
+func redirectsToSsl(svcs []service) bool {
+	for _, svc := range svcs {
+		if svc.SslRedirect != 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestGetSslRedirect(t *testing.T) {
+	lbc := &loadBalancerController{sslRedirectCode: 301}
+	testCases := []struct {
+		global      bool
+		annotations map[string]string
+		expected    int
+	}{
+		{false, nil, 0},
+		{true, nil, 301},
+		{true, map[string]string{lbSslRedirect: "false"}, 0},
+		{false, map[string]string{lbSslRedirect: "true", lbSslRedirectCode: "308"}, 308},
+		{true, map[string]string{lbSslRedirectCode: "200"}, 301},
+	}
+	for _, tc := range testCases {
+		lbc.sslRedirect = tc.global
+		svc := &api.Service{ObjectMeta: api.ObjectMeta{Name: "svc", Annotations: tc.annotations}}
+		if code := lbc.getSslRedirect(svc); code != tc.expected {
+			t.Errorf("Expected redirect %v with default %v and %v, got %v", tc.expected, tc.global, tc.annotations, code)
+		}
+	}
+}
+
+func TestSslRedirect(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	flb.cfg.sslCert = "/etc/haproxy/ssl.pem"
+	flb.cfg.sslRedirectExclude = parsePaths("/.well-known/acme-challenge/, /healthz")
+	for _, name := range []string{"default/svc-1", "default/svc-2"} {
+		obj, _, _ := flb.svcLister.Store.GetByKey(name)
+		obj.(*api.Service).ObjectMeta.Annotations = map[string]string{lbSslTerm: "true"}
+	}
+	obj, _, _ := flb.svcLister.Store.GetByKey("default/svc-2")
+	obj.(*api.Service).ObjectMeta.Annotations[lbSslRedirect] = "true"
+	obj.(*api.Service).ObjectMeta.Annotations[lbSslRedirectCode] = "308"
+	obj.(*api.Service).ObjectMeta.Annotations[lbHostKey] = "foo.bar"
+	_, httpsTermSvc, _ := flb.getServices()
+
+	defer os.Remove(flb.cfg.Config)
+	if err := writeConfig(flb, map[string][]service{"httpsTerm": httpsTermSvc}); err != nil {
+		t.Fatalf("Expected a valid HAProxy cfg, but an error was returned: %v", err)
+	}
+	cfg, _ := ioutil.ReadFile(flb.cfg.Config)
+	for _, line := range []string{
+		"acl ssl_redirect_exclude path_beg /.well-known/acme-challenge/ /healthz\n",
+		"acl https_url_acl_svc-2 path_beg /svc-2\n    acl https_host_acl_svc-2 hdr(host) foo.bar\n",
+		"redirect scheme https code 308 if https_url_acl_svc-2 !ssl_redirect_exclude or https_host_acl_svc-2 !ssl_redirect_exclude\n",
+	} {
+		if !strings.Contains(string(cfg), line) {
+			t.Fatalf("Expected %q in the config:\n%s", line, cfg)
+		}
+	}
+	if strings.Contains(string(cfg), "https_url_acl_svc-1") {
+		t.Fatalf("Expected no redirect for svc-1:\n%s", cfg)
+	}
+}
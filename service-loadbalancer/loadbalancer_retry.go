@@ -0,0 +1,67 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+	"k8s.io/contrib/service-loadbalancer/backoff"
+	"k8s.io/kubernetes/pkg/api/errors"
+)
+
+var (
+	// syncBackoff delays the retries of failed syncs, by queue key.
+	syncBackoff = backoff.Backoff{Initial: time.Second, Max: 5 * time.Minute, Jitter: 0.2}
+
+	// deferredSyncBackoff delays the syncs deferred until the informers
+	// synced.
+	deferredSyncBackoff = backoff.Backoff{Initial: 100 * time.Millisecond, Max: 2 * time.Second, Jitter: 0.2}
+
+	// reloadBackoff delays the retries of failed reloads, within
+	// --reload-retry-timeout.
+	reloadBackoff = backoff.Backoff{Initial: 500 * time.Millisecond, Max: 2 * time.Second, Jitter: 0.2}
+
+	// apiBackoff delays the retries of api calls failing on the server.
+	apiBackoff = backoff.Backoff{Initial: 200 * time.Millisecond, Max: 2 * time.Second, Jitter: 0.2, MaxElapsed: 10 * time.Second}
+)
+
+// retryAPI runs an api call, retrying it while it fails on the server or
+// doesn't reach it. Other errors, eg: conflicts, are returned right away.
+func retryAPI(call func() error) error {
+	return backoff.Retry(context.Background(), apiBackoff, func() error {
+		err := call()
+		if err != nil && !retriable(err) {
+			return backoff.Permanent(err)
+		}
+		return err
+	})
+}
+
+// retriable reports whether a failed api call may succeed if sent again.
+func retriable(err error) bool {
+	if errors.IsServerTimeout(err) || errors.IsUnexpectedServerError(err) {
+		return true
+	}
+	if status, ok := err.(errors.APIStatus); ok {
+		code := status.Status().Code
+		return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+	}
+	// the request didn't get an answer
+	return true
+}
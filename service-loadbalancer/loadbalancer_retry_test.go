@@ -0,0 +1,83 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/errors"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+)
+
+func TestRetryAPI(t *testing.T) {
+	defer func(b time.Duration) { apiBackoff.Initial = b }(apiBackoff.Initial)
+	apiBackoff.Initial = time.Millisecond
+
+	for err, expected := range map[error]int{
+		errors.NewNotFound(api.Resource("services"), "svc-1"):             1,
+		errors.NewConflict(api.Resource("services"), "svc-1", nil):        1,
+		errors.NewServerTimeout(unversioned.GroupResource{}, "update", 0): 3,
+		errors.NewInternalError(fmt.Errorf("etcd unavailable")):           3,
+		fmt.Errorf("dial tcp 10.0.0.1:443: connect: connection refused"):  3,
+	} {
+		calls := 0
+		retryAPI(func() error {
+			if calls++; calls < 3 {
+				return err
+			}
+			return nil
+		})
+		if calls != expected {
+			t.Errorf("Expected %v calls for %v, got %v", expected, err, calls)
+		}
+	}
+}
+
+func TestReloadRetry(t *testing.T) {
+	defer func(b time.Duration) { reloadBackoff.Initial = b }(reloadBackoff.Initial)
+	reloadBackoff.Initial = time.Millisecond
+
+	f, err := ioutil.TempFile("", "reloads")
+	if err != nil {
+		t.Fatalf("Unexpected error creating temp file: %v", err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	// fails the first 2 reloads
+	cfg := &loadBalancerConfig{
+		Name:      "haproxy",
+		ReloadCmd: fmt.Sprintf("echo x >> %v && test $(wc -l < %v) -gt 2", f.Name(), f.Name()),
+	}
+	if err := cfg.reload(); err == nil {
+		t.Errorf("Expected a failed reload without retries")
+	}
+	cfg.reloadRetryTimeout = time.Second
+	if err := cfg.reload(); err != nil {
+		t.Errorf("Expected the reload to be retried: %v", err)
+	}
+	cfg.ReloadCmd = "false"
+	cfg.reloadRetryTimeout = 20 * time.Millisecond
+	if err := cfg.reload(); err == nil {
+		t.Errorf("Expected the retries to give up")
+	}
+}
@@ -0,0 +1,292 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	socketTimeout = 5 * time.Second
+
+	// placeholderAddr is rendered for server slots without an endpoint.
+	// Such servers are also marked as disabled so haproxy never sends
+	// traffic to them.
+	placeholderAddr = "127.0.0.1:1"
+)
+
+// haproxySocket executes commands against the haproxy runtime API exposed
+// on the stats socket. The socket must be declared with "level admin".
+type haproxySocket struct {
+	path string
+}
+
+// exec sends a single command and returns the raw response.
+func (h *haproxySocket) exec(cmd string) (string, error) {
+	conn, err := net.DialTimeout("unix", h.path, socketTimeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(socketTimeout))
+
+	if _, err := fmt.Fprintf(conn, "%v\n", cmd); err != nil {
+		return "", err
+	}
+	out, err := ioutil.ReadAll(conn)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// setServerAddr points backend/server at addr, which is an <ip>:<port> pair.
+func (h *haproxySocket) setServerAddr(backend, server, addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	out, err := h.exec(fmt.Sprintf("set server %v/%v addr %v port %v", backend, server, host, port))
+	if err != nil {
+		return err
+	}
+	if out != "" && !strings.HasPrefix(out, "IP changed") && !strings.HasPrefix(out, "no need to change") {
+		return fmt.Errorf("unable to set address of %v/%v: %v", backend, server, out)
+	}
+	return nil
+}
+
+// setServerState changes the administrative state of backend/server to one
+// of ready, drain or maint.
+func (h *haproxySocket) setServerState(backend, server, state string) error {
+	out, err := h.exec(fmt.Sprintf("set server %v/%v state %v", backend, server, state))
+	if err != nil {
+		return err
+	}
+	if out != "" {
+		return fmt.Errorf("unable to set state of %v/%v: %v", backend, server, out)
+	}
+	return nil
+}
+
+// serverSessions returns the current number of sessions of backend/server,
+// from the scur column of the stats.
+func (h *haproxySocket) serverSessions(backend, server string) (int, error) {
+	out, err := h.exec("show stat")
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, ",")
+		if len(fields) > 4 && fields[0] == backend && fields[1] == server {
+			return strconv.Atoi(fields[4])
+		}
+	}
+	return 0, fmt.Errorf("no stats for %v/%v", backend, server)
+}
+
+// setServerWeight changes the weight of backend/server.
+func (h *haproxySocket) setServerWeight(backend, server, weight string) error {
+	out, err := h.exec(fmt.Sprintf("set server %v/%v weight %v", backend, server, weight))
+	if err != nil {
+		return err
+	}
+	if out != "" {
+		return fmt.Errorf("unable to set weight of %v/%v: %v", backend, server, out)
+	}
+	return nil
+}
+
+// serverSlots keeps the assignment of endpoints to named server slots stable
+// across syncs. Every backend is rendered with a multiple of size slots, so
+// endpoints can come and go through the runtime API as long as they fit.
+type serverSlots struct {
+	size     int
+	backends map[string][]string
+}
+
+func newServerSlots(size int) *serverSlots {
+	return &serverSlots{size: size, backends: map[string][]string{}}
+}
+
+// assign returns the servers for backend. Endpoints that already occupy a
+// slot keep it, new endpoints take the first free slots, and the number of
+// slots only grows.
+func (s *serverSlots) assign(backend string, eps []string) []backendServer {
+	old := s.backends[backend]
+	capacity := ((len(eps) + s.size - 1) / s.size) * s.size
+	if capacity < len(old) {
+		capacity = len(old)
+	}
+
+	wanted := map[string]bool{}
+	for _, ep := range eps {
+		wanted[ep] = true
+	}
+	slots := make([]string, capacity)
+	for i, ep := range old {
+		if wanted[ep] {
+			slots[i] = ep
+			delete(wanted, ep)
+		}
+	}
+	free := 0
+	for _, ep := range eps {
+		if !wanted[ep] {
+			continue
+		}
+		for slots[free] != "" {
+			free++
+		}
+		slots[free] = ep
+	}
+	s.backends[backend] = slots
+
+	servers := make([]backendServer, capacity)
+	for i, ep := range slots {
+		servers[i] = backendServer{Name: slotName(i), Addr: ep}
+		if ep == "" {
+			servers[i].Addr = placeholderAddr
+			servers[i].Disabled = true
+		}
+	}
+	return servers
+}
+
+// slotName is the name of the server in slot i.
+func slotName(i int) string {
+	return fmt.Sprintf("s%v", i)
+}
+
+// retain forgets the slots of backends that are no longer rendered.
+func (s *serverSlots) retain(svcs []service) {
+	current := map[string]bool{}
+	for _, svc := range svcs {
+		current[svc.Name] = true
+	}
+	for name := range s.backends {
+		if !current[name] {
+			delete(s.backends, name)
+		}
+	}
+}
+
+// topology returns a representation of svcs that ignores server addresses,
+// so two configs with the same topology only differ in what the runtime API
+// can change.
+func topology(svcs []service) string {
+	t := make([]service, len(svcs))
+	for i, svc := range svcs {
+		svc.Ep = nil
+		svc.Servers = make([]backendServer, len(svc.Servers))
+		t[i] = svc
+	}
+	return fmt.Sprintf("%+v", t)
+}
+
+// updateServers applies the server changes between running and svcs through
+// the runtime API. Both must have the same topology.
+func (lbc *loadBalancerController) updateServers(running, svcs []service) error {
+	previous := map[string][]backendServer{}
+	for _, svc := range running {
+		previous[svc.Name] = svc.Servers
+	}
+	for _, svc := range svcs {
+		old := previous[svc.Name]
+		for i, srv := range svc.Servers {
+			if srv == old[i] {
+				continue
+			}
+			if srv.Disabled {
+				logInfo("Disabling server", "backend", svc.Name, "server", srv.Name, "was", old[i].Addr)
+				if err := lbc.socket.setServerState(svc.Name, srv.Name, "maint"); err != nil {
+					return err
+				}
+				// Empty slots keep the default weight, so the next
+				// endpoint doesn't inherit the weight of this one.
+				if old[i].runtimeWeight() != defaultWeight {
+					if err := lbc.socket.setServerWeight(svc.Name, srv.Name, defaultWeight); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if srv.Draining {
+				if !old[i].Draining {
+					logInfo("Draining server", "backend", svc.Name, "server", srv.Name, "addr", srv.Addr)
+					if err := lbc.socket.setServerState(svc.Name, srv.Name, "drain"); err != nil {
+						return err
+					}
+				}
+			} else if srv.Addr != old[i].Addr || old[i].Disabled || old[i].Draining {
+				logInfo("Setting server address", "backend", svc.Name, "server", srv.Name, "addr", srv.Addr)
+				if err := lbc.socket.setServerAddr(svc.Name, srv.Name, srv.Addr); err != nil {
+					return err
+				}
+				if err := lbc.socket.setServerState(svc.Name, srv.Name, "ready"); err != nil {
+					return err
+				}
+			}
+			if weight := srv.runtimeWeight(); weight != old[i].runtimeWeight() {
+				logInfo("Setting server weight", "backend", svc.Name, "server", srv.Name, "weight", weight)
+				if err := lbc.socket.setServerWeight(svc.Name, srv.Name, weight); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// showStat returns the rows of the haproxy stats, by column name.
+func (h *haproxySocket) showStat() ([]map[string]string, error) {
+	out, err := h.exec("show stat")
+	if err != nil {
+		return nil, err
+	}
+	return parseStat(out)
+}
+
+// parseStat parses the csv output of show stat, whose first line names the
+// columns after a "# ".
+func parseStat(out string) ([]map[string]string, error) {
+	lines := strings.Split(out, "\n")
+	if len(lines) == 0 || !strings.HasPrefix(lines[0], "# ") {
+		return nil, fmt.Errorf("unexpected stats header %q", lines[0])
+	}
+	columns := strings.Split(strings.TrimSuffix(strings.TrimPrefix(lines[0], "# "), ","), ",")
+	rows := []map[string]string{}
+	for _, line := range lines[1:] {
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		row := make(map[string]string, len(columns))
+		for i, column := range columns {
+			if i < len(fields) {
+				row[column] = fields[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// fakeHAProxySocket records the commands sent to a unix socket and answers
+// every command with response, empty unless set.
+type fakeHAProxySocket struct {
+	listener net.Listener
+	mu       sync.Mutex
+	commands []string
+	response string
+}
+
+func newFakeHAProxySocket(t *testing.T) (*fakeHAProxySocket, string) {
+	dir, err := ioutil.TempDir("", "haproxy-socket")
+	if err != nil {
+		t.Fatalf("Unexpected error creating temp dir: %v", err)
+	}
+	path := filepath.Join(dir, "haproxy.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Unexpected error listening on %v: %v", path, err)
+	}
+	f := &fakeHAProxySocket{listener: l}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			line, _ := bufio.NewReader(conn).ReadString('\n')
+			f.mu.Lock()
+			f.commands = append(f.commands, line[:len(line)-1])
+			response := f.response
+			f.mu.Unlock()
+			conn.Write([]byte(response))
+			conn.Close()
+		}
+	}()
+	return f, path
+}
+
+func (f *fakeHAProxySocket) close(path string) {
+	f.listener.Close()
+	os.RemoveAll(filepath.Dir(path))
+}
+
+func TestServerSlotsAssign(t *testing.T) {
+	slots := newServerSlots(4)
+
+	servers := slots.assign("svc", []string{"1.1.1.1:80", "2.2.2.2:80"})
+	expected := []backendServer{
+		{Name: "s0", Addr: "1.1.1.1:80"},
+		{Name: "s1", Addr: "2.2.2.2:80"},
+		{Name: "s2", Addr: placeholderAddr, Disabled: true},
+		{Name: "s3", Addr: placeholderAddr, Disabled: true},
+	}
+	if !reflect.DeepEqual(servers, expected) {
+		t.Fatalf("Unexpected servers %+v, expected %+v", servers, expected)
+	}
+
+	// 1.1.1.1 goes away and 3.3.3.3 takes the first free slot, while
+	// 2.2.2.2 keeps its slot.
+	servers = slots.assign("svc", []string{"3.3.3.3:80", "2.2.2.2:80"})
+	expected[0].Addr = "3.3.3.3:80"
+	if !reflect.DeepEqual(servers, expected) {
+		t.Fatalf("Unexpected servers %+v, expected %+v", servers, expected)
+	}
+
+	// Growing past the slots adds another set of slots.
+	servers = slots.assign("svc", []string{"1:1", "2:2", "3:3", "4:4", "5:5"})
+	if len(servers) != 8 {
+		t.Fatalf("Expected 8 slots, got %+v", servers)
+	}
+}
+
+func TestTopologyIgnoresServerAddresses(t *testing.T) {
+	slots := newServerSlots(2)
+	svc := service{Name: "svc", Ep: []string{"1.1.1.1:80"}}
+	svc.Servers = slots.assign(svc.Name, svc.Ep)
+	changed := service{Name: "svc", Ep: []string{"2.2.2.2:80"}}
+	changed.Servers = slots.assign(changed.Name, changed.Ep)
+
+	if topology([]service{svc}) != topology([]service{changed}) {
+		t.Fatalf("Expected the same topology for services only differing in endpoints")
+	}
+	changed.Host = "foo.bar"
+	if topology([]service{svc}) == topology([]service{changed}) {
+		t.Fatalf("Expected a different topology after changing the host")
+	}
+}
+
+func TestUpdateServers(t *testing.T) {
+	fake, path := newFakeHAProxySocket(t)
+	defer fake.close(path)
+
+	slots := newServerSlots(2)
+	running := []service{{Name: "svc", Servers: slots.assign("svc", []string{"1.1.1.1:80", "2.2.2.2:80"})}}
+	svcs := []service{{Name: "svc", Servers: slots.assign("svc", []string{"2.2.2.2:80"})}}
+
+	lbc := &loadBalancerController{slots: slots, socket: &haproxySocket{path: path}}
+	if err := lbc.updateServers(running, svcs); err != nil {
+		t.Fatalf("Unexpected error updating servers: %v", err)
+	}
+
+	expected := []string{"set server svc/s0 state maint"}
+	if !reflect.DeepEqual(fake.commands, expected) {
+		t.Fatalf("Unexpected commands %v, expected %v", fake.commands, expected)
+	}
+
+	running, svcs = svcs, []service{{Name: "svc", Servers: slots.assign("svc", []string{"3.3.3.3:8080", "2.2.2.2:80"})}}
+	if err := lbc.updateServers(running, svcs); err != nil {
+		t.Fatalf("Unexpected error updating servers: %v", err)
+	}
+	expected = append(expected,
+		"set server svc/s0 addr 3.3.3.3 port 8080",
+		"set server svc/s0 state ready")
+	if !reflect.DeepEqual(fake.commands, expected) {
+		t.Fatalf("Unexpected commands %v, expected %v", fake.commands, expected)
+	}
+}
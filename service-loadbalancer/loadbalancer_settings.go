@@ -0,0 +1,203 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	goflag "flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"k8s.io/kubernetes/pkg/util/wait"
+)
+
+// settingsQueueKey is queued for the syncs applying reloaded settings.
+const settingsQueueKey = "settings"
+
+// reloadableFlags are the flags a settings file sets at runtime. v is the
+// verbosity of the controller logs, and the others the flags of the same
+// name.
+var reloadableFlags = []string{
+	"sync-debounce", "sync-max-delay", "log-level",
+	"timeout-connect", "timeout-server", "timeout-client", "v",
+}
+
+// settingValue is implemented by the values of both flag packages.
+type settingValue interface {
+	String() string
+	Set(string) error
+}
+
+func lookupSetting(name string) settingValue {
+	if name == "v" {
+		if f := goflag.Lookup(name); f != nil {
+			return f.Value
+		}
+		return nil
+	}
+	if f := flags.Lookup(name); f != nil {
+		return f.Value
+	}
+	return nil
+}
+
+// parseSettings parses a settings file, a json object of reloadable flags
+// and their values, eg: {"sync-debounce": "5s", "timeout-server": "2m"}.
+func parseSettings(data []byte) (map[string]string, error) {
+	settings := map[string]string{}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, err
+	}
+	for name := range settings {
+		reloadable := false
+		for _, f := range reloadableFlags {
+			reloadable = reloadable || f == name
+		}
+		if !reloadable {
+			return nil, fmt.Errorf("%q can't be reloaded, expected one of %v", name, strings.Join(reloadableFlags, ", "))
+		}
+	}
+	return settings, nil
+}
+
+// validateSetting checks value beyond what its flag parses.
+func validateSetting(name, value string) error {
+	switch name {
+	case "log-level":
+		if !syslogLevels.Has(value) {
+			return fmt.Errorf("unknown log level %q", value)
+		}
+	case "v":
+		if v, err := strconv.Atoi(value); err != nil || v < 0 {
+			return fmt.Errorf("invalid verbosity %q", value)
+		}
+	default:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		if d < 0 || (strings.HasPrefix(name, "timeout-") && d == 0) {
+			return fmt.Errorf("invalid %v %v", name, value)
+		}
+	}
+	return nil
+}
+
+// applySettings sets the flags of settings, all of them or none if one is
+// invalid, returning the names of the flags whose value changed.
+func applySettings(settings map[string]string) ([]string, error) {
+	names := []string{}
+	for name, value := range settings {
+		if err := validateSetting(name, value); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	previous := map[string]string{}
+	changed := []string{}
+	for _, name := range names {
+		v := lookupSetting(name)
+		if v == nil {
+			continue
+		}
+		previous[name] = v.String()
+		if err := v.Set(settings[name]); err != nil {
+			for name, value := range previous {
+				lookupSetting(name).Set(value)
+			}
+			return nil, fmt.Errorf("invalid %v %q: %v", name, settings[name], err)
+		}
+		if v.String() != previous[name] {
+			changed = append(changed, name)
+		}
+	}
+	return changed, nil
+}
+
+// reloadSettings applies the settings file at path, queuing a sync if they
+// changed the config.
+func (lbc *loadBalancerController) reloadSettings(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	settings, err := parseSettings(data)
+	if err != nil {
+		return err
+	}
+	lbc.syncLock.Lock()
+	changed, err := applySettings(settings)
+	if err == nil {
+		lbc.debounce.set(*syncDebounce, *syncMaxDelay)
+		lbc.cfg.logLevel = *logLevel
+	}
+	lbc.syncLock.Unlock()
+	if err != nil {
+		return err
+	}
+	if len(changed) == 0 {
+		logInfo("Settings unchanged", "file", path)
+		return nil
+	}
+	logInfo("Reloaded settings", "file", path, "changed", strings.Join(changed, ","))
+	lbc.queue.Add(settingsQueueKey)
+	return nil
+}
+
+// watchSettings reloads the settings file at path on SIGHUP, and when its
+// content changes, checked every interval unless it is 0.
+func (lbc *loadBalancerController) watchSettings(path string, interval time.Duration, stopCh <-chan struct{}) {
+	reload := func() {
+		if err := lbc.reloadSettings(path); err != nil {
+			logWarningf("Keeping the current settings, unable to reload %v: %v", path, err)
+		}
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-signals:
+				reload()
+			case <-stopCh:
+				signal.Stop(signals)
+				return
+			}
+		}
+	}()
+	if interval <= 0 {
+		return
+	}
+	last, _ := ioutil.ReadFile(path)
+	go wait.Until(func() {
+		data, err := ioutil.ReadFile(path)
+		if err != nil || bytes.Equal(data, last) {
+			return
+		}
+		last = data
+		reload()
+	}, interval, stopCh)
+}
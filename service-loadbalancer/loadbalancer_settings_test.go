@@ -0,0 +1,102 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/util/workqueue"
+)
+
+func TestApplySettings(t *testing.T) {
+	defer func(debounce, server time.Duration, level string) {
+		*syncDebounce, *timeoutServer, *logLevel = debounce, server, level
+	}(*syncDebounce, *timeoutServer, *logLevel)
+	*syncDebounce, *timeoutServer, *logLevel = time.Second, 50*time.Second, "info"
+
+	if _, err := parseSettings([]byte(`{"resync-period": "1m"}`)); err == nil {
+		t.Errorf("Expected resync-period not to be reloadable")
+	}
+	for _, settings := range []map[string]string{
+		{"sync-debounce": "5s", "log-level": "loud"},
+		{"sync-debounce": "5s", "timeout-server": "0s"},
+		{"sync-debounce": "-1s"},
+		{"v": "x"},
+	} {
+		if _, err := applySettings(settings); err == nil {
+			t.Errorf("Expected %v to be refused", settings)
+		}
+		if *syncDebounce != time.Second || *timeoutServer != 50*time.Second || *logLevel != "info" {
+			t.Errorf("Expected %v to leave the flags unchanged", settings)
+		}
+	}
+
+	changed, err := applySettings(map[string]string{"sync-debounce": "5s", "timeout-server": "50s", "log-level": "notice"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(changed, []string{"log-level", "sync-debounce"}) {
+		t.Errorf("Unexpected changed flags %v", changed)
+	}
+	if *syncDebounce != 5*time.Second || *logLevel != "notice" {
+		t.Errorf("Expected the flags to be set, got %v and %v", *syncDebounce, *logLevel)
+	}
+}
+
+func TestReloadSettings(t *testing.T) {
+	defer func(debounce, maxDelay time.Duration, level string) {
+		*syncDebounce, *syncMaxDelay, *logLevel = debounce, maxDelay, level
+	}(*syncDebounce, *syncMaxDelay, *logLevel)
+
+	f, err := ioutil.TempFile("", "settings")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`{"sync-debounce": "3s", "sync-max-delay": "30s", "log-level": "err"}`)
+	f.Close()
+
+	lbc := &loadBalancerController{
+		cfg:   &loadBalancerConfig{logLevel: "info"},
+		queue: workqueue.New(),
+	}
+	lbc.debounce = newDebouncer(time.Second, 10*time.Second, func() {})
+	if err := lbc.reloadSettings(f.Name()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if lbc.debounce.window != 3*time.Second || lbc.debounce.maxDelay != 30*time.Second {
+		t.Errorf("Expected the debounce window to be reloaded, got %v and %v", lbc.debounce.window, lbc.debounce.maxDelay)
+	}
+	if lbc.cfg.logLevel != "err" {
+		t.Errorf("Expected the haproxy log level to be reloaded, got %v", lbc.cfg.logLevel)
+	}
+	if lbc.queue.Len() != 1 {
+		t.Errorf("Expected a sync to be queued, got %v", lbc.queue.Len())
+	}
+
+	ioutil.WriteFile(f.Name(), []byte(`{"log-level": "loud"}`), 0644)
+	if err := lbc.reloadSettings(f.Name()); err == nil {
+		t.Errorf("Expected invalid settings to be refused")
+	}
+	if lbc.cfg.logLevel != "err" {
+		t.Errorf("Expected invalid settings to keep the log level, got %v", lbc.cfg.logLevel)
+	}
+}
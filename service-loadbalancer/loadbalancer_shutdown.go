@@ -0,0 +1,131 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// stopCheckInterval is how often stopping proxy processes are checked.
+const stopCheckInterval = 200 * time.Millisecond
+
+// gracefulStopSignals make the proxies stop listening and exit once their
+// connections are done: a soft stop for haproxy, a graceful quit for nginx.
+var gracefulStopSignals = map[string]syscall.Signal{
+	"haproxy": syscall.SIGUSR1,
+	"nginx":   syscall.SIGQUIT,
+}
+
+// readPids returns the pids of the pid file at path, one or more separated
+// by white space.
+func readPids(path string) ([]int, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, field := range strings.Fields(string(data)) {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, err
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+// alive reports whether the process pid is running. Daemonized proxies may
+// be children of the controller when it runs as pid 1, they are reaped
+// first so that they don't linger as zombies.
+func alive(pid int) bool {
+	syscall.Wait4(pid, nil, syscall.WNOHANG, nil)
+	return syscall.Kill(pid, 0) == nil
+}
+
+// stopGracefully sends sig to pids and waits for them to exit, for grace at
+// most. It reports whether they all did.
+func stopGracefully(pids []int, sig syscall.Signal, grace time.Duration) bool {
+	for _, pid := range pids {
+		if err := syscall.Kill(pid, sig); err != nil && err != syscall.ESRCH {
+			logWarningf("Unable to stop process %v: %v", pid, err)
+		}
+	}
+	deadline := time.Now().Add(grace)
+	for {
+		running := 0
+		for _, pid := range pids {
+			if alive(pid) {
+				running++
+			}
+		}
+		if running == 0 {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(stopCheckInterval)
+	}
+}
+
+// shutdown stops syncing and lets the proxy finish its connections for
+// grace at most. The controller reports itself unready first, and no sync
+// may start a new proxy after it was stopped.
+func (lbc *loadBalancerController) shutdown(grace time.Duration) {
+	logInfof("Shutting down, the proxy has %v to finish its connections", grace)
+	lbc.ready.shutdown()
+	lbc.queue.ShutDown()
+	// never released, waits for the current sync
+	lbc.syncLock.Lock()
+	lbc.tracer.flush()
+
+	sig, ok := gracefulStopSignals[lbc.cfg.Name]
+	if !ok || lbc.cfg.PidFile == "" {
+		logInfof("Not stopping %v gracefully, it needs a pidFile in the json manifest", lbc.cfg.Name)
+		return
+	}
+	pids, err := readPids(lbc.cfg.PidFile)
+	if err != nil {
+		logWarningf("Unable to read the pids of %v: %v", lbc.cfg.Name, err)
+		return
+	}
+	if stopGracefully(pids, sig, grace) {
+		logInfof("%v stopped", lbc.cfg.Name)
+	} else {
+		logWarningf("%v still had connections after %v", lbc.cfg.Name, grace)
+	}
+}
+
+// shutdownOnSignal shuts down and exits on SIGTERM or SIGINT.
+func (lbc *loadBalancerController) shutdownOnSignal(grace time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		<-signals
+		lbc.shutdown(grace)
+		glog.Flush()
+		os.Exit(0)
+	}()
+}
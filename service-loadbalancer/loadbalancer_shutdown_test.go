@@ -0,0 +1,70 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestReadPids(t *testing.T) {
+	f, err := ioutil.TempFile("", "pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("12 34\n56\n")
+	f.Close()
+	pids, err := readPids(f.Name())
+	if err != nil || fmt.Sprintf("%v", pids) != "[12 34 56]" {
+		t.Fatalf("Expected pids [12 34 56], got %v %v", pids, err)
+	}
+}
+
+func TestStopGracefully(t *testing.T) {
+	start := func() int {
+		cmd := exec.Command("sleep", "60")
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		return cmd.Process.Pid
+	}
+
+	// a process ignoring the signal keeps running past the grace period
+	pid := start()
+	if stopGracefully([]int{pid}, syscall.Signal(0), 300*time.Millisecond) {
+		t.Fatalf("Expected the process to outlive the grace period")
+	}
+	if !alive(pid) {
+		t.Fatalf("Expected the process to still run")
+	}
+	syscall.Kill(pid, syscall.SIGKILL)
+
+	pids := []int{start(), start()}
+	begin := time.Now()
+	if !stopGracefully(pids, syscall.SIGTERM, 10*time.Second) {
+		t.Fatalf("Expected the processes to stop")
+	}
+	if elapsed := time.Since(begin); elapsed > 5*time.Second {
+		t.Fatalf("Expected to return once the processes stopped, took %v", elapsed)
+	}
+}
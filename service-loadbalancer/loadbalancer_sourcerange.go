@@ -0,0 +1,69 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// sourceRanges restricts the client ips of a service. Denied clients get a
+// 403 from http services, and their connections are rejected by tcp
+// services.
+type sourceRanges struct {
+	// Restricted only lets clients from Allow through. It is set by the
+	// whitelist annotation even if none of its ranges are valid, denying
+	// every client rather than exposing the service.
+	Restricted bool
+	Allow      []string
+
+	// Deny are denied even if they are allowed.
+	Deny []string
+}
+
+// getSourceRanges returns the source ranges of s from its annotations, each
+// a comma separated list of CIDRs or ips. Invalid entries are ignored.
+func getSourceRanges(s *api.Service) sourceRanges {
+	annotations := serviceAnnotations(s.ObjectMeta.Annotations)
+	var ranges sourceRanges
+	if val, ok := annotations.getWhitelistSourceRange(); ok {
+		ranges.Restricted = true
+		ranges.Allow = parseSourceRanges(s, lbWhitelistSourceRange, val)
+	}
+	if val, ok := annotations.getDenylistSourceRange(); ok {
+		ranges.Deny = parseSourceRanges(s, lbDenylistSourceRange, val)
+	}
+	return ranges
+}
+
+func parseSourceRanges(s *api.Service, key, val string) []string {
+	var ranges []string
+	for _, r := range strings.Split(val, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(r); err != nil && net.ParseIP(r) == nil {
+			logWarningf("Ignoring invalid %v %q of service %v", key, r, s.Name)
+			continue
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
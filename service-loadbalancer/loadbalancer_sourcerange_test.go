@@ -0,0 +1,99 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestGetSourceRanges(t *testing.T) {
+	testCases := []struct {
+		annotations map[string]string
+		expected    sourceRanges
+	}{
+		{nil, sourceRanges{}},
+		{
+			map[string]string{lbWhitelistSourceRange: "10.0.0.0/8, 192.168.1.1,oops"},
+			sourceRanges{Restricted: true, Allow: []string{"10.0.0.0/8", "192.168.1.1"}},
+		},
+		{
+			map[string]string{lbWhitelistSourceRange: "oops"},
+			sourceRanges{Restricted: true},
+		},
+		{
+			map[string]string{lbDenylistSourceRange: "1.2.3.0/24"},
+			sourceRanges{Deny: []string{"1.2.3.0/24"}},
+		},
+	}
+	for _, tc := range testCases {
+		svc := &api.Service{ObjectMeta: api.ObjectMeta{Name: "svc", Annotations: tc.annotations}}
+		if ranges := getSourceRanges(svc); !reflect.DeepEqual(ranges, tc.expected) {
+			t.Errorf("Expected source ranges %+v for %v, got %+v", tc.expected, tc.annotations, ranges)
+		}
+	}
+}
+
+func TestSourceRanges(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	flb.tcpServices = map[string]int{"svc-1": 443}
+	obj, _, _ := flb.svcLister.Store.GetByKey("default/svc-2")
+	obj.(*api.Service).ObjectMeta.Annotations = map[string]string{
+		lbWhitelistSourceRange: "10.0.0.0/8,172.16.0.0/12",
+		lbDenylistSourceRange:  "10.1.0.0/16",
+	}
+	obj, _, _ = flb.svcLister.Store.GetByKey("default/svc-1")
+	obj.(*api.Service).ObjectMeta.Annotations = map[string]string{
+		lbWhitelistSourceRange: "10.0.0.0/8",
+	}
+	httpSvc, _, tcpSvc := flb.getServices()
+	services := map[string][]service{"http": httpSvc, "tcp": tcpSvc}
+
+	defer os.Remove(flb.cfg.Config)
+	if err := writeConfig(flb, services); err != nil {
+		t.Fatalf("Expected at least one tcp or http service: %v", err)
+	}
+	cfg, _ := ioutil.ReadFile(flb.cfg.Config)
+	for _, line := range []string{
+		"http-request deny if !{ src 10.0.0.0/8 172.16.0.0/12 }\n    http-request deny if { src 10.1.0.0/16 }",
+		"tcp-request connection reject if !{ src 10.0.0.0/8 }",
+	} {
+		if !strings.Contains(string(cfg), line) {
+			t.Fatalf("Expected %q in the config:\n%s", line, cfg)
+		}
+	}
+
+	flb.cfg.Template, _ = filepath.Abs("nginx_template.cfg")
+	config, err := (&nginxBackend{loadBalancerConfig: flb.cfg}).render(services)
+	if err != nil {
+		t.Fatalf("Unexpected error rendering the nginx config: %v", err)
+	}
+	for _, line := range []string{
+		"deny 10.1.0.0/16;\n            allow 10.0.0.0/8;\n            allow 172.16.0.0/12;\n            deny all;",
+		"listen 443;\n        allow 10.0.0.0/8;\n        deny all;",
+	} {
+		if !strings.Contains(string(config), line) {
+			t.Fatalf("Expected %q in the nginx config:\n%s", line, config)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/util/sets"
+)
+
+// getServiceSecret returns the secret named by an annotation of s. Secrets
+// are only looked up in the namespace of the service, so a service can't
+// make the loadbalancer use keys of another namespace.
+func (lbc *loadBalancerController) getServiceSecret(s *api.Service, val string) (*api.Secret, error) {
+	if strings.Contains(val, "/") {
+		return nil, fmt.Errorf("secret %v of service %v/%v must be in the namespace of the service", val, s.Namespace, s.Name)
+	}
+	key := fmt.Sprintf("%v/%v", s.Namespace, val)
+	if lbc.secretStore == nil {
+		return nil, fmt.Errorf("secret %v requested but secrets are not watched", key)
+	}
+	obj, exists, err := lbc.secretStore.GetByKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("secret %v not found", key)
+	}
+	return obj.(*api.Secret), nil
+}
+
+// getSecret returns the secret key, namespace/name.
+func (lbc *loadBalancerController) getSecret(key string) (*api.Secret, error) {
+	obj, exists, err := lbc.secretStore.GetByKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("secret %v not found", key)
+	}
+	return obj.(*api.Secret), nil
+}
+
+// getSslSecret returns the secret referenced by the sslSecret annotation of
+// s, which must hold a certificate and its key.
+func (lbc *loadBalancerController) getSslSecret(s *api.Service) (*api.Secret, error) {
+	val, ok := serviceAnnotations(s.ObjectMeta.Annotations).getSslSecret()
+	if !ok {
+		return nil, nil
+	}
+	secret, err := lbc.getServiceSecret(s, val)
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("%v/%v", secret.Namespace, secret.Name)
+	if len(secret.Data[api.TLSCertKey]) == 0 || len(secret.Data[api.TLSPrivateKeyKey]) == 0 {
+		return nil, fmt.Errorf("secret %v must contain %v and %v", key, api.TLSCertKey, api.TLSPrivateKeyKey)
+	}
+	return secret, nil
+}
+
+// sslCertPath returns the path of the PEM bundle written for secret.
+func (lbc *loadBalancerController) sslCertPath(secret *api.Secret) string {
+	return filepath.Join(lbc.sslCertDir, fmt.Sprintf("%v_%v.pem", secret.Namespace, secret.Name))
+}
+
+// crtList returns the lines of the haproxy crt-list for svcs. Every
+// certificate from a secret is listed with the host of its service as sni
+// filter, so haproxy presents the right certificate for each domain.
+func crtList(svcs []service) []string {
+	lines := sets.NewString()
+	for _, svc := range svcs {
+		if svc.sslCert == "" {
+			continue
+		}
+		// regular expressions can't filter sni, the names of the
+		// certificate are matched instead
+		filter := svc.Host
+		if hostKind(filter) == regexHost {
+			filter = ""
+		}
+		lines.Insert(strings.TrimSpace(svc.sslCert + " " + filter))
+	}
+	return lines.List()
+}
+
+// writeFile replaces path with data unless it already has that content.
+func writeFile(path string, data []byte) (bool, error) {
+	if current, err := ioutil.ReadFile(path); err == nil && bytes.Equal(current, data) {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return false, err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp, path)
+}
+
+// writeSslCerts writes the PEM bundles of all services that terminate ssl
+// with a certificate from a secret, and the crt-list referencing them.
+// Files are only rewritten when their content changed.
+func (lbc *loadBalancerController) writeSslCerts(svcs []service) error {
+	for _, svc := range svcs {
+		if svc.sslSecret == "" {
+			continue
+		}
+		secret, err := lbc.getSecret(svc.sslSecret)
+		if err != nil {
+			return err
+		}
+		pem := append(append([]byte{}, secret.Data[api.TLSCertKey]...), '\n')
+		pem = append(pem, secret.Data[api.TLSPrivateKeyKey]...)
+		written, err := writeFile(svc.sslCert, pem)
+		if err != nil {
+			return err
+		}
+		if written {
+			logInfof("Wrote certificate of secret %v to %v", svc.sslSecret, svc.sslCert)
+		}
+	}
+
+	lines := crtList(svcs)
+	if len(lines) == 0 {
+		return nil
+	}
+	_, err := writeFile(lbc.cfg.sslCrtList, []byte(strings.Join(lines, "\n")+"\n"))
+	return err
+}
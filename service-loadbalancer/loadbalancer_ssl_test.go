@@ -0,0 +1,133 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+)
+
+func storeSecrets(secrets []*api.Secret) cache.Store {
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for _, secret := range secrets {
+		store.Add(secret)
+	}
+	return store
+}
+
+func TestSslSecret(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	dir, err := ioutil.TempDir("", "ssl-certs")
+	if err != nil {
+		t.Fatalf("Unexpected error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	flb.sslCertDir = dir
+	flb.cfg.sslCrtList = filepath.Join(dir, "crt-list")
+
+	obj, _, _ := flb.svcLister.Store.GetByKey("default/svc-1")
+	svc := *obj.(*api.Service)
+	svc.ObjectMeta.Annotations = map[string]string{lbSslSecret: "tls", lbHostKey: "foo.bar"}
+	flb.svcLister.Store.Update(&svc)
+	flb.secretStore = storeSecrets([]*api.Secret{{
+		ObjectMeta: api.ObjectMeta{Name: "tls", Namespace: svc.Namespace, ResourceVersion: "1"},
+		Data: map[string][]byte{
+			api.TLSCertKey:       []byte("cert"),
+			api.TLSPrivateKeyKey: []byte("key"),
+		},
+	}})
+
+	_, httpsTermSvc, _ := flb.getServices()
+	if len(httpsTermSvc) == 0 {
+		t.Fatalf("Expected the annotated service to terminate ssl")
+	}
+	expectedCert := filepath.Join(dir, svc.Namespace+"_tls.pem")
+	for _, s := range httpsTermSvc {
+		if s.sslCert != expectedCert || s.sslCertVersion != "1" {
+			t.Fatalf("Unexpected certificate %v version %v, expected %v", s.sslCert, s.sslCertVersion, expectedCert)
+		}
+	}
+
+	if err := flb.writeSslCerts(httpsTermSvc); err != nil {
+		t.Fatalf("Unexpected error writing certificates: %v", err)
+	}
+	pem, err := ioutil.ReadFile(expectedCert)
+	if err != nil || string(pem) != "cert\nkey" {
+		t.Fatalf("Unexpected certificate bundle %q: %v", pem, err)
+	}
+	list, err := ioutil.ReadFile(flb.cfg.sslCrtList)
+	if err != nil || string(list) != expectedCert+" foo.bar\n" {
+		t.Fatalf("Unexpected crt-list %q: %v", list, err)
+	}
+
+	if err := writeConfig(flb, map[string][]service{"httpsTerm": httpsTermSvc}); err != nil {
+		t.Fatalf("Expected a valid HAProxy cfg, but an error was returned: %v", err)
+	}
+	defer os.Remove(flb.cfg.Config)
+	cfg, _ := ioutil.ReadFile(flb.cfg.Config)
+	if !strings.Contains(string(cfg), "bind :443 ssl crt-list "+flb.cfg.sslCrtList) {
+		t.Fatalf("Expected the crt-list to be bound on the https frontend:\n%s", cfg)
+	}
+	if !strings.Contains(string(cfg), "acl sni_acl_svc-1 ssl_fc_sni -i foo.bar") {
+		t.Fatalf("Expected an sni acl for the service host:\n%s", cfg)
+	}
+}
+
+func TestSslSecretMissing(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	flb.secretStore = storeSecrets(nil)
+
+	obj, _, _ := flb.svcLister.Store.GetByKey("default/svc-1")
+	svc := *obj.(*api.Service)
+	svc.ObjectMeta.Annotations = map[string]string{lbSslSecret: "missing"}
+	flb.svcLister.Store.Update(&svc)
+
+	_, httpsTermSvc, _ := flb.getServices()
+	if len(httpsTermSvc) != 0 {
+		t.Fatalf("Expected no ssl termination without a secret, got %+v", httpsTermSvc)
+	}
+}
+
+func TestSslSecretOtherNamespace(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	flb.secretStore = storeSecrets([]*api.Secret{{
+		ObjectMeta: api.ObjectMeta{Name: "tls", Namespace: "other"},
+		Data: map[string][]byte{
+			api.TLSCertKey:       []byte("cert"),
+			api.TLSPrivateKeyKey: []byte("key"),
+		},
+	}})
+
+	obj, _, _ := flb.svcLister.Store.GetByKey("default/svc-1")
+	svc := *obj.(*api.Service)
+	if _, err := flb.getServiceSecret(&svc, "other/tls"); err == nil {
+		t.Fatalf("Expected a secret of another namespace to be rejected")
+	}
+	svc.ObjectMeta.Annotations = map[string]string{lbSslSecret: "other/tls"}
+	flb.svcLister.Store.Update(&svc)
+
+	_, httpsTermSvc, _ := flb.getServices()
+	if len(httpsTermSvc) != 0 {
+		t.Fatalf("Expected no ssl termination with a secret of another namespace, got %+v", httpsTermSvc)
+	}
+}
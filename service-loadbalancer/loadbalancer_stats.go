@@ -0,0 +1,150 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// proxyStats are the stats of a frontend, backend or server of haproxy.
+// Counters haproxy doesn't keep for the kind of proxy are 0.
+// http://cbonte.github.io/haproxy-dconv/configuration-1.5.html#9.1
+type proxyStats struct {
+	Name string `json:"name"`
+
+	// Status is OPEN for frontends, UP or DOWN for backends, and the
+	// health of servers, eg: UP, DOWN, MAINT or UP 1/2.
+	Status      string `json:"status"`
+	CheckStatus string `json:"checkStatus,omitempty"`
+	Weight      int64  `json:"weight,omitempty"`
+
+	Sessions      int64 `json:"sessions"`
+	MaxSessions   int64 `json:"maxSessions"`
+	SessionLimit  int64 `json:"sessionLimit,omitempty"`
+	TotalSessions int64 `json:"totalSessions"`
+
+	// Rate is the number of sessions of the last second.
+	Rate    int64 `json:"rate"`
+	MaxRate int64 `json:"maxRate"`
+
+	Queue    int64 `json:"queue"`
+	MaxQueue int64 `json:"maxQueue"`
+
+	BytesIn  int64 `json:"bytesIn"`
+	BytesOut int64 `json:"bytesOut"`
+
+	RequestErrors    int64 `json:"requestErrors"`
+	ConnectionErrors int64 `json:"connectionErrors"`
+	ResponseErrors   int64 `json:"responseErrors"`
+
+	// Responses counts the http responses by class, eg: 5xx.
+	Responses map[string]int64 `json:"responses,omitempty"`
+}
+
+// backendStats are the stats of a backend and of its servers.
+type backendStats struct {
+	proxyStats
+	Servers []proxyStats `json:"servers"`
+}
+
+// haproxyStats are the stats of all the frontends and backends of haproxy,
+// in the order of the config.
+type haproxyStats struct {
+	Frontends []proxyStats   `json:"frontends"`
+	Backends  []backendStats `json:"backends"`
+}
+
+// newProxyStats reads the stats of row, a row of show stat named name.
+func newProxyStats(name string, row map[string]string) proxyStats {
+	value := func(column string) int64 {
+		n, _ := strconv.ParseInt(row[column], 10, 64)
+		return n
+	}
+	stats := proxyStats{
+		Name:             name,
+		Status:           row["status"],
+		CheckStatus:      row["check_status"],
+		Weight:           value("weight"),
+		Sessions:         value("scur"),
+		MaxSessions:      value("smax"),
+		SessionLimit:     value("slim"),
+		TotalSessions:    value("stot"),
+		Rate:             value("rate"),
+		MaxRate:          value("rate_max"),
+		Queue:            value("qcur"),
+		MaxQueue:         value("qmax"),
+		BytesIn:          value("bin"),
+		BytesOut:         value("bout"),
+		RequestErrors:    value("ereq"),
+		ConnectionErrors: value("econ"),
+		ResponseErrors:   value("eresp"),
+	}
+	for _, class := range []string{"1xx", "2xx", "3xx", "4xx", "5xx", "other"} {
+		if val, ok := row["hrsp_"+class]; ok && val != "" {
+			if stats.Responses == nil {
+				stats.Responses = map[string]int64{}
+			}
+			stats.Responses[class] = value("hrsp_" + class)
+		}
+	}
+	return stats
+}
+
+// groupStats groups rows, the output of show stat, by frontend and backend.
+func groupStats(rows []map[string]string) haproxyStats {
+	stats := haproxyStats{Frontends: []proxyStats{}, Backends: []backendStats{}}
+	backends := map[string]int{}
+	backend := func(name string) *backendStats {
+		i, ok := backends[name]
+		if !ok {
+			i = len(stats.Backends)
+			backends[name] = i
+			stats.Backends = append(stats.Backends, backendStats{proxyStats: proxyStats{Name: name}, Servers: []proxyStats{}})
+		}
+		return &stats.Backends[i]
+	}
+	for _, row := range rows {
+		proxy, name := row["pxname"], row["svname"]
+		switch name {
+		case "FRONTEND":
+			stats.Frontends = append(stats.Frontends, newProxyStats(proxy, row))
+		case "BACKEND":
+			backend(proxy).proxyStats = newProxyStats(proxy, row)
+		default:
+			b := backend(proxy)
+			b.Servers = append(b.Servers, newProxyStats(name, row))
+		}
+	}
+	return stats
+}
+
+// haproxyStatsHandler serves the stats of the frontends, backends and
+// servers of the haproxy behind socket as json.
+func haproxyStatsHandler(socket *haproxySocket) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rows, err := socket.showStat()
+		if err != nil {
+			logInfof("Error reading stats: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(groupStats(rows))
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+const haproxyStatsCSV = `# pxname,svname,qcur,qmax,scur,smax,slim,stot,bin,bout,dreq,dresp,ereq,econ,eresp,wretr,wredis,status,weight,act,bck,chkfail,chkdown,lastchg,downtime,qlimit,pid,iid,sid,throttle,lbtot,tracked,type,rate,rate_lim,rate_max,check_status,check_code,check_duration,hrsp_1xx,hrsp_2xx,hrsp_3xx,hrsp_4xx,hrsp_5xx,hrsp_other,
+httpfrontend,FRONTEND,,,3,10,2000,120,5000,9000,0,0,1,,,,,OPEN,,,,,,,,,1,2,0,,,,0,2,0,8,,,,0,100,5,14,1,0,
+web,server0,1,2,2,6,,70,3000,6000,,0,,0,1,0,0,UP,1,1,0,0,0,50,0,,1,3,1,,70,,2,1,,5,L7OK,200,1,0,60,3,6,1,0,
+web,server1,0,0,1,4,,50,2000,3000,,0,,2,0,0,0,DOWN,1,1,0,3,1,10,10,,1,3,2,,50,,2,1,,3,L4CON,,0,0,40,2,8,0,0,
+web,BACKEND,1,2,3,10,200,120,5000,9000,0,0,,2,1,0,0,UP,2,2,0,,1,50,0,,1,3,0,,120,,1,2,,8,,,,0,100,5,14,1,0,
+`
+
+func TestGroupStats(t *testing.T) {
+	rows, err := parseStat(haproxyStatsCSV)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing stats: %v", err)
+	}
+	stats := groupStats(rows)
+	if len(stats.Frontends) != 1 || len(stats.Backends) != 1 {
+		t.Fatalf("Expected a frontend and a backend, got %+v", stats)
+	}
+	frontend := stats.Frontends[0]
+	if frontend.Name != "httpfrontend" || frontend.Status != "OPEN" || frontend.Sessions != 3 || frontend.SessionLimit != 2000 ||
+		frontend.Rate != 2 || frontend.RequestErrors != 1 {
+		t.Fatalf("Unexpected frontend stats %+v", frontend)
+	}
+	backend := stats.Backends[0]
+	if backend.Name != "web" || backend.Status != "UP" || backend.TotalSessions != 120 || backend.Queue != 1 ||
+		!reflect.DeepEqual(backend.Responses, map[string]int64{"1xx": 0, "2xx": 100, "3xx": 5, "4xx": 14, "5xx": 1, "other": 0}) {
+		t.Fatalf("Unexpected backend stats %+v", backend)
+	}
+	if len(backend.Servers) != 2 {
+		t.Fatalf("Expected 2 servers, got %+v", backend.Servers)
+	}
+	server := backend.Servers[1]
+	if server.Name != "server1" || server.Status != "DOWN" || server.CheckStatus != "L4CON" || server.ConnectionErrors != 2 ||
+		server.Weight != 1 || server.BytesOut != 3000 {
+		t.Fatalf("Unexpected server stats %+v", server)
+	}
+}
+
+func TestHAProxyStatsHandler(t *testing.T) {
+	fake, path := newFakeHAProxySocket(t)
+	defer fake.close(path)
+	fake.response = haproxyStatsCSV
+
+	w := httptest.NewRecorder()
+	haproxyStatsHandler(&haproxySocket{path: path})(w, &http.Request{})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %v: %v", w.Code, w.Body.String())
+	}
+	var stats haproxyStats
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Unexpected error decoding %v: %v", w.Body.String(), err)
+	}
+	if len(stats.Backends) != 1 || len(stats.Backends[0].Servers) != 2 || stats.Backends[0].Servers[0].Name != "server0" {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+	if !reflect.DeepEqual(fake.commands, []string{"show stat"}) {
+		t.Fatalf("Expected show stat, got %v", fake.commands)
+	}
+
+	fake.response = "Unknown command."
+	w = httptest.NewRecorder()
+	haproxyStatsHandler(&haproxySocket{path: path})(w, &http.Request{})
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected 500 for invalid stats, got %v", w.Code)
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/util/sets"
+)
+
+// httpsFrontendPort is the port of the frontend of services terminating ssl.
+const httpsFrontendPort = 443
+
+// publishStatus records where the loadbalancer exposes every service in its
+// serviceloadbalancer/lb.status annotation, as a comma separated list of
+// address:port, and removes it from the services that are not exposed
+// anymore. Services of other controllers, see serviceFilter, are left
+// alone. Only services whose annotation differs are updated, so it is cheap
+// to call after every sync.
+func (lbc *loadBalancerController) publishStatus(httpSvc, httpsTermSvc, tcpSvc []service) {
+	if lbc.publishAddress == "" || lbc.updateService == nil || !lbc.leading() {
+		return
+	}
+	exposed := map[string]sets.String{}
+	expose := func(svc service, port int) {
+		if exposed[svc.objectKey] == nil {
+			exposed[svc.objectKey] = sets.NewString()
+		}
+		exposed[svc.objectKey].Insert(net.JoinHostPort(lbc.publishAddress, strconv.Itoa(port)))
+	}
+	for _, svc := range httpSvc {
+		expose(svc, svc.FrontendPort)
+	}
+	for _, svc := range httpsTermSvc {
+		expose(svc, httpsFrontendPort)
+	}
+	for _, svc := range tcpSvc {
+		expose(svc, svc.FrontendPort)
+	}
+
+	services, _ := lbc.svcLister.List()
+	for i := range services.Items {
+		s := &services.Items[i]
+		if lbc.filter != nil && !lbc.filter.matches(s) {
+			continue
+		}
+		status := ""
+		if addresses, ok := exposed[fmt.Sprintf("%v/%v", s.Namespace, s.Name)]; ok {
+			status = strings.Join(addresses.List(), ",")
+		}
+		if s.Annotations[lbStatus] == status {
+			continue
+		}
+		updated := *s
+		updated.Annotations = map[string]string{}
+		for k, v := range s.Annotations {
+			updated.Annotations[k] = v
+		}
+		if status == "" {
+			delete(updated.Annotations, lbStatus)
+		} else {
+			updated.Annotations[lbStatus] = status
+		}
+		if err := lbc.updateService(&updated); err != nil {
+			logWarningf("Unable to publish the status of service %v/%v: %v", s.Namespace, s.Name, err)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestPublishStatus(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	flb.tcpServices = map[string]int{"svc-1": 443}
+	flb.publishAddress = "203.0.113.10"
+	obj, _, _ := flb.svcLister.Store.GetByKey("default/svc-2")
+	obj.(*api.Service).ObjectMeta.Annotations = map[string]string{lbStatus: "203.0.113.10:80"}
+	stale := &api.Service{ObjectMeta: api.ObjectMeta{
+		Name:        "gone",
+		Namespace:   api.NamespaceDefault,
+		Annotations: map[string]string{lbStatus: "203.0.113.10:80", lbHostKey: "foo.bar"},
+	}}
+	flb.svcLister.Store.Add(stale)
+
+	updated := map[string]map[string]string{}
+	flb.updateService = func(svc *api.Service) error {
+		updated[svc.Name] = svc.Annotations
+		return nil
+	}
+	httpSvc, httpsTermSvc, tcpSvc := flb.getServices()
+	flb.publishStatus(httpSvc, httpsTermSvc, tcpSvc)
+
+	expected := map[string]map[string]string{
+		"svc-1": {lbStatus: "203.0.113.10:443,203.0.113.10:80"},
+		"gone":  {lbHostKey: "foo.bar"},
+	}
+	if !reflect.DeepEqual(updated, expected) {
+		t.Fatalf("Expected updates %v, got %v", expected, updated)
+	}
+	if stale.Annotations[lbStatus] == "" {
+		t.Fatalf("Expected the cached service to be left untouched")
+	}
+}
+
+func TestPublishStatusFollower(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	flb.publishAddress = "203.0.113.10"
+	flb.elector = newLeaderElector(nil, "service-loadbalancer", "b", 0)
+	flb.updateService = func(svc *api.Service) error {
+		t.Errorf("Expected followers not to update %v", svc.Name)
+		return nil
+	}
+	httpSvc, httpsTermSvc, tcpSvc := flb.getServices()
+	flb.publishStatus(httpSvc, httpsTermSvc, tcpSvc)
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// syncQueueKey is queued for every change of a watched object. A sync always
+// covers every service, so a burst of changes only needs a single sync.
+const syncQueueKey = "sync"
+
+// objectChanged reports whether an update from old to cur can change the
+// loadbalancer config. Updates that only touch the metadata of endpoints,
+// like the renewals of leader election leases, or the status of services are
+// ignored.
+func objectChanged(old, cur interface{}) bool {
+	switch o := old.(type) {
+	case *api.Endpoints:
+		c, ok := cur.(*api.Endpoints)
+		return !ok || !reflect.DeepEqual(o.Subsets, c.Subsets)
+	case *api.Service:
+		c, ok := cur.(*api.Service)
+		return !ok || !reflect.DeepEqual(o.Spec, c.Spec) || !reflect.DeepEqual(o.Annotations, c.Annotations)
+	case *api.Secret:
+		c, ok := cur.(*api.Secret)
+		return !ok || !reflect.DeepEqual(o.Data, c.Data)
+	}
+	return !reflect.DeepEqual(old, cur)
+}
+
+// modelHash identifies what a sync applies, the rendered config along with
+// the services it was rendered from, which also carry what the config only
+// refers to, like the version of certificates.
+func modelHash(config []byte, svcGroups ...[]service) string {
+	h := sha256.New()
+	for _, group := range svcGroups {
+		fmt.Fprintf(h, "%v\n", group)
+	}
+	h.Write(config)
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// debouncer coalesces changes into a single sync. The sync is queued once no
+// change happened for window, or maxDelay after the first pending change at
+// the latest, so a rolling deployment doesn't trigger a reload per pod.
+type debouncer struct {
+	window   time.Duration
+	maxDelay time.Duration
+	fire     func()
+
+	mu      sync.Mutex
+	pending int
+	first   time.Time
+	timer   *time.Timer
+	// generation tells timers that were replaced from the current one.
+	generation int
+}
+
+func newDebouncer(window, maxDelay time.Duration, fire func()) *debouncer {
+	return &debouncer{window: window, maxDelay: maxDelay, fire: fire}
+}
+
+// set changes the window and maxDelay of the changes added next.
+func (d *debouncer) set(window, maxDelay time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.window, d.maxDelay = window, maxDelay
+}
+
+// add records a change. Without a window, changes fire right away.
+func (d *debouncer) add() {
+	syncEvents.Inc()
+	d.mu.Lock()
+	if d.window <= 0 {
+		d.mu.Unlock()
+		d.fire()
+		return
+	}
+	defer d.mu.Unlock()
+	now := time.Now()
+	if d.pending == 0 {
+		d.first = now
+	}
+	d.pending++
+	delay := d.window
+	if deadline := d.first.Add(d.maxDelay); now.Add(delay).After(deadline) {
+		delay = deadline.Sub(now)
+	}
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.generation++
+	generation := d.generation
+	d.timer = time.AfterFunc(delay, func() { d.flush(generation) })
+}
+
+func (d *debouncer) flush(generation int) {
+	d.mu.Lock()
+	if generation != d.generation || d.pending == 0 {
+		d.mu.Unlock()
+		return
+	}
+	coalesced := d.pending
+	d.pending = 0
+	d.timer = nil
+	d.mu.Unlock()
+
+	coalescedEvents.Observe(float64(coalesced))
+	d.fire()
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestObjectChanged(t *testing.T) {
+	svc := getService([]api.ServicePort{{Port: 80}})
+	ep := getEndpoints(svc, []api.EndpointAddress{{IP: "1.2.3.4"}}, []api.EndpointPort{{Port: 80}})
+
+	renewed := *ep
+	renewed.ResourceVersion = "2"
+	renewed.Annotations = map[string]string{leaderAnnotation: "{}"}
+	if objectChanged(ep, &renewed) {
+		t.Fatalf("Expected a metadata only update of endpoints to be ignored")
+	}
+	moved := *ep
+	moved.Subsets = []api.EndpointSubset{{Addresses: []api.EndpointAddress{{IP: "5.6.7.8"}}}}
+	if !objectChanged(ep, &moved) {
+		t.Fatalf("Expected a change of addresses to be noticed")
+	}
+
+	status := *svc
+	status.Status.LoadBalancer.Ingress = []api.LoadBalancerIngress{{IP: "10.0.0.1"}}
+	if objectChanged(svc, &status) {
+		t.Fatalf("Expected a status update of a service to be ignored")
+	}
+	annotated := *svc
+	annotated.Annotations = map[string]string{lbHostKey: "foo.bar"}
+	if !objectChanged(svc, &annotated) {
+		t.Fatalf("Expected a new annotation to be noticed")
+	}
+}
+
+func TestModelHash(t *testing.T) {
+	svcs := []service{{Name: "svc", Ep: []string{"1.2.3.4:80"}}}
+	config := []byte("config")
+	if modelHash(config, svcs) != modelHash(config, []service{{Name: "svc", Ep: []string{"1.2.3.4:80"}}}) {
+		t.Fatalf("Expected the same hash for the same model")
+	}
+	if modelHash(config, svcs) == modelHash([]byte("other"), svcs) {
+		t.Fatalf("Expected a different hash for a different config")
+	}
+	rotated := []service{{Name: "svc", Ep: []string{"1.2.3.4:80"}, sslCertVersion: "2"}}
+	if modelHash(config, svcs) == modelHash(config, rotated) {
+		t.Fatalf("Expected a different hash after a certificate rotation")
+	}
+}
+
+func TestDebouncer(t *testing.T) {
+	var fired int32
+	d := newDebouncer(50*time.Millisecond, 150*time.Millisecond, func() {
+		atomic.AddInt32(&fired, 1)
+	})
+	for i := 0; i < 5; i++ {
+		d.add()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&fired); n != 0 {
+		t.Fatalf("Expected no sync within the debounce window, got %v", n)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&fired); n != 1 {
+		t.Fatalf("Expected the changes to be coalesced into 1 sync, got %v", n)
+	}
+
+	// Changes coming faster than the window still sync after maxDelay.
+	start := time.Now()
+	for time.Since(start) < 250*time.Millisecond {
+		d.add()
+		time.Sleep(20 * time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&fired); n < 2 {
+		t.Fatalf("Expected a sync after the max delay, got %v syncs", n)
+	}
+
+	atomic.StoreInt32(&fired, 0)
+	d = newDebouncer(0, 0, func() { atomic.AddInt32(&fired, 1) })
+	d.add()
+	if n := atomic.LoadInt32(&fired); n != 1 {
+		t.Fatalf("Expected an immediate sync without a window, got %v", n)
+	}
+}
+
+// recordingBackend counts the reloads of the configs applied to it.
+type recordingBackend struct {
+	proxyBackend
+	reloads int
+}
+
+func (r *recordingBackend) validate(config []byte) error {
+	return nil
+}
+
+func (r *recordingBackend) apply(config []byte, reload bool) error {
+	if reload {
+		r.reloads++
+	}
+	return nil
+}
+
+func TestSyncReloadsChangedModel(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	// the stores of the test controller are already listed
+	flb.fixture = "test"
+	backend := &recordingBackend{proxyBackend: flb.backend}
+	flb.backend = backend
+
+	for i, expected := range []int{1, 1} {
+		if err := flb.sync(false, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if backend.reloads != expected {
+			t.Fatalf("Expected %v reloads after sync %v, got %v", expected, i, backend.reloads)
+		}
+	}
+	obj, _, _ := flb.svcLister.Store.GetByKey("default/svc-1")
+	obj.(*api.Service).ObjectMeta.Annotations = map[string]string{lbTimeoutServer: "30s"}
+	if err := flb.sync(false, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if backend.reloads != 2 {
+		t.Fatalf("Expected an annotation of an http service to reload, got %v reloads", backend.reloads)
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/util/sets"
+)
+
+// getTCPPorts returns the frontend ports of the ports of s published as tcp
+// services, by service port: the port of s in --tcp-services, and those of
+// its tcpPorts annotation, * for every port or a list of ports by number or
+// name, each optionally followed by the port of its frontend, eg:
+// 3306,admin:9443. Frontends listen on the service port by default.
+func (lbc *loadBalancerController) getTCPPorts(s *api.Service) map[int]int {
+	ports := map[int]int{}
+	if port, ok := lbc.tcpServices[s.Name]; ok {
+		ports[port] = port
+	}
+	val, ok := serviceAnnotations(s.ObjectMeta.Annotations).getTCPPorts()
+	if !ok {
+		return ports
+	}
+	if strings.TrimSpace(val) == "*" {
+		for _, servicePort := range s.Spec.Ports {
+			if servicePort.Protocol != api.ProtocolUDP {
+				ports[servicePort.Port] = servicePort.Port
+			}
+		}
+		return ports
+	}
+	for _, entry := range strings.Split(val, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		port, ok := findServicePort(s, parts[0])
+		if !ok {
+			logWarningf("Ignoring invalid %v %q of service %v", lbTCPPorts, entry, s.Name)
+			continue
+		}
+		frontendPort := port
+		if len(parts) == 2 {
+			n, err := strconv.Atoi(parts[1])
+			if err != nil || n <= 0 || n > 65535 {
+				logWarningf("Ignoring invalid %v %q of service %v", lbTCPPorts, entry, s.Name)
+				continue
+			}
+			frontendPort = n
+		}
+		ports[port] = frontendPort
+	}
+	return ports
+}
+
+// findServicePort returns the port of s named or numbered val.
+func findServicePort(s *api.Service, val string) (int, bool) {
+	for _, servicePort := range s.Spec.Ports {
+		if servicePort.Protocol == api.ProtocolUDP {
+			continue
+		}
+		if servicePort.Name == val || strconv.Itoa(servicePort.Port) == val {
+			return servicePort.Port, true
+		}
+	}
+	return 0, false
+}
+
+// reservedPorts returns what listens on the ports tcp services can't use.
+func (lbc *loadBalancerController) reservedPorts(https bool) map[int]string {
+	reserved := map[int]string{
+		lbc.httpPort: "the http frontend",
+		*statsPort:   "the loadbalancer stats",
+		lbApiPort:    "the controller",
+	}
+	if https {
+		reserved[httpsFrontendPort] = "the https frontend"
+	}
+	return reserved
+}
+
+// portClaim is a tcp service claiming its frontend port, created is the
+// creation time of its kubernetes service.
+type portClaim struct {
+	svc     service
+	created time.Time
+}
+
+// claimsByAge orders claims by the creation time of their service, then by
+// name.
+type claimsByAge []portClaim
+
+func (c claimsByAge) Len() int {
+	return len(c)
+}
+func (c claimsByAge) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+}
+func (c claimsByAge) Less(i, j int) bool {
+	if !c[i].created.Equal(c[j].created) {
+		return c[i].created.Before(c[j].created)
+	}
+	return c[i].svc.Name < c[j].svc.Name
+}
+
+// allocateTCPPorts returns the tcp services whose frontend port is free.
+// When several want the same port, the service created first keeps it, so
+// publishing a new service never takes a port over. The others are reported
+// with a warning event on their service, once per conflict.
+func (lbc *loadBalancerController) allocateTCPPorts(svcs []service, reserved map[int]string) []service {
+	claims := []portClaim{}
+	for _, svc := range svcs {
+		claim := portClaim{svc: svc}
+		if obj, exists, err := lbc.svcLister.Store.GetByKey(svc.objectKey); err == nil && exists {
+			claim.created = obj.(*api.Service).CreationTimestamp.Time
+		}
+		claims = append(claims, claim)
+	}
+	sort.Sort(claimsByAge(claims))
+
+	owners := map[int]string{}
+	for port, owner := range reserved {
+		owners[port] = owner
+	}
+	conflicts := sets.NewString()
+	allocated := []service{}
+	for _, claim := range claims {
+		svc := claim.svc
+		owner, taken := owners[svc.FrontendPort]
+		if !taken {
+			owners[svc.FrontendPort] = "service port " + svc.Name
+			allocated = append(allocated, svc)
+			continue
+		}
+		conflict := fmt.Sprintf("%v:%v", svc.Name, svc.FrontendPort)
+		conflicts.Insert(conflict)
+		if lbc.portConflicts.Has(conflict) {
+			continue
+		}
+		message := fmt.Sprintf("Not publishing %v, port %v is used by %v", svc.Name, svc.FrontendPort, owner)
+		logWarning(message, "service", svc.Name, "port", svc.FrontendPort)
+		if lbc.recordEvent != nil {
+			if err := lbc.recordEvent(serviceEvent(svc.objectKey, "PortConflict", message)); err != nil {
+				logWarningf("Unable to record the event of service %v: %v", svc.objectKey, err)
+			}
+		}
+	}
+	lbc.portConflicts = conflicts
+	sort.Sort(serviceByName(allocated))
+	return allocated
+}
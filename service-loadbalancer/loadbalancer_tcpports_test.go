@@ -0,0 +1,78 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+)
+
+func TestTCPPorts(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	flb.tcpServices = nil
+	var events []*api.Event
+	flb.recordEvent = func(event *api.Event) error {
+		events = append(events, event)
+		return nil
+	}
+	created := time.Now()
+	for name, annotations := range map[string]map[string]string{
+		"default/svc-1": {lbTCPPorts: "443:3306"},
+		"default/svc-2": {lbTCPPorts: "443:3306, 80:8080, bogus, 443:99999"},
+	} {
+		obj, _, _ := flb.svcLister.Store.GetByKey(name)
+		obj.(*api.Service).ObjectMeta.Annotations = annotations
+		// svc-2 is newer, it loses the conflict
+		if name == "default/svc-2" {
+			obj.(*api.Service).ObjectMeta.CreationTimestamp = unversioned.NewTime(created.Add(time.Minute))
+		} else {
+			obj.(*api.Service).ObjectMeta.CreationTimestamp = unversioned.NewTime(created)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		httpSvc, _, tcpSvc := flb.getServices()
+		if len(tcpSvc) != 2 || tcpSvc[0].Name != "svc-1:443" || tcpSvc[0].FrontendPort != 3306 ||
+			tcpSvc[1].Name != "svc-2" || tcpSvc[1].FrontendPort != 8080 {
+			t.Fatalf("Expected the port of svc-1 and the remapped port of svc-2, got %+v", tcpSvc)
+		}
+		if len(httpSvc) != 1 || httpSvc[0].Name != "svc-1" {
+			t.Fatalf("Expected the other ports to stay http, got %+v", httpSvc)
+		}
+	}
+	if len(events) != 1 || events[0].Reason != "PortConflict" || events[0].InvolvedObject.Name != "svc-2" ||
+		!strings.Contains(events[0].Message, "svc-2:443") {
+		t.Fatalf("Expected a single conflict event on svc-2, got %+v", events)
+	}
+
+	obj, _, _ := flb.svcLister.Store.GetByKey("default/svc-2")
+	obj.(*api.Service).ObjectMeta.Annotations = map[string]string{lbTCPPorts: "*"}
+	_, _, tcpSvc := flb.getServices()
+	if len(tcpSvc) != 2 || tcpSvc[1].Name != "svc-2:443" || tcpSvc[1].FrontendPort != 443 {
+		t.Fatalf("Expected every free port of svc-2, got %+v", tcpSvc)
+	}
+	if len(events) != 2 || !strings.Contains(events[1].Message, "the http frontend") {
+		t.Fatalf("Expected the http port of svc-2 to conflict with the http frontend, got %+v", events)
+	}
+	if flb.portConflicts.Has("svc-2:443:3306") || !flb.portConflicts.Has("svc-2:80") {
+		t.Fatalf("Expected resolved conflicts to be forgotten, got %v", flb.portConflicts.List())
+	}
+}
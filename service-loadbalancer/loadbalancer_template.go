@@ -0,0 +1,79 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"text/template"
+	"time"
+
+	"k8s.io/kubernetes/pkg/util/wait"
+)
+
+// executeTemplate renders the template at path with conf.
+func executeTemplate(path string, conf map[string]interface{}) ([]byte, error) {
+	t, err := template.ParseFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, conf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderTemplate renders the custom template if one is configured, falling
+// back to the built-in template when the custom one can't be parsed or
+// executed, or renders a config rejected by the validateCmd.
+func (cfg *loadBalancerConfig) renderTemplate(conf map[string]interface{}) ([]byte, error) {
+	if cfg.customTemplate != "" {
+		out, err := executeTemplate(cfg.customTemplate, conf)
+		if err == nil {
+			if err = cfg.validate(out); err == nil {
+				return out, nil
+			}
+			cfg.keepRejected(out, err)
+		}
+		logErrorf("Invalid custom template %v, using %v instead: %v", cfg.customTemplate, cfg.Template, err)
+	}
+	return executeTemplate(cfg.Template, conf)
+}
+
+// watchTemplate starts polling the file at path and calls onChange every
+// time its content changes. ConfigMap volumes are updated by swapping a
+// symlink, so the content is compared rather than the modification time.
+func watchTemplate(path string, interval time.Duration, onChange func(), stopCh <-chan struct{}) {
+	var last [sha256.Size]byte
+	if b, err := ioutil.ReadFile(path); err == nil {
+		last = sha256.Sum256(b)
+	}
+	go wait.Until(func() {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			logWarningf("Unable to read custom template %v: %v", path, err)
+			return
+		}
+		if sum := sha256.Sum256(b); sum != last {
+			logInfof("Custom template %v changed", path)
+			last = sum
+			onChange()
+		}
+	}, interval, stopCh)
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCustomTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "template")
+	if err != nil {
+		t.Fatalf("Unexpected error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	custom := filepath.Join(dir, "template.cfg")
+
+	flb := buildTestLoadBalancer("")
+	flb.cfg.customTemplate = custom
+	httpSvc, _, tcpSvc := flb.getServices()
+	services := map[string][]service{"http": httpSvc, "tcp": tcpSvc}
+	defer os.Remove(flb.cfg.Config)
+
+	ioutil.WriteFile(custom, []byte("{{range .services.http}}{{.Name}} {{end}}"), 0644)
+	if err := writeConfig(flb, services); err != nil {
+		t.Fatalf("Unexpected error writing the config: %v", err)
+	}
+	if out, _ := ioutil.ReadFile(flb.cfg.Config); string(out) != "svc-1 svc-1:443 svc-2 svc-2:443 " {
+		t.Fatalf("Expected the custom template to be used, got %q", out)
+	}
+
+	// A broken custom template falls back to the built-in one.
+	ioutil.WriteFile(custom, []byte("{{range .services.http}"), 0644)
+	if err := writeConfig(flb, services); err != nil {
+		t.Fatalf("Unexpected error writing the config: %v", err)
+	}
+	template, _ := filepath.Abs("./test-samples/TestDefaultAlgorithm.cfg")
+	compareCfgFiles(t, flb.cfg.Config, template)
+
+	// So does a custom template rendering a config rejected by the
+	// validateCmd.
+	ioutil.WriteFile(custom, []byte("invalid {{range .services.http}}{{.Name}} {{end}}"), 0644)
+	flb.cfg.ValidateCmd = "! grep -q invalid"
+	defer os.Remove(flb.cfg.Config + ".rejected")
+	if err := writeConfig(flb, services); err != nil {
+		t.Fatalf("Unexpected error writing the config: %v", err)
+	}
+	compareCfgFiles(t, flb.cfg.Config, template)
+	if out, _ := ioutil.ReadFile(flb.cfg.Config + ".rejected"); string(out) != "invalid svc-1 svc-1:443 svc-2 svc-2:443 " {
+		t.Fatalf("Expected the custom config to be kept as rejected, got %q", out)
+	}
+}
+
+func TestWatchTemplate(t *testing.T) {
+	f, err := ioutil.TempFile("", "template")
+	if err != nil {
+		t.Fatalf("Unexpected error creating temp file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("a")
+	f.Close()
+
+	changed := make(chan struct{}, 1)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	watchTemplate(f.Name(), 10*time.Millisecond, func() {
+		changed <- struct{}{}
+	}, stopCh)
+
+	ioutil.WriteFile(f.Name(), []byte("b"), 0644)
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected a change of the template to be noticed")
+	}
+}
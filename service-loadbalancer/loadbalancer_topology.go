@@ -0,0 +1,93 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+)
+
+// locality keeps traffic in the zone of the loadbalancer. Servers in other
+// zones are backups, used once all the servers of the zone are down, or
+// left out with strict locality.
+type locality struct {
+	zone   string
+	strict bool
+}
+
+// getZones returns the zones of the nodes of the pods behind the endpoints
+// of s, by pod ip. Pods on nodes without a zone are left out.
+func (lbc *loadBalancerController) getZones(s *api.Service) map[string]string {
+	ep, err := lbc.epLister.GetServiceEndpoints(s)
+	if err != nil {
+		return nil
+	}
+	zones := map[string]string{}
+	for _, ss := range ep.Subsets {
+		for _, epAddress := range ss.Addresses {
+			ref := epAddress.TargetRef
+			if ref == nil || ref.Kind != "Pod" {
+				continue
+			}
+			obj, exists, err := lbc.podStore.GetByKey(fmt.Sprintf("%v/%v", ref.Namespace, ref.Name))
+			if err != nil || !exists {
+				continue
+			}
+			if zone := lbc.getNodeZone(obj.(*api.Pod).Spec.NodeName); zone != "" {
+				zones[epAddress.IP] = zone
+			}
+		}
+	}
+	return zones
+}
+
+// getNodeZone returns the zone of the named node, empty if it has none.
+func (lbc *loadBalancerController) getNodeZone(name string) string {
+	obj, exists, err := lbc.nodeStore.GetByKey(name)
+	if err != nil || !exists {
+		return ""
+	}
+	return nodeZone(obj.(*api.Node))
+}
+
+// nodeZone returns the zone label of node.
+func nodeZone(node *api.Node) string {
+	return node.Labels[unversioned.LabelZoneFailureDomain]
+}
+
+// localize returns the endpoints of ep to render, and which of them are in
+// another zone. Endpoints of an unknown zone are considered local.
+func (l *locality) localize(ep []string, zones map[string]string) ([]string, map[string]bool) {
+	var kept []string
+	remote := map[string]bool{}
+	for _, addr := range ep {
+		host, _, err := net.SplitHostPort(addr)
+		zone := zones[host]
+		if err != nil || zone == "" || zone == l.zone {
+			kept = append(kept, addr)
+			continue
+		}
+		if !l.strict {
+			kept = append(kept, addr)
+			remote[addr] = true
+		}
+	}
+	return kept, remote
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/util/intstr"
+)
+
+func getZonedPod(name, node string) *api.Pod {
+	return &api.Pod{
+		ObjectMeta: api.ObjectMeta{Name: name, Namespace: api.NamespaceDefault},
+		Spec:       api.PodSpec{NodeName: node},
+	}
+}
+
+func getZonedNode(name, zone string) *api.Node {
+	return &api.Node{ObjectMeta: api.ObjectMeta{
+		Name:   name,
+		Labels: map[string]string{unversioned.LabelZoneFailureDomain: zone},
+	}}
+}
+
+func TestTopologyAware(t *testing.T) {
+	endpointAddresses := []api.EndpointAddress{
+		{IP: "1.2.3.4", TargetRef: &api.ObjectReference{Kind: "Pod", Namespace: api.NamespaceDefault, Name: "local"}},
+		{IP: "5.6.7.8", TargetRef: &api.ObjectReference{Kind: "Pod", Namespace: api.NamespaceDefault, Name: "remote"}},
+		{IP: "9.9.9.9"},
+	}
+	endpointPorts := []api.EndpointPort{{Port: 80}}
+	svc := getService([]api.ServicePort{{Port: 80, TargetPort: intstr.FromInt(80)}})
+	flb := newFakeLoadBalancerController([]*api.Endpoints{getEndpoints(svc, endpointAddresses, endpointPorts)}, []*api.Service{svc})
+	flb.cfg = &loadBalancerConfig{}
+	flb.podStore.Add(getZonedPod("local", "node-a"))
+	flb.podStore.Add(getZonedPod("remote", "node-b"))
+	flb.nodeStore = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	flb.nodeStore.Add(getZonedNode("node-a", "zone-a"))
+	flb.nodeStore.Add(getZonedNode("node-b", "zone-b"))
+	flb.locality = &locality{zone: "zone-a"}
+
+	httpSvc, _, _ := flb.getServices()
+	expected := []backendServer{
+		{Name: "1.2.3.4:80", Addr: "1.2.3.4:80"},
+		{Name: "5.6.7.8:80", Addr: "5.6.7.8:80", Backup: true},
+		{Name: "9.9.9.9:80", Addr: "9.9.9.9:80"},
+	}
+	if len(httpSvc) != 1 || !reflect.DeepEqual(httpSvc[0].Servers, expected) {
+		t.Fatalf("Unexpected servers %+v, expected %+v", httpSvc, expected)
+	}
+
+	flb.locality.strict = true
+	httpSvc, _, _ = flb.getServices()
+	expected = []backendServer{
+		{Name: "1.2.3.4:80", Addr: "1.2.3.4:80"},
+		{Name: "9.9.9.9:80", Addr: "9.9.9.9:80"},
+	}
+	if len(httpSvc) != 1 || !reflect.DeepEqual(httpSvc[0].Servers, expected) {
+		t.Fatalf("Unexpected servers with strict locality %+v, expected %+v", httpSvc, expected)
+	}
+}
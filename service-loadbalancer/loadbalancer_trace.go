@@ -0,0 +1,292 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// traceExportInterval is how often finished spans are exported.
+	traceExportInterval = 5 * time.Second
+
+	// maxPendingSpans bounds the spans waiting for an export, more are
+	// dropped while the collector is unreachable.
+	maxPendingSpans = 2048
+
+	// traceScope is the instrumentation scope of the spans.
+	traceScope = "k8s.io/contrib/service-loadbalancer"
+)
+
+// tracer exports the spans of syncs to an OpenTelemetry collector, over
+// OTLP/HTTP with the json encoding. A nil tracer starts nil spans, which
+// record nothing.
+type tracer struct {
+	endpoint string
+	headers  map[string]string
+	resource map[string]string
+	client   *http.Client
+
+	lock    sync.Mutex
+	pending []*span
+}
+
+// newTracerFromEnv returns the tracer configured by the standard
+// OTEL_EXPORTER_OTLP_* environment variables read with getenv, or nil if no
+// endpoint is set or OTEL_TRACES_EXPORTER is none. Only the http/json
+// protocol is supported.
+func newTracerFromEnv(getenv func(string) string) (*tracer, error) {
+	if exporter := getenv("OTEL_TRACES_EXPORTER"); exporter == "none" {
+		return nil, nil
+	} else if exporter != "" && exporter != "otlp" {
+		return nil, fmt.Errorf("unsupported OTEL_TRACES_EXPORTER %q, expected otlp or none", exporter)
+	}
+	endpoint := getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	if endpoint == "" {
+		return nil, nil
+	}
+	if _, err := url.Parse(endpoint); err != nil {
+		return nil, fmt.Errorf("invalid otlp endpoint %q: %v", endpoint, err)
+	}
+	protocol := getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+	if protocol == "" {
+		protocol = getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+	if protocol != "" && protocol != "http/json" {
+		return nil, fmt.Errorf("unsupported otlp protocol %q, expected http/json", protocol)
+	}
+	timeout := 10 * time.Second
+	if val := getenv("OTEL_EXPORTER_OTLP_TIMEOUT"); val != "" {
+		ms, err := strconv.Atoi(val)
+		if err != nil || ms <= 0 {
+			return nil, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_TIMEOUT %q", val)
+		}
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+	headers, err := parseOTelList(getenv("OTEL_EXPORTER_OTLP_HEADERS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_HEADERS: %v", err)
+	}
+	resource, err := parseOTelList(getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTEL_RESOURCE_ATTRIBUTES: %v", err)
+	}
+	if name := getenv("OTEL_SERVICE_NAME"); name != "" {
+		resource["service.name"] = name
+	} else if resource["service.name"] == "" {
+		resource["service.name"] = "service-loadbalancer"
+	}
+	return &tracer{
+		endpoint: endpoint,
+		headers:  headers,
+		resource: resource,
+		client:   &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// parseOTelList parses the comma separated key=value pairs of the otel
+// environment variables, whose values are url encoded.
+func parseOTelList(val string) (map[string]string, error) {
+	pairs := map[string]string{}
+	for _, pair := range strings.Split(val, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", pair)
+		}
+		value, err := url.QueryUnescape(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, err
+		}
+		pairs[strings.TrimSpace(parts[0])] = value
+	}
+	return pairs, nil
+}
+
+// span is a timed operation of a sync, in the trace of its root span.
+type span struct {
+	tracer  *tracer
+	traceID string
+	id      string
+	parent  string
+	name    string
+	start   time.Time
+	end     time.Time
+	attrs   map[string]string
+	err     error
+}
+
+// randomID returns n random bytes, hex encoded.
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// start starts a span named name, a child of parent unless it is nil.
+func (t *tracer) start(parent *span, name string) *span {
+	if t == nil {
+		return nil
+	}
+	s := &span{tracer: t, id: randomID(8), name: name, start: time.Now(), attrs: map[string]string{}}
+	if parent != nil {
+		s.traceID, s.parent = parent.traceID, parent.id
+	} else {
+		s.traceID = randomID(16)
+	}
+	return s
+}
+
+// child starts a span named name, a child of s.
+func (s *span) child(name string) *span {
+	if s == nil {
+		return nil
+	}
+	return s.tracer.start(s, name)
+}
+
+// set sets the attribute key of s to the string of val.
+func (s *span) set(key string, val interface{}) {
+	if s == nil {
+		return
+	}
+	s.attrs[key] = fmt.Sprintf("%v", val)
+}
+
+// finish ends s, failed if err is set, and queues it for export.
+func (s *span) finish(err error) {
+	if s == nil {
+		return
+	}
+	s.end, s.err = time.Now(), err
+	t := s.tracer
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if len(t.pending) >= maxPendingSpans {
+		logV(2).Infof("Dropping span %v, too many spans waiting for an export", s.name)
+		return
+	}
+	t.pending = append(t.pending, s)
+}
+
+// otlpAttributes encodes attrs as otlp key values.
+func otlpAttributes(attrs map[string]string) []map[string]interface{} {
+	encoded := []map[string]interface{}{}
+	for key, val := range attrs {
+		encoded = append(encoded, map[string]interface{}{
+			"key":   key,
+			"value": map[string]string{"stringValue": val},
+		})
+	}
+	return encoded
+}
+
+// otlpRequest returns the body of the otlp export request of spans.
+func (t *tracer) otlpRequest(spans []*span) ([]byte, error) {
+	encoded := []map[string]interface{}{}
+	for _, s := range spans {
+		status := map[string]interface{}{"code": 1}
+		if s.err != nil {
+			status = map[string]interface{}{"code": 2, "message": s.err.Error()}
+		}
+		encoded = append(encoded, map[string]interface{}{
+			"traceId":           s.traceID,
+			"spanId":            s.id,
+			"parentSpanId":      s.parent,
+			"name":              s.name,
+			"kind":              1,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.attrs),
+			"status":            status,
+		})
+	}
+	return json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": otlpAttributes(t.resource)},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": traceScope},
+				"spans": encoded,
+			}},
+		}},
+	})
+}
+
+// flush exports the finished spans. Spans failing to export are dropped.
+func (t *tracer) flush() {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	spans := t.pending
+	t.pending = nil
+	t.lock.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+	if err := t.export(spans); err != nil {
+		logWarning("Unable to export spans", "spans", len(spans), "error", err)
+	}
+}
+
+func (t *tracer) export(spans []*span) error {
+	body, err := t.otlpRequest(spans)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, val := range t.headers {
+		req.Header.Set(key, val)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%v responded %v", t.endpoint, resp.Status)
+	}
+	return nil
+}
+
+// run exports finished spans every traceExportInterval.
+func (t *tracer) run() {
+	for range time.Tick(traceExportInterval) {
+		t.flush()
+	}
+}
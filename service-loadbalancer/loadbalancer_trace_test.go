@@ -0,0 +1,144 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewTracerFromEnv(t *testing.T) {
+	for _, tc := range []struct {
+		env      map[string]string
+		endpoint string
+		err      bool
+	}{
+		{env: map[string]string{}},
+		{env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318", "OTEL_TRACES_EXPORTER": "none"}},
+		{env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318/"}, endpoint: "http://collector:4318/v1/traces"},
+		{
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT":        "http://collector:4318",
+				"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "http://traces:4318/custom",
+			},
+			endpoint: "http://traces:4318/custom",
+		},
+		{env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318", "OTEL_EXPORTER_OTLP_PROTOCOL": "grpc"}, err: true},
+		{env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318", "OTEL_EXPORTER_OTLP_HEADERS": "invalid"}, err: true},
+		{env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318", "OTEL_EXPORTER_OTLP_TIMEOUT": "soon"}, err: true},
+	} {
+		tr, err := newTracerFromEnv(func(key string) string { return tc.env[key] })
+		if tc.err {
+			if err == nil {
+				t.Errorf("Expected an error for %v", tc.env)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error for %v: %v", tc.env, err)
+		}
+		if tc.endpoint == "" {
+			if tr != nil {
+				t.Errorf("Expected no tracer for %v, got %+v", tc.env, tr)
+			}
+			continue
+		}
+		if tr == nil || tr.endpoint != tc.endpoint {
+			t.Errorf("Expected endpoint %v for %v, got %+v", tc.endpoint, tc.env, tr)
+		}
+	}
+
+	tr, err := newTracerFromEnv(func(key string) string {
+		return map[string]string{
+			"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318",
+			"OTEL_EXPORTER_OTLP_HEADERS":  "authorization=Bearer%20token",
+			"OTEL_RESOURCE_ATTRIBUTES":    "service.name=lb,k8s.cluster.name=prod",
+		}[key]
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if tr.headers["authorization"] != "Bearer token" || tr.resource["service.name"] != "lb" || tr.resource["k8s.cluster.name"] != "prod" {
+		t.Fatalf("Unexpected headers %v or resource %v", tr.headers, tr.resource)
+	}
+}
+
+func TestTracerExport(t *testing.T) {
+	var received struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID      string `json:"traceId"`
+					SpanID       string `json:"spanId"`
+					ParentSpanID string `json:"parentSpanId"`
+					Name         string `json:"name"`
+					Status       struct {
+						Code    int    `json:"code"`
+						Message string `json:"message"`
+					} `json:"status"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("Unexpected export request: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	tr, err := newTracerFromEnv(func(key string) string {
+		return map[string]string{
+			"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": server.URL,
+			"OTEL_EXPORTER_OTLP_HEADERS":         "Authorization=secret",
+		}[key]
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	root := tr.start(nil, "sync")
+	root.set("key", "default/svc-1")
+	root.child("render").finish(nil)
+	root.child("validate").finish(errors.New("invalid config"))
+	root.finish(nil)
+	tr.flush()
+
+	if authorization != "secret" || len(received.ResourceSpans) != 1 || len(received.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("Unexpected export request %+v with authorization %q", received, authorization)
+	}
+	spans := received.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 3 || spans[2].Name != "sync" || spans[2].ParentSpanID != "" || len(spans[2].TraceID) != 32 {
+		t.Fatalf("Unexpected spans %+v", spans)
+	}
+	for _, s := range spans[:2] {
+		if s.TraceID != spans[2].TraceID || s.ParentSpanID != spans[2].SpanID {
+			t.Fatalf("Expected %v to be a child of the sync span, got %+v", s.Name, spans)
+		}
+	}
+	if spans[1].Status.Code != 2 || spans[1].Status.Message != "invalid config" || spans[0].Status.Code != 1 {
+		t.Fatalf("Unexpected span statuses %+v", spans)
+	}
+
+	var none *tracer
+	none.start(nil, "sync").child("render").finish(nil)
+	none.flush()
+}
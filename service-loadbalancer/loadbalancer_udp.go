@@ -0,0 +1,117 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// getUDPServices returns the udp ports of services annotated with
+// serviceloadbalancer/lb.udp. They are served by the companion udp proxy,
+// on the service port.
+func (lbc *loadBalancerController) getUDPServices() (udpSvc []service) {
+	services, _ := lbc.svcLister.List()
+	for _, s := range services.Items {
+		if !lbc.selected(&s) {
+			continue
+		}
+		val, ok := serviceAnnotations(s.ObjectMeta.Annotations).getUDP()
+		if !ok {
+			continue
+		}
+		if b, err := strconv.ParseBool(val); err != nil || !b {
+			continue
+		}
+		if lbc.targetService != "" && lbc.targetService != s.Name {
+			continue
+		}
+		for _, servicePort := range s.Spec.Ports {
+			if servicePort.Protocol != api.ProtocolUDP {
+				continue
+			}
+			var ep []string
+			if lbc.forwardServices {
+				ep = []string{hostPort(s.Spec.ClusterIP, servicePort.Port)}
+			} else {
+				ep = lbc.getEndpoints(&s, &servicePort)
+			}
+			if len(ep) == 0 {
+				logInfof("No endpoints found for udp service %v, port %+v", s.Name, servicePort)
+				continue
+			}
+			udpSvc = append(udpSvc, service{
+				Name:         getServiceNameForLBRule(&s, servicePort.Port),
+				Ep:           ep,
+				BackendPort:  getTargetPort(&servicePort),
+				FrontendPort: servicePort.Port,
+			})
+		}
+	}
+	sort.Sort(serviceByName(udpSvc))
+	return
+}
+
+// writeUDP writes the configuration of the udp proxy, to stdout if
+// dryRun == true.
+func (cfg *loadBalancerConfig) writeUDP(services []service, dryRun bool) error {
+	out, err := executeTemplate(cfg.UDPTemplate, map[string]interface{}{"services": services})
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		_, err = os.Stdout.Write(out)
+		return err
+	}
+	return ioutil.WriteFile(cfg.UDPConfig, out, 0644)
+}
+
+// reloadUDP reloads the udp proxy using the udpReloadCmd of the json manifest.
+func (cfg *loadBalancerConfig) reloadUDP() error {
+	output, err := exec.Command("sh", "-c", cfg.UDPReloadCmd).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error reloading udp proxy -- %v: %v", string(output), err)
+	}
+	logInfof("udp proxy -- %v", string(output))
+	return nil
+}
+
+// syncUDP brings the udp proxy in line with the udp services, reloading it
+// only when they changed.
+func (lbc *loadBalancerController) syncUDP(dryRun bool) error {
+	udpSvc := lbc.getUDPServices()
+	if err := lbc.cfg.writeUDP(udpSvc, dryRun); err != nil {
+		return err
+	}
+	if dryRun {
+		return nil
+	}
+	if current := fmt.Sprintf("%v", udpSvc); current != lbc.udpRunning {
+		logInfof("UDP service list needs reload")
+		if err := lbc.cfg.reloadUDP(); err != nil {
+			return err
+		}
+		lbc.udpRunning = current
+	}
+	return nil
+}
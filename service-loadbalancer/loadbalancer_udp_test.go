@@ -0,0 +1,122 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/util/intstr"
+)
+
+func TestGetUDPServices(t *testing.T) {
+	endpointAddresses := []api.EndpointAddress{
+		{IP: "1.2.3.4"},
+		{IP: "5.6.7.8"},
+	}
+	endpointPorts := []api.EndpointPort{
+		{Port: 53, Protocol: api.ProtocolUDP, Name: "dns"},
+		{Port: 53, Protocol: api.ProtocolTCP, Name: "dns-tcp"},
+	}
+	servicePorts := []api.ServicePort{
+		{Port: 53, Protocol: api.ProtocolUDP, TargetPort: intstr.FromString("dns")},
+		{Port: 53, Protocol: api.ProtocolTCP, TargetPort: intstr.FromString("dns-tcp")},
+	}
+
+	dns := getService(servicePorts)
+	dns.ObjectMeta.Name = "dns"
+	dns.ObjectMeta.Annotations = map[string]string{lbUDP: "true"}
+	other := getService(servicePorts)
+	other.ObjectMeta.Name = "other"
+	flb := newFakeLoadBalancerController([]*api.Endpoints{
+		getEndpoints(dns, endpointAddresses, endpointPorts),
+		getEndpoints(other, endpointAddresses, endpointPorts),
+	}, []*api.Service{dns, other})
+
+	udp := flb.getUDPServices()
+	if len(udp) != 1 || udp[0].Name != "dns:53" || udp[0].FrontendPort != 53 {
+		t.Fatalf("Expected only the udp port of the annotated service, got %+v", udp)
+	}
+	if strings.Join(udp[0].Ep, ",") != "1.2.3.4:53,5.6.7.8:53" {
+		t.Fatalf("Unexpected udp endpoints %+v", udp[0].Ep)
+	}
+
+	flb.cfg = &loadBalancerConfig{}
+	flb.cfg.UDPTemplate, _ = filepath.Abs("udp_template.cfg")
+	f, err := ioutil.TempFile("", "udp")
+	if err != nil {
+		t.Fatalf("Unexpected error creating temp file: %v", err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	flb.cfg.UDPConfig = f.Name()
+
+	if err := flb.cfg.writeUDP(udp, false); err != nil {
+		t.Fatalf("Unexpected error writing the udp config: %v", err)
+	}
+	cfg, _ := ioutil.ReadFile(f.Name())
+	for _, expected := range []string{"server 1.2.3.4:53;", "server 5.6.7.8:53;", "listen 53 udp;", "proxy_pass udp_0;"} {
+		if !strings.Contains(string(cfg), expected) {
+			t.Fatalf("Expected %q in the udp config:\n%s", expected, cfg)
+		}
+	}
+}
+
+func TestGetUDPServicesFiltered(t *testing.T) {
+	servicePorts := []api.ServicePort{{Port: 53, Protocol: api.ProtocolUDP, TargetPort: intstr.FromInt(53)}}
+	dns := getService(servicePorts)
+	dns.ObjectMeta.Annotations = map[string]string{lbUDP: "true"}
+	flb := newFakeLoadBalancerController([]*api.Endpoints{
+		getEndpoints(dns, []api.EndpointAddress{{IP: "1.2.3.4"}}, []api.EndpointPort{{Port: 53, Protocol: api.ProtocolUDP}}),
+	}, []*api.Service{dns})
+	if udp := flb.getUDPServices(); len(udp) != 1 {
+		t.Fatalf("Expected the udp service, got %+v", udp)
+	}
+
+	flb.filter, _ = newServiceFilter("team-b", "", "")
+	if udp := flb.getUDPServices(); len(udp) != 0 {
+		t.Errorf("Expected the udp services of other namespaces to be left out, got %+v", udp)
+	}
+}
+
+func TestGetUDPServicesClassAndExclude(t *testing.T) {
+	servicePorts := []api.ServicePort{{Port: 53, Protocol: api.ProtocolUDP, TargetPort: intstr.FromInt(53)}}
+	dns := getService(servicePorts)
+	dns.ObjectMeta.Annotations = map[string]string{lbUDP: "true", lbClass: "internal"}
+	flb := newFakeLoadBalancerController([]*api.Endpoints{
+		getEndpoints(dns, []api.EndpointAddress{{IP: "1.2.3.4"}}, []api.EndpointPort{{Port: 53, Protocol: api.ProtocolUDP}}),
+	}, []*api.Service{dns})
+
+	flb.filter, _ = newServiceFilter("", "", "")
+	if udp := flb.getUDPServices(); len(udp) != 0 {
+		t.Errorf("Expected the udp services of another class to be left out, got %+v", udp)
+	}
+	flb.filter, _ = newServiceFilter("", "", "internal")
+	if udp := flb.getUDPServices(); len(udp) != 1 {
+		t.Errorf("Expected the udp services of the class of the controller, got %+v", udp)
+	}
+
+	dns.ObjectMeta.Annotations[lbExclude] = "true"
+	flb.filter = nil
+	if udp := flb.getUDPServices(); len(udp) != 0 {
+		t.Errorf("Expected excluded udp services to be left out, got %+v", udp)
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	// maxWeight is the highest weight haproxy accepts for a server.
+	maxWeight = 256
+
+	// defaultWeight is the weight of servers without an explicit one.
+	defaultWeight = "1"
+)
+
+// getPodWeight returns the weight of pod from its serviceloadbalancer/lb.weight
+// annotation, or an empty string if it has none or it isn't valid.
+func getPodWeight(pod *api.Pod) string {
+	val, ok := serviceAnnotations(pod.ObjectMeta.Annotations).getWeight()
+	if !ok {
+		return ""
+	}
+	w, err := strconv.Atoi(val)
+	if err != nil || w < 0 || w > maxWeight {
+		logWarningf("Ignoring invalid %v %q of pod %v/%v", lbWeight, val, pod.Namespace, pod.Name)
+		return ""
+	}
+	return strconv.Itoa(w)
+}
+
+// getWeights returns the weights of the pods behind the endpoints of s, by
+// pod ip. Pods without a weight are left out.
+func (lbc *loadBalancerController) getWeights(s *api.Service) map[string]string {
+	ep, err := lbc.epLister.GetServiceEndpoints(s)
+	if err != nil {
+		return nil
+	}
+	weights := map[string]string{}
+	for _, ss := range ep.Subsets {
+		for _, epAddress := range ss.Addresses {
+			ref := epAddress.TargetRef
+			if ref == nil || ref.Kind != "Pod" {
+				continue
+			}
+			obj, exists, err := lbc.podStore.GetByKey(fmt.Sprintf("%v/%v", ref.Namespace, ref.Name))
+			if err != nil || !exists {
+				continue
+			}
+			if w := getPodWeight(obj.(*api.Pod)); w != "" {
+				weights[epAddress.IP] = w
+			}
+		}
+	}
+	return weights
+}
+
+// runtimeWeight is the weight haproxy runs srv with, draining servers are
+// rendered with a weight of 0.
+func (srv backendServer) runtimeWeight() string {
+	switch {
+	case srv.Draining:
+		return "0"
+	case srv.Weight == "":
+		return defaultWeight
+	}
+	return srv.Weight
+}
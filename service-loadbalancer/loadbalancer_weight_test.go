@@ -0,0 +1,86 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/util/intstr"
+)
+
+func getPod(name, weight string) *api.Pod {
+	return &api.Pod{
+		ObjectMeta: api.ObjectMeta{
+			Name:        name,
+			Namespace:   api.NamespaceDefault,
+			Annotations: map[string]string{lbWeight: weight},
+		},
+	}
+}
+
+func TestPodWeights(t *testing.T) {
+	endpointAddresses := []api.EndpointAddress{
+		{IP: "1.2.3.4", TargetRef: &api.ObjectReference{Kind: "Pod", Namespace: api.NamespaceDefault, Name: "canary"}},
+		{IP: "5.6.7.8", TargetRef: &api.ObjectReference{Kind: "Pod", Namespace: api.NamespaceDefault, Name: "broken"}},
+		{IP: "9.9.9.9"},
+	}
+	endpointPorts := []api.EndpointPort{{Port: 80}}
+	svc := getService([]api.ServicePort{{Port: 80, TargetPort: intstr.FromInt(80)}})
+	flb := newFakeLoadBalancerController([]*api.Endpoints{getEndpoints(svc, endpointAddresses, endpointPorts)}, []*api.Service{svc})
+	flb.cfg = &loadBalancerConfig{}
+	flb.podStore.Add(getPod("canary", "30"))
+	flb.podStore.Add(getPod("broken", "1000"))
+
+	httpSvc, _, _ := flb.getServices()
+	expected := []backendServer{
+		{Name: "1.2.3.4:80", Addr: "1.2.3.4:80", Weight: "30"},
+		{Name: "5.6.7.8:80", Addr: "5.6.7.8:80"},
+		{Name: "9.9.9.9:80", Addr: "9.9.9.9:80"},
+	}
+	if len(httpSvc) != 1 || !reflect.DeepEqual(httpSvc[0].Servers, expected) {
+		t.Fatalf("Unexpected servers %+v, expected %+v", httpSvc, expected)
+	}
+}
+
+func TestUpdateServerWeights(t *testing.T) {
+	fake, path := newFakeHAProxySocket(t)
+	defer fake.close(path)
+
+	running := []service{{Name: "svc", Servers: []backendServer{
+		{Name: "s0", Addr: "1.1.1.1:80"},
+		{Name: "s1", Addr: "2.2.2.2:80", Weight: "10"},
+	}}}
+	svcs := []service{{Name: "svc", Servers: []backendServer{
+		{Name: "s0", Addr: "1.1.1.1:80", Weight: "50"},
+		{Name: "s1", Addr: placeholderAddr, Disabled: true},
+	}}}
+
+	lbc := &loadBalancerController{socket: &haproxySocket{path: path}}
+	if err := lbc.updateServers(running, svcs); err != nil {
+		t.Fatalf("Unexpected error updating servers: %v", err)
+	}
+	expected := []string{
+		"set server svc/s0 weight 50",
+		"set server svc/s1 state maint",
+		"set server svc/s1 weight 1",
+	}
+	if !reflect.DeepEqual(fake.commands, expected) {
+		t.Fatalf("Unexpected commands %v, expected %v", fake.commands, expected)
+	}
+}
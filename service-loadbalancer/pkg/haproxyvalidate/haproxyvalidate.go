@@ -0,0 +1,187 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package haproxyvalidate models the routing of an haproxy config, its
+// frontends, ACLs, backends and servers, and validates it. It doesn't render
+// configs, only the names and references haproxy would reject.
+package haproxyvalidate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Config is the routing of an haproxy config.
+type Config struct {
+	Frontends []Frontend
+	Backends  []Backend
+}
+
+// Frontend accepts connections on its binds and routes them to backends.
+type Frontend struct {
+	Name string
+	// Mode is http or tcp, empty inherits the mode of the defaults.
+	Mode string
+	// Binds are the addresses and their options, eg: "*:443 ssl crt /ssl".
+	Binds []string
+
+	ACLs        []ACL
+	UseBackends []UseBackend
+	// DefaultBackend gets the requests no UseBackends route.
+	DefaultBackend string
+}
+
+// ACL names a criterion, eg: {"host_acl_foo", "hdr(host) -i foo.com"}. ACLs
+// declared several times with the same name match any of their criteria.
+type ACL struct {
+	Name      string
+	Criterion string
+}
+
+// UseBackend routes the requests matching Condition to Backend, all of them
+// if Condition is empty. Conditions combine the ACLs of their frontend with
+// "or", "!" and anonymous ACLs in braces, eg: "url_acl_foo or { src 10.0.0.0/8 }".
+type UseBackend struct {
+	Backend   string
+	Condition string
+}
+
+// Backend balances requests across its servers.
+type Backend struct {
+	Name string
+	// Mode is http or tcp, empty inherits the mode of the defaults.
+	Mode    string
+	Servers []Server
+}
+
+// Server is a server of a backend.
+type Server struct {
+	Name    string
+	Address string
+}
+
+// validName reports whether name only has the characters haproxy allows in
+// the names of proxies, servers and ACLs.
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func validMode(mode string) bool {
+	return mode == "" || mode == "http" || mode == "tcp"
+}
+
+// conditionACLs returns the names of the ACLs a condition refers to,
+// skipping operators and anonymous ACLs.
+func conditionACLs(condition string) []string {
+	var names []string
+	depth := 0
+	for _, word := range strings.Fields(condition) {
+		switch {
+		case word == "{":
+			depth++
+		case word == "}":
+			depth--
+		case depth > 0, word == "or", word == "||", word == "!":
+		default:
+			names = append(names, strings.TrimLeft(word, "!"))
+		}
+	}
+	return names
+}
+
+// Validate checks the names of c, that frontends and backends are unique,
+// that frontends route to backends of c with the ACLs they declare, and
+// that the servers of a backend are unique.
+func Validate(c Config) error {
+	backends := map[string]bool{}
+	for _, b := range c.Backends {
+		if !validName(b.Name) {
+			return fmt.Errorf("invalid backend name %q", b.Name)
+		}
+		if backends[b.Name] {
+			return fmt.Errorf("duplicate backend %v", b.Name)
+		}
+		backends[b.Name] = true
+		if !validMode(b.Mode) {
+			return fmt.Errorf("backend %v: invalid mode %q", b.Name, b.Mode)
+		}
+		servers := map[string]bool{}
+		for _, s := range b.Servers {
+			if !validName(s.Name) {
+				return fmt.Errorf("backend %v: invalid server name %q", b.Name, s.Name)
+			}
+			if servers[s.Name] {
+				return fmt.Errorf("backend %v: duplicate server %v", b.Name, s.Name)
+			}
+			servers[s.Name] = true
+			if s.Address == "" {
+				return fmt.Errorf("backend %v: server %v has no address", b.Name, s.Name)
+			}
+		}
+	}
+
+	frontends := map[string]bool{}
+	for _, f := range c.Frontends {
+		if !validName(f.Name) {
+			return fmt.Errorf("invalid frontend name %q", f.Name)
+		}
+		if frontends[f.Name] {
+			return fmt.Errorf("duplicate frontend %v", f.Name)
+		}
+		frontends[f.Name] = true
+		if !validMode(f.Mode) {
+			return fmt.Errorf("frontend %v: invalid mode %q", f.Name, f.Mode)
+		}
+		if len(f.Binds) == 0 {
+			return fmt.Errorf("frontend %v: no binds", f.Name)
+		}
+		acls := map[string]bool{}
+		for _, acl := range f.ACLs {
+			if !validName(acl.Name) {
+				return fmt.Errorf("frontend %v: invalid acl name %q", f.Name, acl.Name)
+			}
+			if acl.Criterion == "" {
+				return fmt.Errorf("frontend %v: acl %v has no criterion", f.Name, acl.Name)
+			}
+			acls[acl.Name] = true
+		}
+		for _, use := range f.UseBackends {
+			if !backends[use.Backend] {
+				return fmt.Errorf("frontend %v: use_backend of unknown backend %v", f.Name, use.Backend)
+			}
+			for _, name := range conditionACLs(use.Condition) {
+				if !acls[name] {
+					return fmt.Errorf("frontend %v: use_backend %v of unknown acl %v", f.Name, use.Backend, name)
+				}
+			}
+		}
+		if f.DefaultBackend != "" && !backends[f.DefaultBackend] {
+			return fmt.Errorf("frontend %v: default_backend of unknown backend %v", f.Name, f.DefaultBackend)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package haproxyvalidate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConditionACLs(t *testing.T) {
+	testCases := map[string][]string{
+		"":                                     nil,
+		"url_acl_foo":                          {"url_acl_foo"},
+		"url_acl_foo or host_acl_foo":          {"url_acl_foo", "host_acl_foo"},
+		"path_acl_foo !internal":               {"path_acl_foo", "internal"},
+		"! internal || { src 10.0.0.0/8 } api": {"internal", "api"},
+		"{ path_beg /.well-known/acme-challenge/ }": nil,
+	}
+	for condition, expected := range testCases {
+		if names := conditionACLs(condition); !reflect.DeepEqual(names, expected) {
+			t.Errorf("Expected the acls of %q to be %v, got %v", condition, expected, names)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate(testConfig()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	testCases := map[string]struct {
+		change   func(c *Config)
+		expected string
+	}{
+		"backend name": {
+			func(c *Config) { c.Backends[1].Name = "foo bar" },
+			"invalid backend name",
+		},
+		"duplicate backend": {
+			func(c *Config) { c.Backends[2].Name = "foo" },
+			"duplicate backend foo",
+		},
+		"duplicate server": {
+			func(c *Config) { c.Backends[1].Servers[1].Name = "server1" },
+			"duplicate server server1",
+		},
+		"server address": {
+			func(c *Config) { c.Backends[1].Servers[0].Address = "" },
+			"server server1 has no address",
+		},
+		"mode": {
+			func(c *Config) { c.Frontends[1].Mode = "udp" },
+			"invalid mode",
+		},
+		"duplicate frontend": {
+			func(c *Config) { c.Frontends[1].Name = "httpfrontend" },
+			"duplicate frontend httpfrontend",
+		},
+		"binds": {
+			func(c *Config) { c.Frontends[1].Binds = nil },
+			"no binds",
+		},
+		"acl criterion": {
+			func(c *Config) { c.Frontends[0].ACLs[0].Criterion = "" },
+			"acl url_acl_foo has no criterion",
+		},
+		"unknown acl": {
+			func(c *Config) { c.Frontends[0].UseBackends[0].Condition = "url_acl_bar" },
+			"unknown acl url_acl_bar",
+		},
+		"unknown backend": {
+			func(c *Config) { c.Frontends[0].UseBackends[0].Backend = "bar" },
+			"use_backend of unknown backend bar",
+		},
+		"unknown default backend": {
+			func(c *Config) { c.Frontends[1].DefaultBackend = "postgres" },
+			"default_backend of unknown backend postgres",
+		},
+	}
+	for name, tc := range testCases {
+		c := testConfig()
+		tc.change(&c)
+		err := Validate(c)
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("%v: expected an error containing %q, got %v", name, tc.expected, err)
+		}
+	}
+}
+
+func testConfig() Config {
+	return Config{
+		Frontends: []Frontend{
+			{
+				Name:  "httpfrontend",
+				Binds: []string{"*:80"},
+				ACLs: []ACL{
+					{Name: "url_acl_foo", Criterion: "path_beg /foo"},
+					{Name: "host_acl_foo", Criterion: "hdr(host) -i foo.com"},
+				},
+				UseBackends: []UseBackend{
+					{Backend: "foo", Condition: "url_acl_foo or host_acl_foo"},
+				},
+				DefaultBackend: "default-backend",
+			},
+			{
+				Name:           "mysql",
+				Mode:           "tcp",
+				Binds:          []string{"*:3306"},
+				DefaultBackend: "mysql",
+			},
+		},
+		Backends: []Backend{
+			{Name: "default-backend", Servers: []Server{{Name: "localhost", Address: "127.0.0.1:8081"}}},
+			{
+				Name: "foo",
+				Servers: []Server{
+					{Name: "server1", Address: "10.0.0.1:8080"},
+					{Name: "server2", Address: "10.0.0.2:8080"},
+				},
+			},
+			{Name: "mysql", Mode: "tcp", Servers: []Server{{Name: "server1", Address: "10.0.1.1:3306"}}},
+		},
+	}
+}
@@ -19,41 +19,95 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
-	"reflect"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
-	"text/template"
+	"sync"
 	"time"
 
-	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
 	flag "github.com/spf13/pflag"
+	"golang.org/x/net/context"
+	"k8s.io/contrib/service-loadbalancer/backoff"
 	"k8s.io/kubernetes/pkg/api"
 	"k8s.io/kubernetes/pkg/client/cache"
 	"k8s.io/kubernetes/pkg/client/unversioned"
 	"k8s.io/kubernetes/pkg/controller/framework"
 	"k8s.io/kubernetes/pkg/fields"
 	kubectl_util "k8s.io/kubernetes/pkg/kubectl/cmd/util"
+	"k8s.io/kubernetes/pkg/labels"
 	"k8s.io/kubernetes/pkg/util"
-	"k8s.io/kubernetes/pkg/util/intstr"
+	"k8s.io/kubernetes/pkg/util/sets"
 	"k8s.io/kubernetes/pkg/util/wait"
 	"k8s.io/kubernetes/pkg/util/workqueue"
 )
 
 const (
 	reloadQPS                = 10.0
-	resyncPeriod             = 10 * time.Second
 	lbApiPort                = 8081
 	lbAlgorithmKey           = "serviceloadbalancer/lb.algorithm"
 	lbHostKey                = "serviceloadbalancer/lb.host"
 	lbSslTerm                = "serviceloadbalancer/lb.sslTerm"
+	lbSslSecret              = "serviceloadbalancer/lb.sslSecret"
+	lbUDP                    = "serviceloadbalancer/lb.udp"
+	lbSendProxy              = "serviceloadbalancer/lb.sendProxy"
+	lbAcceptProxy            = "serviceloadbalancer/lb.acceptProxy"
+	lbIPFamily               = "serviceloadbalancer/lb.ipFamily"
+	lbAccessLog              = "serviceloadbalancer/lb.accessLog"
+	lbRequestHeaders         = "serviceloadbalancer/lb.requestHeaders"
+	lbPathPrefix             = "serviceloadbalancer/lb.pathPrefix"
+	lbMaxConn                = "serviceloadbalancer/lb.maxconn"
+	lbMaxQueue               = "serviceloadbalancer/lb.maxqueue"
+	lbTimeoutConnect         = "serviceloadbalancer/lb.timeoutConnect"
+	lbTimeoutServer          = "serviceloadbalancer/lb.timeoutServer"
+	lbTimeoutQueue           = "serviceloadbalancer/lb.timeoutQueue"
+	lbTimeoutClient          = "serviceloadbalancer/lb.timeoutClient"
+	lbErrorLimit             = "serviceloadbalancer/lb.errorLimit"
+	lbErrorCooldown          = "serviceloadbalancer/lb.errorCooldown"
+	lbTCPLog                 = "serviceloadbalancer/lb.tcpLog"
+	lbBackendTLS             = "serviceloadbalancer/lb.backendTLS"
+	lbBackendCASecret        = "serviceloadbalancer/lb.backendCASecret"
+	lbBackendClientSecret    = "serviceloadbalancer/lb.backendClientSecret"
+	lbBackendVerifyHost      = "serviceloadbalancer/lb.backendVerifyHost"
+	lbACME                   = "serviceloadbalancer/lb.acme"
+	lbClass                  = "serviceloadbalancer/class"
+	lbExclude                = "serviceloadbalancer/lb.exclude"
+	lbErrorPages             = "serviceloadbalancer/lb.errorPages"
+	lbTCPPorts               = "serviceloadbalancer/lb.tcpPorts"
+	lbMaxBodySize            = "serviceloadbalancer/lb.maxBodySize"
+	lbCompression            = "serviceloadbalancer/lb.compression"
+	lbCompressionTypes       = "serviceloadbalancer/lb.compressionTypes"
+	lbResponseHeaders        = "serviceloadbalancer/lb.responseHeaders"
 	lbAclMatch               = "serviceloadbalancer/lb.aclMatch"
 	lbCookieStickySessionKey = "serviceloadbalancer/lb.cookie-sticky-session"
+	lbAffinity               = "serviceloadbalancer/lb.affinity"
+	lbCookieName             = "serviceloadbalancer/lb.cookieName"
+	lbCookieMaxAge           = "serviceloadbalancer/lb.cookieMaxAge"
+	lbWeight                 = "serviceloadbalancer/lb.weight"
+	lbCheckPath              = "serviceloadbalancer/lb.checkPath"
+	lbCheckStatus            = "serviceloadbalancer/lb.checkStatus"
+	lbCheckPort              = "serviceloadbalancer/lb.checkPort"
+	lbCheckInterval          = "serviceloadbalancer/lb.checkInterval"
+	lbCheckRise              = "serviceloadbalancer/lb.checkRise"
+	lbCheckFall              = "serviceloadbalancer/lb.checkFall"
+	lbRateLimit              = "serviceloadbalancer/lb.rateLimit"
+	lbRateLimitPeriod        = "serviceloadbalancer/lb.rateLimitPeriod"
+	lbRateLimitStatus        = "serviceloadbalancer/lb.rateLimitStatus"
+	lbWhitelistSourceRange   = "serviceloadbalancer/whitelist-source-range"
+	lbDenylistSourceRange    = "serviceloadbalancer/denylist-source-range"
+	lbAuthSecret             = "serviceloadbalancer/lb.authSecret"
+	lbSslRedirect            = "serviceloadbalancer/lb.sslRedirect"
+	lbSslRedirectCode        = "serviceloadbalancer/lb.sslRedirectCode"
+	lbBackendProtocol        = "serviceloadbalancer/lb.backendProtocol"
+	lbCanary                 = "serviceloadbalancer/lb.canary"
+	lbCanaryWeight           = "serviceloadbalancer/lb.canaryWeight"
+	lbStatus                 = "serviceloadbalancer/lb.status"
 	defaultErrorPage         = "file:///etc/haproxy/errors/404.http"
 )
 
@@ -80,7 +134,16 @@ var (
                 load balancer to behave in the kubernetes cluster.`)
 
 	dry = flags.Bool("dry", false, `if set, a single dry run of configuration
-                parsing is executed. Results written to stdout.`)
+                parsing is executed. The config is validated with the validateCmd of the json
+                config, and the controller exits with an error if it is invalid.`)
+
+	fromFile = flags.String("from-file", "", `if set, path of a yaml or json fixture of services,
+                endpoints, secrets, configmaps and pods, eg: the output of kubectl get -o yaml, the
+                controller loadbalances instead of the objects of a cluster, without connecting to
+                it. The fixture is loaded again when it changes. With --dry, renders its config.`)
+
+	dryPrintConfig = flags.Bool("dry-print-config", true, `if set, dry runs write the rendered
+                config to stdout.`)
 
 	cluster = flags.Bool("use-kubernetes-cluster-service", true, `If true, use the built in kubernetes
                 cluster for creating the client`)
@@ -99,7 +162,8 @@ var (
 
 	tcpServices = flags.String("tcp-services", "", `Comma separated list of tcp/https
                 serviceName:servicePort pairings. This assumes you've opened up the right
-                hostPorts for each service that serves ingress traffic.`)
+                hostPorts for each service that serves ingress traffic. Services publish more ports
+                with the serviceloadbalancer/lb.tcpPorts annotation.`)
 
 	targetService = flags.String(
 		"target-service", "", `Restrict loadbalancing to a single target service.`)
@@ -127,6 +191,15 @@ var (
 	startSyslog = flags.Bool("syslog", false, `if set, it will start a syslog server
                 that will forward haproxy logs to stdout.`)
 
+	logTarget = flags.String("log-target", "", `syslog server receiving the haproxy logs, eg:
+                10.0.0.5:514 for udp or a unix socket path. Defaults to the syslog server of the
+                controller with --syslog.`)
+
+	logFacility = flags.String("log-facility", "local0", `syslog facility of the haproxy logs.`)
+
+	logLevel = flags.String("log-level", "info", `most verbose level of the haproxy logs, one of
+                emerg, alert, crit, err, warning, notice, info or debug.`)
+
 	sslCert   = flags.String("ssl-cert", "", `if set, it will load the certificate.`)
 	sslCaCert = flags.String("ssl-ca-cert", "", `if set, it will load the certificate from which
 		to load CA certificates used to verify client's certificate.`)
@@ -141,7 +214,299 @@ var (
 	lbDefAlgorithm = flags.String("balance-algorithm", "roundrobin", `if set, it allows a custom
                 default balance algorithm.`)
 
-	previousServices = ""
+	serverSlotSize = flags.Int("server-slots", 0, `if set, every backend is rendered with a multiple
+                of this many server slots, and endpoint changes that fit in the existing slots are
+                applied through the haproxy runtime socket instead of reloading haproxy.`)
+
+	sslCertDir = flags.String("ssl-cert-dir", "/etc/haproxy/certs", `directory where certificates
+                of services annotated with serviceloadbalancer/lb.sslSecret are written.`)
+
+	acceptProxy = flags.Bool("accept-proxy", false, `if set, all frontends expect connections
+                to start with a PROXY protocol header, eg: behind an AWS NLB or another haproxy.`)
+
+	customTemplate = flags.String("template", "", `if set, path to a custom haproxy config
+                template, eg: mounted from a ConfigMap. It is watched for changes, and the built-in
+                template is used whenever the custom one can't be rendered.`)
+
+	templatePollInterval = flags.Duration("template-poll-interval", 10*time.Second, `how often
+                the custom template is checked for changes.`)
+
+	drainPeriod = flags.Duration("drain-period", 0, `if set together with server-slots, servers
+                of endpoints that went away are drained through the runtime socket and only removed
+                once they have no sessions left, or after this period at the latest.`)
+
+	leaderElect = flags.Bool("leader-elect", false, `if set, replicas elect a leader, the only one
+                writing status annotations, dns records, acme certificates and events. Every
+                replica configures its own loadbalancer either way.`)
+
+	leaderElectName = flags.String("leader-elect-name", "service-loadbalancer", `name of the
+                endpoints object holding the leader lease.`)
+
+	leaderElectNamespace = flags.String("leader-elect-namespace", api.NamespaceDefault, `namespace
+                of the endpoints object holding the leader lease.`)
+
+	leaderElectLeaseDuration = flags.Duration("leader-elect-lease-duration", 15*time.Second, `how
+                long a leader lease is valid without being renewed.`)
+
+	proxy = flags.String("proxy", "haproxy", `the proxy to configure, haproxy or nginx. Its
+                template, config file and reload command come from the json config, eg: nginx.json.`)
+
+	resyncPeriod = flags.Duration("resync-period", 10*time.Minute, `how often services, endpoints,
+                secrets and pods are listed again from the apiserver, besides watching them.`)
+
+	resyncPeriodsByResource = flags.String("resync-periods", "", `comma separated list of resync
+                periods overriding --resync-period by resource, out of services, endpoints, secrets,
+                configmaps, nodes and pods, eg: endpoints=1m,secrets=1h. 0 never resyncs.`)
+
+	apiQPS = flags.Float32("api-qps", 5, `requests per second of the client of the apiserver.`)
+
+	apiBurst = flags.Int("api-burst", 10, `requests the client of the apiserver sends in a burst
+                over --api-qps.`)
+
+	apiWriteQPS = flags.Float32("api-write-qps", 2, `writes per second of the controller, eg: of the
+                status annotations of services and acme secrets, on top of --api-qps so the
+                writes of large deployments stay spread out during rollouts. 0 doesn't limit them.`)
+
+	apiWriteBurst = flags.Int("api-write-burst", 5, `writes sent in a burst over --api-write-qps.`)
+
+	syncDebounce = flags.Duration("sync-debounce", time.Second, `changes are coalesced into a single
+                sync until none happened for this long, eg: during rolling deployments. 0 disables it.`)
+
+	syncMaxDelay = flags.Duration("sync-max-delay", 10*time.Second, `the longest a change waits for
+                its sync while changes keep coming in the debounce window.`)
+
+	settingsFile = flags.String("settings-file", "", `if set, a json object of flags applied at startup
+                and reloaded on SIGHUP or when the file changes, without restarting the controller,
+                eg: {"sync-debounce": "5s", "timeout-server": "2m"}. Only sync-debounce,
+                sync-max-delay, log-level, timeout-connect, timeout-server, timeout-client and v
+                are reloadable.`)
+
+	settingsPollInterval = flags.Duration("settings-poll-interval", 10*time.Second, `how often
+                --settings-file is checked for changes. 0 only reloads it on SIGHUP.`)
+
+	watchNamespaces = flags.String("watch-namespaces", "", `if set, comma separated list of the
+                namespaces whose services are loadbalanced. Takes precedence over --namespace.`)
+
+	serviceSelector = flags.String("service-selector", "", `if set, only services matching this
+                label selector are loadbalanced, eg: team=a.`)
+
+	lbClassName = flags.String("lb-class", "", `if set, only services with this serviceloadbalancer/class
+                annotation are loadbalanced, otherwise only services without it.`)
+
+	sslRedirect = flags.Bool("ssl-redirect", false, `if set, plaintext requests for services terminating
+                ssl are redirected to https, unless their serviceloadbalancer/lb.sslRedirect is false.`)
+
+	sslRedirectCode = flags.Int("ssl-redirect-code", 301, `status of the redirects to https, eg: 308
+                to preserve the method of the request.`)
+
+	sslRedirectExclude = flags.String("ssl-redirect-exclude", "/.well-known/acme-challenge/", `comma
+                separated list of path prefixes never redirected to https.`)
+
+	reloadRetryTimeout = flags.Duration("reload-retry-timeout", 5*time.Second, `failed reloads are retried
+                with a backoff for up to this long before the sync fails. 0 disables retries.`)
+
+	seamlessReload = flags.Bool("seamless-reload", false, `if set, haproxy reloads hand the listening
+                sockets over to the new process through the stats socket, so no connection is refused
+                during a reload. Requires haproxy 1.8 or newer.`)
+
+	publishAddress = flags.String("publish-address", "", `if set, public ip or hostname of the
+                loadbalancer, published with the frontend port of every exposed service in its
+                serviceloadbalancer/lb.status annotation.`)
+
+	dnsProviderName = flags.String("dns-provider", "", `if set, route53 or clouddns, the provider
+                of the zone where the hosts of http services are pointed at --publish-address.`)
+
+	dnsZone = flags.String("dns-zone", "", `id of the route53 hosted zone or name of the cloud dns
+                managed zone of --dns-provider.`)
+
+	dnsDomain = flags.String("dns-domain", "", `domain of --dns-zone, hosts outside of it aren't
+                published.`)
+
+	dnsOwnerID = flags.String("dns-owner-id", "service-loadbalancer", `owner written in the TXT
+                records of the published hosts. Controllers sharing a zone must use different
+                owners, they never change records they don't own.`)
+
+	dnsTTL = flags.Int("dns-ttl", 300, `ttl in seconds of the published records.`)
+
+	dnsProject = flags.String("dns-project", "", `project of the cloud dns managed zone, defaults
+                to the project of the instance.`)
+
+	ipFamily = flags.String("ip-family", "ipv4", `ip family of the addresses frontends bind, ipv4,
+                ipv6, or dual to accept both on a single ipv6 socket. Services override it for
+                their tcp frontend with serviceloadbalancer/lb.ipFamily.`)
+
+	vip = flags.String("vip", "", `if set, virtual ip, eg: 10.0.0.100/24, kept by keepalived on a
+                node where the loadbalancer is healthy. Defaults --publish-address.`)
+
+	vipInterface = flags.String("vip-interface", "eth0", `network interface of the virtual ip.`)
+
+	vipRouterID = flags.Int("vip-router-id", 50, `vrrp router id of the virtual ip, unique among
+                the keepalived instances of the network.`)
+
+	vipPriority = flags.Int("vip-priority", 100, `vrrp priority of the node, the healthy node with
+                the highest priority gets the virtual ip when its current node fails.`)
+
+	vipPeers = flags.String("vip-peers", "", `comma separated list of the ips of the other nodes,
+                if set vrrp adverts are sent to them instead of multicast.`)
+
+	vipPeerSelector = flags.String("vip-peer-selector", "", `if set, label selector of the pods of the
+                loadbalancer in $POD_NAMESPACE, eg: app=servicelb, whose ips are added to the
+                --vip-peers as they come and go, without the ip of this pod in $POD_IP.`)
+
+	vipBGPCommand = flags.String("vip-bgp-command", "", `if set, the gobgp cli of a gobgpd next to
+                the controller, eg: gobgp, announcing the virtual ip as a host route while it is on
+                this node and withdrawing it when keepalived moves it.`)
+
+	vipCheckScript = flags.String("vip-check-script", "/keepalived_check", `script run by keepalived,
+                the virtual ip leaves the node when it fails.`)
+
+	keepalivedTemplate = flags.String("keepalived-template", "keepalived.tmpl", `template of the
+                keepalived config.`)
+
+	accessLog = flags.Bool("access-log", false, `if set, the requests of http services are logged
+                in --access-log-format, unless their serviceloadbalancer/lb.accessLog is false.`)
+
+	accessLogTarget = flags.String("access-log-target", "", `syslog server receiving access logs,
+                eg: 10.0.0.5:514 for udp. Defaults to the syslog server of the controller, forwarding
+                them to stdout, started by --access-log or --syslog.`)
+
+	accessLogFormat = flags.String("access-log-format", defaultAccessLogFormat, `haproxy log-format
+                of access logs, a json object per request by default.`)
+
+	requestID = flags.Bool("request-id", false, `if set, haproxy gives every http request a unique id
+                in --request-id-format, sent to the backends in the X-Request-ID header, replacing the
+                one of the client, and logged as request_id by the default --access-log-format.`)
+
+	requestIDFormat = flags.String("request-id-format", defaultRequestIDFormat, `haproxy log-format of
+                the ids of --request-id.`)
+
+	topologyAware = flags.Bool("topology-aware", false, `if set, servers in another zone than
+                the loadbalancer are backups, only used when all the servers of its zone are down.
+                Zones are the failure-domain.beta.kubernetes.io/zone labels of the nodes.`)
+
+	zone = flags.String("zone", "", `zone of the loadbalancer for --topology-aware, defaults to the
+                zone of the node named by the NODE_NAME environment variable.`)
+
+	strictLocality = flags.Bool("strict-locality", false, `if set with --topology-aware, servers in
+                other zones are left out instead of being backups.`)
+
+	remoteClusters = flags.StringSlice("remote-clusters", []string{}, `clusters whose endpoints are merged
+                into the backends of the services with the same namespace and name, as
+                name=kubeconfig[#context], eg: west=/etc/clusters/west.yaml#west-admin. Only the
+                services of the cluster of the loadbalancer are loadbalanced.`)
+
+	clusterName = flags.String("cluster-name", "local", `name of the cluster of the loadbalancer in
+                --cluster-weights and --cluster-failover.`)
+
+	clusterWeights = flags.String("cluster-weights", "", `weights of the servers of each cluster,
+                eg: local=2,west=1 sends twice as much traffic to the local cluster. Pods with a
+                weight annotation keep it.`)
+
+	clusterFailover = flags.StringSlice("cluster-failover", []string{}, `clusters in failover order,
+                eg: local,west. Servers of the first cluster with endpoints get the traffic, the
+                others are backups. Clusters joined by + share their place, eg: local+east,west
+                keeps west for when both are down. Clusters not listed come last, without it all
+                clusters are active.`)
+
+	serverMaxConn = flags.Int("server-maxconn", 0, `if set, maximum number of concurrent connections
+                of each server, more wait in the queue of the backend. Services override it with
+                serviceloadbalancer/lb.maxconn.`)
+
+	serverMaxQueue = flags.Int("server-maxqueue", 0, `if set, maximum number of connections waiting
+                for each server, more are sent to other servers. Services override it with
+                serviceloadbalancer/lb.maxqueue.`)
+
+	timeoutConnect = flags.Duration("timeout-connect", 5*time.Second, `default time to wait for a
+                connection to a server. Services override it with serviceloadbalancer/lb.timeoutConnect.`)
+
+	timeoutServer = flags.Duration("timeout-server", 50*time.Second, `default inactivity timeout of
+                servers. Services override it with serviceloadbalancer/lb.timeoutServer.`)
+
+	timeoutClient = flags.Duration("timeout-client", 50*time.Second, `default inactivity timeout of
+                clients. tcp services override it with serviceloadbalancer/lb.timeoutClient.`)
+
+	outlierCheckInterval = flags.Duration("outlier-check-interval", 5*time.Second, `interval of the
+                checks of the servers of services with serviceloadbalancer/lb.errorLimit, reporting
+                the ones marked down.`)
+
+	adminTokenFile = flags.String("admin-token-file", "", `if set, serves the admin api draining
+                servers under /admin/backends, for clients sending the token in this file as a
+                bearer token. Requires --server-slots.`)
+
+	adminOverrides = flags.String("admin-overrides", "", `if set, namespace/name of a ConfigMap
+                the servers drained through the admin api are saved in, created if needed. They
+                are loaded from it at startup, and when it changes if its namespace is watched, so
+                they stay drained across restarts and on every replica.`)
+
+	adminAddress = flags.String("admin-address", "", `if set, eg: :8082, serves the operational
+                endpoints on this address instead, for clients sending the --admin-token-file token
+                or a certificate verified by --admin-client-ca. /healthz and /readyz stay on :8081
+                for the probes.`)
+
+	adminTLSCert = flags.String("admin-tls-cert", "", `certificate of --admin-address, served
+                over tls if set with --admin-tls-key.`)
+
+	adminTLSKey = flags.String("admin-tls-key", "", `key of --admin-tls-cert.`)
+
+	adminClientCA = flags.String("admin-client-ca", "", `if set, authorizes the clients of
+                --admin-address with a certificate verified by the CAs in this file.`)
+
+	adminEndpoints = flags.String("admin-endpoints", "healthz,readyz,metrics,stats,config,backends", `comma
+                separated list of the endpoints served on --admin-address, out of healthz, readyz,
+                metrics, stats, config, backends and pprof.`)
+
+	legacyEndpoints = flags.Bool("legacy-endpoints", false, `watch Endpoints instead of EndpointSlices,
+                for clusters older than 1.21 without the discovery.k8s.io/v1 api.`)
+
+	acmeDirectory = flags.String("acme-directory", "", `if set, the url of the directory of an acme
+                server, eg: https://acme-v02.api.letsencrypt.org/directory, obtaining and renewing the
+                certificates of services with serviceloadbalancer/lb.acme. Requires --acme-account-secret.`)
+
+	acmeEmail = flags.String("acme-email", "", `contact email of the acme account.`)
+
+	acmeAccountSecret = flags.String("acme-account-secret", "", `namespace/name of the secret holding
+                the key of the acme account, generated when missing.`)
+
+	acmeCheckInterval = flags.Duration("acme-check-interval", time.Hour, `interval of the checks of the
+                certificates of services with serviceloadbalancer/lb.acme.`)
+
+	logFormat = flags.String("log-format", "text", `format of the logs of the controller, text or json,
+                one object per line with the time, level, caller and msg of the entry, and fields
+                like service, namespace, backend or reload_duration.`)
+
+	compress = flags.Bool("compression", false, `if set, the responses of http services are compressed
+                with gzip, unless their serviceloadbalancer/lb.compression is false.`)
+
+	compressionTypes = flags.String("compression-types", defaultCompressionTypes, `comma separated mime
+                types of the responses compressed, unless the serviceloadbalancer/lb.compressionTypes
+                of their service overrides them.`)
+
+	compressionMinSize = flags.String("compression-min-size", "", `if set, responses smaller than this
+                size, in bytes or with a k, m or g suffix, aren't compressed. Requires haproxy 3.0.`)
+
+	externalNameResolvers = flags.String("external-name-resolvers", "", `comma separated ip[:port] of the
+                nameservers resolving the servers of ExternalName services at runtime, the nameservers
+                of /etc/resolv.conf by default.`)
+
+	serviceDefaults = flags.String("service-defaults", "", `namespace/name of a ConfigMap in a watched
+                namespace holding the defaults of the annotations of every service, by annotation
+                without the serviceloadbalancer/ prefix, eg: lb.timeoutServer: 2m. Annotations of a
+                service override them.`)
+
+	errorPagesConfigMap = flags.String("error-pages", "", `namespace/name of a ConfigMap holding the
+                pages sent instead of the haproxy error pages, keyed by status code, eg: 503. The
+                serviceloadbalancer/lb.errorPages annotation of a service names another ConfigMap
+                replacing some of them for its backend.`)
+
+	errorPagesDir = flags.String("error-pages-dir", "/etc/haproxy/errors/pages", `directory where the
+                error pages of ConfigMaps are written.`)
+
+	shutdownGracePeriod = flags.Duration("shutdown-grace-period", 25*time.Second, `on SIGTERM, how long
+                the proxy gets to finish its connections after it stopped accepting new ones. Keep it
+                below the terminationGracePeriodSeconds of the pod.`)
+
+	haproxySocketPath = flags.String("haproxy-socket", "/tmp/haproxy", `path to the haproxy stats
+                socket used for runtime updates.`)
 )
 
 // service encapsulates a single backend entry in the load balancer config.
@@ -157,13 +522,20 @@ type service struct {
 
 	// FrontendPort is the port that the loadbalancer listens on for traffic
 	// for this service. For http, it's always :80, for each tcp service it
-	// is the service port of any service matching a name in the tcpServices set.
+	// is the service port of any service matching a name in the tcpServices set,
+	// or the port given by its tcpPorts annotation.
 	FrontendPort int
 
 	// Host if not empty it will add a new haproxy acl to route traffic using the
 	// host header inside the http request. It only applies to http traffic.
+	// It may be a wildcard or a regular expression, see hostKind.
 	Host string
 
+	// HostACL and SNIACL are the haproxy criteria matching Host, by the
+	// host header and by the sni of https connections.
+	HostACL string
+	SNIACL  string
+
 	// if true, terminate ssl using the loadbalancers certificates.
 	SslTerm bool
 
@@ -188,6 +560,123 @@ type service struct {
 	// The name of the cookie is SERVERID
 	// This only can be used in http services
 	CookieStickySession bool
+
+	// CookieName overrides the name of the sticky session cookie.
+	// CookieMaxAge is the haproxy maxlife of the cookie, after which a
+	// client is balanced again. Both are set with the affinity annotations.
+	CookieName   string
+	CookieMaxAge string
+
+	// objectKey is the namespace/name of the kubernetes service.
+	objectKey string
+
+	// sslSecret is the namespace/name of the secret holding the certificate
+	// used to terminate ssl, written as a PEM bundle to sslCert.
+	// sslCertVersion is the resource version of the secret, so that a
+	// rotated certificate is seen as a change of the service.
+	sslSecret      string
+	sslCert        string
+	sslCertVersion string
+
+	// MaxBody limits the size of the request bodies of http services.
+	MaxBody bodyLimit
+
+	// Compression compresses the responses of http services.
+	Compression compression
+
+	// ExternalName is the dns name of an ExternalName service, the address
+	// of its single server is resolved by haproxy at runtime.
+	ExternalName string
+
+	// BackendTLS connects to the servers over TLS.
+	BackendTLS backendTLS
+
+	// ErrorPages replace the haproxy error pages of the backend.
+	ErrorPages errorPages
+
+	// SendProxy is the haproxy server option used to send a PROXY protocol
+	// header to the backends, send-proxy or send-proxy-v2.
+	SendProxy string
+
+	// ConsistentHash hashes the client ip with a consistent hash, so most
+	// clients keep their server when servers come and go.
+	ConsistentHash bool
+
+	// AcceptProxy makes the frontend of a tcp service expect a PROXY protocol
+	// header. http services share their frontends, see the accept-proxy flag.
+	AcceptProxy bool
+
+	// TCPLog makes the frontend of a tcp service log its connections with
+	// the haproxy tcp log format.
+	TCPLog bool
+
+	// AccessLog makes http services log their requests, see
+	// --access-log.
+	AccessLog bool
+
+	// Limits are the connection limits and timeouts of the backend.
+	Limits backendLimits
+
+	// Outlier marks down the servers of http services returning errors.
+	Outlier outlierDetection
+
+	// PathPrefix routes the requests under a path to an http service, on
+	// its Host only when it has one.
+	PathPrefix string
+
+	// RequestHeaders and ResponseHeaders change the headers of the requests
+	// and responses of http services.
+	RequestHeaders  []headerRule
+	ResponseHeaders []headerRule
+
+	// IPv6Bind is the option of the wildcard ipv6 address the frontend of a
+	// tcp service binds, see ipFamilies. Empty binds ipv4 only.
+	IPv6Bind string
+
+	// Check is the health check of the servers of http services.
+	Check healthCheck
+
+	// RateLimit limits the requests per client ip of http services.
+	RateLimit rateLimit
+
+	// SourceRanges restricts the client ips of the service.
+	SourceRanges sourceRanges
+
+	// Auth requires the clients of http services to authenticate.
+	Auth basicAuth
+
+	// Proto is the haproxy proto of the servers of http services, h2 for
+	// h2c and gRPC backends, empty for HTTP/1.
+	Proto string
+
+	// SslRedirect is the status plaintext requests for services
+	// terminating ssl are redirected to https with, 0 if they aren't.
+	SslRedirect int
+
+	// Servers are the server lines rendered in the backend. Without server
+	// slots there is one server per endpoint, named after its address.
+	Servers []backendServer
+}
+
+// backendServer is a single server entry of a backend.
+type backendServer struct {
+	Name string
+	Addr string
+
+	// Disabled servers are empty slots waiting for an endpoint.
+	Disabled bool
+
+	// Weight is the haproxy weight of the server, taken from the pod
+	// annotations. Empty means the haproxy default.
+	Weight string
+
+	// Draining servers get no new traffic, their endpoint is gone but
+	// they still have sessions.
+	Draining bool
+
+	// Backup servers only get traffic when all the other servers are down,
+	// see --topology-aware.
+	Backup bool
 }
 
 type serviceByName []service
@@ -205,15 +694,40 @@ func (s serviceByName) Less(i, j int) bool {
 // loadBalancerConfig represents loadbalancer specific configuration. Eventually
 // kubernetes will have an api for l7 loadbalancing.
 type loadBalancerConfig struct {
-	Name           string `json:"name" description:"Name of the load balancer, eg: haproxy."`
-	ReloadCmd      string `json:"reloadCmd" description:"command used to reload the load balancer."`
-	Config         string `json:"config" description:"path to loadbalancers configuration file."`
-	Template       string `json:"template" description:"template for the load balancer config."`
-	Algorithm      string `json:"algorithm" description:"loadbalancing algorithm."`
-	startSyslog    bool   `description:"indicates if the load balancer uses syslog."`
-	sslCert        string `json:"sslCert" description:"PEM for ssl."`
-	sslCaCert      string `json:"sslCaCert" description:"PEM to verify client's certificate."`
-	lbDefAlgorithm string `description:"custom default load balancer algorithm".`
+	Name               string   `json:"name" description:"Name of the load balancer, eg: haproxy."`
+	ReloadCmd          string   `json:"reloadCmd" description:"command used to reload the load balancer."`
+	Config             string   `json:"config" description:"path to loadbalancers configuration file."`
+	Template           string   `json:"template" description:"template for the load balancer config."`
+	Algorithm          string   `json:"algorithm" description:"loadbalancing algorithm."`
+	UDPConfig          string   `json:"udpConfig" description:"path to the udp proxy configuration file."`
+	UDPTemplate        string   `json:"udpTemplate" description:"template for the udp proxy config."`
+	UDPReloadCmd       string   `json:"udpReloadCmd" description:"command used to reload the udp proxy."`
+	ValidateCmd        string   `json:"validateCmd" description:"command checking a config file given as last argument."`
+	PidFile            string   `json:"pidFile" description:"pid file of the load balancer, to stop it gracefully."`
+	startSyslog        bool     `description:"indicates if the load balancer uses syslog."`
+	sslCert            string   `json:"sslCert" description:"PEM for ssl."`
+	sslCaCert          string   `json:"sslCaCert" description:"PEM to verify client's certificate."`
+	sslCrtList         string   `description:"path of the crt-list built from certificates in secrets."`
+	customTemplate     string   `description:"path to a custom template overriding Template."`
+	acceptProxy        bool     `description:"indicates if the shared frontends expect a PROXY protocol header."`
+	sslRedirectExclude []string `description:"path prefixes never redirected to https."`
+	acmeChallenges     bool     `description:"route acme http-01 challenges to the controller."`
+	seamlessReload     string   `description:"stats socket the listening sockets are handed over through on reloads."`
+	runtimeAPI         bool     `description:"indicates if servers are updated through the admin level stats socket."`
+	ipFamily           string   `description:"ip family of the addresses frontends bind, ipv4, ipv6 or dual."`
+	accessLog          bool     `description:"indicates if http services log their requests by default."`
+	accessLogTarget    string   `description:"syslog address or socket receiving access logs."`
+	accessLogFormat    string   `description:"haproxy log-format of access logs."`
+	requestIDFormat    string   `description:"haproxy log-format of the unique ids of requests, if they get one."`
+	nameservers        []string `description:"ip:port of the nameservers resolving the servers of ExternalName services."`
+	logTarget          string   `description:"syslog address or socket receiving haproxy logs."`
+	logFacility        string   `description:"syslog facility of haproxy logs."`
+	logLevel           string   `description:"most verbose level of haproxy logs."`
+	lbDefAlgorithm     string   `description:"custom default load balancer algorithm".`
+
+	// reloadRetryTimeout bounds the retries of failed reloads, which
+	// aren't retried if 0.
+	reloadRetryTimeout time.Duration
 }
 
 type staticPageHandler struct {
@@ -240,6 +754,21 @@ func (s serviceAnnotations) getCookieStickySession() (string, bool) {
 	return val, ok
 }
 
+func (s serviceAnnotations) getAffinity() (string, bool) {
+	val, ok := s[lbAffinity]
+	return val, ok
+}
+
+func (s serviceAnnotations) getCookieName() (string, bool) {
+	val, ok := s[lbCookieName]
+	return val, ok
+}
+
+func (s serviceAnnotations) getCookieMaxAge() (string, bool) {
+	val, ok := s[lbCookieMaxAge]
+	return val, ok
+}
+
 func (s serviceAnnotations) getSslTerm() (string, bool) {
 	val, ok := s[lbSslTerm]
 	return val, ok
@@ -250,6 +779,185 @@ func (s serviceAnnotations) getAclMatch() (string, bool) {
 	return val, ok
 }
 
+func (s serviceAnnotations) getSslSecret() (string, bool) {
+	val, ok := s[lbSslSecret]
+	return val, ok
+}
+
+func (s serviceAnnotations) getUDP() (string, bool) {
+	val, ok := s[lbUDP]
+	return val, ok
+}
+
+func (s serviceAnnotations) getWeight() (string, bool) {
+	val, ok := s[lbWeight]
+	return val, ok
+}
+
+func (s serviceAnnotations) getCheckPath() (string, bool) {
+	val, ok := s[lbCheckPath]
+	return val, ok
+}
+
+func (s serviceAnnotations) getCheckStatus() (string, bool) {
+	val, ok := s[lbCheckStatus]
+	return val, ok
+}
+
+func (s serviceAnnotations) getCheckPort() (string, bool) {
+	val, ok := s[lbCheckPort]
+	return val, ok
+}
+
+func (s serviceAnnotations) getCheckInterval() (string, bool) {
+	val, ok := s[lbCheckInterval]
+	return val, ok
+}
+
+func (s serviceAnnotations) getCheckRise() (string, bool) {
+	val, ok := s[lbCheckRise]
+	return val, ok
+}
+
+func (s serviceAnnotations) getCheckFall() (string, bool) {
+	val, ok := s[lbCheckFall]
+	return val, ok
+}
+
+func (s serviceAnnotations) getRateLimit() (string, bool) {
+	val, ok := s[lbRateLimit]
+	return val, ok
+}
+
+func (s serviceAnnotations) getRateLimitPeriod() (string, bool) {
+	val, ok := s[lbRateLimitPeriod]
+	return val, ok
+}
+
+func (s serviceAnnotations) getRateLimitStatus() (string, bool) {
+	val, ok := s[lbRateLimitStatus]
+	return val, ok
+}
+
+func (s serviceAnnotations) getWhitelistSourceRange() (string, bool) {
+	val, ok := s[lbWhitelistSourceRange]
+	return val, ok
+}
+
+func (s serviceAnnotations) getDenylistSourceRange() (string, bool) {
+	val, ok := s[lbDenylistSourceRange]
+	return val, ok
+}
+
+func (s serviceAnnotations) getAuthSecret() (string, bool) {
+	val, ok := s[lbAuthSecret]
+	return val, ok
+}
+
+func (s serviceAnnotations) getSslRedirect() (string, bool) {
+	val, ok := s[lbSslRedirect]
+	return val, ok
+}
+
+func (s serviceAnnotations) getSslRedirectCode() (string, bool) {
+	val, ok := s[lbSslRedirectCode]
+	return val, ok
+}
+
+func (s serviceAnnotations) getBackendProtocol() (string, bool) {
+	val, ok := s[lbBackendProtocol]
+	return val, ok
+}
+
+func (s serviceAnnotations) getCanary() (string, bool) {
+	val, ok := s[lbCanary]
+	return val, ok
+}
+
+func (s serviceAnnotations) getCanaryWeight() (string, bool) {
+	val, ok := s[lbCanaryWeight]
+	return val, ok
+}
+
+func (s serviceAnnotations) getIPFamily() (string, bool) {
+	val, ok := s[lbIPFamily]
+	return val, ok
+}
+
+func (s serviceAnnotations) getAccessLog() (string, bool) {
+	val, ok := s[lbAccessLog]
+	return val, ok
+}
+
+func (s serviceAnnotations) getPathPrefix() (string, bool) {
+	val, ok := s[lbPathPrefix]
+	return val, ok
+}
+
+func (s serviceAnnotations) getSendProxy() (string, bool) {
+	val, ok := s[lbSendProxy]
+	return val, ok
+}
+
+func (s serviceAnnotations) getAcceptProxy() (string, bool) {
+	val, ok := s[lbAcceptProxy]
+	return val, ok
+}
+
+func (s serviceAnnotations) getErrorPages() (string, bool) {
+	val, ok := s[lbErrorPages]
+	return val, ok
+}
+
+func (s serviceAnnotations) getTCPPorts() (string, bool) {
+	val, ok := s[lbTCPPorts]
+	return val, ok
+}
+
+func (s serviceAnnotations) getMaxBodySize() (string, bool) {
+	val, ok := s[lbMaxBodySize]
+	return val, ok
+}
+
+func (s serviceAnnotations) getCompression() (string, bool) {
+	val, ok := s[lbCompression]
+	return val, ok
+}
+
+func (s serviceAnnotations) getCompressionTypes() (string, bool) {
+	val, ok := s[lbCompressionTypes]
+	return val, ok
+}
+
+func (s serviceAnnotations) getTCPLog() (string, bool) {
+	val, ok := s[lbTCPLog]
+	return val, ok
+}
+
+// getCookieSettings returns the name and haproxy maxlife of the sticky session
+// cookie of a service. An invalid max age is ignored, the cookie then lives
+// as long as the browser session.
+func getCookieSettings(s *api.Service) (name, maxAge string) {
+	annotations := serviceAnnotations(s.ObjectMeta.Annotations)
+	name, _ = annotations.getCookieName()
+	if val, ok := annotations.getCookieMaxAge(); ok {
+		d, err := time.ParseDuration(val)
+		if err != nil || d < time.Second {
+			logWarningf("Ignoring invalid %v %q of service %v", lbCookieMaxAge, val, s.Name)
+		} else {
+			maxAge = fmt.Sprintf("%ds", int64(d/time.Second))
+		}
+	}
+	return
+}
+
+// sendProxyOptions maps the values of the sendProxy annotation to haproxy
+// server options.
+var sendProxyOptions = map[string]string{
+	"v1": "send-proxy",
+	"v2": "send-proxy-v2",
+}
+
 // Get serves the error page
 func (s *staticPageHandler) Getfunc(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(s.returnCode)
@@ -280,64 +988,45 @@ func (s *staticPageHandler) loadUrl(url string) error {
 	defer res.Body.Close()
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		glog.Errorf("%v", err)
+		logErrorf("%v", err)
 		return err
 	}
-	glog.V(2).Infof("Error page:\n%v", string(body))
+	logV(2).Infof("Error page:\n%v", string(body))
 	s.pagePath = url
 	s.pageContents = body
 
 	return nil
 }
 
-// write writes the configuration file, will write to stdout if dryRun == true
-func (cfg *loadBalancerConfig) write(services map[string][]service, dryRun bool) (err error) {
-	var w io.Writer
-	if dryRun {
-		w = os.Stdout
-	} else {
-		w, err = os.Create(cfg.Config)
+// reload reloads the loadbalancer using the reload cmd specified in the json
+// manifest, retrying failed reloads for up to reloadRetryTimeout.
+func (cfg *loadBalancerConfig) reload() error {
+	if cfg.reloadRetryTimeout <= 0 {
+		return cfg.reloadOnce()
+	}
+	b := reloadBackoff
+	b.MaxElapsed = cfg.reloadRetryTimeout
+	return backoff.Retry(context.Background(), b, func() error {
+		err := cfg.reloadOnce()
 		if err != nil {
-			return
+			logWarningf("Reload of %v failed: %v", cfg.Name, err)
 		}
-	}
-	var t *template.Template
-	t, err = template.ParseFiles(cfg.Template)
-	if err != nil {
-		return
-	}
-
-	conf := make(map[string]interface{})
-	conf["startSyslog"] = strconv.FormatBool(cfg.startSyslog)
-	conf["services"] = services
-
-	var sslConfig string
-	if cfg.sslCert != "" {
-		sslConfig = "crt " + cfg.sslCert
-	}
-	if cfg.sslCaCert != "" {
-		sslConfig += " ca-file " + cfg.sslCaCert
-	}
-	conf["sslCert"] = sslConfig
-
-	// default load balancer algorithm is roundrobin
-	conf["defLbAlgorithm"] = lbDefAlgorithm
-	if cfg.lbDefAlgorithm != "" {
-		conf["defLbAlgorithm"] = cfg.lbDefAlgorithm
-	}
-
-	err = t.Execute(w, conf)
-	return
+		return err
+	})
 }
 
-// reload reloads the loadbalancer using the reload cmd specified in the json manifest.
-func (cfg *loadBalancerConfig) reload() error {
-	output, err := exec.Command("sh", "-c", cfg.ReloadCmd).CombinedOutput()
-	msg := fmt.Sprintf("%v -- %v", cfg.Name, string(output))
+func (cfg *loadBalancerConfig) reloadOnce() error {
+	start := time.Now()
+	cmd := exec.Command("sh", "-c", cfg.ReloadCmd)
+	if cfg.seamlessReload != "" {
+		cmd.Env = append(os.Environ(), "SEAMLESS_RELOAD="+cfg.seamlessReload)
+	}
+	output, err := cmd.CombinedOutput()
+	observeReload(start, err)
 	if err != nil {
-		return fmt.Errorf("error restarting %v: %v", msg, err)
+		return fmt.Errorf("error restarting %v -- %v: %v", cfg.Name, string(output), err)
 	}
-	glog.Infof(msg)
+	logInfo("Reloaded "+cfg.Name, "reload_duration", time.Since(start).Seconds(), "output", strings.TrimSpace(string(output)))
 	return nil
 }
 
@@ -345,18 +1034,130 @@ func (cfg *loadBalancerConfig) reload() error {
 // from the loadbalancer, via loadBalancerConfig.
 type loadBalancerController struct {
 	cfg               *loadBalancerConfig
+	backend           proxyBackend
 	queue             *workqueue.Type
 	client            *unversioned.Client
 	epController      *framework.Controller
+	slices            *endpointSliceWatcher
 	svcController     *framework.Controller
+	secretController  *framework.Controller
+	podController     *framework.Controller
 	svcLister         cache.StoreToServiceLister
 	epLister          cache.StoreToEndpointsLister
+	secretStore       cache.Store
+	podStore          cache.Store
+	nodeController    *framework.Controller
+	nodeStore         cache.Store
+	locality          *locality
+	defaultLimits     backendLimits
 	reloadRateLimiter util.RateLimiter
+	backoff           *backoff.Keyed
+	debounce          *debouncer
+	publishAddress    string
+	dns               *dnsPublisher
+	updateService     func(*api.Service) error
 	template          string
 	targetService     string
 	forwardServices   bool
+	sslRedirect       bool
+	sslRedirectCode   int
+	filter            *serviceFilter
 	tcpServices       map[string]int
 	httpPort          int
+	sslCertDir        string
+
+	// defaultCompression is the compression of http services without
+	// compression annotations.
+	defaultCompression compression
+
+	// configMapStore is set with haproxy, for the error pages of
+	// services, and with --service-defaults. errorPages is the namespace/name of the ConfigMap of the
+	// default error pages, written to errorPagesDir with those of the
+	// services.
+	configMapController *framework.Controller
+	configMapStore      cache.Store
+	errorPages          string
+	errorPagesDir       string
+
+	// slots and socket are set when endpoint changes are applied through
+	// the haproxy runtime API. running holds the services of the last
+	// config haproxy was reloaded with or updated to.
+	slots   *serverSlots
+	socket  *haproxySocket
+	running []service
+
+	// outliers is set with haproxy, to report the servers marked down by
+	// outlier detection.
+	outliers *outlierWatcher
+
+	// overrides is set when servers can be drained through the admin api.
+	overrides *serverOverrides
+
+	// overridesConfigMap is the namespace/name of the ConfigMap the
+	// overrides are saved in, and overridesVersion the version they were
+	// last loaded from.
+	overridesConfigMap string
+	overridesVersion   string
+
+	// drain is set when servers of removed endpoints are drained first.
+	drain *drainer
+
+	// acme is set when certificates are obtained from an acme server.
+	acme *acmeManager
+
+	// elector is set when replicas elect the one configuring the
+	// loadbalancer.
+	elector *leaderElector
+
+	// deferrals delays the syncs deferred until the informers synced, by
+	// queue key.
+	deferrals *backoff.Keyed
+
+	// serviceDefaults is the namespace/name of the ConfigMap of the
+	// defaults of the annotations of services, and serviceDefaultsVersion
+	// the version its ignored keys were last reported for.
+	serviceDefaults        string
+	serviceDefaultsVersion string
+
+	// clusters merges the endpoints of --remote-clusters, nil without.
+	clusters *clusterSet
+
+	// fixture is the path of the file of --from-file the objects come
+	// from, instead of informers.
+	fixture string
+
+	// ready tracks the results of syncs for /readyz.
+	ready *readiness
+
+	// tracer is set when the steps of syncs are traced.
+	tracer *tracer
+
+	// syncLock serializes syncs with the renders of the admin api, as
+	// rendering assigns server slots and tracks draining servers.
+	syncLock sync.Mutex
+
+	// recordEvent posts events about services, unless it is nil.
+	recordEvent func(*api.Event) error
+
+	// unresolvedPorts holds the service ports reported by
+	// reportPortResolution, namespace/name:targetPort.
+	unresolvedPorts sets.String
+
+	// fetchExternalName reads the externalName of a service, cached in
+	// externalNames by namespace/name.
+	fetchExternalName func(namespace, name string) (string, error)
+	externalNames     map[string]externalName
+
+	// portConflicts holds the tcp services not published by the last
+	// allocateTCPPorts, backend:frontendPort.
+	portConflicts sets.String
+
+	// appliedModel is the modelHash of the last successful sync.
+	appliedModel string
+
+	// udpRunning describes the udp services the udp proxy was last
+	// reloaded with.
+	udpRunning string
 }
 
 // getTargetPort returns the numeric value of TargetPort
@@ -371,34 +1172,56 @@ func (lbc *loadBalancerController) getEndpoints(
 	if err != nil {
 		return
 	}
+	endpoints, ready := endpointAddresses(&ep, s, servicePort)
+	if ready {
+		lbc.reportPortResolution(s, servicePort, len(endpoints) > 0)
+	}
+	return
+}
 
+// endpointAddresses returns the <endpoint ip>:<port> of ep for a given
+// service/target port combination, and whether ep has any ready address.
+func endpointAddresses(ep *api.Endpoints, s *api.Service, servicePort *api.ServicePort) (endpoints []string, ready bool) {
 	// The intent here is to create a union of all subsets that match a targetPort.
 	// We know the endpoint already matches the service, so all pod ips that have
 	// the target port are capable of service traffic for it.
 	for _, ss := range ep.Subsets {
+		ready = ready || len(ss.Addresses) > 0
 		for _, epPort := range ss.Ports {
-			var targetPort int
-			switch servicePort.TargetPort.Type {
-			case intstr.Int:
-				if epPort.Port == getTargetPort(servicePort) {
-					targetPort = epPort.Port
-				}
-			case intstr.String:
-				if epPort.Name == servicePort.TargetPort.StrVal {
-					targetPort = epPort.Port
-				}
-			}
-			if targetPort == 0 {
+			if !endpointPortMatches(s, servicePort, epPort) {
 				continue
 			}
 			for _, epAddress := range ss.Addresses {
-				endpoints = append(endpoints, fmt.Sprintf("%v:%v", epAddress.IP, targetPort))
+				endpoints = append(endpoints, hostPort(epAddress.IP, epPort.Port))
 			}
 		}
 	}
 	return
 }
 
+// getServers returns the backend servers for the given endpoints, weighted
+// by the ip of their pod.
+func (lbc *loadBalancerController) getServers(backend string, endpoints []string, weights map[string]string) []backendServer {
+	var servers []backendServer
+	if lbc.slots != nil {
+		servers = lbc.slots.assign(backend, endpoints)
+	} else {
+		servers = make([]backendServer, len(endpoints))
+		for i, ep := range endpoints {
+			servers[i] = backendServer{Name: serverName(ep), Addr: ep}
+		}
+	}
+	for i := range servers {
+		if servers[i].Disabled {
+			continue
+		}
+		if host, _, err := net.SplitHostPort(servers[i].Addr); err == nil {
+			servers[i].Weight = weights[host]
+		}
+	}
+	return servers
+}
+
 // encapsulates all the hacky convenience type name modifications for lb rules.
 // - :80 services don't need a :80 postfix
 // - default ns should be accessible without /ns/name (when we have /ns support)
@@ -412,40 +1235,111 @@ func getServiceNameForLBRule(s *api.Service, servicePort int) string {
 // getServices returns a list of services and their endpoints.
 func (lbc *loadBalancerController) getServices() (httpSvc []service, httpsTermSvc []service, tcpSvc []service) {
 	ep := []string{}
+	defaults := lbc.getServiceDefaults()
 	services, _ := lbc.svcLister.List()
 	for _, s := range services.Items {
+		if !lbc.selected(&s) {
+			continue
+		}
+		s.Annotations = withDefaults(s.Annotations, defaults)
 		if s.Spec.Type == api.ServiceTypeLoadBalancer {
-			glog.Infof("Ignoring service %v, it already has a loadbalancer", s.Name)
+			logInfo("Ignoring service, it already has a loadbalancer", "service", s.Name, "namespace", s.Namespace)
 			continue
 		}
+		external := ""
+		if s.Spec.Type == serviceTypeExternalName {
+			if external = lbc.getExternalName(&s); external == "" {
+				continue
+			}
+		}
+		tcpPorts := lbc.getTCPPorts(&s)
 		for _, servicePort := range s.Spec.Ports {
 			// TODO: headless services?
 			sName := s.Name
 			if servicePort.Protocol == api.ProtocolUDP ||
 				(lbc.targetService != "" && lbc.targetService != sName) {
-				glog.Infof("Ignoring %v: %+v", sName, servicePort)
+				logInfof("Ignoring %v: %+v", sName, servicePort)
 				continue
 			}
 
-			if lbc.forwardServices {
+			var canaryEp []string
+			var canaryPercent int
+			if external != "" {
+				// a single server, the canary, locality and weights of
+				// endpoints don't apply
+				ep = []string{hostPort(external, servicePort.Port)}
+			} else if lbc.forwardServices {
 				ep = []string{
-					fmt.Sprintf("%v:%v", s.Spec.ClusterIP, servicePort.Port)}
+					hostPort(s.Spec.ClusterIP, servicePort.Port)}
 			} else {
 				ep = lbc.getEndpoints(&s, &servicePort)
 			}
+			var clusterOf map[string]string
+			var standby map[string]bool
+			if lbc.clusters != nil && !lbc.forwardServices && external == "" {
+				ep, clusterOf = lbc.clusters.merge(&s, &servicePort, ep)
+				standby = lbc.clusters.standby(clusterOf)
+			}
+			primaryEp := ep
+			if external == "" {
+				canaryEp, canaryPercent = lbc.getCanaryEndpoints(&s, &servicePort)
+				ep = append(ep, canaryEp...)
+			}
+			backend := getServiceNameForLBRule(&s, servicePort.Port)
+			var remote map[string]bool
+			if lbc.locality != nil && !lbc.forwardServices && external == "" {
+				ep, remote = lbc.locality.localize(ep, lbc.getZones(&s))
+			}
+			var draining map[string]bool
+			if lbc.drain != nil {
+				ep, draining = lbc.drain.keep(backend, ep)
+			}
 			if len(ep) == 0 {
-				glog.Infof("No endpoints found for service %v, port %+v",
-					sName, servicePort)
+				logInfo("No endpoints found", "service", sName, "namespace", s.Namespace, "port", servicePort.Port)
 				continue
 			}
 			newSvc := service{
-				Name:        getServiceNameForLBRule(&s, servicePort.Port),
-				Ep:          ep,
-				BackendPort: getTargetPort(&servicePort),
+				Name:         backend,
+				Ep:           ep,
+				BackendPort:  backendPort(&servicePort, primaryEp),
+				ExternalName: external,
+				objectKey:    fmt.Sprintf("%v/%v", s.Namespace, s.Name),
+			}
+			if external != "" {
+				newSvc.BackendPort = servicePort.Port
+			}
+			newSvc.Check = getHealthCheck(&s, newSvc.BackendPort)
+			newSvc.RateLimit = getRateLimit(&s)
+			newSvc.MaxBody = lbc.getBodyLimit(&s)
+			newSvc.SourceRanges = getSourceRanges(&s)
+			newSvc.Auth = lbc.getBasicAuth(&s)
+			newSvc.AccessLog = lbc.getAccessLog(&s)
+			newSvc.RequestHeaders = getHeaderRules(&s, lbRequestHeaders)
+			newSvc.PathPrefix = getPathPrefix(&s)
+			newSvc.ResponseHeaders = getHeaderRules(&s, lbResponseHeaders)
+			var weights map[string]string
+			if len(canaryEp) > 0 {
+				weights = splitWeights(primaryEp, canaryEp, canaryPercent)
+			} else if !lbc.forwardServices && external == "" {
+				weights = lbc.getWeights(&s)
+				if lbc.clusters != nil {
+					weights = lbc.clusters.weigh(weights, clusterOf)
+				}
 			}
+			if external != "" {
+				newSvc.Servers = []backendServer{{Name: serverName(ep[0]), Addr: ep[0]}}
+			} else {
+				newSvc.Servers = lbc.getServers(newSvc.Name, ep, weights)
+			}
+			for i := range newSvc.Servers {
+				newSvc.Servers[i].Draining = draining[newSvc.Servers[i].Addr]
+				newSvc.Servers[i].Backup = remote[newSvc.Servers[i].Addr] || standby[newSvc.Servers[i].Addr]
+			}
+			lbc.drainOverridden(newSvc.Name, newSvc.Servers)
 
-			if val, ok := serviceAnnotations(s.ObjectMeta.Annotations).getHost(); ok {
-				newSvc.Host = val
+			if newSvc.Host = getHost(&s); newSvc.Host != "" {
+				newSvc.HostACL = hostACL(newSvc.Host, false)
+				newSvc.SNIACL = hostACL(newSvc.Host, true)
 			}
 
 			if val, ok := serviceAnnotations(s.ObjectMeta.Annotations).getAlgorithm(); ok {
@@ -474,12 +1368,63 @@ func (lbc *loadBalancerController) getServices() (httpSvc []service, httpsTermSv
 				}
 			}
 
+			if secret, err := lbc.getSslSecret(&s); err != nil {
+				logWarning("Not using the certificate of service", "service", sName, "namespace", s.Namespace, "error", err)
+			} else if secret != nil {
+				newSvc.SslTerm = true
+				newSvc.sslSecret = fmt.Sprintf("%v/%v", secret.Namespace, secret.Name)
+				newSvc.sslCert = lbc.sslCertPath(secret)
+				newSvc.sslCertVersion = secret.ResourceVersion
+			}
+
+			tls, err := lbc.getBackendTLS(&s)
+			if err != nil {
+				logWarning("Not exposing service, its servers can't be reached over TLS", "service", sName, "namespace", s.Namespace, "error", err)
+				continue
+			}
+			newSvc.BackendTLS = tls
+			newSvc.ErrorPages = lbc.getErrorPages(&s)
+
+			if val, ok := serviceAnnotations(s.ObjectMeta.Annotations).getSendProxy(); ok {
+				if option, ok := sendProxyOptions[val]; ok {
+					newSvc.SendProxy = option
+				} else {
+					logWarningf("Ignoring invalid %v %q of service %v", lbSendProxy, val, sName)
+				}
+			}
+
+			if val, ok := serviceAnnotations(s.ObjectMeta.Annotations).getAcceptProxy(); ok {
+				b, err := strconv.ParseBool(val)
+				if err == nil {
+					newSvc.AcceptProxy = b
+				}
+			}
+
 			if val, ok := serviceAnnotations(s.ObjectMeta.Annotations).getAclMatch(); ok {
 				newSvc.AclMatch = val
 			}
 
-			if port, ok := lbc.tcpServices[sName]; ok && port == servicePort.Port {
-				newSvc.FrontendPort = servicePort.Port
+			affinity, _ := serviceAnnotations(s.ObjectMeta.Annotations).getAffinity()
+			if affinity == "source" {
+				newSvc.Algorithm = "source"
+				newSvc.ConsistentHash = true
+			}
+
+			if frontendPort, ok := tcpPorts[servicePort.Port]; ok {
+				if affinity != "" && affinity != "source" {
+					logWarningf("Ignoring invalid %v %q of tcp service %v", lbAffinity, affinity, sName)
+				}
+				newSvc.FrontendPort = frontendPort
+				if val, ok := serviceAnnotations(s.ObjectMeta.Annotations).getTCPLog(); ok {
+					if b, err := strconv.ParseBool(val); err == nil {
+						newSvc.TCPLog = b
+					} else {
+						logWarningf("Ignoring invalid %v %q of service %v", lbTCPLog, val, sName)
+					}
+				}
+				newSvc.Limits = getBackendLimits(&s, lbc.defaultLimits, true)
+				newSvc.Outlier = getOutlierDetection(&s, true)
+				newSvc.IPv6Bind = getIPv6Bind(&s, ipFamilies[lbc.cfg.ipFamily])
 				tcpSvc = append(tcpSvc, newSvc)
 			} else {
 				if val, ok := serviceAnnotations(s.ObjectMeta.Annotations).getCookieStickySession(); ok {
@@ -489,110 +1434,394 @@ func (lbc *loadBalancerController) getServices() (httpSvc []service, httpsTermSv
 					}
 				}
 
+				newSvc.Limits = getBackendLimits(&s, lbc.defaultLimits, false)
+				newSvc.Outlier = getOutlierDetection(&s, false)
+				if affinity == "cookie" {
+					newSvc.SessionAffinity = true
+					newSvc.CookieStickySession = true
+				} else if affinity != "" && affinity != "source" {
+					logWarningf("Ignoring invalid %v %q of service %v", lbAffinity, affinity, sName)
+				}
+				if newSvc.CookieStickySession {
+					newSvc.CookieName, newSvc.CookieMaxAge = getCookieSettings(&s)
+				}
+
 				newSvc.FrontendPort = lbc.httpPort
+				newSvc.Compression = getCompression(&s, lbc.defaultCompression)
+				newSvc.Proto = getBackendProtocol(&s)
 				if newSvc.SslTerm == true {
+					newSvc.SslRedirect = lbc.getSslRedirect(&s)
 					httpsTermSvc = append(httpsTermSvc, newSvc)
 				} else {
 					httpSvc = append(httpSvc, newSvc)
 				}
 			}
-			//glog.Infof("Found service: %+v", newSvc)
+			//logInfof("Found service: %+v", newSvc)
 		}
 	}
 
 	sort.Sort(serviceByName(httpSvc))
 	sort.Sort(serviceByName(httpsTermSvc))
-	sort.Sort(serviceByName(tcpSvc))
+	tcpSvc = lbc.allocateTCPPorts(tcpSvc, lbc.reservedPorts(len(httpsTermSvc) > 0 || lbc.cfg.sslCert != ""))
 
 	return
 }
 
-// sync all services with the loadbalancer.
-func (lbc *loadBalancerController) sync(dryRun bool) error {
-	if !lbc.epController.HasSynced() || !lbc.svcController.HasSynced() {
-		time.Sleep(100 * time.Millisecond)
+// informersSynced reports whether the informers listed every object.
+func (lbc *loadBalancerController) informersSynced() bool {
+	if lbc.fixture != "" {
+		return true
+	}
+	return lbc.endpointsSynced() && lbc.svcController.HasSynced() && lbc.secretController.HasSynced() && lbc.podController.HasSynced() &&
+		(lbc.nodeController == nil || lbc.nodeController.HasSynced()) &&
+		(lbc.configMapController == nil || lbc.configMapController.HasSynced()) &&
+		(lbc.clusters == nil || lbc.clusters.synced())
+}
+
+// sync all services with the loadbalancer. Its steps are traced as children
+// of trace, which may be nil.
+func (lbc *loadBalancerController) sync(dryRun bool, trace *span) (err error) {
+	if !lbc.informersSynced() {
 		return errDeferredSync
 	}
+	lbc.syncLock.Lock()
+	defer lbc.syncLock.Unlock()
+	start := time.Now()
+	defer func() { observeSync(start, err) }()
+
+	if lbc.cfg.UDPConfig != "" {
+		if err := lbc.syncUDP(dryRun); err != nil {
+			return err
+		}
+	}
+
+	watchedObjects.WithLabelValues("services").Set(float64(len(lbc.svcLister.Store.List())))
+	watchedObjects.WithLabelValues("endpoints").Set(float64(len(lbc.epLister.Store.List())))
+
+	lbc.loadOverrides()
+	step := trace.child("services")
 	httpSvc, httpsTermSvc, tcpSvc := lbc.getServices()
+	step.set("services", len(httpSvc)+len(httpsTermSvc)+len(tcpSvc))
+	step.finish(nil)
 	if len(httpSvc) == 0 && len(httpsTermSvc) == 0 && len(tcpSvc) == 0 {
 		return nil
 	}
-	if err := lbc.cfg.write(
+	if !dryRun {
+		if err := lbc.writeSslCerts(httpsTermSvc); err != nil {
+			return err
+		}
+		if err := lbc.writeBackendTLS(httpSvc, httpsTermSvc, tcpSvc); err != nil {
+			return err
+		}
+		if err := lbc.writeErrorPages(httpSvc, httpsTermSvc); err != nil {
+			return err
+		}
+		if err := lbc.writeBodyTooLargePage(httpSvc, httpsTermSvc); err != nil {
+			return err
+		}
+	}
+	step = trace.child("render")
+	config, err := lbc.backend.render(
 		map[string][]service{
 			"http":      httpSvc,
 			"httpsTerm": httpsTermSvc,
 			"tcp":       tcpSvc,
-		}, dryRun); err != nil {
+		})
+	step.finish(err)
+	if err != nil {
 		return err
 	}
 	if dryRun {
+		if *dryPrintConfig {
+			if _, err := os.Stdout.Write(config); err != nil {
+				return err
+			}
+		}
+		return lbc.backend.validate(config)
+	}
+	if lbc.drain != nil && lbc.drain.active() {
+		time.AfterFunc(drainCheckInterval, func() { lbc.queue.Add(drainQueueKey) })
+	}
+	model := modelHash(config, httpSvc, httpsTermSvc, tcpSvc)
+	if model == lbc.appliedModel {
+		logV(2).Infof("Services and config unchanged, nothing to apply")
+		lbc.publishStatus(httpSvc, httpsTermSvc, tcpSvc)
+		lbc.publishDNS(httpSvc, httpsTermSvc)
+		lbc.watchOutliers(httpSvc, httpsTermSvc)
 		return nil
 	}
+	step = trace.child("validate")
+	err = lbc.backend.validate(config)
+	step.finish(err)
+	if err != nil {
+		lbc.cfg.keepRejected(config, err)
+		return fmt.Errorf("keeping the last applied config: %v", err)
+	}
+
+	step = trace.child("apply")
+	step.set("runtime_api", lbc.slots != nil)
+	if lbc.slots != nil {
+		err = lbc.apply(config, httpSvc, httpsTermSvc, tcpSvc)
+	} else {
+		// the model changed since the last applied config
+		logInfof("Services or config changed, reloading")
+		step.set("reload", true)
+		err = lbc.backend.apply(config, true)
+	}
+	step.finish(err)
+	if err == nil {
+		lbc.appliedModel = model
+		lbc.publishStatus(httpSvc, httpsTermSvc, tcpSvc)
+		lbc.publishDNS(httpSvc, httpsTermSvc)
+		lbc.watchOutliers(httpSvc, httpsTermSvc)
+	}
+	return err
+}
+
+// apply brings haproxy up to date with config. When only server addresses
+// changed they are updated through the runtime API, otherwise haproxy is
+// reloaded.
+func (lbc *loadBalancerController) apply(config []byte, svcGroups ...[]service) error {
+	svcs := []service{}
+	for _, group := range svcGroups {
+		svcs = append(svcs, group...)
+	}
+	lbc.slots.retain(svcs)
+	if lbc.drain != nil {
+		lbc.drain.retain(svcs)
+	}
 
-	newServices := fmt.Sprintf("%v", httpsTermSvc)
-	//fmt.Println("newServices: ", newServices)
-	if previousServices != newServices {
-		glog.Infof("Service list needs reload")
-		previousServices = newServices
-		return lbc.cfg.reload()
+	if lbc.running != nil && topology(lbc.running) == topology(svcs) {
+		if err := lbc.backend.apply(config, false); err != nil {
+			return err
+		}
+		err := lbc.updateServers(lbc.running, svcs)
+		if err == nil {
+			lbc.running = svcs
+			return nil
+		}
+		logWarning("Runtime update failed, reloading instead", "error", err)
+	}
+
+	logInfof("Loadbalancer topology changed, reloading")
+	if err := lbc.backend.apply(config, true); err != nil {
+		return err
 	}
+	lbc.running = svcs
 	return nil
 }
 
-// worker handles the work queue.
+// worker handles the work queue. Syncs are rate limited, and failed syncs
+// are retried with an exponential backoff.
 func (lbc *loadBalancerController) worker() {
 	for {
-		key, _ := lbc.queue.Get()
-		glog.Infof("Sync triggered by service %v", key)
-		if err := lbc.sync(false); err != nil {
-			glog.Warningf("Requeuing %v because of error: %v", key, err)
-			lbc.queue.Add(key)
+		key, quit := lbc.queue.Get()
+		if quit {
+			return
+		}
+		trace := lbc.tracer.start(nil, "sync")
+		trace.set("key", key)
+		step := trace.child("rate_limit")
+		lbc.reloadRateLimiter.Accept()
+		step.finish(nil)
+		logInfo("Sync triggered", "key", key)
+		id := fmt.Sprintf("%v", key)
+		err := lbc.sync(false, trace)
+		if err == errDeferredSync {
+			trace.set("deferred", true)
+			trace.finish(nil)
+		} else {
+			trace.finish(err)
+		}
+		switch {
+		case err == errDeferredSync:
+			time.AfterFunc(lbc.deferrals.Next(id), func() { lbc.queue.Add(key) })
+		case err != nil:
+			lbc.deferrals.Reset(id)
+			lbc.ready.observe(err)
+			delay := lbc.backoff.Next(id)
+			logWarning("Requeuing sync", "key", key, "retry_delay", delay.Seconds(), "error", err)
+			time.AfterFunc(delay, func() { lbc.queue.Add(key) })
+		default:
+			lbc.deferrals.Reset(id)
+			lbc.ready.observe(nil)
+			lbc.backoff.Reset(id)
 		}
 		lbc.queue.Done(key)
 	}
 }
 
 // newLoadBalancerController creates a new controller from the given config.
-func newLoadBalancerController(cfg *loadBalancerConfig, kubeClient *unversioned.Client, namespace string, tcpServices map[string]int) *loadBalancerController {
+func newLoadBalancerController(cfg *loadBalancerConfig, kubeClient *unversioned.Client, namespaces []string, tcpServices map[string]int) *loadBalancerController {
 	lbc := loadBalancerController{
 		cfg:    cfg,
 		client: kubeClient,
 		queue:  workqueue.New(),
 		reloadRateLimiter: util.NewTokenBucketRateLimiter(
 			reloadQPS, int(reloadQPS)),
+		backoff:         backoff.NewKeyed(syncBackoff),
+		deferrals:       backoff.NewKeyed(deferredSyncBackoff),
+		ready:           &readiness{},
 		targetService:   *targetService,
 		forwardServices: *forwardServices,
 		httpPort:        *httpPort,
+		sslRedirect:     *sslRedirect,
+		sslRedirectCode: *sslRedirectCode,
+		publishAddress:  *publishAddress,
+		defaultLimits:   backendLimits{MaxConn: *serverMaxConn, MaxQueue: *serverMaxQueue},
 		tcpServices:     tcpServices,
+		sslCertDir:      *sslCertDir,
+		errorPages:      *errorPagesConfigMap,
+		errorPagesDir:   *errorPagesDir,
+		serviceDefaults: *serviceDefaults,
+	}
+	lbc.updateService = func(svc *api.Service) error {
+		return writeAPI(func() error {
+			_, err := kubeClient.Services(svc.Namespace).Update(svc)
+			return err
+		})
+	}
+	backend, err := newProxyBackend(*proxy, cfg)
+	if err != nil {
+		logFatalf("%v", err)
+	}
+	if lbc.defaultCompression, err = newCompression(*compress, *compressionTypes, *compressionMinSize); err != nil {
+		logFatalf("Invalid compression settings: %v", err)
+	}
+	lbc.backend = backend
+	lbc.fetchExternalName = fetchExternalName(kubeClient)
+	lbc.recordEvent = func(event *api.Event) error {
+		_, err := kubeClient.Events(event.Namespace).Create(event)
+		return err
+	}
+	if kubeClient == nil {
+		// Objects come from a fixture, events are only logged.
+		lbc.updateService, lbc.fetchExternalName = nil, nil
+		lbc.recordEvent = func(event *api.Event) error {
+			logInfo("Event", "object", event.InvolvedObject.Namespace+"/"+event.InvolvedObject.Name, "reason", event.Reason, "message", event.Message)
+			return nil
+		}
+	}
+	if *proxy == "haproxy" {
+		lbc.outliers = newOutlierWatcher(&haproxySocket{path: *haproxySocketPath}, lbc.recordEvent)
+	}
+	if *dnsProviderName != "" {
+		if *publishAddress == "" || *dnsZone == "" || *dnsDomain == "" {
+			logFatalf("--dns-provider requires --publish-address, --dns-zone and --dns-domain")
+		}
+		provider, err := newDNSProvider(*dnsProviderName, *dnsZone, *dnsProject)
+		if err != nil {
+			logFatalf("%v", err)
+		}
+		lbc.dns = newDNSPublisher(provider, *dnsDomain, *dnsOwnerID, *dnsTTL)
+	}
+	if len(*remoteClusters) > 0 {
+		clusters, err := newClusterSet(*clusterName, *remoteClusters, *clusterWeights, *clusterFailover)
+		if err != nil {
+			logFatalf("%v", err)
+		}
+		if len(*clusterFailover) > 0 && (*proxy != "haproxy" || *serverSlotSize > 0) {
+			logFatalf("Cluster failover relies on haproxy backup servers, --cluster-failover can't be used with %v or server slots", *proxy)
+		}
+		lbc.clusters = clusters
+	}
+	if *serverSlotSize > 0 {
+		if *proxy != "haproxy" {
+			logFatalf("Server slots rely on the haproxy runtime API, they can't be used with %v", *proxy)
+		}
+		if *topologyAware {
+			logFatalf("Server slots can't change backup servers at runtime, they can't be used with --topology-aware")
+		}
+		lbc.slots = newServerSlots(*serverSlotSize)
+		cfg.runtimeAPI = true
+		lbc.socket = &haproxySocket{path: *haproxySocketPath}
+		if *drainPeriod > 0 {
+			lbc.drain = newDrainer(*drainPeriod, lbc.serverIdle)
+		}
 	}
 
+	lbc.debounce = newDebouncer(*syncDebounce, *syncMaxDelay, func() {
+		lbc.queue.Add(syncQueueKey)
+	})
 	enqueue := func(obj interface{}) {
 		key, err := keyFunc(obj)
 		if err != nil {
-			glog.Infof("Couldn't get key for object %+v: %v", obj, err)
+			logInfof("Couldn't get key for object %+v: %v", obj, err)
 			return
 		}
-		lbc.queue.Add(key)
+		logV(2).Infof("Queuing a sync for %v", key)
+		lbc.debounce.add()
 	}
 	eventHandlers := framework.ResourceEventHandlerFuncs{
 		AddFunc:    enqueue,
 		DeleteFunc: enqueue,
 		UpdateFunc: func(old, cur interface{}) {
-			if !reflect.DeepEqual(old, cur) {
+			if objectChanged(old, cur) {
 				enqueue(cur)
 			}
 		},
 	}
 
 	lbc.svcLister.Store, lbc.svcController = framework.NewInformer(
-		cache.NewListWatchFromClient(
-			lbc.client, "services", namespace, fields.Everything()),
-		&api.Service{}, resyncPeriod, eventHandlers)
+		namespacedListWatch(lbc.client, "services", namespaces),
+		&api.Service{}, resyncPeriodOf("services"), eventHandlers)
+
+	if *legacyEndpoints {
+		lbc.epLister.Store, lbc.epController = framework.NewInformer(
+			namespacedListWatch(lbc.client, "endpoints", namespaces),
+			&api.Endpoints{}, resyncPeriodOf("endpoints"), eventHandlers)
+	} else {
+		lbc.slices = newEndpointSliceWatcher(lbc.client, namespaces, eventHandlers)
+		lbc.epLister.Store = lbc.slices.store
+	}
+	if lbc.clusters != nil {
+		if err := lbc.clusters.watch(namespaces, eventHandlers); err != nil {
+			logFatalf("%v", err)
+		}
+	}
+
+	lbc.secretStore, lbc.secretController = framework.NewInformer(
+		namespacedListWatch(lbc.client, "secrets", namespaces),
+		&api.Secret{}, resyncPeriodOf("secrets"), eventHandlers)
+
+	if *proxy == "haproxy" || *serviceDefaults != "" {
+		lbc.configMapStore, lbc.configMapController = framework.NewInformer(
+			namespacedListWatch(lbc.client, "configmaps", namespaces),
+			&api.ConfigMap{}, resyncPeriodOf("configmaps"), eventHandlers)
+	}
+
+	if *topologyAware {
+		if *proxy != "haproxy" {
+			logFatalf("Backup servers are only supported by haproxy, --topology-aware can't be used with %v", *proxy)
+		}
+		lbc.locality = &locality{zone: *zone, strict: *strictLocality}
+		if lbc.locality.zone == "" {
+			node, err := kubeClient.Nodes().Get(os.Getenv("NODE_NAME"))
+			if err != nil {
+				logFatalf("Unable to get the zone of the node, set --zone or NODE_NAME: %v", err)
+			}
+			lbc.locality.zone = nodeZone(node)
+		}
+		logInfof("Preferring servers in zone %q", lbc.locality.zone)
+		// Nodes are only read for their zone, servers are placed again on
+		// the next sync.
+		lbc.nodeStore, lbc.nodeController = framework.NewInformer(
+			cache.NewListWatchFromClient(
+				lbc.client, "nodes", api.NamespaceAll, fields.Everything()),
+			&api.Node{}, resyncPeriodOf("nodes"), framework.ResourceEventHandlerFuncs{})
+	}
 
-	lbc.epLister.Store, lbc.epController = framework.NewInformer(
-		cache.NewListWatchFromClient(
-			lbc.client, "endpoints", namespace, fields.Everything()),
-		&api.Endpoints{}, resyncPeriod, eventHandlers)
+	// Pods are only watched for their weight, the endpoints already
+	// reflect pods coming and going.
+	lbc.podStore, lbc.podController = framework.NewInformer(
+		namespacedListWatch(lbc.client, "pods", namespaces),
+		&api.Pod{}, resyncPeriodOf("pods"), framework.ResourceEventHandlerFuncs{
+			UpdateFunc: func(old, cur interface{}) {
+				if getPodWeight(old.(*api.Pod)) != getPodWeight(cur.(*api.Pod)) {
+					enqueue(cur)
+				}
+			},
+		})
 
 	return &lbc
 }
@@ -602,49 +1831,57 @@ func newLoadBalancerController(cfg *loadBalancerConfig, kubeClient *unversioned.
 func parseCfg(configPath string, defLbAlgorithm string, sslCert string, sslCaCert string) *loadBalancerConfig {
 	jsonBlob, err := ioutil.ReadFile(configPath)
 	if err != nil {
-		glog.Fatalf("Could not parse lb config: %v", err)
+		logFatalf("Could not parse lb config: %v", err)
 	}
 	var cfg loadBalancerConfig
 	err = json.Unmarshal(jsonBlob, &cfg)
 	if err != nil {
-		glog.Fatalf("Unable to unmarshal json blob: %v", string(jsonBlob))
+		logFatalf("Unable to unmarshal json blob: %v", string(jsonBlob))
 	}
 	cfg.sslCert = sslCert
 	cfg.sslCaCert = sslCaCert
 	cfg.lbDefAlgorithm = defLbAlgorithm
-	glog.Infof("Creating new loadbalancer: %+v", cfg)
+	logInfof("Creating new loadbalancer: %+v", cfg)
 	return &cfg
 }
 
-// registerHandlers  services liveness probes.
-func registerHandlers(s *staticPageHandler) {
-	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		// Delegate a check to the haproxy stats service.
-		response, err := http.Get(fmt.Sprintf("http://localhost:%v", *statsPort))
-		if err != nil {
-			glog.Infof("Error %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-		} else {
-			defer response.Body.Close()
-			if response.StatusCode != http.StatusOK {
-				contents, err := ioutil.ReadAll(response.Body)
-				if err != nil {
-					glog.Infof("Error reading resonse on receiving status %v: %v",
-						response.StatusCode, err)
-				}
-				glog.Infof("%v\n", string(contents))
-				w.WriteHeader(response.StatusCode)
-			} else {
-				w.WriteHeader(200)
-				w.Write([]byte("ok"))
+// healthzHandler serves liveness probes, delegating a check to the haproxy
+// stats service.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	response, err := http.Get(fmt.Sprintf("http://localhost:%v", *statsPort))
+	if err != nil {
+		logInfof("Error %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	} else {
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			contents, err := ioutil.ReadAll(response.Body)
+			if err != nil {
+				logInfof("Error reading resonse on receiving status %v: %v",
+					response.StatusCode, err)
 			}
+			logInfof("%v\n", string(contents))
+			w.WriteHeader(response.StatusCode)
+		} else {
+			w.WriteHeader(200)
+			w.Write([]byte("ok"))
 		}
-	})
+	}
+}
+
+// registerHandlers  services liveness probes and metrics, unless metrics
+// are served by the admin server.
+func registerHandlers(s *staticPageHandler, metrics bool) {
+	http.HandleFunc("/healthz", healthzHandler)
+
+	if metrics {
+		http.Handle("/metrics", prometheus.Handler())
+	}
 
 	// handler for not matched traffic
 	http.HandleFunc("/", s.Getfunc)
 
-	glog.Fatal(http.ListenAndServe(fmt.Sprintf(":%v", lbApiPort), nil))
+	logFatalf("%v", http.ListenAndServe(fmt.Sprintf(":%v", lbApiPort), nil))
 }
 
 func parseTCPServices(tcpServices string) map[string]int {
@@ -652,14 +1889,14 @@ func parseTCPServices(tcpServices string) map[string]int {
 	for _, service := range strings.Split(tcpServices, ",") {
 		portSplit := strings.Split(service, ":")
 		if len(portSplit) != 2 {
-			glog.Errorf("Ignoring misconfigured TCP service %v", service)
+			logErrorf("Ignoring misconfigured TCP service %v", service)
 			continue
 		}
 		if port, err := strconv.Atoi(portSplit[1]); err != nil {
-			glog.Errorf("Ignoring misconfigured TCP service %v: %v", service, err)
+			logErrorf("Ignoring misconfigured TCP service %v: %v", service, err)
 			continue
 		} else {
-			glog.Infof("Adding TCP service %v", service)
+			logInfof("Adding TCP service %v", service)
 			tcpSvcs[portSplit[0]] = port
 		}
 	}
@@ -667,73 +1904,364 @@ func parseTCPServices(tcpServices string) map[string]int {
 	return tcpSvcs
 }
 
+// dryRun renders and validates the config once without applying it, and
+// exits with an error if it is invalid.
 func dryRun(lbc *loadBalancerController) {
-	var err error
-	for err = lbc.sync(true); err == errDeferredSync; err = lbc.sync(true) {
+	err := lbc.sync(true, nil)
+	for attempt := 0; err == errDeferredSync; attempt++ {
+		time.Sleep(deferredSyncBackoff.Delay(attempt))
+		err = lbc.sync(true, nil)
 	}
 	if err != nil {
-		glog.Infof("ERROR: %+v", err)
+		logFatalf("ERROR: %+v", err)
 	}
+	if lbc.cfg.ValidateCmd == "" {
+		logInfof("Config rendered, it is not validated without a validateCmd in %v", *config)
+		return
+	}
+	logInfof("Config rendered and validated")
 }
 
 func main() {
 	clientConfig := kubectl_util.DefaultClientConfig(flags)
 	flags.Parse(os.Args)
+	switch *logFormat {
+	case "json":
+		if err := logToJSON(); err != nil {
+			logFatalf("Unable to log as json: %v", err)
+		}
+	case "text":
+	default:
+		logFatalf("Invalid log format %q, expected text or json", *logFormat)
+	}
+	if *settingsFile != "" {
+		data, err := ioutil.ReadFile(*settingsFile)
+		if err != nil {
+			logFatalf("Unable to read the settings: %v", err)
+		}
+		settings, err := parseSettings(data)
+		if err == nil {
+			_, err = applySettings(settings)
+		}
+		if err != nil {
+			logFatalf("Invalid settings in %v: %v", *settingsFile, err)
+		}
+	}
 	cfg := parseCfg(*config, *lbDefAlgorithm, *sslCert, *sslCaCert)
+	cfg.sslCrtList = filepath.Join(*sslCertDir, "crt-list")
+	cfg.customTemplate = *customTemplate
+	cfg.acceptProxy = *acceptProxy
+	if _, ok := ipFamilies[*ipFamily]; !ok {
+		logFatalf("Invalid ip family %q, expected ipv4, ipv6 or dual", *ipFamily)
+	}
+	cfg.ipFamily = *ipFamily
+	cfg.sslRedirectExclude = parsePaths(*sslRedirectExclude)
+	cfg.reloadRetryTimeout = *reloadRetryTimeout
+	if *seamlessReload {
+		cfg.seamlessReload = *haproxySocketPath
+	}
+	if !redirectCodes[*sslRedirectCode] {
+		logFatalf("Invalid ssl redirect code %v, expected 301, 302, 303, 307 or 308", *sslRedirectCode)
+	}
 
 	var kubeClient *unversioned.Client
 	var err error
 
 	defErrorPage := newStaticPageHandler(*errorPage, defaultErrorPage, *defaultReturnCode)
 	if defErrorPage == nil {
-		glog.Fatalf("Failed to load the default error page")
+		logFatalf("Failed to load the default error page")
 	}
 
-	go registerHandlers(defErrorPage)
+	go registerHandlers(defErrorPage, *adminAddress == "")
 
 	var tcpSvcs map[string]int
 	if *tcpServices != "" {
 		tcpSvcs = parseTCPServices(*tcpServices)
 	} else {
-		glog.Infof("No tcp/https services specified")
+		logInfof("No tcp/https services specified")
 	}
 
-	if *startSyslog {
-		cfg.startSyslog = true
-		_, err = newSyslogServer("/var/run/haproxy.log.socket")
+	cfg.accessLog = *accessLog
+	cfg.accessLogTarget = *accessLogTarget
+	cfg.accessLogFormat = *accessLogFormat
+	if *requestID {
+		if *proxy != "haproxy" {
+			logFatalf("Request ids are only supported by haproxy, --request-id can't be used with %v", *proxy)
+		}
+		cfg.requestIDFormat = *requestIDFormat
+		cfg.accessLogFormat = requestIDLogFormat(cfg.accessLogFormat)
+	}
+	if *startSyslog || (*accessLog && *accessLogTarget == "") {
+		cfg.startSyslog = *startSyslog
+		_, err = newSyslogServer(syslogSocket)
 		if err != nil {
-			glog.Fatalf("Failed to start syslog server: %v", err)
+			logFatalf("Failed to start syslog server: %v", err)
+		}
+		if *accessLogTarget == "" {
+			cfg.accessLogTarget = syslogSocket
+		}
+	}
+	if *externalNameResolvers != "" {
+		cfg.nameservers, err = parseNameservers(*externalNameResolvers)
+	} else {
+		cfg.nameservers, err = readNameservers(resolvConf)
+	}
+	if err != nil {
+		logFatalf("Unable to find the nameservers of ExternalName services: %v", err)
+	}
+	cfg.logTarget, cfg.logFacility, cfg.logLevel = *logTarget, *logFacility, *logLevel
+	if cfg.logTarget == "" && *startSyslog {
+		cfg.logTarget = syslogSocket
+	}
+	if cfg.logTarget != "" {
+		if err := validateLog(cfg.logTarget, cfg.logFacility, cfg.logLevel); err != nil {
+			logFatalf("Invalid haproxy log settings: %v", err)
 		}
 	}
 
-	if *cluster {
-		if kubeClient, err = unversioned.NewInCluster(); err != nil {
-			glog.Fatalf("Failed to create client: %v", err)
+	namespace := api.NamespaceAll
+	if *fromFile == "" {
+		var clientCfg *unversioned.Config
+		if *cluster {
+			if clientCfg, err = unversioned.InClusterConfig(); err != nil {
+				logFatalf("Failed to create client: %v", err)
+			}
+		} else {
+			if clientCfg, err = clientConfig.ClientConfig(); err != nil {
+				logFatalf("error connecting to the client: %v", err)
+			}
 		}
-	} else {
-		config, err := clientConfig.ClientConfig()
+		if *apiQPS <= 0 || *apiBurst <= 0 {
+			logFatalf("--api-qps and --api-burst must be positive")
+		}
+		clientCfg.QPS, clientCfg.Burst = *apiQPS, *apiBurst
+		if kubeClient, err = unversioned.New(clientCfg); err != nil {
+			logFatalf("Failed to create client: %v", err)
+		}
+		ns, specified, err := clientConfig.Namespace()
 		if err != nil {
-			glog.Fatalf("error connecting to the client: %v", err)
+			logFatalf("unexpected error: %v", err)
+		}
+		if specified {
+			namespace = ns
 		}
-		kubeClient, err = unversioned.New(config)
+	} else if (flags.Changed("leader-elect") && *leaderElect) || *acmeDirectory != "" || *vipPeerSelector != "" || *topologyAware || len(*remoteClusters) > 0 || *adminOverrides != "" {
+		logFatalf("--from-file runs without a cluster, it can't be used with --leader-elect, --acme-directory, --vip-peer-selector, --topology-aware, --remote-clusters or --admin-overrides")
 	}
-	namespace, specified, err := clientConfig.Namespace()
-	if err != nil {
-		glog.Fatalf("unexpected error: %v", err)
+	if resyncPeriods, err = parseResyncPeriods(*resyncPeriodsByResource); err != nil {
+		logFatalf("%v", err)
 	}
-	if !specified {
-		namespace = api.NamespaceAll
+	if *apiWriteQPS > 0 {
+		if *apiWriteBurst <= 0 {
+			logFatalf("--api-write-burst must be positive")
+		}
+		apiWrites = util.NewTokenBucketRateLimiter(*apiWriteQPS, *apiWriteBurst)
 	}
 
-	// TODO: Handle multiple namespaces
-	lbc := newLoadBalancerController(cfg, kubeClient, namespace, tcpSvcs)
+	var vrrp *keepalived
+	var announcer *bgpAnnouncer
+	if *vip != "" {
+		cidr, addr, err := parseVIP(*vip)
+		if err != nil {
+			logFatalf("%v", err)
+		}
+		peers, err := parsePeers(*vipPeers)
+		if err != nil {
+			logFatalf("%v", err)
+		}
+		if *publishAddress == "" {
+			*publishAddress = addr
+		}
+		vrrp = &keepalived{
+			vip:         cidr,
+			iface:       *vipInterface,
+			routerID:    *vipRouterID,
+			priority:    *vipPriority,
+			peers:       peers,
+			checkScript: *vipCheckScript,
+			config:      "/etc/keepalived/keepalived.conf",
+			staticPeers: peers,
+		}
+		if *vipBGPCommand != "" {
+			announcer = newBGPAnnouncer(*vipBGPCommand, *vipInterface, addr)
+		}
+	}
+
+	filter, err := newServiceFilter(*watchNamespaces, *serviceSelector, *lbClassName)
+	if err != nil {
+		logFatalf("Invalid service selector %q: %v", *serviceSelector, err)
+	}
+	lbc := newLoadBalancerController(cfg, kubeClient, filter.watchNamespaces(namespace), tcpSvcs)
+	lbc.filter = filter
 
-	go lbc.epController.Run(wait.NeverStop)
-	go lbc.svcController.Run(wait.NeverStop)
+	if *fromFile != "" {
+		if err := lbc.loadFixture(*fromFile); err != nil {
+			logFatalf("%v", err)
+		}
+		lbc.queue.Add(fixtureQueueKey)
+		if !*dry {
+			lbc.watchFixture(*fromFile, fixturePollInterval, wait.NeverStop)
+		}
+	} else {
+		if lbc.slices != nil {
+			go lbc.slices.run(wait.NeverStop)
+		} else {
+			go lbc.epController.Run(wait.NeverStop)
+		}
+		go lbc.svcController.Run(wait.NeverStop)
+		go lbc.secretController.Run(wait.NeverStop)
+		go lbc.podController.Run(wait.NeverStop)
+		if lbc.nodeController != nil {
+			go lbc.nodeController.Run(wait.NeverStop)
+		}
+		if lbc.configMapController != nil {
+			go lbc.configMapController.Run(wait.NeverStop)
+		}
+		if lbc.clusters != nil {
+			lbc.clusters.run(wait.NeverStop)
+		}
+	}
+	http.Handle("/readyz", lbc.ready)
+	var token string
+	if *adminTokenFile != "" {
+		data, err := ioutil.ReadFile(*adminTokenFile)
+		if err != nil {
+			logFatalf("Unable to read the admin token: %v", err)
+		}
+		token = strings.TrimSpace(string(data))
+		if token == "" {
+			logFatalf("The admin token file %v is empty", *adminTokenFile)
+		}
+	}
+	if *adminAddress != "" {
+		admin := newAdminServer(token)
+		admin.Handle("healthz", "/healthz", http.HandlerFunc(healthzHandler))
+		admin.Handle("readyz", "/readyz", lbc.ready)
+		admin.Handle("metrics", "/metrics", prometheus.Handler())
+		if admin.Handle("stats", "/stats", statsHandler(lbc.backend)) {
+			if h, ok := lbc.backend.(*haproxyBackend); ok {
+				admin.Handle("stats", "/stats.json", haproxyStatsHandler(h.socket))
+			}
+		}
+		// The admin server authenticates the clients of the config and
+		// backends, which are served without a token of their own.
+		admin.Handle("config", configPath+"/", &configHandler{running: cfg.Config, pending: lbc.pendingConfig})
+		if lbc.slots != nil {
+			admin.Handle("backends", adminPath, lbc.newAdminHandler("", kubeClient))
+		} else {
+			logInfof("Not serving %v, draining servers through the runtime api requires --server-slots", adminPath)
+		}
+		admin.HandlePprof()
+		logInfof("Serving %v on %v", strings.Join(admin.Routes(), ","), *adminAddress)
+		go func() {
+			logFatalf("%v", admin.ListenAndServe(*adminAddress, *adminTLSCert, *adminTLSKey))
+		}()
+	} else {
+		http.HandleFunc("/stats", statsHandler(lbc.backend))
+		if h, ok := lbc.backend.(*haproxyBackend); ok {
+			http.HandleFunc("/stats.json", haproxyStatsHandler(h.socket))
+		}
+		if token != "" {
+			http.Handle(configPath+"/", &configHandler{token: token, running: cfg.Config, pending: lbc.pendingConfig})
+			if lbc.slots != nil {
+				admin := lbc.newAdminHandler(token, kubeClient)
+				http.Handle(adminPath, admin)
+				http.Handle(adminPath+"/", admin)
+			} else {
+				logInfof("Not serving %v, draining servers through the runtime api requires --server-slots", adminPath)
+			}
+		}
+	}
+	if *acmeDirectory != "" {
+		if *acmeAccountSecret == "" {
+			logFatalf("--acme-directory requires --acme-account-secret")
+		}
+		if _, ok := lbc.backend.(*haproxyBackend); !ok {
+			logFatalf("Acme challenges are only routed to the controller by haproxy")
+		}
+		if _, _, err := splitKey(*acmeAccountSecret); err != nil {
+			logFatalf("%v", err)
+		}
+		lbc.acme = newACMEManager(*acmeDirectory, *acmeEmail, *acmeAccountSecret, kubeClient)
+		lbc.acme.responder.shared = func(token string) (string, bool) {
+			return lbc.sharedACMEChallenge(*acmeAccountSecret, token)
+		}
+		cfg.acmeChallenges = true
+		http.Handle(acmeChallengePath, lbc.acme.responder)
+	}
+	if lbc.tracer, err = newTracerFromEnv(os.Getenv); err != nil {
+		logFatalf("Invalid tracing settings: %v", err)
+	} else if lbc.tracer != nil {
+		logInfof("Exporting the traces of syncs to %v", lbc.tracer.endpoint)
+	}
+	if cfg.customTemplate != "" {
+		watchTemplate(cfg.customTemplate, *templatePollInterval, func() {
+			lbc.queue.Add(cfg.customTemplate)
+		}, wait.NeverStop)
+	}
 	if *dry {
 		dryRun(lbc)
 	} else {
+		// Fixtures have no cluster to elect a leader in, the only replica
+		// leads.
+		if *leaderElect && *fromFile == "" {
+			identity, err := os.Hostname()
+			if err != nil {
+				logFatalf("Unable to get the hostname for leader election: %v", err)
+			}
+			lbc.elector = newLeaderElector(kubeClient.Endpoints(*leaderElectNamespace),
+				*leaderElectName, identity, *leaderElectLeaseDuration)
+			go lbc.elector.run(func(bool) {
+				lbc.queue.Add(leaderQueueKey)
+			}, wait.NeverStop)
+		} else {
+			isLeader.Set(1)
+		}
 		lbc.cfg.reload()
+		lbc.shutdownOnSignal(*shutdownGracePeriod)
+		if *settingsFile != "" {
+			lbc.watchSettings(*settingsFile, *settingsPollInterval, wait.NeverStop)
+		}
+		if vrrp != nil {
+			var listPeers func() ([]string, error)
+			if *vipPeerSelector != "" {
+				sel, err := labels.Parse(*vipPeerSelector)
+				if err != nil {
+					logFatalf("Invalid vrrp peer selector %q: %v", *vipPeerSelector, err)
+				}
+				listPeers = func() ([]string, error) {
+					pods, err := kubeClient.Pods(os.Getenv("POD_NAMESPACE")).List(api.ListOptions{LabelSelector: sel})
+					if err != nil {
+						return nil, err
+					}
+					return podPeers(pods.Items, os.Getenv("POD_IP")), nil
+				}
+				if discovered, err := listPeers(); err != nil {
+					logWarningf("Unable to list the vrrp peers: %v", err)
+				} else {
+					vrrp.setPeers(discovered)
+				}
+			}
+			if err := vrrp.writeConfig(*keepalivedTemplate); err != nil {
+				logFatalf("Unable to write the keepalived config: %v", err)
+			}
+			go vrrp.run()
+			if listPeers != nil {
+				go vrrp.watchPeers(listPeers, *keepalivedTemplate, wait.NeverStop)
+			}
+		}
+		if announcer != nil {
+			go announcer.run(wait.NeverStop)
+		}
+		if lbc.outliers != nil {
+			go lbc.outliers.run(*outlierCheckInterval, wait.NeverStop)
+		}
+		if lbc.acme != nil {
+			go lbc.runACME(*acmeCheckInterval, wait.NeverStop)
+		}
+		if lbc.tracer != nil {
+			go lbc.tracer.run()
+		}
 		wait.Until(lbc.worker, time.Second, wait.NeverStop)
 	}
 
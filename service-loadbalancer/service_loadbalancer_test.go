@@ -22,6 +22,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"k8s.io/kubernetes/pkg/api"
@@ -86,6 +87,7 @@ func newFakeLoadBalancerController(endpoints []*api.Endpoints, services []*api.S
 	flb := loadBalancerController{}
 	flb.epLister.Store = storeEps(endpoints)
 	flb.svcLister.Store = storeServices(services)
+	flb.podStore = cache.NewStore(cache.MetaNamespaceKeyFunc)
 	flb.httpPort = 80
 	return &flb
 }
@@ -270,6 +272,7 @@ func buildTestLoadBalancer(lbDefAlgorithm string) *loadBalancerController {
 	flb.cfg = parseCfg(cfg, lbDefAlgorithm, "", "")
 	cfgFile, _ := filepath.Abs("test-" + string(util.NewUUID()))
 	flb.cfg.Config = cfgFile
+	flb.backend = &haproxyBackend{loadBalancerConfig: flb.cfg}
 	flb.tcpServices = map[string]int{
 		svc1.Name: 20,
 	}
@@ -277,6 +280,15 @@ func buildTestLoadBalancer(lbDefAlgorithm string) *loadBalancerController {
 	return flb
 }
 
+// writeConfig renders services with the backend of flb into its config file.
+func writeConfig(flb *loadBalancerController, services map[string][]service) error {
+	config, err := flb.backend.render(services)
+	if err != nil {
+		return err
+	}
+	return flb.backend.apply(config, false)
+}
+
 // compareCfgFiles check that two files are equals
 func compareCfgFiles(t *testing.T, orig, template string) {
 	f1, err := ioutil.ReadFile(orig)
@@ -296,11 +308,11 @@ func compareCfgFiles(t *testing.T, orig, template string) {
 func TestDefaultAlgorithm(t *testing.T) {
 	flb := buildTestLoadBalancer("")
 	httpSvc, _, tcpSvc := flb.getServices()
-	if err := flb.cfg.write(
+	if err := writeConfig(flb,
 		map[string][]service{
 			"http": httpSvc,
 			"tcp":  tcpSvc,
-		}, false); err != nil {
+		}); err != nil {
 		t.Fatalf("Expected a valid HAProxy cfg, but an error was returned: %v", err)
 	}
 	template, _ := filepath.Abs("./test-samples/TestDefaultAlgorithm.cfg")
@@ -311,11 +323,11 @@ func TestDefaultAlgorithm(t *testing.T) {
 func TestDefaultCustomAlgorithm(t *testing.T) {
 	flb := buildTestLoadBalancer("leastconn")
 	httpSvc, _, tcpSvc := flb.getServices()
-	if err := flb.cfg.write(
+	if err := writeConfig(flb,
 		map[string][]service{
 			"http": httpSvc,
 			"tcp":  tcpSvc,
-		}, false); err != nil {
+		}); err != nil {
 		t.Fatalf("Expected at least one tcp or http service: %v", err)
 	}
 	template, _ := filepath.Abs("./test-samples/TestDefaultCustomAlgorithm.cfg")
@@ -327,11 +339,11 @@ func TestSyslog(t *testing.T) {
 	flb := buildTestLoadBalancer("")
 	httpSvc, _, tcpSvc := flb.getServices()
 	flb.cfg.startSyslog = true
-	if err := flb.cfg.write(
+	if err := writeConfig(flb,
 		map[string][]service{
 			"http": httpSvc,
 			"tcp":  tcpSvc,
-		}, false); err != nil {
+		}); err != nil {
 		t.Fatalf("Expected at least one tcp or http service: %v", err)
 	}
 	template, _ := filepath.Abs("./test-samples/TestSyslog.cfg")
@@ -343,11 +355,11 @@ func TestSvcCustomAlgorithm(t *testing.T) {
 	flb := buildTestLoadBalancer("")
 	httpSvc, _, tcpSvc := flb.getServices()
 	httpSvc[0].Algorithm = "leastconn"
-	if err := flb.cfg.write(
+	if err := writeConfig(flb,
 		map[string][]service{
 			"http": httpSvc,
 			"tcp":  tcpSvc,
-		}, false); err != nil {
+		}); err != nil {
 		t.Fatalf("Expected at least one tcp or http service: %v", err)
 	}
 	template, _ := filepath.Abs("./test-samples/TestSvcCustomAlgorithm.cfg")
@@ -359,11 +371,11 @@ func TestCustomDefaultAndSvcAlgorithm(t *testing.T) {
 	flb := buildTestLoadBalancer("leastconn")
 	httpSvc, _, tcpSvc := flb.getServices()
 	httpSvc[0].Algorithm = "roundrobin"
-	if err := flb.cfg.write(
+	if err := writeConfig(flb,
 		map[string][]service{
 			"http": httpSvc,
 			"tcp":  tcpSvc,
-		}, false); err != nil {
+		}); err != nil {
 		t.Fatalf("Expected at least one tcp or http service: %v", err)
 	}
 	template, _ := filepath.Abs("./test-samples/TestCustomDefaultAndSvcAlgorithm.cfg")
@@ -375,11 +387,11 @@ func TestServiceAffinity(t *testing.T) {
 	flb := buildTestLoadBalancer("")
 	httpSvc, _, tcpSvc := flb.getServices()
 	httpSvc[0].SessionAffinity = true
-	if err := flb.cfg.write(
+	if err := writeConfig(flb,
 		map[string][]service{
 			"http": httpSvc,
 			"tcp":  tcpSvc,
-		}, false); err != nil {
+		}); err != nil {
 		t.Fatalf("Expected at least one tcp or http service: %v", err)
 	}
 	template, _ := filepath.Abs("./test-samples/TestServiceAffinity.cfg")
@@ -392,14 +404,87 @@ func TestServiceAffinityWithCookies(t *testing.T) {
 	httpSvc, _, tcpSvc := flb.getServices()
 	httpSvc[0].SessionAffinity = true
 	httpSvc[0].CookieStickySession = true
-	if err := flb.cfg.write(
+	if err := writeConfig(flb,
 		map[string][]service{
 			"http": httpSvc,
 			"tcp":  tcpSvc,
-		}, false); err != nil {
+		}); err != nil {
 		t.Fatalf("Expected at least one tcp or http service: %v", err)
 	}
 	template, _ := filepath.Abs("./test-samples/TestServiceAffinityWithCookies.cfg")
 	compareCfgFiles(t, flb.cfg.Config, template)
 	os.Remove(flb.cfg.Config)
 }
+
+func TestProxyProtocol(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	flb.tcpServices = map[string]int{"svc-1": 443}
+	httpSvc, _, tcpSvc := flb.getServices()
+	httpSvc[0].SendProxy = "send-proxy-v2"
+	tcpSvc[0].SendProxy = "send-proxy"
+	tcpSvc[0].AcceptProxy = true
+	if err := writeConfig(flb,
+		map[string][]service{
+			"http": httpSvc,
+			"tcp":  tcpSvc,
+		}); err != nil {
+		t.Fatalf("Expected at least one tcp or http service: %v", err)
+	}
+	template, _ := filepath.Abs("./test-samples/TestProxyProtocol.cfg")
+	compareCfgFiles(t, flb.cfg.Config, template)
+	os.Remove(flb.cfg.Config)
+}
+
+func TestCookieAffinity(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	obj, _, _ := flb.svcLister.Store.GetByKey("default/svc-2")
+	obj.(*api.Service).ObjectMeta.Annotations = map[string]string{
+		lbAffinity:     "cookie",
+		lbCookieName:   "route",
+		lbCookieMaxAge: "1h",
+	}
+	httpSvc, _, tcpSvc := flb.getServices()
+	for _, svc := range httpSvc {
+		if svc.Name == "svc-2:443" {
+			if !svc.SessionAffinity || !svc.CookieStickySession {
+				t.Fatalf("Expected cookie affinity for %v", svc.Name)
+			}
+			if svc.CookieName != "route" || svc.CookieMaxAge != "3600s" {
+				t.Fatalf("Unexpected cookie %v with max age %v", svc.CookieName, svc.CookieMaxAge)
+			}
+		}
+	}
+	if err := writeConfig(flb,
+		map[string][]service{
+			"http": httpSvc,
+			"tcp":  tcpSvc,
+		}); err != nil {
+		t.Fatalf("Expected at least one tcp or http service: %v", err)
+	}
+	template, _ := filepath.Abs("./test-samples/TestCookieAffinity.cfg")
+	compareCfgFiles(t, flb.cfg.Config, template)
+	os.Remove(flb.cfg.Config)
+}
+
+func TestSourceAffinity(t *testing.T) {
+	flb := buildTestLoadBalancer("")
+	flb.tcpServices = map[string]int{"svc-1": 443}
+	obj, _, _ := flb.svcLister.Store.GetByKey("default/svc-1")
+	obj.(*api.Service).ObjectMeta.Annotations = map[string]string{lbAffinity: "source"}
+	httpSvc, _, tcpSvc := flb.getServices()
+	if len(tcpSvc) != 1 || tcpSvc[0].Algorithm != "source" || !tcpSvc[0].ConsistentHash {
+		t.Fatalf("Expected a consistent hash of the source of the tcp service, got %+v", tcpSvc)
+	}
+	for _, svc := range httpSvc {
+		if svc.ConsistentHash != (svc.Name == "svc-1") {
+			t.Fatalf("Expected only svc-1 to hash the source, got %+v", svc)
+		}
+	}
+	config, err := flb.backend.render(map[string][]service{"http": httpSvc, "tcp": tcpSvc})
+	if err != nil {
+		t.Fatalf("Unexpected error rendering the config: %v", err)
+	}
+	if strings.Count(string(config), "balance source\n    hash-type consistent\n") != 2 {
+		t.Fatalf("Expected a consistent source hash in both backends of svc-1:\n%s", config)
+	}
+}